@@ -194,7 +194,8 @@ func (srv *Server) Lookup(domain string) (netip.Addr, Source) {
 	if cut {
 		friend, ok := srv.instance.Config().FriendsByName[friendName]
 		if ok {
-			return friend.IP, SourceFriend
+			// Follow identity handovers of the friend.
+			return srv.instance.State().Successor(friend.IP), SourceFriend
 		}
 	}
 
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+func init() {
+	configCmd.AddCommand(anycastGroupCmd)
+	configCmd.AddCommand(anycastMemberCmd)
+	anycastMemberCmd.Flags().IntVar(&anycastMemberDays, "days", 365, "days until the membership expires")
+}
+
+var (
+	anycastGroupCmd = &cobra.Command{
+		Use:  "anycast-group",
+		Long: "Generate a new anycast group address and key. Keep the output secret, as it allows anyone to add members to the group.",
+		Args: cobra.NoArgs,
+		RunE: anycastGroup,
+	}
+
+	anycastMemberCmd = &cobra.Command{
+		Use:  "anycast-member [group key file] [router IP]",
+		Long: "Sign an anycast group membership for a router with the group key generated by anycast-group. Add the output to router.anycast in the config of the router.",
+		Args: cobra.ExactArgs(2),
+		RunE: anycastMember,
+	}
+
+	anycastMemberDays int
+)
+
+func anycastGroup(cmd *cobra.Command, args []string) error {
+	// Generate address.
+	addr, _, err := m.GenerateRoutableAddress(cmd.Context(), []netip.Prefix{m.AnycastPrefix})
+	if err != nil {
+		return fmt.Errorf("failed to generate address: %w", err)
+	}
+
+	// Output group key.
+	data, err := yaml.Marshal(addr.Store())
+	if err != nil {
+		return fmt.Errorf("failed to marshal group key: %w", err)
+	}
+	fmt.Println(string(data)) // CLI output.
+	return nil
+}
+
+func anycastMember(cmd *cobra.Command, args []string) error {
+	// Load group key.
+	group, err := loadAddressFile(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to load group key: %w", err)
+	}
+
+	// Parse member.
+	member, err := netip.ParseAddr(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid router IP: %w", err)
+	}
+	if anycastMemberDays <= 0 {
+		return errors.New("days must be greater than zero")
+	}
+
+	// Sign and output membership.
+	am, err := m.NewAnycastMembership(group, member, time.Now().AddDate(0, 0, anycastMemberDays))
+	if err != nil {
+		return fmt.Errorf("failed to create membership: %w", err)
+	}
+	proof, err := am.Export()
+	if err != nil {
+		return fmt.Errorf("failed to export membership: %w", err)
+	}
+	fmt.Println(proof) // CLI output.
+	return nil
+}
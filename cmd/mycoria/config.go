@@ -1,6 +1,14 @@
 package main
 
-import "github.com/spf13/cobra"
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+
+	"github.com/mycoria/mycoria/m"
+)
 
 func init() {
 	rootCmd.AddCommand(configCmd)
@@ -9,3 +17,16 @@ func init() {
 var configCmd = &cobra.Command{
 	Use: "config",
 }
+
+// loadAddressFile loads an address with its private key from a yaml file.
+func loadAddressFile(path string) (*m.Address, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read file: %w", err)
+	}
+	var stored m.AddressStorage
+	if err := yaml.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("parse file: %w", err)
+	}
+	return m.AddressFromStorage(stored)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/m"
+)
+
+func init() {
+	configCmd.AddCommand(rotateIdentityCmd)
+	rotateIdentityCmd.Flags().IntVar(&rotateIdentityDays, "days", 90, "days the handover is announced to other routers")
+}
+
+var (
+	rotateIdentityCmd = &cobra.Command{
+		Use:  "rotate-identity",
+		Long: "Generate a new identity for the router configured with --config and output the updated config. The old identity signs a handover to the new address, which the router announces, so that other routers move friends and domain mappings to the new address. Replace the config with the output and restart the router.",
+		Args: cobra.NoArgs,
+		RunE: rotateIdentity,
+	}
+
+	rotateIdentityDays int
+)
+
+func rotateIdentity(cmd *cobra.Command, args []string) error {
+	if *configFile == "" {
+		return errors.New("config file must be set with --config")
+	}
+	if rotateIdentityDays <= 0 {
+		return errors.New("days must be greater than zero")
+	}
+
+	// Load config and current identity.
+	c, err := config.LoadConfig(*configFile)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	old, err := m.AddressFromStorage(c.Router.Address)
+	if err != nil {
+		return fmt.Errorf("failed to load current identity: %w", err)
+	}
+
+	// Generate new address in the same prefix.
+	prefix, err := rotateIdentityPrefix(old.IP)
+	if err != nil {
+		return err
+	}
+	addr, _, err := m.GenerateRoutableAddress(cmd.Context(), []netip.Prefix{prefix})
+	if err != nil {
+		return fmt.Errorf("failed to generate address: %w", err)
+	}
+
+	// Sign handover with old identity.
+	ih, err := m.NewIdentityHandover(old, addr.IP, time.Now().AddDate(0, 0, rotateIdentityDays))
+	if err != nil {
+		return fmt.Errorf("failed to create handover: %w", err)
+	}
+	handover, err := ih.Export()
+	if err != nil {
+		return fmt.Errorf("failed to export handover: %w", err)
+	}
+
+	// Update config.
+	store := c.Store
+	store.Router.Address = addr.Store()
+	store.Router.Handover = handover
+	if len(store.Router.Anycast) > 0 {
+		// Memberships are signed for the old address.
+		store.Router.Anycast = nil
+		fmt.Fprintln(os.Stderr, "Removed anycast memberships, sign new ones for the new address with anycast-member.")
+	}
+	fmt.Fprintf(os.Stderr, "Rotated identity from %s to %s.\n\n", old.IP, addr.IP)
+
+	// Output config in the format of the config file.
+	var data []byte
+	if strings.HasSuffix(*configFile, ".json") {
+		data, err = json.MarshalIndent(store, "", "  ")
+	} else {
+		data, err = yaml.Marshal(store)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+	fmt.Println(string(data)) // CLI output.
+	return nil
+}
+
+// rotateIdentityPrefix returns the prefix for the new address of a router
+// with the given address.
+func rotateIdentityPrefix(ip netip.Addr) (netip.Prefix, error) {
+	switch m.GetAddressType(ip) {
+	case m.TypeGeoMarked:
+		marker, err := m.LookupCountryMarker(ip)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("failed to find country of current address: %w", err)
+		}
+		return marker.Prefix, nil
+	case m.TypeRoaming:
+		return m.RoamingPrefix, nil
+	case m.TypeExperiment:
+		return m.ExperimentsPrefix, nil
+	case m.TypeOrganization:
+		return netip.Prefix{}, errors.New("organization addresses cannot be rotated, as the new address needs a new delegation by the organization root key")
+	default:
+		return netip.Prefix{}, fmt.Errorf("addresses of type %s cannot be rotated", m.GetAddressType(ip))
+	}
+}
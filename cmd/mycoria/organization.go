@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+func init() {
+	configCmd.AddCommand(orgRootCmd)
+	configCmd.AddCommand(orgMemberCmd)
+	orgMemberCmd.Flags().IntVar(&orgMemberDays, "days", 365, "days until the delegation expires")
+}
+
+var (
+	orgRootCmd = &cobra.Command{
+		Use:  "org-root",
+		Long: "Generate a new organization root address and key. The first 32 bits of the root address are the prefix of the organization. Keep the output secret, as it allows anyone to add routers to the organization.",
+		Args: cobra.NoArgs,
+		RunE: orgRoot,
+	}
+
+	orgMemberCmd = &cobra.Command{
+		Use:  "org-member [root key file] [router IP]",
+		Long: "Sign a delegation for a router address within the organization prefix with the root key generated by org-root. Add the output to router.organization in the config of the router.",
+		Args: cobra.ExactArgs(2),
+		RunE: orgMember,
+	}
+
+	orgMemberDays int
+)
+
+func orgRoot(cmd *cobra.Command, args []string) error {
+	// Generate address.
+	addr, _, err := m.GenerateRoutableAddress(cmd.Context(), []netip.Prefix{m.OrganizationPrefix})
+	if err != nil {
+		return fmt.Errorf("failed to generate address: %w", err)
+	}
+
+	// Output root key.
+	data, err := yaml.Marshal(addr.Store())
+	if err != nil {
+		return fmt.Errorf("failed to marshal root key: %w", err)
+	}
+	fmt.Printf("# Organization prefix: %s\n", m.OrganizationPrefixFor(addr.IP)) // CLI output.
+	fmt.Println(string(data))                                                   // CLI output.
+	return nil
+}
+
+func orgMember(cmd *cobra.Command, args []string) error {
+	// Load root key.
+	root, err := loadAddressFile(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to load root key: %w", err)
+	}
+
+	// Parse member.
+	member, err := netip.ParseAddr(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid router IP: %w", err)
+	}
+	if orgMemberDays <= 0 {
+		return errors.New("days must be greater than zero")
+	}
+
+	// Sign and output delegation.
+	od, err := m.NewOrgDelegation(root, member, time.Now().AddDate(0, 0, orgMemberDays))
+	if err != nil {
+		return fmt.Errorf("failed to create delegation: %w", err)
+	}
+	delegation, err := od.Export()
+	if err != nil {
+		return fmt.Errorf("failed to export delegation: %w", err)
+	}
+	fmt.Println(delegation) // CLI output.
+	return nil
+}
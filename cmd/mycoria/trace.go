@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/router"
+)
+
+func init() {
+	rootCmd.AddCommand(traceCmd)
+}
+
+var traceCmd = &cobra.Command{
+	Use:  "trace [router IP]",
+	Long: "Trace the path to a router via the API of the running router. Use --config to connect to a custom API listen address.",
+	Args: cobra.ExactArgs(1),
+	RunE: trace,
+}
+
+func trace(cmd *cobra.Command, args []string) error {
+	dst, err := netip.ParseAddr(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid router IP: %w", err)
+	}
+
+	// Get API address.
+	apiAddr := netip.AddrPortFrom(config.DefaultAPIAddress, 80)
+	if *configFile != "" {
+		c, err := config.LoadConfig(*configFile)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		if c.APIListen.IsValid() {
+			apiAddr = c.APIListen
+		}
+	}
+
+	// Request trace from router.
+	client := &http.Client{
+		Timeout: router.TraceTimeout + 10*time.Second,
+	}
+	resp, err := client.Get(fmt.Sprintf("http://%s/api/trace/%s", apiAddr, dst))
+	if err != nil {
+		return fmt.Errorf("failed to request trace: %w", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to trace: %s", strings.TrimSpace(string(msg)))
+	}
+	result := &router.TraceResult{}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to parse trace: %w", err)
+	}
+
+	// Print hops.
+	fmt.Printf("trace to %s\n", result.Dst) // CLI output.
+	for _, hop := range result.Hops {
+		if !hop.Answered() {
+			fmt.Printf("%2d  *\n", hop.Hop) // CLI output.
+			continue
+		}
+
+		reached := ""
+		if hop.Reached {
+			reached = "  [destination]"
+		}
+		fmt.Printf( // CLI output.
+			"%2d  %s  label=%d  link=%dms  rtt=%s%s\n",
+			hop.Hop, hop.Router, hop.Label, hop.Latency, hop.RTT.Round(100*time.Microsecond), reached,
+		)
+	}
+	if len(result.Hops) == 0 || !result.Hops[len(result.Hops)-1].Reached {
+		fmt.Println("destination not reached") // CLI output.
+	}
+
+	return nil
+}
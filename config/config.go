@@ -23,6 +23,23 @@ type Config struct {
 
 	APIListen netip.AddrPort
 
+	Proxy          *url.URL
+	ConnectProxies map[string]*url.URL
+
+	LinkRateLimitsByURL map[string]RateLimit
+	LinkRateLimitsByIP  map[netip.Addr]RateLimit
+
+	InboundAllowRouters []netip.Prefix
+	InboundDenyRouters  []netip.Prefix
+	InboundAllowSources []netip.Prefix
+	InboundDenySources  []netip.Prefix
+
+	StaticRoutes []StaticRoute
+
+	AnycastMemberships []*m.AnycastMembership
+	OrgDelegation      *m.OrgDelegation
+	IdentityHandover   *m.IdentityHandover
+
 	Friends       []Friend
 	FriendsByName map[string]Friend
 	FriendsByIP   map[netip.Addr]Friend
@@ -44,6 +61,14 @@ type Friend struct {
 	IP   netip.Addr
 }
 
+// StaticRoute pins traffic for a prefix to a peer or an explicit switch path.
+type StaticRoute struct {
+	Prefix netip.Prefix
+	Via    netip.Addr
+	// Path holds the hops starting with the peer. Empty for via routes.
+	Path []m.SwitchHop
+}
+
 // Service defines an endpoint other routers can send traffic to.
 type Service struct { //nolint:maligned
 	Name        string
@@ -117,13 +142,15 @@ func (s Store) parse(test bool) (*Config, error) { //nolint:maintidx // Function
 
 	// Check if there is any way to connect.
 	if !test {
-		if len(c.Router.Listen) == 0 && len(c.Router.Connect) == 0 && len(c.Router.Bootstrap) == 0 {
+		if len(c.Router.Listen) == 0 && len(c.Router.Connect) == 0 &&
+			len(c.Router.Bootstrap) == 0 && len(c.Router.Discover) == 0 {
 			return nil, errors.New(
 				`router has no way to connect or accept connections and will die forever alone
 Configure at least one of these settings:
 - router.listen
 - router.connect
-- router.bootstrap`)
+- router.bootstrap
+- router.discover`)
 		}
 	}
 
@@ -138,6 +165,142 @@ Configure at least one of these settings:
 			return nil, fmt.Errorf("router.connect.#%d is invalid: %w", i+1, err)
 		}
 	}
+
+	// Parse proxies.
+	if c.Router.Proxy != "" {
+		var err error
+		c.Proxy, err = parseProxyURL(c.Router.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("router.proxy is invalid: %w", err)
+		}
+	}
+	c.ConnectProxies = make(map[string]*url.URL, len(c.Router.ConnectProxies))
+	for peeringURL, proxyURL := range c.Router.ConnectProxies {
+		parsed, err := m.ParsePeeringURL(peeringURL)
+		if err != nil {
+			return nil, fmt.Errorf("router.connectProxies peering url %q is invalid: %w", peeringURL, err)
+		}
+
+		// Use nil for a direct connection.
+		var proxy *url.URL
+		if proxyURL != ProxyDirect {
+			proxy, err = parseProxyURL(proxyURL)
+			if err != nil {
+				return nil, fmt.Errorf("router.connectProxies proxy of %q is invalid: %w", peeringURL, err)
+			}
+		}
+		c.ConnectProxies[parsed.String()] = proxy
+	}
+
+	// Parse rate limits.
+	if c.Router.RateLimit.IsSet() || c.Router.RateLimit.Burst != 0 {
+		var err error
+		c.Router.RateLimit, err = checkRateLimit(c.Router.RateLimit)
+		if err != nil {
+			return nil, fmt.Errorf("router.rateLimit is invalid: %w", err)
+		}
+	}
+	c.LinkRateLimitsByURL = make(map[string]RateLimit)
+	c.LinkRateLimitsByIP = make(map[netip.Addr]RateLimit)
+	for key, rateLimit := range c.Router.LinkRateLimits {
+		rl, err := checkRateLimit(rateLimit)
+		if err != nil {
+			return nil, fmt.Errorf("router.linkRateLimits of %q is invalid: %w", key, err)
+		}
+
+		// Key may be a router IP or a peering URL.
+		if ip, err := netip.ParseAddr(key); err == nil {
+			c.LinkRateLimitsByIP[ip] = rl
+			continue
+		}
+		parsed, err := m.ParsePeeringURL(key)
+		if err != nil {
+			return nil, fmt.Errorf("router.linkRateLimits key %q is neither a router IP nor a peering url: %w", key, err)
+		}
+		c.LinkRateLimitsByURL[parsed.String()] = rl
+	}
+
+	// Parse inbound restrictions.
+	var err error
+	c.InboundAllowRouters, err = parsePrefixes(c.Router.Inbound.AllowRouters)
+	if err != nil {
+		return nil, fmt.Errorf("router.inbound.allowRouters is invalid: %w", err)
+	}
+	c.InboundDenyRouters, err = parsePrefixes(c.Router.Inbound.DenyRouters)
+	if err != nil {
+		return nil, fmt.Errorf("router.inbound.denyRouters is invalid: %w", err)
+	}
+	c.InboundAllowSources, err = parsePrefixes(c.Router.Inbound.AllowSources)
+	if err != nil {
+		return nil, fmt.Errorf("router.inbound.allowSources is invalid: %w", err)
+	}
+	c.InboundDenySources, err = parsePrefixes(c.Router.Inbound.DenySources)
+	if err != nil {
+		return nil, fmt.Errorf("router.inbound.denySources is invalid: %w", err)
+	}
+	if c.Router.Inbound.MaxPeers < 0 {
+		return nil, errors.New("router.inbound.maxPeers is invalid: must not be negative")
+	}
+
+	switch rd := c.Router.RouteDamping; {
+	case rd.Suppress < 0 || rd.Reuse < 0 || rd.HalfLife < 0:
+		return nil, errors.New("router.routeDamping is invalid: values must not be negative")
+	case rd.Suppress > 0 && rd.Reuse >= rd.Suppress:
+		return nil, errors.New("router.routeDamping is invalid: reuse must be lower than suppress")
+	case rd.Suppress == 0 && rd.Reuse >= m.DefaultRouteSuppressThreshold:
+		return nil, errors.New("router.routeDamping is invalid: reuse must be lower than the default suppress of 2000")
+	}
+
+	if pa := c.Router.PrivacyAddresses; pa.Rotate < 0 || pa.Keep < 0 {
+		return nil, errors.New("router.privacyAddresses is invalid: values must not be negative")
+	}
+
+	// Parse static routes.
+	c.StaticRoutes = make([]StaticRoute, 0, len(c.Router.Routes))
+	for i, routeConfig := range c.Router.Routes {
+		route, err := parseStaticRoute(routeConfig)
+		if err != nil {
+			return nil, fmt.Errorf("router.routes.#%d is invalid: %w", i+1, err)
+		}
+		c.StaticRoutes = append(c.StaticRoutes, route)
+	}
+
+	// Parse anycast memberships.
+	routerIP, _ := netip.ParseAddr(c.Router.Address.IP)
+	c.AnycastMemberships = make([]*m.AnycastMembership, 0, len(c.Router.Anycast))
+	for i, proof := range c.Router.Anycast {
+		am, err := m.ParseAnycastMembership(proof)
+		if err != nil {
+			return nil, fmt.Errorf("router.anycast.#%d is invalid: %w", i+1, err)
+		}
+		if routerIP.IsValid() && am.Member != routerIP {
+			return nil, fmt.Errorf("router.anycast.#%d is invalid: membership is for router %s", i+1, am.Member)
+		}
+		c.AnycastMemberships = append(c.AnycastMemberships, am)
+	}
+
+	// Parse organization delegation.
+	if c.Router.Organization != "" {
+		c.OrgDelegation, err = m.ParseOrgDelegation(c.Router.Organization)
+		if err != nil {
+			return nil, fmt.Errorf("router.organization is invalid: %w", err)
+		}
+		if routerIP.IsValid() && c.OrgDelegation.Member != routerIP {
+			return nil, fmt.Errorf("router.organization is invalid: delegation is for router %s", c.OrgDelegation.Member)
+		}
+	}
+
+	// Parse identity handover.
+	if c.Router.Handover != "" {
+		c.IdentityHandover, err = m.ParseIdentityHandover(c.Router.Handover)
+		if err != nil {
+			return nil, fmt.Errorf("router.handover is invalid: %w", err)
+		}
+		if routerIP.IsValid() && c.IdentityHandover.New != routerIP {
+			return nil, fmt.Errorf("router.handover is invalid: handover is to router %s", c.IdentityHandover.New)
+		}
+	}
+
 	for i, peeringURL := range c.Router.Bootstrap {
 		if _, err := m.ParsePeeringURL(peeringURL); err != nil {
 			return nil, fmt.Errorf("router.bootstrap.#%d is invalid: %w", i+1, err)
@@ -356,6 +519,167 @@ func (c *Config) CheckInboundTrafficPolicy(protocol uint8, dstPort uint16, src n
 	return ok
 }
 
+// ProxyDirect is used in router.connectProxies to connect without a proxy.
+const ProxyDirect = "direct"
+
+func parseProxyURL(proxyURL string) (*url.URL, error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "socks5", "socks5h", "http":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q, use socks5 or http", u.Scheme)
+	}
+	if u.Hostname() == "" || u.Port() == "" {
+		return nil, errors.New("proxy host and port required")
+	}
+
+	return u, nil
+}
+
+// ProxyFor returns the proxy to use for connecting to the given peering URL.
+// Returns nil if no proxy should be used.
+func (c *Config) ProxyFor(peeringURL *m.PeeringURL) *url.URL {
+	if proxy, ok := c.ConnectProxies[peeringURL.String()]; ok {
+		return proxy
+	}
+	return c.Proxy
+}
+
+// MinRateLimitBurst is the minimum burst of a rate limit.
+// It must be able to fit the biggest possible frame.
+const MinRateLimitBurst = 0xFFFF
+
+func checkRateLimit(rl RateLimit) (RateLimit, error) {
+	switch {
+	case rl.Rate <= 0:
+		return rl, errors.New("rate must be greater than zero")
+	case rl.Burst < 0:
+		return rl, errors.New("burst must not be negative")
+	}
+
+	// Default burst to rate and make sure it fits the biggest frame.
+	if rl.Burst == 0 {
+		rl.Burst = rl.Rate
+	}
+	if rl.Burst < MinRateLimitBurst {
+		rl.Burst = MinRateLimitBurst
+	}
+
+	return rl, nil
+}
+
+// LinkRateLimit returns the rate limit for the link with the given peering
+// URL and peer. The peering URL may be nil for incoming links.
+func (c *Config) LinkRateLimit(peeringURL *m.PeeringURL, peer netip.Addr) (rl RateLimit, ok bool) {
+	if rl, ok := c.LinkRateLimitsByIP[peer]; ok {
+		return rl, true
+	}
+	if peeringURL != nil {
+		rl, ok = c.LinkRateLimitsByURL[peeringURL.String()]
+	}
+	return rl, ok
+}
+
+// parsePrefixes parses the given IPs and prefixes.
+// IPs are converted to single IP prefixes.
+func parsePrefixes(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for i, entry := range entries {
+		if ip, err := netip.ParseAddr(entry); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(ip, ip.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("#%d is neither an IP nor a prefix: %w", i+1, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func parseStaticRoute(rc RouteConfig) (StaticRoute, error) {
+	// Parse prefix.
+	prefixes, err := parsePrefixes([]string{rc.Prefix})
+	if err != nil {
+		return StaticRoute{}, fmt.Errorf("prefix: %w", err)
+	}
+	route := StaticRoute{Prefix: prefixes[0]}
+
+	// Parse via peer.
+	switch {
+	case rc.Via != "" && len(rc.Path) > 0:
+		return StaticRoute{}, errors.New("via and path are mutually exclusive")
+	case rc.Via != "":
+		route.Via, err = netip.ParseAddr(rc.Via)
+		if err != nil {
+			return StaticRoute{}, fmt.Errorf("via: %w", err)
+		}
+		return route, nil
+	case len(rc.Path) == 0:
+		return StaticRoute{}, errors.New("either via or path must be set")
+	}
+
+	// Parse switch path.
+	route.Path = make([]m.SwitchHop, 0, len(rc.Path))
+	for i, hopConfig := range rc.Path {
+		ip, err := netip.ParseAddr(hopConfig.Router)
+		if err != nil {
+			return StaticRoute{}, fmt.Errorf("path hop #%d: %w", i+1, err)
+		}
+		isLast := i == len(rc.Path)-1
+		switch {
+		case isLast && hopConfig.ForwardLabel != 0:
+			return StaticRoute{}, fmt.Errorf("path hop #%d: last hop must not have a forward label", i+1)
+		case !isLast && hopConfig.ForwardLabel == 0:
+			return StaticRoute{}, fmt.Errorf("path hop #%d: forward label is missing", i+1)
+		}
+		route.Path = append(route.Path, m.SwitchHop{
+			Router:       ip,
+			ForwardLabel: m.SwitchLabel(hopConfig.ForwardLabel),
+			ReturnLabel:  m.SwitchLabel(hopConfig.ReturnLabel),
+		})
+	}
+	route.Via = route.Path[0].Router
+
+	return route, nil
+}
+
+// CheckInbound checks whether the given router may peer with this router
+// when connecting from the given source IP.
+// The source IP may be invalid, if the connection is not IP based.
+func (c *Config) CheckInbound(router, source netip.Addr) error {
+	switch {
+	case matchPrefixes(c.InboundDenyRouters, router):
+		return errors.New("router is denied")
+	case len(c.InboundAllowRouters) > 0 && !matchPrefixes(c.InboundAllowRouters, router):
+		return errors.New("router is not allowed")
+	case matchPrefixes(c.InboundDenySources, source):
+		return errors.New("source network is denied")
+	case len(c.InboundAllowSources) > 0 && !matchPrefixes(c.InboundAllowSources, source):
+		return errors.New("source network is not allowed")
+	default:
+		return nil
+	}
+}
+
+func matchPrefixes(prefixes []netip.Prefix, ip netip.Addr) bool {
+	if !ip.IsValid() {
+		return false
+	}
+	ip = ip.Unmap()
+	for _, prefix := range prefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
 func makePolicyKey(protocol uint8, dstPort uint16) string {
 	return strconv.FormatInt(int64(protocol), 10) + "-" + strconv.FormatInt(int64(dstPort), 10)
 }
@@ -424,10 +748,17 @@ func getInfoFromURL(svcURL string) (policyKeys []string, domain string, err erro
 func (c *Config) GetRouterInfo() *m.RouterInfo {
 	// Create router info.
 	info := &m.RouterInfo{
-		Listeners: c.Router.Listen,
+		Listeners: make([]string, 0, len(c.Router.Listen)),
 		IANA:      c.Router.IANA,
 	}
 
+	// Collect listeners, except unix sockets, as they are only reachable locally.
+	for _, listener := range c.Router.Listen {
+		if !strings.HasPrefix(listener, "unix:") {
+			info.Listeners = append(info.Listeners, listener)
+		}
+	}
+
 	// Collect public services.
 	srv := make([]m.RouterService, 0, len(c.Services))
 	for _, service := range c.Services {
@@ -5,6 +5,13 @@ import "net/netip"
 // DefaultPortNumber is the default port number used by Mycoria.
 const DefaultPortNumber = 47369 // M(1+3), Y(2+5), C(3), O(1+5), R(1+8); 0xB909
 
+// DefaultDiscoveryPort is the default port used for local network discovery.
+const DefaultDiscoveryPort = DefaultPortNumber - 1
+
+// DefaultDiscoveryGroup is the IPv6 link-local multicast group used for local
+// network discovery.
+var DefaultDiscoveryGroup = netip.MustParseAddr("ff02::b909")
+
 // DefaultAPIAddress is the default local API address used by Mycoria.
 var DefaultAPIAddress = netip.MustParseAddr("fd00::b909")
 
@@ -26,6 +26,7 @@ func (d *Dashboard) registerViews() {
 
 	api.HandleFunc("GET /discover", d.discoverPage)
 	api.HandleFunc("GET /table", d.tablePage)
+	api.HandleFunc("GET /trace", d.tracePage)
 	api.HandleFunc("GET /info", d.infoPage)
 
 	api.HandleFunc("GET /mappings", d.mappingsPage)
@@ -136,13 +137,53 @@ func (d *Dashboard) discoverPage(w http.ResponseWriter, r *http.Request) {
 
 func (d *Dashboard) tablePage(w http.ResponseWriter, r *http.Request) {
 	d.render(w, r, "table", struct {
-		Table string
-		Stub  bool
-		Lite  bool
+		Table      string
+		Suppressed int
+		Stub       bool
+		Lite       bool
 	}{
-		Table: d.instance.Router().Table().Format(),
-		Stub:  d.instance.Config().Router.Stub,
-		Lite:  d.instance.Config().Router.Lite,
+		Table:      d.instance.Router().Table().Format(),
+		Suppressed: len(d.instance.Router().Table().SuppressedRoutes()),
+		Stub:       d.instance.Config().Router.Stub,
+		Lite:       d.instance.Config().Router.Lite,
+	})
+}
+
+func (d *Dashboard) tracePage(w http.ResponseWriter, r *http.Request) {
+	// Show form only, if no IP is given.
+	ipParam := r.URL.Query().Get("ip")
+	if ipParam == "" {
+		d.render(w, r, "trace", struct {
+			Dst  string
+			Hops []*router.TraceHop
+			Err  string
+		}{})
+		return
+	}
+
+	// Trace destination.
+	var (
+		hops   []*router.TraceHop
+		errMsg string
+	)
+	dst, err := netip.ParseAddr(ipParam)
+	if err == nil {
+		// Traces take longer than the default write timeout.
+		_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(router.TraceTimeout + 10*time.Second))
+		hops, err = d.instance.Router().TracePing.Trace(r.Context(), dst)
+	}
+	if err != nil {
+		errMsg = err.Error()
+	}
+
+	d.render(w, r, "trace", struct {
+		Dst  string
+		Hops []*router.TraceHop
+		Err  string
+	}{
+		Dst:  ipParam,
+		Hops: hops,
+		Err:  errMsg,
 	})
 }
 
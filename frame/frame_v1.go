@@ -31,7 +31,7 @@ import (
 // - DstIPData [16]byte
 // --- ~B
 // - Switch Block Length (uint8; zero for no switching)
-// - Switch Block ([]byte; if any) [signed/MAC'd in the final format the receiving node sees]
+// - Switch Block ([]byte; if any) [rotated by switch hops, set to zero for cryptographic ops]
 // --- ~B
 // - Message Data Length (uint16)
 // - Message Data []byte (signed or encrypted envelope)
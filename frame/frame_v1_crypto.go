@@ -6,6 +6,7 @@ import (
 	"crypto/ed25519"
 	"errors"
 	"fmt"
+	"slices"
 
 	"github.com/mycoria/mycoria/state"
 )
@@ -89,9 +90,28 @@ func (f *FrameV1) Unseal(s *state.Session) error {
 			return err
 		}
 
+		// Keep a copy of the encrypted data while re-keying, as decryption
+		// happens in place and the frame might be encrypted with the alternate key.
+		alt := s.Encryption().InAlternate()
+		var encrypted []byte
+		if alt != nil {
+			encrypted = slices.Clone(f.MessageDataWithAuth())
+		}
+
 		// Decrypt.
 		if err := f.decryptFrame(c); err != nil {
-			return fmt.Errorf("decrypt: %w", err)
+			if alt == nil {
+				return fmt.Errorf("decrypt: %w", err)
+			}
+
+			// Try again with alternate key.
+			copy(f.MessageDataWithAuth(), encrypted)
+			if err := f.decryptFrame(alt); err != nil {
+				return fmt.Errorf("decrypt: %w", err)
+			}
+			s.Encryption().ConfirmAlternate(alt)
+		} else if alt != nil {
+			s.Encryption().ConfirmCurrent()
 		}
 		return s.Encryption().Check(seqNum, msgClass == MessageClassPriorityEncrypted)
 
@@ -137,13 +157,21 @@ func (f *FrameV1) putFieldsIntoCryptoState() (done func()) {
 	// Save current values.
 	ttl := f.TTL()
 	flowC := f.FlowControl()
+	var switchBlock []byte
+	if block := f.SwitchBlock(); len(block) > 0 {
+		switchBlock = slices.Clone(block)
+	}
 	// Set values to zero for cryptographic operations.
+	// The switch block is changed by every switch hop and the return block
+	// is only available to the destination.
 	f.SetTTL(0)
 	f.SetFlowControl(0)
+	clear(f.SwitchBlock())
 	// Return done function to set data back to what it was.
 	return func() {
 		f.SetTTL(ttl)
 		f.SetFlowControl(flowC)
+		copy(f.SwitchBlock(), switchBlock)
 	}
 }
 
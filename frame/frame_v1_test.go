@@ -3,6 +3,7 @@ package frame
 import (
 	"context"
 	"net/netip"
+	"slices"
 	"sync"
 	"testing"
 	"time"
@@ -159,9 +160,13 @@ func TestFrameV1(t *testing.T) {
 		if err := f.Seal(s2); err != nil { // Seal for s2.
 			t.Fatalf("failed to seal %s: %s", msgType, err)
 		}
+		// Simulate a switch hop changing the switch block.
+		f.SwitchBlock()[0]++
+		switchBlock := slices.Clone(f.SwitchBlock())
 		if err := f.Unseal(s1); err != nil { // Unseal from s1.
 			t.Fatalf("failed to unseal %s: %s", msgType, err)
 		}
+		assert.Equal(t, switchBlock, f.SwitchBlock(), "switch block should be kept by crypto ops")
 
 		// Wait for 2ms, because the signature sequence is ms based.
 		time.Sleep(2 * time.Millisecond)
@@ -228,6 +233,69 @@ func TestKeyRollover(t *testing.T) { //nolint:paralleltest // Key iteration must
 	assert.NotEqual(t, e2h.InKey(), s2OldInKey, "s2 in key should have changed")
 }
 
+func TestRekeyCutOver(t *testing.T) { //nolint:paralleltest // Re-keying must be done exlusively.
+	// Setup.
+	b := NewFrameBuilder()
+	s1, s2 := getTestSessions(t)
+	e1 := s1.Encryption()
+	e2 := s2.Encryption()
+	newFrame := func() Frame {
+		t.Helper()
+
+		f, err := b.NewFrameV1(s1.Address().IP, s2.Address().IP, NetworkTraffic, nil, testData, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+
+	// Start re-keying.
+	kxKey, kxType, err := e1.RekeyStart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kxKey, kxType, err = e2.RekeyServer(kxKey, kxType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Frame of the server in flight with the previous keys.
+	inFlight := newFrame()
+	if err := inFlight.Seal(s2); err != nil {
+		t.Fatal(err)
+	}
+
+	// Complete re-keying on the client.
+	if err := e1.RekeyClientComplete(kxKey, kxType); err != nil {
+		t.Fatal(err)
+	}
+
+	// Server must accept frames with the new keys and switch to them.
+	f := newFrame()
+	if err := f.Seal(s1); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Unseal(s2); err != nil {
+		t.Fatalf("failed to unseal frame with new keys: %s", err)
+	}
+	assert.Equal(t, testData, f.MessageData(), "message data should match")
+
+	// Client must still accept the frame in flight.
+	if err := inFlight.Unseal(s1); err != nil {
+		t.Fatalf("failed to unseal frame with previous keys: %s", err)
+	}
+	assert.Equal(t, testData, inFlight.MessageData(), "message data should match")
+
+	// Server uses the new keys.
+	f = newFrame()
+	if err := f.Seal(s2); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Unseal(s1); err != nil {
+		t.Fatalf("failed to unseal frame after re-keying: %s", err)
+	}
+}
+
 // TODO: Delete if not used anymore.
 // var (
 // 	fakeSrc         = netip.MustParseAddr(gofakeit.IPv6Address())
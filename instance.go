@@ -153,6 +153,12 @@ func New(version string, c *config.Config) (*Instance, error) {
 
 	// Add protocols.
 	instance.peering.AddProtocol("tcp", peering.ProtocolTCP)
+	instance.peering.AddProtocol("tls", peering.ProtocolTLS)
+	instance.peering.AddProtocol("udp", peering.ProtocolUDP)
+	instance.peering.AddProtocol("quic", peering.ProtocolQUIC)
+	instance.peering.AddProtocol("ws", peering.ProtocolWebSocket)
+	instance.peering.AddProtocol("wss", peering.ProtocolWebSocketSecure)
+	instance.peering.AddProtocol("unix", peering.ProtocolUnix)
 
 	// Add all modules to instance group.
 	instance.Group = mgr.NewGroup(
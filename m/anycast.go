@@ -0,0 +1,188 @@
+package m
+
+import (
+	"errors"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Anycast groups.
+// An anycast group is identified by an address in the anycast range, which is
+// derived from the key of the group like any other address. The group key
+// signs membership proofs for routers, which allow them to serve the anycast
+// address. Routers announce their memberships and other routers send traffic
+// for the anycast address to the nearest member.
+
+// anycastMembershipContext is the signing context of anycast memberships.
+var anycastMembershipContext = []byte("mycoria anycast membership")
+
+// AnycastMembership is a proof that a router is a member of an anycast group.
+type AnycastMembership struct {
+	Group     PublicAddress `cbor:"g" json:"group"     yaml:"group"`
+	Member    netip.Addr    `cbor:"m" json:"member"    yaml:"member"`
+	Expires   time.Time     `cbor:"e" json:"expires"   yaml:"expires"`
+	Signature []byte        `cbor:"s" json:"signature" yaml:"signature"`
+}
+
+// NewAnycastMembership returns a new membership proof for the given member,
+// signed by the given anycast group address.
+func NewAnycastMembership(group *Address, member netip.Addr, expires time.Time) (*AnycastMembership, error) {
+	switch {
+	case GetAddressType(group.IP) != TypeAnycast:
+		return nil, errors.New("group address is not an anycast address")
+	case !RoutingAddressPrefix.Contains(member) || GetAddressType(member) == TypeAnycast:
+		return nil, errors.New("member is not a router address")
+	}
+
+	p := &membershipProof{
+		member:  member,
+		expires: expires,
+	}
+	if err := p.sign(group, anycastMembershipContext); err != nil {
+		return nil, err
+	}
+	return anycastMembershipFromProof(p), nil
+}
+
+func anycastMembershipFromProof(p *membershipProof) *AnycastMembership {
+	return &AnycastMembership{
+		Group:     p.authority,
+		Member:    p.member,
+		Expires:   p.expires,
+		Signature: p.signature,
+	}
+}
+
+func (am *AnycastMembership) proof() *membershipProof {
+	return &membershipProof{
+		authority: am.Group,
+		member:    am.Member,
+		expires:   am.Expires,
+		signature: am.Signature,
+	}
+}
+
+// Verify checks if the group address is a valid anycast address and if the
+// membership is signed by it. Expiry is not checked.
+func (am *AnycastMembership) Verify() error {
+	switch {
+	case GetAddressType(am.Group.IP) != TypeAnycast:
+		return errors.New("group address is not an anycast address")
+	case !RoutingAddressPrefix.Contains(am.Member) || GetAddressType(am.Member) == TypeAnycast:
+		return errors.New("member is not a router address")
+	}
+	return am.proof().verify(anycastMembershipContext)
+}
+
+// Expired returns whether the membership has expired.
+func (am *AnycastMembership) Expired() bool {
+	return time.Now().After(am.Expires)
+}
+
+// Export returns the membership in a compact text format.
+func (am *AnycastMembership) Export() (string, error) {
+	return am.proof().export(proofTypeAnycast)
+}
+
+// ParseAnycastMembership parses and verifies an exported membership.
+func ParseAnycastMembership(s string) (*AnycastMembership, error) {
+	p, err := parseMembershipProof(s, proofTypeAnycast)
+	if err != nil {
+		return nil, err
+	}
+	am := anycastMembershipFromProof(p)
+	if err := am.Verify(); err != nil {
+		return nil, err
+	}
+	return am, nil
+}
+
+// AnycastTable holds the known members of anycast groups.
+type AnycastTable struct {
+	// groups maps anycast groups to their members and when they expire.
+	groups map[netip.Addr]map[netip.Addr]time.Time
+	lock   sync.RWMutex
+}
+
+// NewAnycastTable returns a new anycast table.
+func NewAnycastTable() *AnycastTable {
+	return &AnycastTable{
+		groups: make(map[netip.Addr]map[netip.Addr]time.Time),
+	}
+}
+
+// AddMember adds or updates a member of an anycast group.
+// Returns whether the member is new.
+func (at *AnycastTable) AddMember(group, member netip.Addr, expires time.Time) (added bool) {
+	at.lock.Lock()
+	defer at.lock.Unlock()
+
+	members, ok := at.groups[group]
+	if !ok {
+		members = make(map[netip.Addr]time.Time)
+		at.groups[group] = members
+	}
+	_, ok = members[member]
+	members[member] = expires
+	return !ok
+}
+
+// RemoveMember removes the given router from all anycast groups.
+func (at *AnycastTable) RemoveMember(member netip.Addr) {
+	at.lock.Lock()
+	defer at.lock.Unlock()
+
+	for group, members := range at.groups {
+		delete(members, member)
+		if len(members) == 0 {
+			delete(at.groups, group)
+		}
+	}
+}
+
+// IsMember returns whether the given router is a member of the anycast group.
+func (at *AnycastTable) IsMember(group, member netip.Addr) bool {
+	at.lock.RLock()
+	defer at.lock.RUnlock()
+
+	expires, ok := at.groups[group][member]
+	return ok && time.Now().Before(expires)
+}
+
+// Members returns the members of the given anycast group.
+func (at *AnycastTable) Members(group netip.Addr) []netip.Addr {
+	at.lock.RLock()
+	defer at.lock.RUnlock()
+
+	now := time.Now()
+	members := make([]netip.Addr, 0, len(at.groups[group]))
+	for member, expires := range at.groups[group] {
+		if now.Before(expires) {
+			members = append(members, member)
+		}
+	}
+	slices.SortFunc(members, func(a, b netip.Addr) int {
+		return a.Compare(b)
+	})
+	return members
+}
+
+// Clean removes expired members.
+func (at *AnycastTable) Clean() {
+	at.lock.Lock()
+	defer at.lock.Unlock()
+
+	now := time.Now()
+	for group, members := range at.groups {
+		for member, expires := range members {
+			if now.After(expires) {
+				delete(members, member)
+			}
+		}
+		if len(members) == 0 {
+			delete(at.groups, group)
+		}
+	}
+}
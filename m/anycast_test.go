@@ -0,0 +1,99 @@
+package m
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestAnycastMembership(t *testing.T) {
+	t.Parallel()
+
+	group, _, err := GenerateRoutableAddress(context.Background(), []netip.Prefix{AnycastPrefix})
+	if err != nil {
+		t.Fatal(err)
+	}
+	member := netip.MustParseAddr("fd12:3456::1")
+
+	// Create and verify membership.
+	am, err := NewAnycastMembership(group, member, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := am.Verify(); err != nil {
+		t.Fatalf("membership should be valid: %s", err)
+	}
+	if am.Expired() {
+		t.Fatal("membership should not be expired")
+	}
+
+	// Export and parse.
+	exported, err := am.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseAnycastMembership(exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Group.IP != group.IP || parsed.Member != member || !parsed.Expires.Equal(am.Expires) {
+		t.Fatalf("parsed membership does not match: %+v", parsed)
+	}
+
+	// Memberships must not be transferable.
+	am.Member = netip.MustParseAddr("fd12:3456::2")
+	if err := am.Verify(); err == nil {
+		t.Fatal("membership for other member should be invalid")
+	}
+
+	// Only anycast addresses may sign memberships.
+	router, _, err := GenerateRoutableAddress(context.Background(), []netip.Prefix{RoamingPrefix})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewAnycastMembership(router, member, time.Now().Add(time.Hour)); err == nil {
+		t.Fatal("non-anycast address should not create memberships")
+	}
+}
+
+func TestAnycastTable(t *testing.T) {
+	t.Parallel()
+
+	var (
+		group   = netip.MustParseAddr("fd0e:1234::1")
+		memberA = netip.MustParseAddr("fd12:3456::1")
+		memberB = netip.MustParseAddr("fd12:3456::2")
+		memberC = netip.MustParseAddr("fd12:3456::3")
+	)
+
+	at := NewAnycastTable()
+	if !at.AddMember(group, memberB, time.Now().Add(time.Hour)) {
+		t.Fatal("member should be new")
+	}
+	if at.AddMember(group, memberB, time.Now().Add(time.Hour)) {
+		t.Fatal("member should not be new")
+	}
+	at.AddMember(group, memberA, time.Now().Add(time.Hour))
+	at.AddMember(group, memberC, time.Now().Add(-time.Second))
+
+	// Expired members are ignored.
+	members := at.Members(group)
+	if len(members) != 2 || members[0] != memberA || members[1] != memberB {
+		t.Fatalf("unexpected members: %v", members)
+	}
+	if at.IsMember(group, memberC) {
+		t.Fatal("expired member should not be a member")
+	}
+
+	// Remove members.
+	at.RemoveMember(memberA)
+	if at.IsMember(group, memberA) {
+		t.Fatal("removed member should not be a member")
+	}
+	at.Clean()
+	members = at.Members(group)
+	if len(members) != 1 || members[0] != memberB {
+		t.Fatalf("unexpected members after clean: %v", members)
+	}
+}
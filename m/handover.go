@@ -0,0 +1,106 @@
+package m
+
+import (
+	"errors"
+	"net/netip"
+	"time"
+)
+
+// Identity handovers.
+// When a router rotates its identity, the key of the old address signs a
+// handover to the new address. The router announces the handover with its new
+// address, so that other routers can move friends and domain mappings from
+// the old to the new address.
+
+// identityHandoverContext is the signing context of identity handovers.
+var identityHandoverContext = []byte("mycoria identity handover")
+
+// IdentityHandover is a proof that a router address was replaced by a new one.
+type IdentityHandover struct {
+	Old       PublicAddress `cbor:"o" json:"old"       yaml:"old"`
+	New       netip.Addr    `cbor:"n" json:"new"       yaml:"new"`
+	Expires   time.Time     `cbor:"e" json:"expires"   yaml:"expires"`
+	Signature []byte        `cbor:"s" json:"signature" yaml:"signature"`
+}
+
+// NewIdentityHandover returns a new handover to the given new address,
+// signed by the given old address.
+func NewIdentityHandover(old *Address, newIP netip.Addr, expires time.Time) (*IdentityHandover, error) {
+	switch {
+	case !isRouterAddress(old.IP):
+		return nil, errors.New("old address is not a router address")
+	case !isRouterAddress(newIP):
+		return nil, errors.New("new address is not a router address")
+	case old.IP == newIP:
+		return nil, errors.New("old and new address are the same")
+	}
+
+	p := &membershipProof{
+		member:  newIP,
+		expires: expires,
+	}
+	if err := p.sign(old, identityHandoverContext); err != nil {
+		return nil, err
+	}
+	return identityHandoverFromProof(p), nil
+}
+
+func identityHandoverFromProof(p *membershipProof) *IdentityHandover {
+	return &IdentityHandover{
+		Old:       p.authority,
+		New:       p.member,
+		Expires:   p.expires,
+		Signature: p.signature,
+	}
+}
+
+func (ih *IdentityHandover) proof() *membershipProof {
+	return &membershipProof{
+		authority: ih.Old,
+		member:    ih.New,
+		expires:   ih.Expires,
+		signature: ih.Signature,
+	}
+}
+
+// Verify checks if both addresses are router addresses and if the handover is
+// signed by the old address. Expiry is not checked.
+func (ih *IdentityHandover) Verify() error {
+	switch {
+	case !isRouterAddress(ih.Old.IP):
+		return errors.New("old address is not a router address")
+	case !isRouterAddress(ih.New):
+		return errors.New("new address is not a router address")
+	case ih.Old.IP == ih.New:
+		return errors.New("old and new address are the same")
+	}
+	return ih.proof().verify(identityHandoverContext)
+}
+
+// Expired returns whether the handover has expired.
+func (ih *IdentityHandover) Expired() bool {
+	return time.Now().After(ih.Expires)
+}
+
+// Export returns the handover in a compact text format.
+func (ih *IdentityHandover) Export() (string, error) {
+	return ih.proof().export(proofTypeHandover)
+}
+
+// ParseIdentityHandover parses and verifies an exported handover.
+func ParseIdentityHandover(s string) (*IdentityHandover, error) {
+	p, err := parseMembershipProof(s, proofTypeHandover)
+	if err != nil {
+		return nil, err
+	}
+	ih := identityHandoverFromProof(p)
+	if err := ih.Verify(); err != nil {
+		return nil, err
+	}
+	return ih, nil
+}
+
+// isRouterAddress returns whether the given IP may be used by a router.
+func isRouterAddress(ip netip.Addr) bool {
+	return RoutingAddressPrefix.Contains(ip) && GetAddressType(ip) != TypeAnycast
+}
@@ -0,0 +1,75 @@
+package m
+
+import (
+	"context"
+	"encoding/base64"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestIdentityHandover(t *testing.T) {
+	t.Parallel()
+
+	old, _, err := GenerateRoutableAddress(context.Background(), []netip.Prefix{RoamingPrefix})
+	if err != nil {
+		t.Fatal(err)
+	}
+	newIP := RoamingPrefix.Addr().Next()
+
+	// Create and verify handover.
+	ih, err := NewIdentityHandover(old, newIP, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ih.Verify(); err != nil {
+		t.Fatalf("handover should be valid: %s", err)
+	}
+	if ih.Expired() {
+		t.Fatal("handover should not be expired")
+	}
+
+	// Export and parse.
+	exported, err := ih.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseIdentityHandover(exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Old.IP != old.IP || parsed.New != newIP {
+		t.Fatalf("parsed handover does not match: %+v", parsed)
+	}
+
+	// Handovers use the common proof version with their own proof type.
+	data, err := base64.RawURLEncoding.DecodeString(exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data[0] != membershipProofVersion || data[1] != proofTypeHandover {
+		t.Fatalf("unexpected version %d or proof type %d", data[0], data[1])
+	}
+
+	// Handovers and other proofs are not interchangeable.
+	if _, err := ParseOrgDelegation(exported); err == nil {
+		t.Fatal("handover should not parse as organization delegation")
+	}
+	if _, err := ParseAnycastMembership(exported); err == nil {
+		t.Fatal("handover should not parse as anycast membership")
+	}
+
+	// Handovers to invalid addresses are rejected.
+	if _, err := NewIdentityHandover(old, old.IP, time.Now().Add(time.Hour)); err == nil {
+		t.Fatal("handover to the same address should be rejected")
+	}
+	if _, err := NewIdentityHandover(old, AnycastPrefix.Addr().Next(), time.Now().Add(time.Hour)); err == nil {
+		t.Fatal("handover to an anycast address should be rejected")
+	}
+
+	// Modified handovers are invalid.
+	ih.New = newIP.Next()
+	if err := ih.Verify(); err == nil {
+		t.Fatal("modified handover should be invalid")
+	}
+}
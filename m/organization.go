@@ -0,0 +1,113 @@
+package m
+
+import (
+	"errors"
+	"net/netip"
+	"time"
+)
+
+// Organizations.
+// An organization is identified by its root address in the organization
+// range. The first 32 bits of the root address are the prefix of the
+// organization. The root key signs delegations for the router addresses
+// within the organization prefix, which proves that they belong to the
+// organization. Routers with an organization address announce their
+// delegation and other routers only accept announcements of organization
+// addresses with a valid delegation.
+
+// orgDelegationContext is the signing context of organization delegations.
+var orgDelegationContext = []byte("mycoria organization delegation")
+
+// OrganizationPrefixFor returns the organization prefix of the given
+// organization address.
+func OrganizationPrefixFor(ip netip.Addr) netip.Prefix {
+	prefix, _ := ip.Prefix(OrganizationPrefix.Bits() + OrganizationBits)
+	return prefix
+}
+
+// OrgDelegation is a proof that a router address belongs to an organization.
+type OrgDelegation struct {
+	Root      PublicAddress `cbor:"r" json:"root"      yaml:"root"`
+	Member    netip.Addr    `cbor:"m" json:"member"    yaml:"member"`
+	Expires   time.Time     `cbor:"e" json:"expires"   yaml:"expires"`
+	Signature []byte        `cbor:"s" json:"signature" yaml:"signature"`
+}
+
+// NewOrgDelegation returns a new delegation for the given member, signed by
+// the given organization root address.
+func NewOrgDelegation(root *Address, member netip.Addr, expires time.Time) (*OrgDelegation, error) {
+	switch {
+	case GetAddressType(root.IP) != TypeOrganization:
+		return nil, errors.New("root address is not an organization address")
+	case !OrganizationPrefixFor(root.IP).Contains(member):
+		return nil, errors.New("member is not within the organization prefix")
+	}
+
+	p := &membershipProof{
+		member:  member,
+		expires: expires,
+	}
+	if err := p.sign(root, orgDelegationContext); err != nil {
+		return nil, err
+	}
+	return orgDelegationFromProof(p), nil
+}
+
+func orgDelegationFromProof(p *membershipProof) *OrgDelegation {
+	return &OrgDelegation{
+		Root:      p.authority,
+		Member:    p.member,
+		Expires:   p.expires,
+		Signature: p.signature,
+	}
+}
+
+func (od *OrgDelegation) proof() *membershipProof {
+	return &membershipProof{
+		authority: od.Root,
+		member:    od.Member,
+		expires:   od.Expires,
+		signature: od.Signature,
+	}
+}
+
+// Prefix returns the organization prefix of the delegation.
+func (od *OrgDelegation) Prefix() netip.Prefix {
+	return OrganizationPrefixFor(od.Root.IP)
+}
+
+// Verify checks if the root address is a valid organization address, if the
+// member is within its prefix and if the delegation is signed by it.
+// Expiry is not checked.
+func (od *OrgDelegation) Verify() error {
+	switch {
+	case GetAddressType(od.Root.IP) != TypeOrganization:
+		return errors.New("root address is not an organization address")
+	case !od.Prefix().Contains(od.Member):
+		return errors.New("member is not within the organization prefix")
+	}
+	return od.proof().verify(orgDelegationContext)
+}
+
+// Expired returns whether the delegation has expired.
+func (od *OrgDelegation) Expired() bool {
+	return time.Now().After(od.Expires)
+}
+
+// Export returns the delegation in a compact text format.
+func (od *OrgDelegation) Export() (string, error) {
+	return od.proof().export(proofTypeOrg)
+}
+
+// ParseOrgDelegation parses and verifies an exported delegation.
+func ParseOrgDelegation(s string) (*OrgDelegation, error) {
+	p, err := parseMembershipProof(s, proofTypeOrg)
+	if err != nil {
+		return nil, err
+	}
+	od := orgDelegationFromProof(p)
+	if err := od.Verify(); err != nil {
+		return nil, err
+	}
+	return od, nil
+}
@@ -0,0 +1,65 @@
+package m
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestOrgDelegation(t *testing.T) {
+	t.Parallel()
+
+	root, _, err := GenerateRoutableAddress(context.Background(), []netip.Prefix{OrganizationPrefix})
+	if err != nil {
+		t.Fatal(err)
+	}
+	orgPrefix := OrganizationPrefixFor(root.IP)
+	if orgPrefix.Bits() != 32 || !orgPrefix.Contains(root.IP) {
+		t.Fatalf("unexpected organization prefix %s for %s", orgPrefix, root.IP)
+	}
+	member := orgPrefix.Addr().Next()
+
+	// Create and verify delegation.
+	od, err := NewOrgDelegation(root, member, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := od.Verify(); err != nil {
+		t.Fatalf("delegation should be valid: %s", err)
+	}
+
+	// Export and parse.
+	exported, err := od.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseOrgDelegation(exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Root.IP != root.IP || parsed.Member != member || parsed.Prefix() != orgPrefix {
+		t.Fatalf("parsed delegation does not match: %+v", parsed)
+	}
+
+	// Delegations and anycast memberships are not interchangeable.
+	if _, err := ParseAnycastMembership(exported); err == nil {
+		t.Fatal("delegation should not parse as anycast membership")
+	}
+
+	// Members outside of the organization prefix cannot be delegated.
+	outside := netip.MustParseAddr("fd12:3456::1")
+	if _, err := NewOrgDelegation(root, outside, time.Now().Add(time.Hour)); err == nil {
+		t.Fatal("member outside of organization prefix should not be delegated")
+	}
+	od.Member = outside
+	if err := od.Verify(); err == nil {
+		t.Fatal("delegation for member outside of organization prefix should be invalid")
+	}
+
+	// Own organization is kept in full detail.
+	prefixes := GetRoutablePrefixesFor(member, OrganizationPrefix)
+	if prefixes[0].BasePrefix != orgPrefix {
+		t.Fatalf("own organization prefix should have highest priority, got %s", prefixes[0].BasePrefix)
+	}
+}
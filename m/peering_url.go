@@ -63,6 +63,21 @@ func ParsePeeringURL(definition string) (*PeeringURL, error) {
 		return nil, errors.New("missing scheme/protocol")
 	}
 
+	// Unix sockets use the path as address and have no host or port.
+	if p.Protocol == "unix" {
+		p.Path = u.Path
+		if p.Path == "" {
+			p.Path = u.Opaque
+		}
+		switch {
+		case u.Host != "":
+			return nil, errors.New("unix socket may not have a host or port")
+		case p.Path == "":
+			return nil, errors.New("missing socket path")
+		}
+		return p, nil
+	}
+
 	// Parse port.
 	portData := u.Port()
 	if portData == "" && u.Opaque != "" {
@@ -93,7 +108,7 @@ func ParsePeeringURL(definition string) (*PeeringURL, error) {
 			p.Port = 80
 		case "https", "wss":
 			p.Port = 443
-		case "tcp", "kcp", "udp":
+		case "tcp", "tls", "kcp", "udp", "quic":
 			p.Port = 47369 // config.DefaultPortNumber
 		}
 		return nil, errors.New("missing port")
@@ -110,6 +125,10 @@ func ParsePeeringURL(definition string) (*PeeringURL, error) {
 // String returns the definition form of the peering URL.
 func (p *PeeringURL) String() string {
 	switch {
+	case p.Protocol == "unix" && p.Option != "":
+		return fmt.Sprintf("%s:%s#%s", p.Protocol, p.Path, p.Option)
+	case p.Protocol == "unix":
+		return fmt.Sprintf("%s:%s", p.Protocol, p.Path)
 	case p.Option != "":
 		return fmt.Sprintf("%s://%s:%d%s#%s", p.Protocol, p.Domain, p.Port, p.Path, p.Option)
 	case p.Domain != "":
@@ -120,7 +139,11 @@ func (p *PeeringURL) String() string {
 }
 
 // FormatWith formats the peering URL with the given host.
+// Unix socket URLs are returned as is.
 func (p *PeeringURL) FormatWith(host string) string {
+	if p.Protocol == "unix" {
+		return p.String()
+	}
 	if host == "" {
 		host = p.Domain
 	}
@@ -159,10 +182,22 @@ func SortPeeringURLs(urls []*PeeringURL) {
 
 func (p *PeeringURL) protocolOrder() int {
 	switch p.Protocol {
+	case "unix":
+		return 0
 	case "tcp":
 		return 1
-	case "http":
+	case "tls":
 		return 2
+	case "http":
+		return 3
+	case "quic":
+		return 4
+	case "udp":
+		return 5
+	case "wss":
+		return 6
+	case "ws":
+		return 7
 	default:
 		return 0xFFFF
 	}
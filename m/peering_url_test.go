@@ -107,6 +107,16 @@ func TestPeeringURLParsing(t *testing.T) {
 		Path:     "/test?key=value",
 	}, parseT(t, "http://example.com:80/test?key=value"), "should match")
 
+	assert.Equal(t, &PeeringURL{
+		Protocol: "unix",
+		Path:     "/run/mycoria/peering.sock",
+	}, parseT(t, "unix:///run/mycoria/peering.sock"), "should match")
+
+	assert.Equal(t, &PeeringURL{
+		Protocol: "unix",
+		Path:     "peering.sock",
+	}, parseT(t, "unix:peering.sock"), "should match")
+
 	// test parsing and formatting
 
 	assert.Equal(t, "mycoria:47369",
@@ -138,10 +148,19 @@ func TestPeeringURLParsing(t *testing.T) {
 	assert.Equal(t, "http://example.com:80/test?key=value",
 		parseT(t, "http://example.com:80/test?key=value").String(), "should match")
 
+	assert.Equal(t, "unix:/run/mycoria/peering.sock",
+		parseT(t, "unix:///run/mycoria/peering.sock").String(), "should match")
+	assert.Equal(t, "unix:/run/mycoria/peering.sock",
+		parseT(t, "unix:/run/mycoria/peering.sock").String(), "should match")
+	assert.Equal(t, "unix:peering.sock",
+		parseT(t, "unix:peering.sock").String(), "should match")
+
 	// test invalid
 
 	assert.NotEqual(t, parseTError("tcp"), nil, "should fail")
 	assert.NotEqual(t, parseTError("tcp:"), nil, "should fail")
 	assert.NotEqual(t, parseTError("tcp:0"), nil, "should fail")
 	assert.NotEqual(t, parseTError("tcp:65536"), nil, "should fail")
+	assert.NotEqual(t, parseTError("unix:"), nil, "should fail")
+	assert.NotEqual(t, parseTError("unix://example.com/peering.sock"), nil, "should fail")
 }
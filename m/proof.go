@@ -0,0 +1,133 @@
+package m
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"time"
+)
+
+// Membership proofs.
+// Anycast memberships, organization delegations and identity handovers are
+// all proofs that an authority address (the anycast group, the organization
+// root or the old router address) vouches for a member router until an
+// expiry. They share the signed data layout and the compact text format used
+// in the config. The proof type in the text format prevents using one kind of
+// proof as another, and the signing context differs for each kind.
+
+// membershipProofVersion is the version of the exported membership proof.
+const membershipProofVersion = 1
+
+// Membership proof types.
+const (
+	proofTypeAnycast  byte = 1
+	proofTypeOrg      byte = 2
+	proofTypeHandover byte = 3
+)
+
+// membershipProofExportSize is the size of an exported membership proof.
+const membershipProofExportSize = 1 + // Version
+	1 + // Proof Type
+	16 + // Authority IP
+	ed25519.PublicKeySize + // Authority Key
+	16 + // Member IP
+	8 + // Expires
+	ed25519.SignatureSize // Signature
+
+// membershipProof holds the fields of a membership proof.
+type membershipProof struct {
+	authority PublicAddress
+	member    netip.Addr
+	expires   time.Time
+	signature []byte
+}
+
+// signedData returns the data that is signed by the authority.
+func (p *membershipProof) signedData() []byte {
+	data := make([]byte, 16+16+8)
+	copy(data[:16], p.authority.IP.AsSlice())
+	copy(data[16:32], p.member.AsSlice())
+	PutUint64(data[32:40], uint64(p.expires.Unix()))
+	return data
+}
+
+// sign signs the proof with the given authority address.
+func (p *membershipProof) sign(authority *Address, context []byte) error {
+	p.authority = authority.PublicAddress
+	p.expires = time.Unix(p.expires.Unix(), 0)
+
+	sig, err := authority.SignWithContext(p.signedData(), context)
+	if err != nil {
+		return fmt.Errorf("sign: %w", err)
+	}
+	p.signature = sig
+	return nil
+}
+
+// verify verifies the authority address and the signature.
+func (p *membershipProof) verify(context []byte) error {
+	if err := p.authority.VerifyAddress(); err != nil {
+		return fmt.Errorf("invalid authority address: %w", err)
+	}
+	if err := p.authority.VerifySigWithContext(p.signedData(), p.signature, context); err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+	return nil
+}
+
+// export returns the proof of the given type in the compact text format.
+func (p *membershipProof) export(proofType byte) (string, error) {
+	switch {
+	case p.authority.Hash != AddressDigestAlg:
+		return "", fmt.Errorf("unsupported address hash %q", p.authority.Hash)
+	case p.authority.Type != AddressKeyToolID:
+		return "", fmt.Errorf("unsupported address type %q", p.authority.Type)
+	case len(p.authority.PublicKey) != ed25519.PublicKeySize:
+		return "", errors.New("invalid key")
+	case len(p.signature) != ed25519.SignatureSize:
+		return "", errors.New("invalid signature")
+	}
+
+	data := make([]byte, membershipProofExportSize)
+	data[0] = membershipProofVersion
+	data[1] = proofType
+	copy(data[2:18], p.authority.IP.AsSlice())
+	copy(data[18:50], p.authority.PublicKey)
+	copy(data[50:66], p.member.AsSlice())
+	PutUint64(data[66:74], uint64(p.expires.Unix()))
+	copy(data[74:], p.signature)
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// parseMembershipProof parses a proof of the given type in the compact text
+// format. The proof is not verified.
+func parseMembershipProof(s string, proofType byte) (*membershipProof, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("decode: %w", err)
+	}
+	switch {
+	case len(data) != membershipProofExportSize:
+		return nil, fmt.Errorf("invalid size: %d", len(data))
+	case data[0] != membershipProofVersion:
+		return nil, fmt.Errorf("unsupported version: %d", data[0])
+	case data[1] != proofType:
+		return nil, fmt.Errorf("unexpected proof type: %d", data[1])
+	}
+
+	return &membershipProof{
+		authority: PublicAddress{
+			IP:        netip.AddrFrom16([16]byte(data[2:18])),
+			Hash:      AddressDigestAlg,
+			Type:      AddressKeyToolID,
+			PublicKey: ed25519.PublicKey(slices.Clone(data[18:50])),
+		},
+		member:    netip.AddrFrom16([16]byte(data[50:66])),
+		expires:   time.Unix(int64(GetUint64(data[66:74])), 0),
+		signature: slices.Clone(data[74:]),
+	}, nil
+}
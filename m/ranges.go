@@ -97,7 +97,8 @@ var (
 )
 
 // GetRoutablePrefixesFor returns the routable prefix for the given own IP as
-// well as the own prefix.
+// well as the own prefix. Routers of the own organization are kept in full
+// detail.
 func GetRoutablePrefixesFor(myIP netip.Addr, myPrefix netip.Prefix) []RoutablePrefix {
 	prefixes := []RoutablePrefix{
 		{ // Continent Prefixes.
@@ -137,6 +138,16 @@ func GetRoutablePrefixesFor(myIP netip.Addr, myPrefix netip.Prefix) []RoutablePr
 		})
 	}
 
+	// Keep full detail for own organization.
+	if GetAddressType(myIP) == TypeOrganization {
+		prefixes = append(prefixes, RoutablePrefix{
+			BasePrefix:       OrganizationPrefixFor(myIP),
+			RoutingBits:      OrganizationPrefix.Bits() + OrganizationBits,
+			EntryTTL:         24 * time.Hour,
+			EntriesPerPrefix: 1 << 16, // Keep all routers.
+		})
+	}
+
 	// Reverse for correct lookup priority.
 	slices.Reverse[[]RoutablePrefix, RoutablePrefix](prefixes)
 	return prefixes
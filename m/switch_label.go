@@ -95,6 +95,17 @@ blockScan:
 	return SwitchLabel(next), nil
 }
 
+// IsEmptySwitchBlock reports whether the given block is missing or cleared.
+// Frames with an empty switch block are routed by IP.
+func IsEmptySwitchBlock(block []byte) bool {
+	for _, b := range block {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
 // TransformToReturnBlock transform the given block to a return block that
 // takes the exact route it came from.
 func TransformToReturnBlock(block []byte) {
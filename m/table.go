@@ -7,17 +7,25 @@ import (
 	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
-
-	"go4.org/netipx"
 )
 
 // RoutingTable is a routing table.
+// Lookups use a snapshot of the table and do not lock.
 type RoutingTable struct {
-	lock sync.RWMutex
+	// lock serializes changes to the table.
+	lock sync.Mutex
+
+	cfg      RoutingTableConfig
+	snapshot atomic.Pointer[tableSnapshot]
+	damping  map[routeDampingKey]*routeDampingState
+}
 
-	cfg     RoutingTableConfig
-	entries []*RoutingTableEntry
+// tableSnapshot is an immutable state of the routing table.
+type tableSnapshot struct {
+	root   *trieNode
+	static []*RoutingTableEntry
 }
 
 // RoutingTableConfig holds the configuration for a routing table.
@@ -28,6 +36,9 @@ type RoutingTableConfig struct {
 
 	// RouterIP is ip address of router of the routing table.
 	RouterIP netip.Addr
+
+	// Damping configures route flap damping.
+	Damping RouteDampingConfig
 }
 
 // RoutablePrefix configures how routing entries of a defined base prefix should be handled.
@@ -80,6 +91,10 @@ const (
 	// Discovered by active probing (for own use).
 	// Entries are automatically removed after expiry.
 	RouteSourceDiscovered
+
+	// Configured by the user.
+	// Entries never expire and take precedence over learned routes.
+	RouteSourceStatic
 )
 
 // NewRoutingTable returns a new routing table with the given config.
@@ -87,8 +102,9 @@ func NewRoutingTable(cfg RoutingTableConfig) *RoutingTable {
 	// Create new table with initial sizes.
 	rt := &RoutingTable{
 		cfg:     cfg,
-		entries: make([]*RoutingTableEntry, 0, 128),
+		damping: make(map[routeDampingKey]*routeDampingState),
 	}
+	rt.snapshot.Store(&tableSnapshot{})
 
 	// Apply defaults.
 	if len(rt.cfg.RoutablePrefixes) == 0 {
@@ -97,12 +113,18 @@ func NewRoutingTable(cfg RoutingTableConfig) *RoutingTable {
 			RoutingBits: ContinentPrefixBits,
 		}}
 	}
+	rt.cfg.Damping.applyDefaults()
 
 	return rt
 }
 
 // AddRoute adds the given route to the routing table.
 func (rt *RoutingTable) AddRoute(entry RoutingTableEntry) (added bool, err error) {
+	// Static routes are held separately.
+	if entry.Source == RouteSourceStatic {
+		return rt.addStaticRoute(entry)
+	}
+
 	// Get routable prefix.
 	rp, ok := rt.getRoutablePrefixConfig(entry.DstIP)
 	if !ok {
@@ -167,25 +189,47 @@ func (rt *RoutingTable) AddRoute(entry RoutingTableEntry) (added bool, err error
 	rt.lock.Lock()
 	defer rt.lock.Unlock()
 
-	// Get destination section.
-	start, end := rt.getDstSection(entry.DstIP)
-	if start >= end {
+	// Hold back suppressed routes.
+	if rt.suppressRoute(&entry, time.Now()) {
+		return false, nil
+	}
+
+	return rt.insertRoute(entry, rp)
+}
+
+// insertRoute inserts the given route into the table.
+// The table must be locked.
+func (rt *RoutingTable) insertRoute(entry RoutingTableEntry, rp RoutablePrefix) (added bool, err error) { //nolint:unparam // Makes usage easier.
+	snap := rt.snapshot.Load()
+	key := makeTrieKey(entry.DstIP)
+
+	// Get routes to destination.
+	routes := snap.root.get(key)
+	if len(routes) == 0 {
 		// We don't have this destination yet.
+		// Gossip routes are limited per prefix, check the limit.
+		if entry.Source == RouteSourceGossip {
+			prefixCnt := snap.root.countPrefix(makeTrieKey(entry.RoutingPrefix.Addr()), entry.RoutingPrefix.Bits())
+			if prefixCnt > rp.EntriesPerPrefix*2 {
+				// We already have 2 times the entries we want for this prefix.
+				return false, nil
+			}
+		}
+
 		// Add it as a new destination.
-		return rt.addNewDestination(entry, rp)
+		rt.setRoutes(snap, key, []*RoutingTableEntry{&entry})
+		return true, nil
 	}
 
+	// Copy routes for changing them.
+	routes = slices.Clone(routes)
+
 	// Check if we have this exact route already.
-	for i := start; i < end; i++ {
-		if rt.entries[i].RouteEquals(&entry) {
+	for i, rte := range routes {
+		if rte.RouteEquals(&entry) {
 			// Replace entry.
-			rt.entries[i] = &entry
-			// Sort section.
-			slices.SortFunc[[]*RoutingTableEntry, *RoutingTableEntry](
-				rt.entries[start:end],
-				rt.stdSort,
-			)
-			// Return as added.
+			routes[i] = &entry
+			rt.setRoutes(snap, key, routes)
 			return true, nil
 		}
 	}
@@ -193,30 +237,16 @@ func (rt *RoutingTable) AddRoute(entry RoutingTableEntry) (added bool, err error
 	// We have a new route for a known destination.
 
 	// If we don't have 3 routes to this destination yet, add it.
-	if end-start < 3 || entry.Source == RouteSourcePeer {
-		// Get insert index.
-		insertIndex, _ := slices.BinarySearchFunc[[]*RoutingTableEntry, *RoutingTableEntry, *RoutingTableEntry](
-			rt.entries,
-			&entry,
-			rt.stdSort,
-		)
-		// Insert
-		rt.entries = slices.Insert[[]*RoutingTableEntry, *RoutingTableEntry](
-			rt.entries, insertIndex, &entry,
-		)
+	if len(routes) < 3 || entry.Source == RouteSourcePeer {
+		rt.setRoutes(snap, key, append(routes, &entry))
 		return true, nil
 	}
 
 	// Check if the entry is good enough to make it into the top 3.
-	if rt.stdSort(&entry, rt.entries[start+2]) < 0 {
+	if rt.stdSort(&entry, routes[2]) < 0 {
 		// Replace third entry.
-		rt.entries[start+2] = &entry
-		// Sort section.
-		slices.SortFunc[[]*RoutingTableEntry, *RoutingTableEntry](
-			rt.entries[start:end],
-			rt.stdSort,
-		)
-		// Return as added.
+		routes[2] = &entry
+		rt.setRoutes(snap, key, routes)
 		return true, nil
 	}
 
@@ -224,125 +254,107 @@ func (rt *RoutingTable) AddRoute(entry RoutingTableEntry) (added bool, err error
 	return false, nil
 }
 
-func (rt *RoutingTable) addNewDestination(entry RoutingTableEntry, rp RoutablePrefix) (added bool, err error) { //nolint:unparam // Makes usage easier.
-	// Gossip routes are limited per prefix, check the limit.
-	if entry.Source == RouteSourceGossip {
-		// Get prefix section.
-		start, end := rt.getPrefixSection(entry.RoutingPrefix)
-		if end-start > rp.EntriesPerPrefix*2 {
-			// We already have 2 times the entries we want for this prefix.
-			return false, nil
-		}
-	}
-
-	// If permitted to add route, go ahead.
-
-	// Get insert index.
-	insertIndex, _ := slices.BinarySearchFunc[[]*RoutingTableEntry, *RoutingTableEntry, *RoutingTableEntry](
-		rt.entries,
-		&entry,
-		rt.stdSort,
-	)
-	// Insert
-	rt.entries = slices.Insert[[]*RoutingTableEntry, *RoutingTableEntry](
-		rt.entries, insertIndex, &entry,
-	)
-	return true, nil
+// setRoutes sorts the given routes to a destination and publishes a new
+// snapshot with them. The table must be locked.
+func (rt *RoutingTable) setRoutes(snap *tableSnapshot, key trieKey, routes []*RoutingTableEntry) {
+	slices.SortFunc(routes, rt.stdSort)
+	rt.snapshot.Store(&tableSnapshot{
+		root:   snap.root.setRoutes(key, routes),
+		static: snap.static,
+	})
 }
 
-func (rt *RoutingTable) getDstSection(dst netip.Addr) (startIndex, endIndex int) {
-	// Find start index.
-	startIndex, _ = slices.BinarySearchFunc[[]*RoutingTableEntry, *RoutingTableEntry, *RoutingTableEntry](
-		rt.entries,
-		&RoutingTableEntry{
-			DstIP: dst,
-			Path: SwitchPath{
-				TotalDelay: 0, // Lower than possible normal values.
-				TotalHops:  0, // Lower than possible normal values.
-			},
-		},
-		rt.stdSort,
-	)
-
-	// Find end index.
-	endIndex, _ = slices.BinarySearchFunc[[]*RoutingTableEntry, *RoutingTableEntry, *RoutingTableEntry](
-		rt.entries,
-		&RoutingTableEntry{
-			DstIP: dst,
-			Path: SwitchPath{
-				TotalDelay: 65535, // Higher than possible normal values.
-				TotalHops:  255,   // Higher than possible normal values.
-			},
-		},
-		rt.stdSort,
-	)
-
-	return
+// filterRoutes publishes a new snapshot without the routes for which remove
+// returns true. The table must be locked.
+func (rt *RoutingTable) filterRoutes(remove func(rte *RoutingTableEntry) bool) {
+	snap := rt.snapshot.Load()
+	rt.snapshot.Store(&tableSnapshot{
+		root:   snap.root.filter(remove),
+		static: snap.static,
+	})
 }
 
-func (rt *RoutingTable) getPrefixSection(prefix netip.Prefix) (startIndex, endIndex int) {
-	// Find start index.
-	startIndex, _ = slices.BinarySearchFunc[[]*RoutingTableEntry, *RoutingTableEntry, *RoutingTableEntry](
-		rt.entries,
-		&RoutingTableEntry{
-			DstIP: prefix.Masked().Addr(),
-			Path: SwitchPath{
-				TotalDelay: 0, // Lower than possible normal values.
-				TotalHops:  0, // Lower than possible normal values.
-			},
-		},
-		rt.stdSort,
-	)
-
-	// Find end index.
-	endIndex, _ = slices.BinarySearchFunc[[]*RoutingTableEntry, *RoutingTableEntry, *RoutingTableEntry](
-		rt.entries,
-		&RoutingTableEntry{
-			DstIP: netipx.PrefixLastIP(prefix),
-			Path: SwitchPath{
-				TotalDelay: 65535, // Higher than possible normal values.
-				TotalHops:  255,   // Higher than possible normal values.
-			},
-		},
-		rt.stdSort,
-	)
-
-	return
+// entries returns all routes sorted for routing.
+func (rt *RoutingTable) entries() []*RoutingTableEntry {
+	snap := rt.snapshot.Load()
+	return snap.root.appendRoutes(make([]*RoutingTableEntry, 0, snap.root.size()))
 }
 
 // LookupNearest returns the best matching table entry for the given destination.
 func (rt *RoutingTable) LookupNearest(dst netip.Addr) (rte *RoutingTableEntry, isDestination bool) {
-	rt.lock.RLock()
-	defer rt.lock.RUnlock()
-
-	index, dstMatched := rt.findIndex(dst)
-	if index < 0 {
+	leaf, exact := rt.snapshot.Load().root.nearestLeaf(makeTrieKey(dst))
+	if leaf == nil {
 		return nil, false
 	}
-	rte = rt.entries[index]
-	return rte, dstMatched
+	return bestRoute(leaf.routes), exact
 }
 
 // LookupNearestRoute returns the best route for the given destination.
 func (rt *RoutingTable) LookupNearestRoute(dst netip.Addr) (rte *RoutingTableEntry, isDestination bool) {
-	rt.lock.RLock()
-	defer rt.lock.RUnlock()
+	return rt.snapshot.Load().lookupNearestRoute(dst)
+}
 
+// LookupNearestRoutes returns up to maxRoutes routes to the nearest router of
+// the given destination, best first.
+// If the nearest router is a peer or a static route applies, only that route
+// is returned.
+func (rt *RoutingTable) LookupNearestRoutes(dst netip.Addr, maxRoutes int) (routes []*RoutingTableEntry, isDestination bool) {
+	snap := rt.snapshot.Load()
+
+	// Find best route.
+	best, isDestination := snap.lookupNearestRoute(dst)
+	switch {
+	case best == nil:
+		return nil, false
+	case best.Source == RouteSourcePeer || best.Source == RouteSourceStatic || maxRoutes <= 1:
+		return []*RoutingTableEntry{best}, isDestination
+	}
+
+	// Add all routes to the same router.
+	routes = make([]*RoutingTableEntry, 0, maxRoutes)
+	routes = append(routes, best)
+	for _, rte := range snap.root.get(makeTrieKey(best.DstIP)) {
+		if len(routes) >= maxRoutes {
+			break
+		}
+		if rte != best && rte.Source != RouteSourcePeer {
+			routes = append(routes, rte)
+		}
+	}
+	return routes, isDestination
+}
+
+func (snap *tableSnapshot) lookupNearestRoute(dst netip.Addr) (rte *RoutingTableEntry, isDestination bool) {
 	// Find nearest router.
-	index, dstMatched := rt.findIndex(dst)
-	if index < 0 {
+	key := makeTrieKey(dst)
+	leaf, dstMatched := snap.root.nearestLeaf(key)
+
+	// Always reach direct peers directly.
+	if dstMatched {
+		if peer := bestRoute(leaf.routes); peer.Source == RouteSourcePeer {
+			return peer, true
+		}
+	}
+
+	// Static routes take precedence over learned routes.
+	if static := snap.lookupStaticRoute(dst); static != nil {
+		return static, static.DstIP == dst
+	}
+
+	if leaf == nil {
 		return nil, false
 	}
 	// Return immediately if matched directly or not a stub router.
-	if dstMatched || !rt.entries[index].Stub {
-		return rt.entries[index], dstMatched
+	rte = bestRoute(leaf.routes)
+	if dstMatched || !rte.Stub {
+		return rte, dstMatched
 	}
 
 	// We don't have a route to the destination.
 	// And the nearest router we found is a stub.
 	// Go looking for nearby routers that are not stubs.
 	var nearestNonStub *RoutingTableEntry
-	rt.iterateNearest(dst, index, func(rte *RoutingTableEntry, distance AddrDistance) (done bool) {
+	snap.root.iterateNearest(key, dst, func(rte *RoutingTableEntry, distance AddrDistance) (done bool) {
 		if !rte.Stub {
 			nearestNonStub = rte
 			return true
@@ -352,20 +364,33 @@ func (rt *RoutingTable) LookupNearestRoute(dst netip.Addr) (rte *RoutingTableEnt
 	return nearestNonStub, false
 }
 
+// bestRoute returns the best of the given routes to a destination.
+// Peer routes are always preferred.
+func bestRoute(routes []*RoutingTableEntry) *RoutingTableEntry {
+	for _, rte := range routes {
+		if rte.Source == RouteSourcePeer {
+			return rte
+		}
+	}
+	return routes[0]
+}
+
 // LookupPossiblePaths looks the best possible entries for the given destination.
 func (rt *RoutingTable) LookupPossiblePaths(dst netip.Addr, maxMatches int, maxDistance AddrDistance, distinctNextHop bool, avoid []netip.Addr) []*RoutingTableEntry {
-	rt.lock.RLock()
-	defer rt.lock.RUnlock()
+	snap := rt.snapshot.Load()
 
-	// Get index of best matching entry.
-	index, _ := rt.findIndex(dst)
-	if index < 0 {
-		return nil
+	// Prefer a matching static route.
+	possibleNextHops := make([]*RoutingTableEntry, 0, maxMatches)
+	if static := snap.lookupStaticRoute(dst); static != nil {
+		var done bool
+		possibleNextHops, done = addToPossiblePaths(possibleNextHops, static, maxMatches, distinctNextHop, avoid)
+		if done {
+			return possibleNextHops
+		}
 	}
 
 	// Iterate over nearest destinations and add possible paths.
-	possibleNextHops := make([]*RoutingTableEntry, 0, maxMatches)
-	rt.iterateNearest(dst, index, func(rte *RoutingTableEntry, distance AddrDistance) (done bool) {
+	snap.root.iterateNearest(makeTrieKey(dst), dst, func(rte *RoutingTableEntry, distance AddrDistance) (done bool) {
 		// Check if we have reached max distance.
 		if !maxDistance.IsZero() && maxDistance.Less(distance) {
 			return true
@@ -377,70 +402,6 @@ func (rt *RoutingTable) LookupPossiblePaths(dst netip.Addr, maxMatches int, maxD
 	return possibleNextHops
 }
 
-func (rt *RoutingTable) iterateNearest(dst netip.Addr, startIndex int, fn func(rte *RoutingTableEntry, distance AddrDistance) (done bool)) {
-	var (
-		nextNextIndex = startIndex + 1
-		nextEntry     *RoutingTableEntry
-		nextDistance  AddrDistance
-
-		prevNextIndex = startIndex - 1
-		prevEntry     *RoutingTableEntry
-		prevDistance  AddrDistance
-	)
-	for {
-		// Get next entries and distances.
-		if nextEntry == nil && nextNextIndex < len(rt.entries) {
-			nextEntry = rt.entries[nextNextIndex]
-			nextDistance = IPDistance(nextEntry.DstIP, dst)
-			nextNextIndex++
-		}
-		if prevEntry == nil && prevNextIndex >= 0 {
-			prevEntry = rt.entries[prevNextIndex]
-			prevDistance = IPDistance(prevEntry.DstIP, dst)
-			prevNextIndex--
-		}
-
-		// Check what we have and call function on next nearest entry.
-		switch {
-		case prevEntry == nil && nextEntry == nil:
-			// No new data, end search.
-			return
-
-		case nextEntry == nil:
-			// Next reached limit, process prev.
-			if fn(prevEntry, prevDistance) {
-				return
-			}
-			prevEntry = nil
-			prevDistance = AddrDistance{}
-
-		case prevEntry == nil:
-			// Prev reached limit, process next.
-			if fn(nextEntry, nextDistance) {
-				return
-			}
-			nextEntry = nil
-			nextDistance = AddrDistance{}
-
-		default:
-			// Add better entry, use prev in a draw.
-			if prevDistance.Compare(nextDistance) <= 0 {
-				if fn(prevEntry, prevDistance) {
-					return
-				}
-				prevEntry = nil
-				prevDistance = AddrDistance{}
-			} else {
-				if fn(nextEntry, nextDistance) {
-					return
-				}
-				nextEntry = nil
-				nextDistance = AddrDistance{}
-			}
-		}
-	}
-}
-
 func addToPossiblePaths(list []*RoutingTableEntry, add *RoutingTableEntry, maxMatches int, distinctNextHop bool, avoid []netip.Addr) (l []*RoutingTableEntry, done bool) {
 	// First, check if the entry should be avoided.
 	if len(add.Path.Hops) < 2 {
@@ -470,83 +431,26 @@ func addToPossiblePaths(list []*RoutingTableEntry, add *RoutingTableEntry, maxMa
 	return list, len(list) >= maxMatches
 }
 
-// findIndex looks up the given dst address in the routing table.
-// It always returns the address-nearest next hop, if the table is not empty.
-func (rt *RoutingTable) findIndex(dst netip.Addr) (index int, dstMatched bool) {
-	// Search for entry, get index where it is or should be.
-	index, dstMatched = slices.BinarySearchFunc[[]*RoutingTableEntry, *RoutingTableEntry, netip.Addr](
-		rt.entries,
-		dst,
-		func(rte *RoutingTableEntry, a netip.Addr) int {
-			// Compare IPs and return if not equal.
-			cmp := rte.DstIP.Compare(a)
-			if cmp != 0 {
-				return cmp
-			}
-
-			// Return exact match when entry is a peer.
-			if rte.Source == RouteSourcePeer {
-				return 0
-			}
-
-			// Otherwise, find the best route by moving to first entry.
-			// Routes to the same destination are ordered by best first.
-			return 1
-		},
-	)
-
-	// TODO: We might have multiple entries for the same dst ip but with different paths!
-
-	switch {
-	case dstMatched:
-		// Destination is a peer, return index as match.
-		return index, true
-
-	case index >= len(rt.entries):
-		// Index is after last entry, return last possible index.
-		// If the table is empty, this will return an index of -1.
-		return len(rt.entries) - 1, false
-
-	case rt.entries[index].DstIP == dst:
-		// If entry dst matches, return index as match.
-		return index, true
-
-	case index <= 0:
-		// Index is before or at first entry, return first entry.
-		return 0, false
-
-	default:
-		// The returned index is where the entry should be. This means that between
-		// two IPs, the index will always be at the next IP, not the previous. In
-		// case of routing, this means the next IP might be in a different address
-		// scope, while the previous might fit better. The best and easiest way is
-		// to choose the IP that is closer in regards to the IP distance.
-		prevEntry := rt.entries[index-1]
-		nextEntry := rt.entries[index]
-		prevDistance := IPDistance(prevEntry.DstIP, dst)
-		nextDistance := IPDistance(nextEntry.DstIP, dst)
-		if prevDistance.Less(nextDistance) {
-			return index - 1, false
-		}
-		return index, false
-	}
-}
-
 // RemoveNextHop removes all routes with the given next hop IP from the routing table.
 func (rt *RoutingTable) RemoveNextHop(ip netip.Addr) (removed int) {
 	rt.lock.Lock()
 	defer rt.lock.Unlock()
 
-	rt.entries = slices.DeleteFunc[[]*RoutingTableEntry, *RoutingTableEntry](
-		rt.entries,
-		func(rte *RoutingTableEntry) bool {
-			if rte.NextHop == ip {
-				removed++
-				return true
-			}
-			return false
-		},
-	)
+	now := time.Now()
+	rt.filterRoutes(func(rte *RoutingTableEntry) bool {
+		if rte.NextHop == ip {
+			rt.addFlapPenalty(rte, now)
+			removed++
+			return true
+		}
+		return false
+	})
+	rt.withdrawSuppressed(now, func(rte *RoutingTableEntry) bool {
+		return rte.NextHop == ip
+	})
+	rt.removeStaticRoutes(func(rte *RoutingTableEntry) bool {
+		return rte.NextHop == ip
+	})
 
 	return
 }
@@ -557,123 +461,145 @@ func (rt *RoutingTable) RemoveDisconnected(router netip.Addr, disconnected []net
 	rt.lock.Lock()
 	defer rt.lock.Unlock()
 
-	rt.entries = slices.DeleteFunc[[]*RoutingTableEntry, *RoutingTableEntry](
-		rt.entries,
-		func(rte *RoutingTableEntry) bool {
-			// Remove any route with the router in it.
-			if len(disconnected) == 0 {
-				switch {
-				case rte.DstIP == router:
-					removed++
-					return true
-				case rte.NextHop == router:
-					removed++
-					return true
-				default:
-					for _, hop := range rte.Path.Hops {
-						if hop.Router == router {
-							removed++
-							return true
-						}
+	isDisconnected := func(rte *RoutingTableEntry) bool {
+		// Remove any route with the router in it.
+		if len(disconnected) == 0 {
+			switch {
+			case rte.DstIP == router:
+				return true
+			case rte.NextHop == router:
+				return true
+			default:
+				for _, hop := range rte.Path.Hops {
+					if hop.Router == router {
+						return true
 					}
-					return false
 				}
+				return false
 			}
+		}
+
+		// Remove specific links only.
+		for i, hop := range rte.Path.Hops {
+			if hop.Router == router {
+				// Found route that includes the router.
 
-			// Remove specific links only.
-			for i, hop := range rte.Path.Hops {
-				if hop.Router == router {
-					// Found route that includes the router.
-
-					// Check if the previous hop in the path is one of the peerings.
-					if i > 0 {
-						for _, peer := range disconnected {
-							if rte.Path.Hops[i-1].Router == peer {
-								removed++
-								return true
-							}
+				// Check if the previous hop in the path is one of the peerings.
+				if i > 0 {
+					for _, peer := range disconnected {
+						if rte.Path.Hops[i-1].Router == peer {
+							return true
 						}
 					}
+				}
 
-					// Check if the next hop in the path is one of the peerings.
-					if i < len(rte.Path.Hops)-1 {
-						for _, peer := range disconnected {
-							if rte.Path.Hops[i+1].Router == peer {
-								removed++
-								return true
-							}
+				// Check if the next hop in the path is one of the peerings.
+				if i < len(rte.Path.Hops)-1 {
+					for _, peer := range disconnected {
+						if rte.Path.Hops[i+1].Router == peer {
+							return true
 						}
 					}
-
-					// Router was in route, but not the disconnected peer.
-					// Router cannot be in route twice, stop here.
-					return false
 				}
+
+				// Router was in route, but not the disconnected peer.
+				// Router cannot be in route twice, stop here.
+				return false
 			}
+		}
 
-			return false
-		},
-	)
+		return false
+	}
+
+	now := time.Now()
+	rt.filterRoutes(func(rte *RoutingTableEntry) bool {
+		if isDisconnected(rte) {
+			rt.addFlapPenalty(rte, now)
+			removed++
+			return true
+		}
+		return false
+	})
+	rt.withdrawSuppressed(now, isDisconnected)
 
 	return removed
 }
 
 // Clean cleans the routing table from unneeded entries:
+// - Reinstates suppressed routes that may be used again.
 // - Removes expired routes.
 // - Removes excess routes of identical routing prefixes.
 func (rt *RoutingTable) Clean() {
 	rt.lock.Lock()
 	defer rt.lock.Unlock()
 
-	// Removes expired (non-peer) routes.
+	// Reinstate suppressed routes that may be used again.
 	now := time.Now()
-	rt.entries = slices.DeleteFunc[[]*RoutingTableEntry, *RoutingTableEntry](
-		rt.entries,
-		func(rte *RoutingTableEntry) bool {
-			return rte.Source != RouteSourcePeer && rte.Expires.Before(now)
-		},
-	)
+	rt.cleanDamping(now)
+
+	// Removes expired (non-peer) routes.
+	rt.filterRoutes(func(rte *RoutingTableEntry) bool {
+		return rte.Source != RouteSourcePeer && rte.Expires.Before(now)
+	})
 
 	// Sort into buckets for cleaning.
-	rt.sortForCleaning()
-	defer rt.sortForRouting()
+	entries := rt.entries()
+	rt.sortForCleaning(entries)
 
-	// Go through the buckets and remove excess entries.
+	// Go through the buckets and find excess entries.
 	var (
 		currentPrefix    netip.Prefix
 		currentPrefixMax int
 		seenInPrefix     int
+		excess           = make(map[*RoutingTableEntry]struct{})
 	)
-	rt.entries = slices.DeleteFunc[[]*RoutingTableEntry, *RoutingTableEntry](
-		rt.entries,
-		func(rte *RoutingTableEntry) bool {
-			// Count entries in prefix.
-			if currentPrefix != rte.RoutingPrefix {
-				currentPrefix = rte.RoutingPrefix
-				rp, ok := rt.getRoutablePrefixConfig(rte.RoutingPrefix.Addr())
-				if ok {
-					currentPrefixMax = rp.EntriesPerPrefix
-				} else {
-					currentPrefixMax = 0
-				}
-				seenInPrefix = 0
+	for _, rte := range entries {
+		// Count entries in prefix.
+		if currentPrefix != rte.RoutingPrefix {
+			currentPrefix = rte.RoutingPrefix
+			rp, ok := rt.getRoutablePrefixConfig(rte.RoutingPrefix.Addr())
+			if ok {
+				currentPrefixMax = rp.EntriesPerPrefix
+			} else {
+				currentPrefixMax = 0
 			}
-			seenInPrefix++
+			seenInPrefix = 0
+		}
+		seenInPrefix++
 
-			// If we already have enough, remove any excess routes learned from gossip. Discovered routes must expire.
-			if seenInPrefix > currentPrefixMax {
-				return rte.Source == RouteSourceGossip
-			}
+		// If we already have enough, remove any excess routes learned from gossip. Discovered routes must expire.
+		if seenInPrefix > currentPrefixMax && rte.Source == RouteSourceGossip {
+			excess[rte] = struct{}{}
+		}
+	}
 
-			return false
-		},
-	)
+	// Remove excess entries.
+	if len(excess) > 0 {
+		rt.filterRoutes(func(rte *RoutingTableEntry) bool {
+			_, ok := excess[rte]
+			return ok
+		})
+	}
+}
+
+// LearnedRoutes returns copies of all routes learned from gossip or by
+// discovery, for example in order to persist them.
+func (rt *RoutingTable) LearnedRoutes() []RoutingTableEntry {
+	entries := rt.entries()
+	routes := make([]RoutingTableEntry, 0, len(entries))
+	for _, rte := range entries {
+		switch rte.Source { //nolint:exhaustive
+		case RouteSourceGossip, RouteSourceDiscovered:
+			routes = append(routes, *rte)
+		}
+	}
+	return routes
 }
 
-func (rt *RoutingTable) sortForCleaning() {
+func (rt *RoutingTable) sortForCleaning(entries []*RoutingTableEntry) {
 	// Sort all routes into their bucket.
 	slices.SortFunc[[]*RoutingTableEntry, *RoutingTableEntry](
-		rt.entries,
+		entries,
 		func(a, b *RoutingTableEntry) int {
 			switch {
 			case a.RoutingPrefix != b.RoutingPrefix:
@@ -759,13 +685,6 @@ func (a *RoutingTableEntry) RouteEquals(b *RoutingTableEntry) bool {
 	return true
 }
 
-func (rt *RoutingTable) sortForRouting() {
-	slices.SortFunc[[]*RoutingTableEntry, *RoutingTableEntry](
-		rt.entries,
-		rt.stdSort,
-	)
-}
-
 // Format formats the routing table for printing it.
 // Warning: Acquires a write lock!
 func (rt *RoutingTable) Format() string {
@@ -775,8 +694,10 @@ func (rt *RoutingTable) Format() string {
 	var (
 		b        = &strings.Builder{}
 		previous *RoutingTableEntry
+		now      = time.Now()
+		snap     = rt.snapshot.Load()
 	)
-	for i, rte := range rt.entries {
+	for i, rte := range snap.root.appendRoutes(nil) {
 		if previous == nil || rte.RoutingPrefix != previous.RoutingPrefix {
 			previous = rte
 			fmt.Fprintln(b, formatPrefix(rte.RoutingPrefix))
@@ -790,6 +711,9 @@ func (rt *RoutingTable) Format() string {
 		if rte.Stub {
 			stub = " stub"
 		}
+		if penalty := rt.routePenalty(rte, now); penalty > 0 {
+			stub += fmt.Sprintf(" penalty=%d", penalty)
+		}
 
 		switch {
 		case rte.Source == RouteSourcePeer:
@@ -811,6 +735,45 @@ func (rt *RoutingTable) Format() string {
 		}
 	}
 
+	// Add static routes.
+	if len(snap.static) > 0 {
+		fmt.Fprintln(b, "static")
+	}
+	for i, rte := range snap.static {
+		fmt.Fprintf(b, "  %d: %s %s dst=%s hops=%d lat=%dms next=%x via=%s\n", i+1,
+			rte.Source,
+			rte.RoutingPrefix,
+			rte.DstIP.StringExpanded(),
+			rte.Path.TotalHops,
+			rte.Path.TotalDelay,
+			rte.Path.Hops[0].ForwardLabel,
+			formatRelays(rte.Path.Hops),
+		)
+	}
+
+	// Add suppressed routes.
+	suppressed := rt.suppressedRoutes(now)
+	if len(suppressed) > 0 {
+		fmt.Fprintln(b, "suppressed (flapping)")
+	}
+	for i, sr := range suppressed {
+		switch {
+		case sr.Entry == nil:
+			fmt.Fprintf(b, "  %d: withdrawn %s next=%s penalty=%d\n", i+1,
+				sr.DstIP.StringExpanded(), sr.NextHop, sr.Penalty,
+			)
+		default:
+			fmt.Fprintf(b, "  %d: %s %s hops=%d lat=%dms next=%s penalty=%d\n", i+1,
+				sr.Entry.Source,
+				sr.DstIP.StringExpanded(),
+				sr.Entry.Path.TotalHops,
+				sr.Entry.Path.TotalDelay,
+				sr.NextHop,
+				sr.Penalty,
+			)
+		}
+	}
+
 	return b.String()
 }
 
@@ -888,6 +851,8 @@ func (s RouteSource) String() string {
 		return "peer"
 	case RouteSourceDiscovered:
 		return "discovered"
+	case RouteSourceStatic:
+		return "static"
 	case RouteSourceUnknown:
 		fallthrough
 	default:
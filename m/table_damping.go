@@ -0,0 +1,249 @@
+package m
+
+import (
+	"math"
+	"net/netip"
+	"slices"
+	"time"
+)
+
+// Route flap damping.
+// Every time a route is withdrawn, a penalty is added to it. The penalty
+// decays exponentially over time. When the penalty reaches the suppress
+// threshold, the route is suppressed until the penalty decays below the reuse
+// threshold. This prevents flapping routes from churning the routing tables
+// of the whole network.
+// Only learned routes are damped. Routes to direct peers follow the link
+// layer and static routes are configured by the user.
+
+// Route flap damping defaults.
+const (
+	// RouteFlapPenalty is the penalty added to a route when it is withdrawn.
+	RouteFlapPenalty = 1000
+
+	// DefaultRouteSuppressThreshold is the default penalty at which a route is
+	// suppressed.
+	DefaultRouteSuppressThreshold = 2000
+	// DefaultRouteReuseThreshold is the default penalty under which a
+	// suppressed route is used again.
+	DefaultRouteReuseThreshold = 750
+	// DefaultRouteDampingHalfLife is the default duration in which a penalty
+	// is halved.
+	DefaultRouteDampingHalfLife = 15 * time.Minute
+
+	// routeDampingMaxSuppress defines how long a route may be suppressed at
+	// most after it stopped flapping. The penalty is capped accordingly.
+	routeDampingMaxSuppress = time.Hour
+)
+
+// RouteDampingConfig configures route flap damping.
+type RouteDampingConfig struct {
+	// Disable disables route flap damping.
+	Disable bool
+
+	// SuppressThreshold is the penalty at which a route is suppressed.
+	SuppressThreshold int
+	// ReuseThreshold is the penalty under which a suppressed route is used
+	// again. Must be lower than the suppress threshold.
+	ReuseThreshold int
+	// HalfLife is the duration in which the penalty is halved.
+	HalfLife time.Duration
+}
+
+func (cfg *RouteDampingConfig) applyDefaults() {
+	if cfg.SuppressThreshold <= 0 {
+		cfg.SuppressThreshold = DefaultRouteSuppressThreshold
+	}
+	if cfg.ReuseThreshold <= 0 || cfg.ReuseThreshold >= cfg.SuppressThreshold {
+		cfg.ReuseThreshold = min(DefaultRouteReuseThreshold, cfg.SuppressThreshold/2)
+	}
+	if cfg.HalfLife <= 0 {
+		cfg.HalfLife = DefaultRouteDampingHalfLife
+	}
+}
+
+// maxPenalty returns the maximum penalty of a route.
+func (cfg *RouteDampingConfig) maxPenalty() float64 {
+	return float64(cfg.ReuseThreshold) * math.Exp2(routeDampingMaxSuppress.Seconds()/cfg.HalfLife.Seconds())
+}
+
+// routeDampingKey identifies a route for damping.
+type routeDampingKey struct {
+	dst     netip.Addr
+	nextHop netip.Addr
+}
+
+// routeDampingState holds the damping state of a route.
+type routeDampingState struct {
+	penalty float64
+	updated time.Time
+
+	// suppressed signifies that the route is suppressed.
+	suppressed bool
+	// entry holds the latest entry of a suppressed route.
+	entry *RoutingTableEntry
+}
+
+// SuppressedRoute is a route that is suppressed because it flapped.
+type SuppressedRoute struct {
+	DstIP   netip.Addr
+	NextHop netip.Addr
+	Penalty int
+
+	// Entry is the latest entry of the route, if it is currently announced.
+	Entry *RoutingTableEntry
+}
+
+// dampable returns whether the route is subject to route flap damping.
+func (rte *RoutingTableEntry) dampable() bool {
+	return rte.Source != RouteSourcePeer && rte.Source != RouteSourceStatic
+}
+
+func dampingKeyFor(rte *RoutingTableEntry) routeDampingKey {
+	return routeDampingKey{
+		dst:     rte.DstIP,
+		nextHop: rte.NextHop,
+	}
+}
+
+// decay decays the penalty to the given time and returns it.
+func (ds *routeDampingState) decay(cfg *RouteDampingConfig, now time.Time) float64 {
+	if elapsed := now.Sub(ds.updated); elapsed > 0 {
+		ds.penalty *= math.Exp2(-elapsed.Seconds() / cfg.HalfLife.Seconds())
+		ds.updated = now
+	}
+	return ds.penalty
+}
+
+// addFlapPenalty adds the flap penalty to the given route.
+// The table must be locked.
+func (rt *RoutingTable) addFlapPenalty(rte *RoutingTableEntry, now time.Time) {
+	if rt.cfg.Damping.Disable || !rte.dampable() {
+		return
+	}
+
+	// Get or create damping state.
+	key := dampingKeyFor(rte)
+	ds, ok := rt.damping[key]
+	if !ok {
+		ds = &routeDampingState{updated: now}
+		rt.damping[key] = ds
+	}
+
+	// Add penalty and check if route must be suppressed.
+	ds.penalty = min(ds.decay(&rt.cfg.Damping, now)+RouteFlapPenalty, rt.cfg.Damping.maxPenalty())
+	if ds.penalty >= float64(rt.cfg.Damping.SuppressThreshold) {
+		ds.suppressed = true
+	}
+}
+
+// suppressRoute checks if the given route is suppressed and holds it back if
+// it is. The table must be locked.
+func (rt *RoutingTable) suppressRoute(rte *RoutingTableEntry, now time.Time) (suppressed bool) {
+	if !rte.dampable() {
+		return false
+	}
+
+	ds, ok := rt.damping[dampingKeyFor(rte)]
+	if !ok || !ds.suppressed {
+		return false
+	}
+
+	// Check if the route may be used again.
+	if ds.decay(&rt.cfg.Damping, now) < float64(rt.cfg.Damping.ReuseThreshold) {
+		ds.suppressed = false
+		ds.entry = nil
+		return false
+	}
+
+	// Hold back latest entry.
+	ds.entry = rte
+	return true
+}
+
+// withdrawSuppressed removes held back entries of suppressed routes that match
+// the given function. The table must be locked.
+func (rt *RoutingTable) withdrawSuppressed(now time.Time, fn func(rte *RoutingTableEntry) bool) {
+	for _, ds := range rt.damping {
+		if ds.entry != nil && fn(ds.entry) {
+			ds.entry = nil
+			ds.penalty = min(ds.decay(&rt.cfg.Damping, now)+RouteFlapPenalty, rt.cfg.Damping.maxPenalty())
+		}
+	}
+}
+
+// cleanDamping reinstates suppressed routes that may be used again and
+// removes damping state that is not needed anymore. The table must be locked
+// and sorted for routing.
+func (rt *RoutingTable) cleanDamping(now time.Time) {
+	forgetThreshold := float64(rt.cfg.Damping.ReuseThreshold) / 2
+	for key, ds := range rt.damping {
+		penalty := ds.decay(&rt.cfg.Damping, now)
+
+		// Drop expired entries of suppressed routes.
+		if ds.entry != nil && ds.entry.Source != RouteSourcePeer && ds.entry.Expires.Before(now) {
+			ds.entry = nil
+		}
+
+		// Reinstate routes that may be used again.
+		if ds.suppressed && penalty < float64(rt.cfg.Damping.ReuseThreshold) {
+			ds.suppressed = false
+			if ds.entry != nil {
+				if rp, ok := rt.getRoutablePrefixConfig(ds.entry.DstIP); ok {
+					_, _ = rt.insertRoute(*ds.entry, rp)
+				}
+				ds.entry = nil
+			}
+		}
+
+		// Forget routes that have calmed down.
+		if !ds.suppressed && penalty < forgetThreshold {
+			delete(rt.damping, key)
+		}
+	}
+}
+
+// RoutePenalty returns the current flap penalty of the given route.
+func (rt *RoutingTable) RoutePenalty(rte *RoutingTableEntry) int {
+	rt.lock.Lock()
+	defer rt.lock.Unlock()
+
+	return rt.routePenalty(rte, time.Now())
+}
+
+func (rt *RoutingTable) routePenalty(rte *RoutingTableEntry, now time.Time) int {
+	ds, ok := rt.damping[dampingKeyFor(rte)]
+	if !ok {
+		return 0
+	}
+	return int(ds.decay(&rt.cfg.Damping, now))
+}
+
+// SuppressedRoutes returns all currently suppressed routes.
+func (rt *RoutingTable) SuppressedRoutes() []SuppressedRoute {
+	rt.lock.Lock()
+	defer rt.lock.Unlock()
+
+	return rt.suppressedRoutes(time.Now())
+}
+
+func (rt *RoutingTable) suppressedRoutes(now time.Time) []SuppressedRoute {
+	var suppressed []SuppressedRoute
+	for key, ds := range rt.damping {
+		if ds.suppressed {
+			suppressed = append(suppressed, SuppressedRoute{
+				DstIP:   key.dst,
+				NextHop: key.nextHop,
+				Penalty: int(ds.decay(&rt.cfg.Damping, now)),
+				Entry:   ds.entry,
+			})
+		}
+	}
+	slices.SortFunc(suppressed, func(a, b SuppressedRoute) int {
+		if cmp := a.DstIP.Compare(b.DstIP); cmp != 0 {
+			return cmp
+		}
+		return a.NextHop.Compare(b.NextHop)
+	})
+	return suppressed
+}
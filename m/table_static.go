@@ -0,0 +1,110 @@
+package m
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"time"
+)
+
+// Static routes.
+// Static routes are configured by the user and pin traffic for a prefix to a
+// peer or an explicit switch path. They are held separately from the learned
+// routes, never expire and take precedence over all learned routes, except
+// when the destination is a direct peer. They are removed when the link to
+// their next hop is removed and must be added again when it comes back.
+
+// addStaticRoute adds or replaces the given static route.
+// The routing prefix of the entry defines which destinations the route
+// applies to. If not set, the route applies to the dst IP only.
+func (rt *RoutingTable) addStaticRoute(entry RoutingTableEntry) (added bool, err error) {
+	// Apply defaults.
+	if !entry.RoutingPrefix.IsValid() && entry.DstIP.IsValid() {
+		entry.RoutingPrefix = netip.PrefixFrom(entry.DstIP, entry.DstIP.BitLen())
+	}
+	entry.RoutingPrefix = entry.RoutingPrefix.Masked()
+	entry.Expires = time.Time{}
+
+	// Check if entry has all required fields.
+	switch {
+	case !entry.DstIP.IsValid():
+		return false, errors.New("dst ip is invalid/missing")
+	case !entry.NextHop.IsValid():
+		return false, errors.New("next hop is invalid/missing")
+	case !entry.RoutingPrefix.IsValid():
+		return false, errors.New("routing prefix is invalid/missing")
+	case len(entry.Path.Hops) < 2:
+		return false, errors.New("missing or incomplete switch path")
+	case entry.Path.Hops[1].Router != entry.NextHop:
+		return false, errors.New("switch path does not start with next hop")
+	}
+
+	// Finish processing the switch path.
+	err = entry.Path.BuildBlocks()
+	if err != nil {
+		return false, fmt.Errorf("failed to build switch blocks: %w", err)
+	}
+	entry.Path.CalculateTotals()
+
+	rt.lock.Lock()
+	defer rt.lock.Unlock()
+
+	// Replace existing route with same prefix and next hop.
+	snap := rt.snapshot.Load()
+	static := slices.Clone(snap.static)
+	index := slices.IndexFunc(static, func(rte *RoutingTableEntry) bool {
+		return rte.RoutingPrefix == entry.RoutingPrefix && rte.NextHop == entry.NextHop
+	})
+	if index >= 0 {
+		static[index] = &entry
+	} else {
+		static = append(static, &entry)
+	}
+
+	// Sort most specific and then best first.
+	slices.SortStableFunc(static, func(a, b *RoutingTableEntry) int {
+		switch {
+		case a.RoutingPrefix.Bits() != b.RoutingPrefix.Bits():
+			return b.RoutingPrefix.Bits() - a.RoutingPrefix.Bits()
+		case a.Path.TotalHops != b.Path.TotalHops:
+			return int(a.Path.TotalHops) - int(b.Path.TotalHops)
+		default:
+			return int(a.Path.TotalDelay) - int(b.Path.TotalDelay)
+		}
+	})
+
+	rt.snapshot.Store(&tableSnapshot{
+		root:   snap.root,
+		static: static,
+	})
+	return true, nil
+}
+
+// removeStaticRoutes removes the static routes for which remove returns true.
+// The table must be locked.
+func (rt *RoutingTable) removeStaticRoutes(remove func(rte *RoutingTableEntry) bool) {
+	snap := rt.snapshot.Load()
+	if !slices.ContainsFunc(snap.static, remove) {
+		return
+	}
+	rt.snapshot.Store(&tableSnapshot{
+		root:   snap.root,
+		static: slices.DeleteFunc(slices.Clone(snap.static), remove),
+	})
+}
+
+// lookupStaticRoute returns the best static route for the given destination.
+func (snap *tableSnapshot) lookupStaticRoute(dst netip.Addr) *RoutingTableEntry {
+	for _, rte := range snap.static {
+		if rte.RoutingPrefix.Contains(dst) {
+			return rte
+		}
+	}
+	return nil
+}
+
+// StaticRoutes returns all static routes, most specific first.
+func (rt *RoutingTable) StaticRoutes() []*RoutingTableEntry {
+	return slices.Clone(rt.snapshot.Load().static)
+}
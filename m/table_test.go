@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"net/netip"
 	"slices"
+	"sync"
 	"testing"
 	"time"
 
@@ -78,7 +79,7 @@ func TestTable(t *testing.T) { //nolint:maintidx
 		}
 
 		// Check if tables is sorted.
-		if !slices.IsSortedFunc[[]*RoutingTableEntry, *RoutingTableEntry](tbl.entries, tbl.stdSort) {
+		if !slices.IsSortedFunc[[]*RoutingTableEntry, *RoutingTableEntry](tbl.entries(), tbl.stdSort) {
 			t.Fatal("table is not sorted after adding peer entry")
 		}
 
@@ -99,6 +100,10 @@ func TestTable(t *testing.T) { //nolint:maintidx
 	}
 
 	t.Logf("adding gossip entries...")
+	// Exclude the prefix of the peers, as their entries count towards the
+	// entries per prefix limit.
+	myRoutingPrefix, _ := myIP.Prefix(RegionPrefixBits)
+	prefixes[myRoutingPrefix.String()] = struct{}{}
 	for range addRandomGossipPrefixes {
 		var prefix netip.Prefix
 		for {
@@ -155,7 +160,7 @@ func TestTable(t *testing.T) { //nolint:maintidx
 			}
 
 			// Check if tables is sorted.
-			if !slices.IsSortedFunc[[]*RoutingTableEntry, *RoutingTableEntry](tbl.entries, tbl.stdSort) {
+			if !slices.IsSortedFunc[[]*RoutingTableEntry, *RoutingTableEntry](tbl.entries(), tbl.stdSort) {
 				t.Fatal("table is not sorted after adding gossip entry")
 			}
 
@@ -200,26 +205,26 @@ func TestTable(t *testing.T) { //nolint:maintidx
 
 	// Remove next hop and check size afterwards.
 	tbl.RemoveNextHop(peers[0])
-	t.Logf("table size after removing one next hop: %d", len(tbl.entries))
+	t.Logf("table size after removing one next hop: %d", len(tbl.entries()))
 	switch {
-	case len(tbl.entries) > expectedSizeAfterRemovingNextHop:
-		assert.Equal(t, expectedSizeAfterRemovingNextHop, len(tbl.entries), "unexpected table size after removing hop")
-	case len(tbl.entries) < expectedSizeAfterRemovingNextHop*9/10:
-		assert.Equal(t, expectedSizeAfterRemovingNextHop, len(tbl.entries), "unexpected table size after removing hop")
+	case len(tbl.entries()) > expectedSizeAfterRemovingNextHop:
+		assert.Equal(t, expectedSizeAfterRemovingNextHop, len(tbl.entries()), "unexpected table size after removing hop")
+	case len(tbl.entries()) < expectedSizeAfterRemovingNextHop*9/10:
+		assert.Equal(t, expectedSizeAfterRemovingNextHop, len(tbl.entries()), "unexpected table size after removing hop")
 	}
 
 	// Clean and check size afterwards.
 	tbl.Clean()
-	t.Logf("table size after clean: %d", len(tbl.entries))
+	t.Logf("table size after clean: %d", len(tbl.entries()))
 
 	// DEBUG:
 	// fmt.Println(tbl.Format())
 
 	switch {
-	case len(tbl.entries) > expectedSizeAfterClean:
-		assert.Equal(t, expectedSizeAfterClean, len(tbl.entries), "unexpected table size after cleaning")
-	case len(tbl.entries) < expectedSizeAfterClean*8/10:
-		assert.Equal(t, expectedSizeAfterClean, len(tbl.entries), "unexpected table size after cleaning")
+	case len(tbl.entries()) > expectedSizeAfterClean:
+		assert.Equal(t, expectedSizeAfterClean, len(tbl.entries()), "unexpected table size after cleaning")
+	case len(tbl.entries()) < expectedSizeAfterClean*8/10:
+		assert.Equal(t, expectedSizeAfterClean, len(tbl.entries()), "unexpected table size after cleaning")
 	}
 
 	// Randomly remove routes.
@@ -235,6 +240,295 @@ func TestTable(t *testing.T) { //nolint:maintidx
 	}
 }
 
+func TestLookupNearestRoutes(t *testing.T) {
+	t.Parallel()
+
+	tbl := NewRoutingTable(RoutingTableConfig{
+		RoutablePrefixes: []RoutablePrefix{{
+			BasePrefix:       RoutingAddressPrefix,
+			RoutingBits:      RegionPrefixBits,
+			EntryTTL:         3 * time.Hour,
+			EntriesPerPrefix: 5,
+		}},
+		RouterIP: myIP,
+	})
+
+	// Add routes to the same destination via different next hops.
+	dst := makeRandomAddress(myPrefix)
+	for range 5 {
+		// Build path: own router, next hop, destination.
+		nextHop := makeRandomAddress(myPrefix)
+		path := makeRandomSwitchPath(myIP, 2, 2)
+		path.Hops[1].Router = nextHop
+		path.Hops[2].Router = dst
+		_, err := tbl.AddRoute(RoutingTableEntry{
+			DstIP:   dst,
+			NextHop: nextHop,
+			Path:    path,
+			Source:  RouteSourceGossip,
+			Expires: time.Now().Add(time.Hour),
+		})
+		assert.NoError(t, err, "adding gossip entry should succeed")
+	}
+
+	// Check multiple routes.
+	routes, isDestination := tbl.LookupNearestRoutes(dst, 3)
+	assert.True(t, isDestination, "lookup should match destination")
+	assert.Len(t, routes, 3, "should return the top three routes")
+	best, _ := tbl.LookupNearestRoute(dst)
+	assert.Equal(t, best, routes[0], "first route should be the best route")
+	for _, rte := range routes {
+		assert.Equal(t, dst, rte.DstIP, "routes should lead to the destination")
+	}
+	routes, _ = tbl.LookupNearestRoutes(dst, 1)
+	assert.Len(t, routes, 1, "should respect max routes")
+
+	// Check that peers are only reached directly.
+	_, err := tbl.AddRoute(RoutingTableEntry{
+		DstIP:   dst,
+		NextHop: dst,
+		Path:    makeRandomSwitchPath(dst, 0, 0),
+		Source:  RouteSourcePeer,
+	})
+	assert.NoError(t, err, "adding peer entry should succeed")
+	routes, _ = tbl.LookupNearestRoutes(dst, 3)
+	assert.Len(t, routes, 1, "should only return the peer route")
+	assert.Equal(t, RouteSourcePeer, routes[0].Source, "should return the peer route")
+}
+
+func TestRouteDamping(t *testing.T) {
+	t.Parallel()
+
+	tbl := NewRoutingTable(RoutingTableConfig{
+		RoutablePrefixes: []RoutablePrefix{{
+			BasePrefix:       RoutingAddressPrefix,
+			RoutingBits:      RegionPrefixBits,
+			EntryTTL:         3 * time.Hour,
+			EntriesPerPrefix: 5,
+		}},
+		RouterIP: myIP,
+	})
+	dst := makeRandomAddress(myPrefix)
+	path := makeRandomSwitchPath(myIP, 2, 2)
+	path.Hops[2].Router = dst
+	peer := path.Hops[1].Router
+	addRoute := func() bool {
+		t.Helper()
+		added, err := tbl.AddRoute(RoutingTableEntry{
+			DstIP:   dst,
+			NextHop: peer,
+			Path:    path,
+			Source:  RouteSourceGossip,
+			Expires: time.Now().Add(time.Hour),
+		})
+		assert.NoError(t, err, "adding gossip entry should succeed")
+		return added
+	}
+
+	// First flaps are tolerated.
+	assert.True(t, addRoute(), "route should be added")
+	for range 2 {
+		assert.Equal(t, 1, tbl.RemoveNextHop(peer), "route should be removed")
+		assert.True(t, addRoute(), "route should be added again after a flap")
+	}
+
+	// Further flaps suppress the route.
+	assert.Equal(t, 1, tbl.RemoveNextHop(peer), "route should be removed")
+	assert.False(t, addRoute(), "flapping route should be suppressed")
+	rte, _ := tbl.LookupNearestRoute(dst)
+	assert.Nil(t, rte, "suppressed route must not be used")
+	suppressed := tbl.SuppressedRoutes()
+	if assert.Len(t, suppressed, 1, "suppressed route should be listed") {
+		assert.Equal(t, dst, suppressed[0].DstIP)
+		assert.NotNil(t, suppressed[0].Entry, "latest entry should be held back")
+		assert.GreaterOrEqual(t, suppressed[0].Penalty, DefaultRouteSuppressThreshold)
+	}
+	assert.Contains(t, tbl.Format(), "suppressed", "suppressed route should be shown")
+
+	// Cleaning keeps the route suppressed until the penalty decays.
+	tbl.Clean()
+	rte, _ = tbl.LookupNearestRoute(dst)
+	assert.Nil(t, rte, "route must stay suppressed")
+
+	// Simulate passing of time and check if the route is reinstated.
+	tbl.lock.Lock()
+	for _, ds := range tbl.damping {
+		ds.updated = ds.updated.Add(-5 * DefaultRouteDampingHalfLife / 2)
+	}
+	tbl.lock.Unlock()
+	tbl.Clean()
+	rte, isDestination := tbl.LookupNearestRoute(dst)
+	assert.True(t, isDestination, "route should be reinstated")
+	assert.NotNil(t, rte, "route should be reinstated")
+	assert.Empty(t, tbl.SuppressedRoutes(), "no routes should be suppressed anymore")
+	assert.Positive(t, tbl.RoutePenalty(rte), "penalty should still be tracked")
+}
+
+func TestRouteDampingExemptsPeers(t *testing.T) {
+	t.Parallel()
+
+	tbl := NewRoutingTable(RoutingTableConfig{
+		RoutablePrefixes: []RoutablePrefix{{
+			BasePrefix:       RoutingAddressPrefix,
+			RoutingBits:      RegionPrefixBits,
+			EntryTTL:         3 * time.Hour,
+			EntriesPerPrefix: 5,
+		}},
+		RouterIP: myIP,
+	})
+
+	// A peer that reconnects repeatedly stays routable.
+	peer := makeRandomAddress(myPrefix)
+	for range 10 {
+		added, err := tbl.AddRoute(RoutingTableEntry{
+			DstIP:   peer,
+			NextHop: peer,
+			Path:    makeRandomSwitchPath(peer, 0, 0),
+			Source:  RouteSourcePeer,
+		})
+		assert.NoError(t, err, "adding peer entry should succeed")
+		assert.True(t, added, "reconnecting peer should be added")
+		rte, isDestination := tbl.LookupNearestRoute(peer)
+		assert.True(t, isDestination, "peer should be routable")
+		assert.NotNil(t, rte, "peer should be routable")
+		assert.Equal(t, 1, tbl.RemoveNextHop(peer), "peer should be removed")
+	}
+	assert.Empty(t, tbl.SuppressedRoutes(), "peers must not be suppressed")
+	assert.Zero(t, tbl.RoutePenalty(&RoutingTableEntry{DstIP: peer, NextHop: peer}), "peers must not be penalized")
+}
+
+func TestStaticRoutes(t *testing.T) {
+	t.Parallel()
+
+	tbl := NewRoutingTable(RoutingTableConfig{
+		RoutablePrefixes: []RoutablePrefix{{
+			BasePrefix:       RoutingAddressPrefix,
+			RoutingBits:      RegionPrefixBits,
+			EntryTTL:         3 * time.Hour,
+			EntriesPerPrefix: 5,
+		}},
+		RouterIP: myIP,
+	})
+
+	// Add gossip route to destination.
+	dst := makeRandomAddress(myPrefix)
+	gossipPath := makeRandomSwitchPath(myIP, 2, 2)
+	gossipPath.Hops[2].Router = dst
+	_, err := tbl.AddRoute(RoutingTableEntry{
+		DstIP:   dst,
+		NextHop: gossipPath.Hops[1].Router,
+		Path:    gossipPath,
+		Source:  RouteSourceGossip,
+		Expires: time.Now().Add(time.Hour),
+	})
+	assert.NoError(t, err, "adding gossip entry should succeed")
+
+	// Add static route for the prefix of the destination via a peer.
+	peer := makeRandomAddress(myPrefix)
+	_, err = tbl.AddRoute(RoutingTableEntry{
+		DstIP:         peer,
+		RoutingPrefix: myPrefix,
+		NextHop:       peer,
+		Path: SwitchPath{Hops: []SwitchHop{
+			{Router: myIP, ForwardLabel: 10},
+			{Router: peer},
+		}},
+		Source: RouteSourceStatic,
+	})
+	assert.NoError(t, err, "adding static entry should succeed")
+
+	// Static route takes precedence over gossip.
+	rte, isDestination := tbl.LookupNearestRoute(dst)
+	assert.Equal(t, RouteSourceStatic, rte.Source, "static route should take precedence")
+	assert.False(t, isDestination, "static prefix route does not lead to destination")
+	routes, _ := tbl.LookupNearestRoutes(dst, 3)
+	assert.Len(t, routes, 1, "should only return the static route")
+	paths := tbl.LookupPossiblePaths(dst, 3, AddrDistance{}, true, nil)
+	if assert.NotEmpty(t, paths, "should return possible paths") {
+		assert.Equal(t, RouteSourceStatic, paths[0].Source, "static route should be preferred")
+	}
+	rte, isDestination = tbl.LookupNearestRoute(peer)
+	assert.Equal(t, RouteSourceStatic, rte.Source, "static route should lead to peer")
+	assert.True(t, isDestination, "static route should lead to peer")
+
+	// Static routes do not expire.
+	assert.True(t, rte.Expires.IsZero(), "static route should not expire")
+	tbl.Clean()
+	assert.Len(t, tbl.StaticRoutes(), 1, "static route should survive cleaning")
+	assert.Contains(t, tbl.Format(), "static", "static route should be shown")
+
+	// Direct peers take precedence over static routes.
+	_, err = tbl.AddRoute(RoutingTableEntry{
+		DstIP:   dst,
+		NextHop: dst,
+		Path:    makeRandomSwitchPath(dst, 0, 0),
+		Source:  RouteSourcePeer,
+	})
+	assert.NoError(t, err, "adding peer entry should succeed")
+	rte, _ = tbl.LookupNearestRoute(dst)
+	assert.Equal(t, RouteSourcePeer, rte.Source, "peer should be reached directly")
+	tbl.RemoveNextHop(dst)
+
+	// Removing the peer removes the static route.
+	tbl.RemoveNextHop(peer)
+	assert.Empty(t, tbl.StaticRoutes(), "static route should be removed with its next hop")
+	assert.Zero(t, tbl.RoutePenalty(&RoutingTableEntry{DstIP: peer, NextHop: peer}), "static routes must not be penalized")
+	rte, _ = tbl.LookupNearestRoute(dst)
+	assert.Equal(t, RouteSourceGossip, rte.Source, "should fall back to gossip route")
+}
+
+func TestLearnedRoutes(t *testing.T) {
+	t.Parallel()
+
+	tbl := NewRoutingTable(RoutingTableConfig{
+		RoutablePrefixes: []RoutablePrefix{{
+			BasePrefix:       RoutingAddressPrefix,
+			RoutingBits:      RegionPrefixBits,
+			EntryTTL:         3 * time.Hour,
+			EntriesPerPrefix: 5,
+		}},
+		RouterIP: myIP,
+	})
+
+	// Add one route of every learnable source.
+	peer := makeRandomAddress(myPrefix)
+	_, err := tbl.AddRoute(RoutingTableEntry{
+		DstIP:   peer,
+		NextHop: peer,
+		Path:    makeRandomSwitchPath(peer, 0, 0),
+		Source:  RouteSourcePeer,
+	})
+	assert.NoError(t, err, "adding peer entry should succeed")
+	for _, source := range []RouteSource{RouteSourceGossip, RouteSourceDiscovered} {
+		path := makeRandomSwitchPath(myIP, 2, 2)
+		path.Hops[1].Router = peer
+		_, err := tbl.AddRoute(RoutingTableEntry{
+			DstIP:   path.Hops[2].Router,
+			NextHop: peer,
+			Path:    path,
+			Source:  source,
+			Expires: time.Now().Add(time.Hour),
+		})
+		assert.NoError(t, err, "adding %s entry should succeed", source)
+	}
+
+	// Only gossip and discovered routes are returned.
+	learned := tbl.LearnedRoutes()
+	if assert.Len(t, learned, 2, "should return learned routes only") {
+		for _, rte := range learned {
+			assert.NotEqual(t, RouteSourcePeer, rte.Source, "should not return peer routes")
+			assert.False(t, rte.Expires.IsZero(), "should keep expiry")
+			assert.Len(t, rte.Path.Hops, 3, "should keep switch path")
+		}
+	}
+
+	// Returned routes are copies.
+	learned[0].NextHop = netip.Addr{}
+	for _, rte := range tbl.LearnedRoutes() {
+		assert.Equal(t, peer, rte.NextHop, "table entries must not be modified")
+	}
+}
+
 func makeRandomAddress(prefix netip.Prefix) netip.Addr {
 	// Get random bytes.
 	var buf [16]byte
@@ -308,6 +602,67 @@ func makeRandomSwitchPath(peer netip.Addr, minHops, maxHops int) SwitchPath {
 	return sp
 }
 
+// benchmarkTableSize is the amount of routes in the own prefix, which is
+// where most routes are held.
+const benchmarkTableSize = 2000
+
+// makeBenchmarkRoutes returns peer routes and routes via these peers within
+// the own prefix.
+func makeBenchmarkRoutes(peerCnt, routeCnt int) []RoutingTableEntry {
+	routes := make([]RoutingTableEntry, 0, peerCnt+routeCnt)
+	peers := make([]netip.Addr, 0, peerCnt)
+	for range peerCnt {
+		ip := makeRandomAddress(myPrefix)
+		peers = append(peers, ip)
+		routes = append(routes, RoutingTableEntry{
+			DstIP:   ip,
+			NextHop: ip,
+			Source:  RouteSourcePeer,
+		})
+	}
+	for i := range routeCnt {
+		peer := peers[i%len(peers)]
+		path := makeRandomSwitchPath(myIP, 1, 3)
+		path.Hops[1].Router = peer
+		path.Hops[len(path.Hops)-1].Router = makeRandomAddress(myPrefix)
+		source := RouteSourceGossip
+		if i%10 == 0 {
+			source = RouteSourceDiscovered
+		}
+		routes = append(routes, RoutingTableEntry{
+			DstIP:   path.Hops[len(path.Hops)-1].Router,
+			NextHop: peer,
+			Path:    path,
+			Source:  source,
+			Expires: time.Now().Add(1 * time.Hour),
+		})
+	}
+	return routes
+}
+
+func makeBenchmarkTable(b *testing.B) *RoutingTable {
+	b.Helper()
+
+	tbl := NewRoutingTable(RoutingTableConfig{
+		RoutablePrefixes: GetRoutablePrefixesFor(myIP, myPrefix),
+		RouterIP:         myIP,
+	})
+	for _, rte := range makeBenchmarkRoutes(10, benchmarkTableSize) {
+		if _, err := tbl.AddRoute(rte); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return tbl
+}
+
+func makeBenchmarkLookups() []netip.Addr {
+	ips := make([]netip.Addr, 1000)
+	for i := range ips {
+		ips[i] = makeRandomAddress(myPrefix)
+	}
+	return ips
+}
+
 func BenchmarkTableLookup(b *testing.B) {
 	tbl := NewRoutingTable(RoutingTableConfig{
 		RoutablePrefixes: GetRoutablePrefixesFor(myIP, myPrefix),
@@ -358,6 +713,65 @@ func BenchmarkTableLookup(b *testing.B) {
 	}
 }
 
+func BenchmarkTableLookupRoutes(b *testing.B) {
+	tbl := makeBenchmarkTable(b)
+	ips := makeBenchmarkLookups()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		entry, _ := tbl.LookupNearestRoute(ips[i%1000])
+		if entry == nil {
+			b.Fatal("lookup failed")
+		}
+	}
+}
+
+func BenchmarkTableLookupParallel(b *testing.B) {
+	tbl := makeBenchmarkTable(b)
+	ips := makeBenchmarkLookups()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var i int
+		for pb.Next() {
+			entry, _ := tbl.LookupNearestRoute(ips[i%1000])
+			if entry == nil {
+				b.Error("lookup failed")
+				return
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkTableLookupPossiblePaths(b *testing.B) {
+	tbl := makeBenchmarkTable(b)
+	ips := makeBenchmarkLookups()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		paths := tbl.LookupPossiblePaths(ips[i%1000], 3, AddrDistance{}, true, nil)
+		if len(paths) == 0 {
+			b.Fatal("lookup failed")
+		}
+	}
+}
+
+func BenchmarkTableBuild(b *testing.B) {
+	routes := makeBenchmarkRoutes(10, benchmarkTableSize)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tbl := NewRoutingTable(RoutingTableConfig{
+			RoutablePrefixes: GetRoutablePrefixesFor(myIP, myPrefix),
+			RouterIP:         myIP,
+		})
+		for _, rte := range routes {
+			_, _ = tbl.AddRoute(rte)
+		}
+	}
+}
+
 func BenchmarkMapTableLookup(b *testing.B) {
 	tbl := make(map[netip.Addr]RoutingTableEntry, 1000)
 	ips := make([]netip.Addr, 0, 1000)
@@ -405,65 +819,109 @@ func BenchmarkMapTableLookup(b *testing.B) {
 	}
 }
 
-func BenchmarkTableCleaning(b *testing.B) {
-	tbl := NewRoutingTable(RoutingTableConfig{
-		RoutablePrefixes: GetRoutablePrefixesFor(myIP, myPrefix),
-		RouterIP:         myIP,
+// sliceTable is the previous implementation of the routing table as a sorted
+// slice, reduced to inserting and looking up routes.
+// It is used as a baseline for benchmarks.
+type sliceTable struct {
+	lock    sync.RWMutex
+	entries []*RoutingTableEntry
+}
+
+func (st *sliceTable) sort(a, b *RoutingTableEntry) int {
+	if cmp := a.DstIP.Compare(b.DstIP); cmp != 0 {
+		return cmp
+	}
+	return int(a.Path.TotalHops) - int(b.Path.TotalHops)
+}
+
+func (st *sliceTable) add(entry RoutingTableEntry) {
+	_ = entry.Path.BuildBlocks()
+	entry.Path.CalculateTotals()
+
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	index, _ := slices.BinarySearchFunc(st.entries, &entry, st.sort)
+	st.entries = slices.Insert(st.entries, index, &entry)
+}
+
+func (st *sliceTable) lookupNearest(dst netip.Addr) *RoutingTableEntry {
+	st.lock.RLock()
+	defer st.lock.RUnlock()
+
+	index, _ := slices.BinarySearchFunc(st.entries, dst, func(rte *RoutingTableEntry, a netip.Addr) int {
+		return rte.DstIP.Compare(a)
 	})
+	switch {
+	case len(st.entries) == 0:
+		return nil
+	case index >= len(st.entries):
+		return st.entries[len(st.entries)-1]
+	case index == 0 || st.entries[index].DstIP == dst:
+		return st.entries[index]
+	}
+	prevDistance := IPDistance(st.entries[index-1].DstIP, dst)
+	nextDistance := IPDistance(st.entries[index].DstIP, dst)
+	if prevDistance.Less(nextDistance) {
+		return st.entries[index-1]
+	}
+	return st.entries[index]
+}
 
-	var (
-		addRandomGossipEntries     = 890
-		addRandomPeerEntries       = 10
-		addRandomDiscoveredEntries = 100
-	)
+func makeBenchmarkSliceTable() *sliceTable {
+	st := &sliceTable{}
+	for _, rte := range makeBenchmarkRoutes(10, benchmarkTableSize) {
+		st.add(rte)
+	}
+	return st
+}
 
-	b.Logf("adding peer entries...")
-	for i := 0; i < addRandomPeerEntries; i++ {
-		ip := makeRandomAddress(myPrefix)
-		_, err := tbl.AddRoute(RoutingTableEntry{
-			DstIP:   ip,
-			NextHop: ip,
-			Path:    makeRandomSwitchPath(ip, 1, 3),
-			Source:  RouteSourcePeer,
-			Expires: time.Now().Add(1 * time.Hour),
-		})
-		if err != nil {
-			b.Fatal(err)
+func BenchmarkSliceTableLookup(b *testing.B) {
+	st := makeBenchmarkSliceTable()
+	ips := makeBenchmarkLookups()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if st.lookupNearest(ips[i%1000]) == nil {
+			b.Fatal("lookup failed")
 		}
 	}
-	b.Logf("adding gossip entries...")
-	for i := 0; i < addRandomGossipEntries; i++ {
-		ip := makeRandomAddress(RoutingAddressPrefix)
-		_, err := tbl.AddRoute(RoutingTableEntry{
-			DstIP:   ip,
-			NextHop: ip,
-			Path:    makeRandomSwitchPath(ip, 1, 3),
-			Source:  RouteSourceGossip,
-			Expires: time.Now().Add(1 * time.Hour),
-		})
-		if err != nil {
-			b.Fatal(err)
+}
+
+func BenchmarkSliceTableLookupParallel(b *testing.B) {
+	st := makeBenchmarkSliceTable()
+	ips := makeBenchmarkLookups()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var i int
+		for pb.Next() {
+			if st.lookupNearest(ips[i%1000]) == nil {
+				b.Error("lookup failed")
+				return
+			}
+			i++
 		}
-	}
-	b.Logf("adding discovered entries...")
-	for i := 0; i < addRandomDiscoveredEntries; i++ {
-		ip := makeRandomAddress(RoutingAddressPrefix)
-		_, err := tbl.AddRoute(RoutingTableEntry{
-			DstIP:   ip,
-			NextHop: ip,
-			Path:    makeRandomSwitchPath(ip, 1, 3),
-			Source:  RouteSourceDiscovered,
-			Expires: time.Now().Add(1 * time.Hour),
-		})
-		if err != nil {
-			b.Fatal(err)
+	})
+}
+
+func BenchmarkSliceTableBuild(b *testing.B) {
+	routes := makeBenchmarkRoutes(10, benchmarkTableSize)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		st := &sliceTable{}
+		for _, rte := range routes {
+			st.add(rte)
 		}
 	}
+}
 
-	b.ResetTimer()
+func BenchmarkTableCleaning(b *testing.B) {
+	tbl := makeBenchmarkTable(b)
 
+	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		tbl.sortForCleaning()
-		tbl.sortForRouting()
+		tbl.Clean()
 	}
 }
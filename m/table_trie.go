@@ -0,0 +1,270 @@
+package m
+
+import (
+	"math/bits"
+	"net/netip"
+)
+
+// The routing table stores its entries in a persistent, path compressed binary
+// trie keyed by the destination IP. Nodes are never modified after they are
+// published. Changes copy the path from the root to the changed node, so that
+// readers can use a snapshot of the trie without locking.
+//
+// Leaves hold all routes to a single destination, sorted best first. Inner
+// nodes always have two children and hold no routes.
+// Walking the trie in order yields the routes sorted for routing.
+// Walking the trie while always preferring the child that matches the bit of
+// the searched address yields the routes in order of their IP distance, as
+// the IP distance is the XOR of the addresses.
+
+// trieKeyBits is the bit length of a trie key.
+const trieKeyBits = 128
+
+// trieKey is an IPv6 address as two 64 bit integers.
+type trieKey struct {
+	hi, lo uint64
+}
+
+func makeTrieKey(ip netip.Addr) trieKey {
+	b := ip.As16()
+	return trieKey{
+		hi: beUint64(b[:8]),
+		lo: beUint64(b[8:]),
+	}
+}
+
+// bit returns the bit at the given position, starting with the most
+// significant bit at position 0.
+func (k trieKey) bit(pos int) int {
+	if pos < 64 {
+		return int(k.hi>>(63-pos)) & 1
+	}
+	return int(k.lo>>(127-pos)) & 1
+}
+
+// commonPrefixLen returns the amount of leading bits that are equal in both keys.
+func (k trieKey) commonPrefixLen(other trieKey) int {
+	if x := k.hi ^ other.hi; x != 0 {
+		return bits.LeadingZeros64(x)
+	}
+	return 64 + bits.LeadingZeros64(k.lo^other.lo)
+}
+
+// trieNode is a node in the routing table trie.
+// Nodes must be treated as constants.
+type trieNode struct {
+	// key holds the prefix of the node in its first bits.
+	// Leaves hold the full destination IP.
+	key  trieKey
+	bits int
+
+	children [2]*trieNode
+	routes   []*RoutingTableEntry
+
+	// count is the amount of routes in this subtree.
+	count int
+}
+
+func newTrieLeaf(key trieKey, routes []*RoutingTableEntry) *trieNode {
+	return &trieNode{
+		key:    key,
+		bits:   trieKeyBits,
+		routes: routes,
+		count:  len(routes),
+	}
+}
+
+func newTrieInner(key trieKey, bits int, a, b *trieNode) *trieNode {
+	n := &trieNode{
+		key:   key,
+		bits:  bits,
+		count: a.count + b.count,
+	}
+	n.children[a.key.bit(bits)] = a
+	n.children[b.key.bit(bits)] = b
+	return n
+}
+
+func (n *trieNode) isLeaf() bool {
+	return n.bits == trieKeyBits
+}
+
+// get returns the routes to the given destination.
+func (n *trieNode) get(key trieKey) []*RoutingTableEntry {
+	for n != nil {
+		if n.isLeaf() {
+			if n.key == key {
+				return n.routes
+			}
+			return nil
+		}
+		if key.commonPrefixLen(n.key) < n.bits {
+			return nil
+		}
+		n = n.children[key.bit(n.bits)]
+	}
+	return nil
+}
+
+// setRoutes returns a trie in which the routes to the given destination are
+// replaced with the given routes. Empty routes remove the destination.
+// Unchanged parts of the trie are shared.
+func (n *trieNode) setRoutes(key trieKey, routes []*RoutingTableEntry) *trieNode {
+	switch {
+	case n == nil:
+		if len(routes) == 0 {
+			return nil
+		}
+		return newTrieLeaf(key, routes)
+
+	case n.isLeaf() && n.key == key:
+		if len(routes) == 0 {
+			return nil
+		}
+		return newTrieLeaf(key, routes)
+	}
+
+	// Check if the key diverges from this node.
+	cpl := key.commonPrefixLen(n.key)
+	if cpl < n.bits {
+		if len(routes) == 0 {
+			return n
+		}
+		return newTrieInner(key, cpl, n, newTrieLeaf(key, routes))
+	}
+
+	// Descend into matching child.
+	b := key.bit(n.bits)
+	child := n.children[b].setRoutes(key, routes)
+	switch child {
+	case n.children[b]:
+		return n
+	case nil:
+		// Collapse node, as inner nodes always have two children.
+		return n.children[1-b]
+	default:
+		return newTrieInner(n.key, n.bits, child, n.children[1-b])
+	}
+}
+
+// filter returns a trie without the routes for which remove returns true.
+// Unchanged parts of the trie are shared.
+func (n *trieNode) filter(remove func(rte *RoutingTableEntry) bool) *trieNode {
+	if n == nil {
+		return nil
+	}
+
+	// Filter routes of leaf.
+	if n.isLeaf() {
+		var kept []*RoutingTableEntry
+		for i, rte := range n.routes {
+			switch {
+			case remove(rte):
+				if kept == nil {
+					kept = make([]*RoutingTableEntry, i, len(n.routes))
+					copy(kept, n.routes[:i])
+				}
+			case kept != nil:
+				kept = append(kept, rte)
+			}
+		}
+		switch {
+		case kept == nil:
+			return n
+		case len(kept) == 0:
+			return nil
+		default:
+			return newTrieLeaf(n.key, kept)
+		}
+	}
+
+	// Filter children.
+	a := n.children[0].filter(remove)
+	b := n.children[1].filter(remove)
+	switch {
+	case a == n.children[0] && b == n.children[1]:
+		return n
+	case a == nil:
+		return b
+	case b == nil:
+		return a
+	default:
+		return newTrieInner(n.key, n.bits, a, b)
+	}
+}
+
+// countPrefix returns the amount of routes within the given prefix.
+func (n *trieNode) countPrefix(key trieKey, prefixBits int) int {
+	for n != nil {
+		cpl := key.commonPrefixLen(n.key)
+		if n.bits >= prefixBits {
+			if cpl >= prefixBits {
+				return n.count
+			}
+			return 0
+		}
+		if cpl < n.bits {
+			return 0
+		}
+		n = n.children[key.bit(n.bits)]
+	}
+	return 0
+}
+
+// nearestLeaf returns the leaf with the smallest IP distance to the given key.
+func (n *trieNode) nearestLeaf(key trieKey) (leaf *trieNode, exact bool) {
+	if n == nil {
+		return nil, false
+	}
+	for !n.isLeaf() {
+		n = n.children[key.bit(n.bits)]
+	}
+	return n, n.key == key
+}
+
+// iterateNearest calls fn for all routes in order of their IP distance to the
+// given destination, until fn returns true.
+func (n *trieNode) iterateNearest(key trieKey, dst netip.Addr, fn func(rte *RoutingTableEntry, distance AddrDistance) (done bool)) (done bool) {
+	if n == nil {
+		return false
+	}
+
+	if n.isLeaf() {
+		if len(n.routes) == 0 {
+			return false
+		}
+		distance := IPDistance(n.routes[0].DstIP, dst)
+		for _, rte := range n.routes {
+			if fn(rte, distance) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Visit the nearer child first.
+	b := key.bit(n.bits)
+	return n.children[b].iterateNearest(key, dst, fn) ||
+		n.children[1-b].iterateNearest(key, dst, fn)
+}
+
+// appendRoutes appends all routes in order to the given slice.
+func (n *trieNode) appendRoutes(routes []*RoutingTableEntry) []*RoutingTableEntry {
+	switch {
+	case n == nil:
+		return routes
+	case n.isLeaf():
+		return append(routes, n.routes...)
+	default:
+		routes = n.children[0].appendRoutes(routes)
+		return n.children[1].appendRoutes(routes)
+	}
+}
+
+// size returns the amount of routes in the trie.
+func (n *trieNode) size() int {
+	if n == nil {
+		return 0
+	}
+	return n.count
+}
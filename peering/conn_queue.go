@@ -0,0 +1,134 @@
+package peering
+
+import (
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// frameQueue implements reading for net.Conn implementations that receive
+// whole frames instead of a byte stream.
+// Queued frames are returned by Read as a continuous stream.
+// Priority frames are read before regular frames.
+type frameQueue struct {
+	prio chan []byte
+	regl chan []byte
+
+	current     []byte
+	currentPrio bool
+
+	readDeadline        atomic.Pointer[time.Time]
+	readDeadlineChanged chan struct{}
+
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+func newFrameQueue(prioSize, reglSize int) *frameQueue {
+	return &frameQueue{
+		prio:                make(chan []byte, prioSize),
+		regl:                make(chan []byte, reglSize),
+		readDeadlineChanged: make(chan struct{}, 1),
+		closing:             make(chan struct{}),
+	}
+}
+
+// submit adds a copy of the given frame to the queue.
+// The frame is dropped if the queue is full.
+func (q *frameQueue) submit(data []byte, prio bool) {
+	queue := q.regl
+	if prio {
+		queue = q.prio
+	}
+
+	select {
+	case queue <- append([]byte(nil), data...):
+	default:
+		// Queue is full, drop frame.
+	}
+}
+
+// Read reads queued frame data.
+func (q *frameQueue) Read(b []byte) (int, error) {
+	for len(q.current) == 0 {
+		// Get priority frames first.
+		select {
+		case q.current = <-q.prio:
+			q.currentPrio = true
+			continue
+		default:
+		}
+
+		// Set up deadline.
+		var (
+			timer    *time.Timer
+			deadline <-chan time.Time
+		)
+		if t := q.readDeadline.Load(); t != nil && !t.IsZero() {
+			timer = time.NewTimer(time.Until(*t))
+			deadline = timer.C
+		}
+
+		// Wait for next frame.
+		var err error
+		select {
+		case q.current = <-q.prio:
+			q.currentPrio = true
+		case q.current = <-q.regl:
+			q.currentPrio = false
+		case <-q.readDeadlineChanged:
+		case <-deadline:
+			err = os.ErrDeadlineExceeded
+		case <-q.closing:
+			err = io.EOF
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(b, q.current)
+	q.current = q.current[n:]
+	return n, nil
+}
+
+// ReadingPriority returns whether the frame currently being read is a
+// priority frame.
+func (q *frameQueue) ReadingPriority() bool {
+	return q.currentPrio
+}
+
+// SetReadDeadline sets the deadline for future and currently blocked Read calls.
+func (q *frameQueue) SetReadDeadline(t time.Time) error {
+	q.readDeadline.Store(&t)
+	select {
+	case q.readDeadlineChanged <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// close makes all current and future Read calls return io.EOF.
+// It reports whether the queue was closed by this call.
+func (q *frameQueue) close() (closed bool) {
+	q.closeOnce.Do(func() {
+		close(q.closing)
+		closed = true
+	})
+	return closed
+}
+
+// isClosed returns whether the queue is closed.
+func (q *frameQueue) isClosed() bool {
+	select {
+	case <-q.closing:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,357 @@
+package peering
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"golang.org/x/net/ipv6"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+const (
+	// discoveryInterval defines how often beacons are sent.
+	discoveryInterval = 30 * time.Second
+	// discoveryMaxTimeDiff defines how much the time of a beacon may differ
+	// from the local time.
+	discoveryMaxTimeDiff = 2 * time.Minute
+	// discoveryRetryInterval defines how long to wait before trying to peer
+	// with a discovered router again.
+	discoveryRetryInterval = time.Minute
+)
+
+var discoverySigningContext = []byte("mycoria lan discovery beacon")
+
+// discoveryBeacon announces a router on the local network.
+type discoveryBeacon struct {
+	Address   m.PublicAddress `cbor:"a,omitempty" json:"a,omitempty"`
+	Universe  string          `cbor:"u,omitempty" json:"u,omitempty"`
+	Listeners []string        `cbor:"l,omitempty" json:"l,omitempty"`
+	Time      int64           `cbor:"t,omitempty" json:"t,omitempty"`
+}
+
+// discoveryMessage holds a signed beacon.
+type discoveryMessage struct {
+	Beacon    []byte `cbor:"b,omitempty" json:"b,omitempty"`
+	Signature []byte `cbor:"s,omitempty" json:"s,omitempty"`
+}
+
+// lanDiscovery discovers other routers on the local network.
+type lanDiscovery struct {
+	peering *Peering
+
+	conn  *ipv6.PacketConn
+	group *net.UDPAddr
+
+	// joined holds the indexes of the interfaces the group was joined on.
+	joined map[string]int
+
+	// attempts holds the last time peering with a router was attempted.
+	attempts     map[netip.Addr]time.Time
+	attemptsLock sync.Mutex
+}
+
+func (p *Peering) discoveryMgr(w *mgr.WorkerCtx) error {
+	// Open socket.
+	packetConn, err := net.ListenPacket("udp6", fmt.Sprintf("[::]:%d", config.DefaultDiscoveryPort))
+	if err != nil {
+		w.Error(
+			"failed to start lan discovery",
+			"err", err,
+		)
+		return nil
+	}
+	d := &lanDiscovery{
+		peering: p,
+		conn:    ipv6.NewPacketConn(packetConn),
+		group: &net.UDPAddr{
+			IP:   config.DefaultDiscoveryGroup.AsSlice(),
+			Port: config.DefaultDiscoveryPort,
+		},
+		joined:   make(map[string]int),
+		attempts: make(map[netip.Addr]time.Time),
+	}
+	defer func() {
+		_ = d.conn.Close()
+	}()
+	_ = d.conn.SetMulticastLoopback(false)
+	_ = d.conn.SetMulticastHopLimit(1)
+
+	// Start reader.
+	p.mgr.Go("lan discovery reader", d.reader)
+
+	// Send beacons.
+	ticker := time.NewTicker(discoveryInterval)
+	defer ticker.Stop()
+	for {
+		d.joinInterfaces(w)
+		d.sendBeacon(w)
+
+		select {
+		case <-ticker.C:
+		case <-w.Done():
+			return nil
+		}
+	}
+}
+
+// joinInterfaces joins the multicast group on all configured interfaces.
+// Interfaces that are not available yet are retried on the next call.
+func (d *lanDiscovery) joinInterfaces(w *mgr.WorkerCtx) {
+	for _, ifName := range d.peering.instance.Config().Router.Discover {
+		iface, err := net.InterfaceByName(ifName)
+		if err != nil {
+			w.Debug(
+				"lan discovery interface not available",
+				"iface", ifName,
+				"err", err,
+			)
+			delete(d.joined, ifName)
+			continue
+		}
+
+		// Check if already joined.
+		if index, ok := d.joined[ifName]; ok && index == iface.Index {
+			continue
+		}
+
+		// Join group.
+		if err := d.conn.JoinGroup(iface, d.group); err != nil {
+			w.Warn(
+				"failed to join lan discovery group",
+				"iface", ifName,
+				"err", err,
+			)
+			continue
+		}
+		d.joined[ifName] = iface.Index
+	}
+}
+
+func (d *lanDiscovery) sendBeacon(w *mgr.WorkerCtx) {
+	msg, err := d.peering.makeDiscoveryBeacon(time.Now())
+	if err != nil {
+		w.Warn(
+			"failed to create lan discovery beacon",
+			"err", err,
+		)
+		return
+	}
+
+	for ifName, index := range d.joined {
+		_, err := d.conn.WriteTo(msg, &ipv6.ControlMessage{IfIndex: index}, d.group)
+		if err != nil {
+			w.Debug(
+				"failed to send lan discovery beacon",
+				"iface", ifName,
+				"err", err,
+			)
+		}
+	}
+}
+
+func (d *lanDiscovery) reader(w *mgr.WorkerCtx) error {
+	buf := make([]byte, 4096)
+	for {
+		n, _, src, err := d.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) || w.IsDone() {
+				return nil
+			}
+			w.Debug(
+				"failed to read lan discovery beacon",
+				"err", err,
+			)
+			continue
+		}
+		srcAddr, ok := src.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+		srcIP := srcAddr.AddrPort().Addr()
+
+		// Check beacon.
+		beacon, err := d.peering.parseDiscoveryBeacon(buf[:n], time.Now())
+		if err != nil {
+			w.Debug(
+				"received invalid lan discovery beacon",
+				"src", srcIP,
+				"err", err,
+			)
+			continue
+		}
+
+		d.handleBeacon(w, beacon, srcIP)
+	}
+}
+
+func (d *lanDiscovery) handleBeacon(w *mgr.WorkerCtx, beacon *discoveryBeacon, srcIP netip.Addr) {
+	routerIP := beacon.Address.IP
+
+	// Check if we already have a link.
+	if d.peering.GetLink(routerIP) != nil {
+		return
+	}
+
+	// Respect isolation: only peer with friends.
+	cfg := d.peering.instance.Config()
+	if cfg.Router.Isolate {
+		if !d.peering.instance.State().IsFriend(routerIP) {
+			return
+		}
+	}
+
+	// Check if we recently tried to peer.
+	d.attemptsLock.Lock()
+	defer d.attemptsLock.Unlock()
+	if time.Since(d.attempts[routerIP]) < discoveryRetryInterval {
+		return
+	}
+	d.attempts[routerIP] = time.Now()
+
+	// Clean up old attempts.
+	for ip, attempted := range d.attempts {
+		if time.Since(attempted) > discoveryRetryInterval {
+			delete(d.attempts, ip)
+		}
+	}
+
+	w.Debug(
+		"discovered router on local network",
+		"router", routerIP,
+		"src", srcIP,
+	)
+	d.peering.mgr.Go("lan discovery peering", func(w *mgr.WorkerCtx) error {
+		d.peering.peerWithDiscovered(w, beacon, srcIP)
+		return nil
+	})
+}
+
+func (p *Peering) peerWithDiscovered(w *mgr.WorkerCtx, beacon *discoveryBeacon, srcIP netip.Addr) {
+	// Sort listeners by preference.
+	urls, _ := m.ParsePeeringURLs(beacon.Listeners)
+	m.SortPeeringURLs(urls)
+
+	// Try to connect to the listeners.
+	for _, u := range urls {
+		// Skip protocols we do not support.
+		if p.GetProtocol(u.Protocol) == nil {
+			continue
+		}
+
+		// Connect via the source address, unless the listener has a specific host.
+		ip := srcIP
+		if u.Domain != "" {
+			ip = netip.Addr{}
+		}
+		link, err := p.PeerWith(u, ip)
+		if err != nil {
+			w.Debug(
+				"failed to peer with discovered router",
+				"router", beacon.Address.IP,
+				"peeringURL", u.String(),
+				"err", err,
+			)
+			continue
+		}
+
+		// Check if we are connected to the announced router.
+		if link.Peer() != beacon.Address.IP {
+			link.Close(func() {
+				w.Warn(
+					"discovered router has different identity, closing link",
+					"router", beacon.Address.IP,
+					"peer", link.Peer(),
+				)
+			})
+			p.RemoveLink(link)
+			continue
+		}
+
+		w.Info(
+			"peered with discovered router",
+			"router", beacon.Address.IP,
+			"peeringURL", u.String(),
+		)
+		return
+	}
+}
+
+// makeDiscoveryBeacon returns a signed and serialized discovery beacon.
+func (p *Peering) makeDiscoveryBeacon(now time.Time) ([]byte, error) {
+	// Collect listeners, except unix sockets, as they are only reachable locally.
+	listen := p.instance.Config().Router.Listen
+	listeners := make([]string, 0, len(listen))
+	for _, listener := range listen {
+		if !strings.HasPrefix(listener, "unix:") {
+			listeners = append(listeners, listener)
+		}
+	}
+
+	beacon, err := cbor.Marshal(&discoveryBeacon{
+		Address:   p.instance.Identity().PublicAddress,
+		Universe:  p.instance.Config().Router.Universe,
+		Listeners: listeners,
+		Time:      now.Unix(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal beacon: %w", err)
+	}
+
+	sig, err := p.instance.Identity().SignWithContext(beacon, discoverySigningContext)
+	if err != nil {
+		return nil, fmt.Errorf("sign beacon: %w", err)
+	}
+
+	return cbor.Marshal(&discoveryMessage{
+		Beacon:    beacon,
+		Signature: sig,
+	})
+}
+
+// parseDiscoveryBeacon parses and verifies a discovery beacon.
+// It returns an error if the beacon is invalid or not relevant.
+func (p *Peering) parseDiscoveryBeacon(data []byte, now time.Time) (*discoveryBeacon, error) {
+	msg := &discoveryMessage{}
+	if err := cbor.Unmarshal(data, msg); err != nil {
+		return nil, fmt.Errorf("unmarshal message: %w", err)
+	}
+	beacon := &discoveryBeacon{}
+	if err := cbor.Unmarshal(msg.Beacon, beacon); err != nil {
+		return nil, fmt.Errorf("unmarshal beacon: %w", err)
+	}
+
+	// Ignore own beacons.
+	if beacon.Address.IP == p.instance.Identity().IP {
+		return nil, errors.New("own beacon")
+	}
+
+	// Verify address and signature.
+	if err := beacon.Address.VerifyAddress(); err != nil {
+		return nil, fmt.Errorf("verify address: %w", err)
+	}
+	if err := beacon.Address.VerifySigWithContext(msg.Beacon, msg.Signature, discoverySigningContext); err != nil {
+		return nil, fmt.Errorf("verify signature: %w", err)
+	}
+
+	// Check time to limit replays.
+	timeDiff := now.Sub(time.Unix(beacon.Time, 0))
+	if timeDiff > discoveryMaxTimeDiff || timeDiff < -discoveryMaxTimeDiff {
+		return nil, errors.New("beacon time out of range")
+	}
+
+	// Check universe.
+	if beacon.Universe != p.instance.Config().Router.Universe {
+		return nil, errors.New("universe mismatch")
+	}
+
+	return beacon, nil
+}
@@ -0,0 +1,72 @@
+package peering
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+
+	"github.com/mycoria/mycoria/config"
+)
+
+func TestDiscoveryBeacon(t *testing.T) {
+	t.Parallel()
+
+	c := config.MakeTestConfig(config.Store{
+		Router: config.Router{
+			Universe: "test",
+			Listen:   []string{"tcp:47369", "unix:///run/mycoria/peering.sock"},
+		},
+	})
+	cOther := config.MakeTestConfig(config.Store{
+		Router: config.Router{
+			Universe: "other",
+		},
+	})
+	p1 := New(getTestInstance(t, c), nil)
+	p2 := New(getTestInstance(t, c), nil)
+	pOther := New(getTestInstance(t, cOther), nil)
+	now := time.Now()
+
+	msg, err := p1.makeDiscoveryBeacon(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Check valid beacon.
+	beacon, err := p2.parseDiscoveryBeacon(msg, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if beacon.Address.IP != p1.instance.Identity().IP {
+		t.Errorf("unexpected router address %s", beacon.Address.IP)
+	}
+	if len(beacon.Listeners) != 1 || beacon.Listeners[0] != "tcp:47369" {
+		t.Errorf("unexpected listeners %v", beacon.Listeners)
+	}
+
+	// Check invalid beacons.
+	if _, err := p1.parseDiscoveryBeacon(msg, now); err == nil {
+		t.Error("own beacon should be ignored")
+	}
+	if _, err := pOther.parseDiscoveryBeacon(msg, now); err == nil {
+		t.Error("beacon from other universe should be ignored")
+	}
+	if _, err := p2.parseDiscoveryBeacon(msg, now.Add(discoveryMaxTimeDiff+time.Second)); err == nil {
+		t.Error("old beacon should be rejected")
+	}
+
+	// Check tampered beacon.
+	dm := &discoveryMessage{}
+	if err := cbor.Unmarshal(msg, dm); err != nil {
+		t.Fatal(err)
+	}
+	dm.Signature[0] ^= 0xFF
+	tampered, err := cbor.Marshal(dm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p2.parseDiscoveryBeacon(tampered, now); err == nil {
+		t.Error("tampered beacon should be rejected")
+	}
+}
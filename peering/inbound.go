@@ -0,0 +1,131 @@
+package peering
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+)
+
+// inboundEvictionMinUptime defines how long an inbound link must be up before
+// it may be evicted in favor of a new peer.
+// This gives new links the chance to prove their usefulness.
+const inboundEvictionMinUptime = 10 * time.Minute
+
+// ErrInboundDenied is returned when an inbound peer is rejected.
+var ErrInboundDenied = errors.New("inbound peering denied")
+
+// checkInboundPolicy checks whether the remote may peer with this router
+// according to the configured allow and deny lists.
+func (p *Peering) checkInboundPolicy(router, source netip.Addr) error {
+	if err := p.instance.Config().CheckInbound(router, source); err != nil {
+		return fmt.Errorf("%w: %w", ErrInboundDenied, err)
+	}
+	return nil
+}
+
+// addInboundLink adds a new inbound link to the peering list.
+// If the maximum amount of inbound links is reached, the least useful inbound
+// link is closed to make room for the new link. The limit is checked together
+// with adding the link, so that concurrent link setups cannot exceed it.
+func (p *Peering) addInboundLink(link Link) error {
+	var evict Link
+	err := func() error {
+		p.linksLock.Lock()
+		defer p.linksLock.Unlock()
+
+		if maxPeers := p.instance.Config().Router.Inbound.MaxPeers; maxPeers > 0 {
+			var inbound int
+			inbound, evict = p.getInboundEvictionCandidate()
+			switch {
+			case inbound < maxPeers:
+				evict = nil
+			case evict == nil:
+				return fmt.Errorf("%w: inbound peer limit of %d reached", ErrInboundDenied, maxPeers)
+			default:
+				// Remove evicted link before closing it, so that it is not held
+				// for resumption.
+				p.removeLink(evict)
+			}
+		}
+
+		return p.addLink(link)
+	}()
+
+	// Close evicted link outside of the lock, as closing requires it.
+	if evict != nil {
+		evict.Close(func() {
+			p.mgr.Info(
+				"closing link (evicted by new inbound peer)",
+				"router", evict.Peer(),
+				"address", evict.RemoteAddr(),
+				"newPeer", link.Peer(),
+			)
+		})
+	}
+	return err
+}
+
+// getInboundEvictionCandidate returns the amount of inbound links and the
+// least useful inbound link that may be evicted.
+// Usefulness is measured by the average traffic of the link.
+// The links lock must be held.
+func (p *Peering) getInboundEvictionCandidate() (inbound int, evict Link) {
+	var (
+		lowestRate float64
+		now        = time.Now()
+	)
+	for _, link := range p.links {
+		if link.Outgoing() || link.IsClosing() {
+			continue
+		}
+		inbound++
+
+		// Keep friends and new links.
+		if p.instance.State().IsFriend(link.Peer()) {
+			continue
+		}
+		uptime := now.Sub(link.Started())
+		if uptime < inboundEvictionMinUptime {
+			continue
+		}
+
+		// Find link with the lowest average traffic.
+		rate := float64(link.BytesIn()+link.BytesOut()) / uptime.Seconds()
+		if evict == nil || rate < lowestRate {
+			evict = link
+			lowestRate = rate
+		}
+	}
+
+	return inbound, evict
+}
+
+// getRemoteIP returns the IP of the given remote address, if available.
+func getRemoteIP(addr net.Addr) netip.Addr {
+	var remoteIP net.IP
+	switch v := addr.(type) {
+	case *net.TCPAddr:
+		remoteIP = v.IP
+	case *net.UDPAddr:
+		remoteIP = v.IP
+	case *net.IPAddr:
+		remoteIP = v.IP
+	case nil:
+		return netip.Addr{}
+	default:
+		// Fall back to parsing the address.
+		ap, err := netip.ParseAddrPort(addr.String())
+		if err != nil {
+			return netip.Addr{}
+		}
+		return ap.Addr().Unmap()
+	}
+
+	ip, ok := netip.AddrFromSlice(remoteIP)
+	if !ok {
+		return netip.Addr{}
+	}
+	return ip.Unmap()
+}
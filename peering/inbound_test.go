@@ -0,0 +1,181 @@
+package peering
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+func TestInboundPolicy(t *testing.T) {
+	t.Parallel()
+
+	cServer := config.MakeTestConfig(config.Store{
+		Router: config.Router{
+			Inbound: config.Inbound{
+				AllowSources: []string{"192.0.2.0/24"},
+			},
+		},
+	})
+	server := New(getTestInstance(t, cServer), nil)
+
+	tests := []struct {
+		name   string
+		source netip.Addr
+		deny   bool
+		errMsg string
+	}{
+		{name: "allowed", source: netip.MustParseAddr("192.0.2.1")},
+		{name: "source not allowed", source: netip.MustParseAddr("198.51.100.1"), errMsg: "source network is not allowed"},
+		{name: "no source", errMsg: "source network is not allowed"},
+		{name: "router denied", source: netip.MustParseAddr("192.0.2.1"), deny: true, errMsg: "router is denied"},
+	}
+	for _, tc := range tests {
+		client := New(getTestInstance(t, config.MakeTestConfig(config.Store{})), nil)
+
+		// Deny client router, if required.
+		cServer.InboundDenyRouters = nil
+		if tc.deny {
+			clientIP := client.instance.Identity().IP
+			cServer.InboundDenyRouters = []netip.Prefix{netip.PrefixFrom(clientIP, clientIP.BitLen())}
+		}
+
+		// Exchange peering requests.
+		stateClient, msgFromClient, err := client.createPeeringRequest(true, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stateServer, msgFromServer, err := server.createPeeringRequest(false, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stateServer.remoteSource = tc.source
+
+		if _, err := stateClient.handle(msgFromServer); err != nil {
+			t.Fatalf("%s: client failed to handle request: %s", tc.name, err)
+		}
+		resp, err := stateServer.handle(msgFromClient)
+		if tc.errMsg == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %s", tc.name, err)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrInboundDenied) {
+			t.Errorf("%s: expected inbound denied error, got %v", tc.name, err)
+			continue
+		}
+
+		// Check if the client receives the reason.
+		_, err = stateClient.handle(resp)
+		if !errors.Is(err, ErrRemoteDeniedPeering) || !strings.Contains(err.Error(), tc.errMsg) {
+			t.Errorf("%s: expected remote denied error with %q, got %v", tc.name, tc.errMsg, err)
+		}
+	}
+}
+
+func TestInboundLimit(t *testing.T) {
+	t.Parallel()
+
+	c := config.MakeTestConfig(config.Store{
+		Router: config.Router{
+			Inbound: config.Inbound{
+				MaxPeers: 2,
+			},
+		},
+	})
+	p := New(getTestInstance(t, c), nil)
+	p.mgr = mgr.New("peering")
+
+	var nextIP uint16
+	newTestLink := func(started time.Time, bytesIn uint64) *LinkBase {
+		t.Helper()
+
+		nextIP++
+		conn, remote := net.Pipe()
+		t.Cleanup(func() { _ = remote.Close() })
+		link := &LinkBase{
+			conn:        conn,
+			peer:        netip.AddrFrom16([16]byte{0xfd, 14: byte(nextIP >> 8), 15: byte(nextIP)}),
+			switchLabel: m.SwitchLabel(nextIP),
+			started:     started,
+			peering:     p,
+		}
+		link.bytesIn.Store(bytesIn)
+		return link
+	}
+	countInbound := func() int {
+		p.linksLock.RLock()
+		defer p.linksLock.RUnlock()
+
+		inbound, _ := p.getInboundEvictionCandidate()
+		return inbound
+	}
+
+	// Fill up inbound links.
+	old := time.Now().Add(-inboundEvictionMinUptime - time.Minute)
+	busy := newTestLink(old, 1_000_000)
+	idle := newTestLink(old, 10)
+	for _, link := range []*LinkBase{busy, idle} {
+		if err := p.addInboundLink(link); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// New peers evict the least useful link.
+	if err := p.addInboundLink(newTestLink(time.Now(), 0)); err != nil {
+		t.Fatalf("new peer should evict idle link: %s", err)
+	}
+	if !idle.IsClosing() || p.GetLink(idle.Peer()) != nil {
+		t.Error("idle link should be evicted")
+	}
+	if busy.IsClosing() || p.GetLink(busy.Peer()) == nil {
+		t.Error("busy link should be kept")
+	}
+
+	// Concurrent setups cannot exceed the limit, new links are not evicted.
+	var (
+		wg       sync.WaitGroup
+		accepted atomic.Int32
+	)
+	for range 5 {
+		link := newTestLink(time.Now(), 0)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := p.addInboundLink(link)
+			switch {
+			case err == nil:
+				accepted.Add(1)
+			case !errors.Is(err, ErrInboundDenied):
+				t.Errorf("expected inbound denied error, got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if accepted.Load() != 1 {
+		t.Errorf("expected one accepted link, got %d", accepted.Load())
+	}
+	if inbound := countInbound(); inbound != 2 {
+		t.Errorf("expected 2 inbound links, got %d", inbound)
+	}
+
+	// Outgoing links do not count towards the limit.
+	outgoing := newTestLink(time.Now(), 0)
+	outgoing.outgoing = true
+	if err := p.AddLink(outgoing); err != nil {
+		t.Fatal(err)
+	}
+	if inbound := countInbound(); inbound != 2 {
+		t.Errorf("expected 2 inbound links, got %d", inbound)
+	}
+}
@@ -40,9 +40,17 @@ type peeringRequestState struct { //nolint:maligned
 	session *state.Session
 
 	remoteIP      netip.Addr
+	remoteSource  netip.Addr
 	remoteVersion string
 	remoteLite    bool
 	challenge     []byte
+
+	// resume holds the held link that is being resumed.
+	resume *heldLink
+	// resumed specifies whether the remote accepted resuming the held link.
+	resumed bool
+	// resumedSession is the link encryption session derived when resuming.
+	resumedSession *state.EncryptionSession
 }
 
 type peeringRequest struct {
@@ -55,6 +63,8 @@ type peeringRequest struct {
 
 	LinkVersion int `cbor:"lv,omitempty"   json:"lv,omitempty"`
 	TunMTU      int `cbor:"tmtu,omitempty" json:"tmtu,omitempty"`
+
+	Resume *peeringResume `cbor:"rs,omitempty" json:"rs,omitempty"`
 }
 
 type peeringResponse struct {
@@ -63,9 +73,25 @@ type peeringResponse struct {
 	KeyExchange     []byte `cbor:"kx,omitempty"  json:"kx,omitempty"`
 	KeyExchangeType string `cbor:"kxt,omitempty" json:"kxt,omitempty"`
 
+	// The hybrid key exchange is offered in addition to the default key
+	// exchange, so that routers that do not support it can fall back.
+	HybridKeyExchange     []byte `cbor:"hkx,omitempty"  json:"hkx,omitempty"`
+	HybridKeyExchangeType string `cbor:"hkxt,omitempty" json:"hkxt,omitempty"`
+
+	Resume *peeringResumeAccept `cbor:"rs,omitempty" json:"rs,omitempty"`
+
 	Err string `cbor:"err,omitempty" json:"err,omitempty"`
 }
 
+// selectKeyExchange returns the hybrid key exchange, if offered and
+// supported, and the default key exchange otherwise.
+func (r *peeringResponse) selectKeyExchange() (kxKey []byte, kxType string) {
+	if len(r.HybridKeyExchange) > 0 && state.KXTypeSupported(r.HybridKeyExchangeType) {
+		return r.HybridKeyExchange, r.HybridKeyExchangeType
+	}
+	return r.KeyExchange, r.KeyExchangeType
+}
+
 type peeringAck struct {
 	Ack             bool   `cbor:"ack,omitempty" json:"ack,omitempty"`
 	KeyExchange     []byte `cbor:"kx,omitempty"  json:"kx,omitempty"`
@@ -78,7 +104,9 @@ type peeringErr struct {
 	Err string `cbor:"err,omitempty" json:"err,omitempty"`
 }
 
-func (p *Peering) createPeeringRequest(client bool) (*peeringRequestState, frame.Frame, error) {
+// createPeeringRequest creates a new peering request.
+// If a held link is given, the request asks the remote to resume it.
+func (p *Peering) createPeeringRequest(client bool, resume *heldLink) (*peeringRequestState, frame.Frame, error) {
 	challenge := make([]byte, challengeSize)
 	_, err := rand.Read(challenge)
 	if err != nil {
@@ -95,6 +123,18 @@ func (p *Peering) createPeeringRequest(client bool) (*peeringRequestState, frame
 		LinkVersion:   1,
 		TunMTU:        p.instance.Config().TunMTU(),
 	}
+	// Add resume auth, if resuming a held link.
+	var resumeSession *state.Session
+	if resume != nil {
+		resumeSession = p.instance.State().GetSession(resume.peer)
+	}
+	if resumeSession != nil {
+		r.Resume = &peeringResume{
+			Auth: makeResumeRequestAuth(resume.secret, challenge, p.instance.Identity().IP, resume.peer),
+		}
+	} else {
+		resume = nil
+	}
 	msg, err := cbor.Marshal(r)
 	if err != nil {
 		return nil, nil, fmt.Errorf("marshal peering request: %w", err)
@@ -119,12 +159,18 @@ func (p *Peering) createPeeringRequest(client bool) (*peeringRequestState, frame
 	}
 	f.SetTTL(1)
 
-	return &peeringRequestState{
+	reqState := &peeringRequestState{
 		peering:   p,
 		challenge: challenge,
 		client:    client,
 		step:      1,
-	}, f, nil
+	}
+	if resume != nil {
+		reqState.resume = resume
+		reqState.session = resumeSession
+		reqState.remoteIP = resume.peer
+	}
+	return reqState, f, nil
 }
 
 func (state *peeringRequestState) handle(in frame.Frame) (response frame.Frame, err error) {
@@ -145,10 +191,21 @@ func (state *peeringRequestState) handle(in frame.Frame) (response frame.Frame,
 		if respErr != nil {
 			goto done
 		}
-		respErr = in.Reply(nil, data, nil)
+		if state.remoteIP.IsValid() {
+			respErr = in.ReplyTo(state.peering.instance.Identity().IP, state.remoteIP, nil, data, nil)
+		} else {
+			respErr = in.Reply(nil, data, nil)
+		}
 		if respErr != nil {
 			goto done
 		}
+		// Sign the error response, so that the remote can read it.
+		if state.session != nil {
+			respErr = in.Seal(state.session)
+			if respErr != nil {
+				goto done
+			}
+		}
 		response = in
 	}
 
@@ -190,7 +247,8 @@ func (state *peeringRequestState) handlePeeringRequest(in frame.Frame) (frame.Fr
 	}
 
 	// Check if we already have a connection to this router.
-	if state.peering.GetLink(r.Address.IP) != nil {
+	// If the remote wants to resume a link, check again later.
+	if state.peering.GetLink(r.Address.IP) != nil && r.Resume == nil {
 		return nil, errors.New("already connected to this router")
 	}
 
@@ -227,6 +285,13 @@ func (state *peeringRequestState) handlePeeringRequest(in frame.Frame) (frame.Fr
 	state.remoteVersion = r.RouterVersion
 	state.remoteLite = r.LiteMode
 
+	// Check if the remote may connect to us.
+	if !state.client {
+		if err := state.peering.checkInboundPolicy(state.remoteIP, state.remoteSource); err != nil {
+			return nil, err
+		}
+	}
+
 	// Start building response.
 	resp := &peeringResponse{}
 
@@ -253,6 +318,37 @@ func (state *peeringRequestState) handlePeeringRequest(in frame.Frame) (frame.Fr
 	// Sign it with the frame later.
 	resp.Challenge = r.Challenge
 
+	// Accept resuming a held link, if the remote proves knowing its secret.
+	if r.Resume != nil && !state.client {
+		localIP := state.peering.instance.Identity().IP
+		held := state.peering.getHeldLinkForResume(state.remoteIP, func(secret []byte) bool {
+			return checkResumeAuth(
+				r.Resume.Auth,
+				makeResumeRequestAuth(secret, r.Challenge, state.remoteIP, localIP),
+			)
+		})
+		if held != nil {
+			nonce := make([]byte, challengeSize)
+			if _, err := rand.Read(nonce); err != nil {
+				return nil, fmt.Errorf("generate resume nonce: %w", err)
+			}
+			resumedSession, err := deriveResumedSession(held.secret, r.Challenge, nonce, state.client)
+			if err != nil {
+				return nil, fmt.Errorf("derive resumed session: %w", err)
+			}
+			resp.Resume = &peeringResumeAccept{
+				Nonce: nonce,
+				Auth:  makeResumeAcceptAuth(held.secret, r.Challenge, nonce, state.remoteIP, localIP),
+			}
+			state.resume = held
+			state.resumed = true
+			state.resumedSession = resumedSession
+		}
+	}
+	if !state.resumed && state.peering.GetLink(r.Address.IP) != nil {
+		return nil, errors.New("already connected to this router")
+	}
+
 	// Generate key exchange.
 	if state.client {
 		kxKey, kxType, err := state.session.Encryption().InitKeyClientStart()
@@ -261,6 +357,13 @@ func (state *peeringRequestState) handlePeeringRequest(in frame.Frame) (frame.Fr
 		}
 		resp.KeyExchange = kxKey
 		resp.KeyExchangeType = kxType
+
+		hkxKey, hkxType, err := state.session.Encryption().InitKeyClientHybrid()
+		if err != nil {
+			return nil, fmt.Errorf("init hybrid key exchange: %w", err)
+		}
+		resp.HybridKeyExchange = hkxKey
+		resp.HybridKeyExchangeType = hkxType
 	}
 
 	// Create response frame.
@@ -333,6 +436,29 @@ func (state *peeringRequestState) handlePeeringResponse(in frame.Frame) (frame.F
 		}
 	}
 
+	// Complete resuming the held link, if the remote accepted.
+	if state.resume != nil && r.Resume != nil {
+		expectedAuth := makeResumeAcceptAuth(
+			state.resume.secret,
+			state.challenge,
+			r.Resume.Nonce,
+			state.peering.instance.Identity().IP,
+			state.remoteIP,
+		)
+		if !checkResumeAuth(r.Resume.Auth, expectedAuth) {
+			return nil, errors.New("resume auth failed")
+		}
+		resumedSession, err := deriveResumedSession(state.resume.secret, state.challenge, r.Resume.Nonce, state.client)
+		if err != nil {
+			return nil, fmt.Errorf("derive resumed session: %w", err)
+		}
+		state.resumed = true
+		state.resumedSession = resumedSession
+
+		// No further messages are needed.
+		return nil, nil //nolint:nilnil // Setup is complete.
+	}
+
 	// Start building response.
 	resp := &peeringAck{}
 
@@ -341,7 +467,8 @@ func (state *peeringRequestState) handlePeeringResponse(in frame.Frame) (frame.F
 		if len(r.KeyExchange) == 0 || r.KeyExchangeType == "" {
 			return nil, errors.New("key exchange missing")
 		}
-		kxKey, kxType, err := state.session.Encryption().InitKeyServer(r.KeyExchange, r.KeyExchangeType)
+		kxKey, kxType := r.selectKeyExchange()
+		kxKey, kxType, err := state.session.Encryption().InitKeyServer(kxKey, kxType)
 		if err != nil {
 			return nil, fmt.Errorf("process key exchange: %w", err)
 		}
@@ -413,6 +540,10 @@ func (state *peeringRequestState) handlePeeringAck(in frame.Frame) error {
 func (state *peeringRequestState) finalize() (*state.EncryptionSession, error) {
 	// Clean up exchange keys when done.
 	defer state.session.Encryption().InitCleanup()
+	// Use the resumed session, if the link was resumed.
+	if state.resumed {
+		return state.resumedSession, nil
+	}
 	// Derive link layer encryption session.
 	return state.session.Encryption().DeriveSessionFromKX(state.client, "link layer crypt")
 }
@@ -6,6 +6,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/mycoria/mycoria/api/httpapi"
 	"github.com/mycoria/mycoria/config"
 	"github.com/mycoria/mycoria/frame"
 	"github.com/mycoria/mycoria/m"
@@ -37,11 +38,11 @@ func TestPeeringInit(t *testing.T) {
 	peeringB := New(instB, nil)
 
 	// Initialize connection.
-	stateA, msgFromA, err := peeringA.createPeeringRequest(true)
+	stateA, msgFromA, err := peeringA.createPeeringRequest(true, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
-	stateB, msgFromB, err := peeringB.createPeeringRequest(false)
+	stateB, msgFromB, err := peeringB.createPeeringRequest(false, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -128,6 +129,7 @@ type testInstance struct {
 	TunDeviceStub    *tun.Device
 	FrameBuilderStub *frame.Builder
 	RoutingTableStub *m.RoutingTable
+	APIStub          *httpapi.API
 }
 
 var _ instance = &testInstance{}
@@ -166,3 +168,8 @@ func (stub *testInstance) FrameBuilder() *frame.Builder {
 func (stub *testInstance) RoutingTable() *m.RoutingTable {
 	return stub.RoutingTableStub
 }
+
+// API returns the local http API.
+func (stub *testInstance) API() *httpapi.API {
+	return stub.APIStub
+}
@@ -10,6 +10,8 @@ import (
 	"sync/atomic"
 	"time"
 
+	"golang.org/x/time/rate"
+
 	"github.com/mycoria/mycoria/frame"
 	"github.com/mycoria/mycoria/m"
 	"github.com/mycoria/mycoria/mgr"
@@ -22,6 +24,9 @@ var (
 	ErrNetworkWriteError = errors.New("write i/o error")
 )
 
+// linkSetupTimeout is the maximum duration of the link setup.
+const linkSetupTimeout = 30 * time.Second
+
 // Link represents a network connection to another router.
 type Link interface {
 	String() string
@@ -41,6 +46,9 @@ type Link interface {
 	// Outgoing returns whether the connection was initiated by this router.
 	Outgoing() bool
 
+	// Proxy returns the proxy through which the link was connected, if any.
+	Proxy() string
+
 	// Lite returns whether the connected router is in lite mode.
 	Lite() bool
 
@@ -86,10 +94,23 @@ type Link interface {
 	Close(log func())
 }
 
+// priorityConn is implemented by connections that transport priority frames
+// separately from regular frames, so that they do not queue up behind them.
+type priorityConn interface {
+	// WritePriority writes priority data to the connection.
+	WritePriority(b []byte) (n int, err error)
+
+	// ReadingPriority returns whether the data currently being read is
+	// priority data.
+	ReadingPriority() bool
+}
+
 // LinkBase implements common functions to comply with the Link interface.
 type LinkBase struct { //nolint:maligned
 	// conn is the actual underlying connection.
 	conn net.Conn
+	// prioConn is the underlying connection, if it supports priority frames.
+	prioConn priorityConn
 	// encSession is the encryption session.
 	encSession *state.EncryptionSession
 
@@ -109,6 +130,13 @@ type LinkBase struct { //nolint:maligned
 	peeringURL *m.PeeringURL
 	// outgoing specifies whether the link was initiated by this router.
 	outgoing bool
+	// proxy holds the proxy through which the link was connected, if any.
+	proxy string
+	// resumed specifies whether the link resumed a lost link.
+	resumed bool
+	// resumeSecret holds the secret to resume the link when lost.
+	// It is only set when the link was fully set up.
+	resumeSecret []byte
 	// lite specifies whether the connected router is in lite mode.
 	lite bool
 
@@ -118,6 +146,12 @@ type LinkBase struct { //nolint:maligned
 	// closing specifies if the link is being closed
 	closing atomic.Bool
 
+	// rateLimiter limits the traffic sent via this link, if configured.
+	rateLimiter *rate.Limiter
+	// throttledUntil holds the time (in unix nanoseconds) until which the
+	// writer is waiting for a rate limit.
+	throttledUntil atomic.Int64
+
 	// peering references back to the peering manager.
 	peering *Peering
 
@@ -156,6 +190,7 @@ func newLinkBase(
 		started:       time.Now(),
 		peering:       peering,
 	}
+	link.prioConn, _ = conn.(priorityConn)
 	link.latency = link.getFallbackLatency()
 
 	return link
@@ -202,6 +237,11 @@ func (link *LinkBase) Outgoing() bool {
 	return link.outgoing
 }
 
+// Proxy returns the proxy through which the link was connected, if any.
+func (link *LinkBase) Proxy() string {
+	return link.proxy
+}
+
 // Lite returns whether the connected router is in lite mode.
 func (link *LinkBase) Lite() bool {
 	return link.lite
@@ -296,15 +336,20 @@ func (link *LinkBase) BytesOut() uint64 {
 // FlowControlIndicator returns a flow control flag that indicates the
 // pressure on the sending queue of this link.
 func (link *LinkBase) FlowControlIndicator() frame.FlowControlFlag {
+	var queueFlag frame.FlowControlFlag
 	percent := len(link.sendQueueRegl) * 100 / cap(link.sendQueueRegl)
 	switch {
 	case percent >= 70: // Send queue is over 70% full.
-		return frame.FlowControlFlagDecreaseFlow
+		queueFlag = frame.FlowControlFlagDecreaseFlow
 	case percent >= 30: // Send queue is over 30% full.
-		return frame.FlowControlFlagHoldFlow
+		queueFlag = frame.FlowControlFlagHoldFlow
 	default:
-		return frame.FlowControlFlagIncreaseFlow
+		queueFlag = frame.FlowControlFlagIncreaseFlow
 	}
+
+	// Report the higher pressure of the queue and the rate limit.
+	// Lower flags indicate higher pressure.
+	return min(queueFlag, link.rateLimitIndicator())
 }
 
 // IsClosing returns whether the link is closing or has closed.
@@ -323,7 +368,12 @@ func (link *LinkBase) Close(log func()) {
 			log()
 		}
 
-		link.peering.RemoveLink(link)
+		// Hold the link for resumption, if possible.
+		if len(link.resumeSecret) > 0 && !link.peering.mgr.IsDone() {
+			link.peering.holdLink(link)
+		} else {
+			link.peering.RemoveLink(link)
+		}
 		_ = link.conn.Close()
 	}
 }
@@ -412,16 +462,20 @@ func (link *LinkBase) writer(w *mgr.WorkerCtx) error {
 
 	var (
 		f                 frame.Frame
+		prio              bool
 		consecutiveErrors int
 	)
 	for {
 		// Get next frame to write.
 		select {
 		case f = <-link.sendQueuePrio:
+			prio = true
 		default:
 			select {
 			case f = <-link.sendQueuePrio:
+				prio = true
 			case f = <-link.sendQueueRegl:
+				prio = false
 			case <-w.Done():
 				return nil
 			}
@@ -430,8 +484,14 @@ func (link *LinkBase) writer(w *mgr.WorkerCtx) error {
 			return nil
 		}
 
+		// Apply rate limits.
+		if !link.waitForRateLimit(w, f, prio) {
+			f.ReturnToPool()
+			return nil
+		}
+
 		// Write frame.
-		err := link.writeFrame(f)
+		err := link.writeFrame(f, prio)
 		if err == nil {
 			consecutiveErrors = 0
 			continue
@@ -484,7 +544,8 @@ func (link *LinkBase) readFrame(b *frame.Builder) (frame.Frame, error) {
 	if link.encSession != nil {
 		// Unseal linked frame.
 		lf := LinkFrame(data)
-		if err := lf.Unseal(link.encSession); err != nil {
+		prio := link.prioConn != nil && link.prioConn.ReadingPriority()
+		if err := lf.unseal(link.encSession, prio); err != nil {
 			return nil, fmt.Errorf("unseal link frame: %w", err)
 		}
 		// Parse Frame.
@@ -505,10 +566,13 @@ func (link *LinkBase) readFrame(b *frame.Builder) (frame.Frame, error) {
 	return f, nil
 }
 
-func (link *LinkBase) writeFrame(f frame.Frame) error {
+func (link *LinkBase) writeFrame(f frame.Frame, prio bool) error {
 	// Return frame to pool when done writing.
 	defer f.ReturnToPool()
 
+	// Only send as priority if the connection supports it.
+	prio = prio && link.prioConn != nil
+
 	// If link encryption is enabled, wrap the frame in a link frame.
 	if link.encSession != nil {
 		data, err := f.FrameDataWithMargins(FrameOffset, FrameOverhead)
@@ -516,10 +580,10 @@ func (link *LinkBase) writeFrame(f frame.Frame) error {
 			return fmt.Errorf("frame with margins %d,%d: %w", FrameOffset, FrameOverhead, err)
 		}
 		lf := LinkFrame(data)
-		if err := lf.Seal(link.encSession); err != nil {
+		if err := lf.seal(link.encSession, prio); err != nil {
 			return fmt.Errorf("seal link frame: %w", err)
 		}
-		if err := link.writeData(data); err != nil {
+		if err := link.writeData(data, prio); err != nil {
 			return fmt.Errorf("write: %w", err)
 		}
 		return nil
@@ -534,7 +598,7 @@ func (link *LinkBase) writeFrame(f frame.Frame) error {
 		return fmt.Errorf("frame is too big (%d bytes)", len(data))
 	}
 	m.PutUint16(data[:2], uint16(len(data)))
-	if err := link.writeData(data); err != nil {
+	if err := link.writeData(data, prio); err != nil {
 		return fmt.Errorf("write: %w", err)
 	}
 	return nil
@@ -589,11 +653,16 @@ func (link *LinkBase) readLengthAndData() ([]byte, error) {
 	return pooledSlice[:dataLen], nil
 }
 
-func (link *LinkBase) writeData(data []byte) error {
-	var written int
+func (link *LinkBase) writeData(data []byte, prio bool) error {
+	// Select write function.
+	write := link.conn.Write
+	if prio {
+		write = link.prioConn.WritePriority
+	}
 
+	var written int
 	for written < len(data) {
-		n, err := link.conn.Write(data[written:])
+		n, err := write(data[written:])
 		if err != nil {
 			return fmt.Errorf("%w: %w", ErrNetworkWriteError, err)
 		}
@@ -618,12 +687,26 @@ func (link *LinkBase) setupWorker(w *mgr.WorkerCtx) error {
 		if cmlErr == nil && cml != nil {
 			link.geoMark = fmt.Sprintf("%s (%s)", cml.Country, cml.Continent)
 		}
-		// Assign switch label.
-		err = link.assignSwitchLabel()
+		// Assign switch label, reuse it if the link was resumed.
+		if peeringState.resumed {
+			link.switchLabel = peeringState.resume.switchLabel
+			link.resumed = true
+		} else {
+			err = link.assignSwitchLabel()
+		}
 	}
 	if err == nil {
 		// Add link to peerings.
-		err = link.peering.AddLink(link)
+		// Enforce inbound peer limit, resumed links do not add a new peer.
+		link.setupRateLimit()
+		if link.outgoing || link.resumed {
+			err = link.peering.AddLink(link)
+		} else {
+			err = link.peering.addInboundLink(link)
+		}
+	}
+	if err == nil {
+		link.enableResumption()
 	}
 	if err != nil {
 		link.Close(func() {
@@ -644,6 +727,7 @@ func (link *LinkBase) setupWorker(w *mgr.WorkerCtx) error {
 		"label", link.SwitchLabel(),
 		"peeringURL", link.peeringURL,
 		"outgoing", link.outgoing,
+		"resumed", link.resumed,
 	)
 	link.startWorkers()
 	return nil
@@ -654,6 +738,16 @@ func (link *LinkBase) handleSetup(mgr *mgr.Manager) (*LinkBase, error) {
 	if err == nil {
 		link.encSession, err = peeringState.finalize()
 	}
+	if err == nil {
+		// Check if the peer matches the pinned router, if set.
+		pinned, pinErr := getPinnedRouter(link.peeringURL)
+		switch {
+		case pinErr != nil:
+			err = pinErr
+		case pinned.IsValid() && pinned != peeringState.session.Address().IP:
+			err = fmt.Errorf("peer %s does not match pinned router %s", peeringState.session.Address().IP, pinned)
+		}
+	}
 	if err == nil {
 		// Assign peer and geomarked country.
 		link.peer = peeringState.session.Address().IP
@@ -662,13 +756,22 @@ func (link *LinkBase) handleSetup(mgr *mgr.Manager) (*LinkBase, error) {
 		if cmlErr == nil && cml != nil {
 			link.geoMark = fmt.Sprintf("%s (%s)", cml.Country, cml.Continent)
 		}
-		// Assign switch label.
-		err = link.assignSwitchLabel()
+		// Assign switch label, reuse it if the link was resumed.
+		if peeringState.resumed {
+			link.switchLabel = peeringState.resume.switchLabel
+			link.resumed = true
+		} else {
+			err = link.assignSwitchLabel()
+		}
 	}
 	if err == nil {
 		// Add link to peerings.
+		link.setupRateLimit()
 		err = link.peering.AddLink(link)
 	}
+	if err == nil {
+		link.enableResumption()
+	}
 	if err != nil {
 		link.Close(nil)
 		return nil, err
@@ -681,6 +784,7 @@ func (link *LinkBase) handleSetup(mgr *mgr.Manager) (*LinkBase, error) {
 		"label", link.SwitchLabel(),
 		"peeringURL", link.peeringURL,
 		"outgoing", link.outgoing,
+		"resumed", link.resumed,
 	)
 	link.startWorkers()
 	return link, nil
@@ -689,17 +793,32 @@ func (link *LinkBase) handleSetup(mgr *mgr.Manager) (*LinkBase, error) {
 func (link *LinkBase) handleSetupMessages(client bool) (*peeringRequestState, error) {
 	builder := link.peering.instance.FrameBuilder()
 
+	// Limit the time the setup may take.
+	// Required for connectionless protocols, where the remote might never answer.
+	_ = link.conn.SetDeadline(time.Now().Add(linkSetupTimeout))
+	defer func() {
+		_ = link.conn.SetDeadline(time.Time{})
+	}()
+
+	// Try to resume a lost link, if connecting to the same peering URL again.
+	var resume *heldLink
+	if client {
+		resume = link.peering.getHeldLinkByURL(link.peeringURL)
+	}
+
 	// Initialize connection.
-	state, f, err := link.peering.createPeeringRequest(client)
+	state, f, err := link.peering.createPeeringRequest(client, resume)
 	if err != nil {
 		return nil, fmt.Errorf("create peering request (1): %w", err)
 	}
-	err = link.writeFrame(f)
+	state.remoteSource = getRemoteIP(link.RemoteAddr())
+	err = link.writeFrame(f, false)
 	if err != nil {
 		return nil, fmt.Errorf("write peering request (1): %w", err)
 	}
 
 	// Handle setup messages.
+	var deferred frame.Frame
 	for i := 1; i <= 3; i++ {
 		// Read next setup msg.
 		f, err := link.readFrame(builder)
@@ -711,21 +830,42 @@ func (link *LinkBase) handleSetupMessages(client bool) (*peeringRequestState, er
 		if err != nil {
 			// If the error also has a response, try to write it as best effort.
 			if f != nil {
-				_ = link.writeFrame(f)
+				_ = link.writeFrame(f, false)
 			}
 			return nil, fmt.Errorf("handle peering msg %d: %w", i, err)
 		}
 
+		// When resuming, hold back the response to the remote's peering request,
+		// as it is not needed if the remote accepts resuming the link.
+		if i == 1 && state.resume != nil && !state.resumed {
+			deferred = f
+			continue
+		}
+
 		// If there is no respose, we are done with the setup.
 		if f == nil {
 			return state, nil
 		}
 
+		// Send held back response, as the remote did not accept resuming.
+		if deferred != nil {
+			err = link.writeFrame(deferred, false)
+			if err != nil {
+				return nil, fmt.Errorf("write peering msg response 2: %w", err)
+			}
+			deferred = nil
+		}
+
 		// Return response.
-		err = link.writeFrame(f)
+		err = link.writeFrame(f, false)
 		if err != nil {
 			return nil, fmt.Errorf("write peering msg response %d: %w", i+1, err)
 		}
+
+		// The setup is complete when resuming was accepted.
+		if state.resumed {
+			return state, nil
+		}
 	}
 	return nil, errors.New("too much setup")
 }
@@ -733,7 +873,7 @@ func (link *LinkBase) handleSetupMessages(client bool) (*peeringRequestState, er
 func (link *LinkBase) assignSwitchLabel() error {
 	// Derive label from address.
 	label, ok := m.DeriveSwitchLabelFromIP(link.peer)
-	if ok && label != 0 && link.peering.GetLinkByLabel(label) == nil {
+	if ok && label != 0 && !link.peering.isSwitchLabelInUse(label) {
 		link.switchLabel = label
 		return nil
 	}
@@ -742,7 +882,7 @@ func (link *LinkBase) assignSwitchLabel() error {
 	if m.RoutingAddressPrefix.Contains(link.peer) {
 		for i := 0; i < 100; i++ {
 			label, ok := m.GetRandomSwitchLabel(true)
-			if ok && label != 0 && link.peering.GetLinkByLabel(label) == nil {
+			if ok && label != 0 && !link.peering.isSwitchLabelInUse(label) {
 				link.switchLabel = label
 				return nil
 			}
@@ -752,7 +892,7 @@ func (link *LinkBase) assignSwitchLabel() error {
 	// Then try 1000 time for a longer one.
 	for i := 0; i < 1000; i++ {
 		label, ok := m.GetRandomSwitchLabel(false)
-		if ok && label != 0 && link.peering.GetLinkByLabel(label) == nil {
+		if ok && label != 0 && !link.peering.isSwitchLabelInUse(label) {
 			link.switchLabel = label
 			return nil
 		}
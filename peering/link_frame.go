@@ -99,11 +99,18 @@ func (f LinkFrame) LinkDataWithAuth() []byte {
 
 // Seal sets the link frame metadata and encrypts everything.
 func (f LinkFrame) Seal(encrypt *state.EncryptionSession) error {
+	return f.seal(encrypt, false)
+}
+
+// seal seals the link frame using the priority or regular sequence.
+// The priority sequence must only be used if the link transports priority
+// frames separately, as they will arrive out of order otherwise.
+func (f LinkFrame) seal(encrypt *state.EncryptionSession, prio bool) error {
 	// Prepare.
 	if len(f) > 0xFFFF {
 		return fmt.Errorf("link frame is too big (%d bytes)", len(f))
 	}
-	seqNum, ack, recvRate, c, err := encrypt.Out(false)
+	seqNum, ack, recvRate, c, err := encrypt.Out(prio)
 	if err != nil {
 		return err
 	}
@@ -122,9 +129,14 @@ func (f LinkFrame) Seal(encrypt *state.EncryptionSession) error {
 
 // Unseal decrypts the link frame.
 func (f LinkFrame) Unseal(encrypt *state.EncryptionSession) error {
+	return f.unseal(encrypt, false)
+}
+
+// unseal decrypts the link frame using the priority or regular sequence.
+func (f LinkFrame) unseal(encrypt *state.EncryptionSession, prio bool) error {
 	// Prepare.
 	seqNum := f.SequenceNum()
-	c, err := encrypt.In(seqNum, false)
+	c, err := encrypt.In(seqNum, prio)
 	if err != nil {
 		return err
 	}
@@ -136,5 +148,5 @@ func (f LinkFrame) Unseal(encrypt *state.EncryptionSession) error {
 	}
 
 	// Check sequence.
-	return encrypt.Check(seqNum, false)
+	return encrypt.Check(seqNum, prio)
 }
@@ -7,6 +7,9 @@ import (
 	"slices"
 	"sync"
 
+	"golang.org/x/time/rate"
+
+	"github.com/mycoria/mycoria/api/httpapi"
 	"github.com/mycoria/mycoria/config"
 	"github.com/mycoria/mycoria/frame"
 	"github.com/mycoria/mycoria/m"
@@ -24,6 +27,7 @@ type Peering struct {
 
 	links        map[netip.Addr]Link
 	linksByLabel map[m.SwitchLabel]Link
+	heldLinks    map[netip.Addr]*heldLink
 	linksLock    sync.RWMutex
 
 	listeners     map[string]Listener
@@ -32,6 +36,12 @@ type Peering struct {
 	protocols     map[string]Protocol
 	protocolsLock sync.RWMutex
 
+	webSocketMounts     map[string]*wsAcceptor
+	webSocketMountsLock sync.Mutex
+
+	// rateLimiter limits the total traffic sent via all links.
+	rateLimiter *rate.Limiter
+
 	PeeringEvents *mgr.EventMgr[*EventPeering]
 }
 
@@ -46,6 +56,7 @@ type instance interface {
 
 	TunDevice() *tun.Device
 	RoutingTable() *m.RoutingTable
+	API() *httpapi.API
 }
 
 // New returns a new peering manager.
@@ -56,8 +67,14 @@ func New(instance instance, frameHandler chan frame.Frame) *Peering {
 		triggerPeering: make(chan struct{}, 1),
 		links:          make(map[netip.Addr]Link),
 		linksByLabel:   make(map[m.SwitchLabel]Link),
+		heldLinks:      make(map[netip.Addr]*heldLink),
 		listeners:      make(map[string]Listener),
 		protocols:      make(map[string]Protocol),
+
+		webSocketMounts: make(map[string]*wsAcceptor),
+	}
+	if rl := instance.Config().Router.RateLimit; rl.IsSet() {
+		p.rateLimiter = rate.NewLimiter(rate.Limit(rl.Rate), rl.Burst)
 	}
 
 	return p
@@ -66,12 +83,16 @@ func New(instance instance, frameHandler chan frame.Frame) *Peering {
 // Start starts the peering manager. It:
 // - Starts configured listeners.
 // - Connects to configured peers.
+// - Discovers routers on the local network, if enabled.
 func (p *Peering) Start(m *mgr.Manager) error {
 	p.mgr = m
 	p.PeeringEvents = mgr.NewEventMgr[*EventPeering]("peering", p.mgr)
 
 	p.mgr.Go("listen manager", p.listenMgr)
 	p.mgr.Go("connect manager", p.connectMgr)
+	if len(p.instance.Config().Router.Discover) > 0 {
+		p.mgr.Go("lan discovery", p.discoveryMgr)
+	}
 
 	return nil
 }
@@ -82,6 +103,7 @@ func (p *Peering) Stop(mgr *mgr.Manager) error {
 
 	p.closeAllListeners()
 	p.closeAllLinks()
+	p.releaseAllHeldLinks()
 
 	return nil
 }
@@ -147,6 +169,12 @@ func (p *Peering) AddLink(link Link) error {
 	p.linksLock.Lock()
 	defer p.linksLock.Unlock()
 
+	return p.addLink(link)
+}
+
+// addLink adds the link to the peering list.
+// The links lock must be held.
+func (p *Peering) addLink(link Link) error {
 	_, err := p.instance.RoutingTable().AddRoute(m.RoutingTableEntry{
 		DstIP:   link.Peer(),
 		NextHop: link.Peer(),
@@ -158,17 +186,33 @@ func (p *Peering) AddLink(link Link) error {
 
 	p.links[link.Peer()] = link
 	p.linksByLabel[link.SwitchLabel()] = link
+	p.removeHeldLink(link.Peer())
 	return nil
 }
 
 // RemoveLink removes the link from the peering list.
+// It also removes a held link of the peer and the peer's routes.
 // The link is not closed by this function!
 func (p *Peering) RemoveLink(link Link) {
 	p.linksLock.Lock()
 	defer p.linksLock.Unlock()
 
+	p.removeLink(link)
+}
+
+// removeLink removes the link from the peering list.
+// The links lock must be held.
+func (p *Peering) removeLink(link Link) {
+	// Do not touch another link of the same peer.
+	if current, ok := p.links[link.Peer()]; ok && current != link {
+		return
+	}
+
 	delete(p.links, link.Peer())
-	delete(p.linksByLabel, link.SwitchLabel())
+	if p.linksByLabel[link.SwitchLabel()] == link {
+		delete(p.linksByLabel, link.SwitchLabel())
+	}
+	p.removeHeldLink(link.Peer())
 	p.instance.RoutingTable().RemoveNextHop(link.Peer())
 
 	// If we reach zero links, trigger peering.
@@ -0,0 +1,358 @@
+package peering
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+// ProtocolQUIC uses QUIC.
+// Priority frames are sent on a separate stream, so they never queue up
+// behind regular frames.
+var ProtocolQUIC = NewProtocol(
+	"quic",
+	quicPeerWith,
+	quicStartListener,
+)
+
+var _ Protocol = ProtocolQUIC
+
+const (
+	// quicALPN is the application protocol negotiated via TLS.
+	quicALPN = "mycoria"
+
+	// quicStreamTypeRegl identifies the stream for regular frames.
+	quicStreamTypeRegl byte = 1
+	// quicStreamTypePrio identifies the stream for priority frames.
+	quicStreamTypePrio byte = 2
+)
+
+// quicConfig is the QUIC config used for all connections.
+// Keep-alive and idle detection is handled by the router.
+var quicConfig = &quic.Config{
+	HandshakeIdleTimeout: 10 * time.Second,
+	MaxIdleTimeout:       5 * time.Minute,
+}
+
+func quicPeerWith(peering *Peering, peeringURL *m.PeeringURL, ip netip.Addr) (Link, error) {
+	// Build destination address.
+	var host string
+	switch {
+	case ip.IsValid():
+		host = ip.String()
+	case peeringURL.Domain != "":
+		host = peeringURL.Domain
+	default:
+		return nil, errors.New("host not specified")
+	}
+	address := net.JoinHostPort(host, strconv.FormatUint(uint64(peeringURL.Port), 10))
+
+	// Create TLS config.
+	tlsConfig, err := makeTLSClientConfig(peeringURL, quicALPN)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig.MinVersion = tls.VersionTLS13
+
+	// Connect.
+	ctx, cancel := context.WithTimeout(peering.mgr.Ctx(), 30*time.Second)
+	defer cancel()
+	qConn, err := quic.DialAddr(ctx, address, tlsConfig, quicConfig)
+	if err != nil {
+		return nil, fmt.Errorf("connect to %s: %w", address, err)
+	}
+	conn, err := newQUICConn(qConn, peering)
+	if err != nil {
+		return nil, fmt.Errorf("set up streams with %s: %w", address, err)
+	}
+
+	// Start link setup.
+	newLink := newLinkBase(
+		conn,
+		peeringURL,
+		true,
+		peering,
+	)
+	return newLink.handleSetup(peering.mgr)
+}
+
+func quicStartListener(peering *Peering, peeringURL *m.PeeringURL, ip netip.Addr) (Listener, error) {
+	// Build listen address.
+	var host string
+	switch {
+	case ip.IsValid():
+		host = ip.String()
+	case peeringURL.Domain != "":
+		host = peeringURL.Domain
+	default:
+		host = ""
+	}
+	address := net.JoinHostPort(host, strconv.FormatUint(uint64(peeringURL.Port), 10))
+
+	// Create TLS config.
+	tlsConfig, err := makeTLSServerConfig(peering.instance.Identity(), quicALPN)
+	if err != nil {
+		return nil, fmt.Errorf("create tls config: %w", err)
+	}
+	tlsConfig.MinVersion = tls.VersionTLS13
+
+	// Bind listener.
+	qListener, err := quic.ListenAddr(address, tlsConfig, quicConfig)
+	if err != nil {
+		return nil, fmt.Errorf("listen: %w", err)
+	}
+
+	// Start listener.
+	newListener := newListenerBase(
+		peeringURL.FormatWith(host),
+		&quicListener{
+			listener: qListener,
+			peering:  peering,
+		},
+		peeringURL,
+		peering,
+	)
+	newListener.startWorkers()
+
+	// Add to peering manager and return.
+	peering.AddListener(newListener.id, newListener)
+	return newListener, nil
+}
+
+// quicListener wraps a QUIC listener to implement net.Listener.
+type quicListener struct {
+	listener *quic.Listener
+	peering  *Peering
+}
+
+var _ net.Listener = &quicListener{}
+
+// Accept waits for and returns the next connection to the listener.
+func (ln *quicListener) Accept() (net.Conn, error) {
+	for {
+		qConn, err := ln.listener.Accept(ln.peering.mgr.Ctx())
+		if err != nil {
+			return nil, err
+		}
+
+		conn, err := newQUICConn(qConn, ln.peering)
+		if err != nil {
+			// Failing to set up streams only affects this connection.
+			ln.peering.mgr.Debug(
+				"failed to set up quic streams",
+				"remote", qConn.RemoteAddr(),
+				"err", err,
+			)
+			continue
+		}
+		return conn, nil
+	}
+}
+
+// Close closes the listener.
+func (ln *quicListener) Close() error {
+	return ln.listener.Close()
+}
+
+// Addr returns the listener's network address.
+func (ln *quicListener) Addr() net.Addr {
+	return ln.listener.Addr()
+}
+
+// quicConn is a QUIC connection that transports frames on two unidirectional
+// streams per direction: one for regular and one for priority frames.
+type quicConn struct {
+	*frameQueue
+
+	conn quic.Connection
+	mgr  *mgr.Manager
+
+	reglStream quic.SendStream
+	reglLock   sync.Mutex
+	prioStream quic.SendStream
+	prioLock   sync.Mutex
+}
+
+var (
+	_ net.Conn     = &quicConn{}
+	_ priorityConn = &quicConn{}
+)
+
+func newQUICConn(qConn quic.Connection, peering *Peering) (*quicConn, error) {
+	conn := &quicConn{
+		frameQueue: newFrameQueue(100, 1000),
+		conn:       qConn,
+		mgr:        peering.mgr,
+	}
+
+	// Open outgoing streams.
+	var err error
+	conn.reglStream, err = conn.openStream(quicStreamTypeRegl)
+	if err == nil {
+		conn.prioStream, err = conn.openStream(quicStreamTypePrio)
+	}
+	if err != nil {
+		_ = qConn.CloseWithError(0, "")
+		return nil, err
+	}
+
+	// Start accepting incoming streams.
+	peering.mgr.Go("quic stream acceptor", conn.acceptStreams)
+
+	return conn, nil
+}
+
+func (conn *quicConn) openStream(streamType byte) (quic.SendStream, error) {
+	stream, err := conn.conn.OpenUniStream()
+	if err != nil {
+		return nil, fmt.Errorf("open stream: %w", err)
+	}
+	// Announce stream type.
+	_, err = stream.Write([]byte{streamType})
+	if err != nil {
+		return nil, fmt.Errorf("write stream type: %w", err)
+	}
+
+	return stream, nil
+}
+
+func (conn *quicConn) acceptStreams(w *mgr.WorkerCtx) error {
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	for i := 0; i < 2; i++ {
+		stream, err := conn.conn.AcceptUniStream(conn.conn.Context())
+		if err != nil {
+			return nil //nolint:nilerr // Connection was closed.
+		}
+
+		// Read stream type.
+		var streamType [1]byte
+		if _, err := readFull(stream, streamType[:]); err != nil {
+			return nil //nolint:nilerr // Connection was closed.
+		}
+		switch streamType[0] {
+		case quicStreamTypeRegl:
+			conn.mgr.Go("quic stream reader", func(_ *mgr.WorkerCtx) error {
+				conn.readStream(stream, false)
+				return nil
+			})
+		case quicStreamTypePrio:
+			conn.mgr.Go("quic prio stream reader", func(_ *mgr.WorkerCtx) error {
+				conn.readStream(stream, true)
+				return nil
+			})
+		default:
+			w.Debug(
+				"unknown quic stream type",
+				"remote", conn.RemoteAddr(),
+				"type", streamType[0],
+			)
+			return nil
+		}
+	}
+
+	// Wait for the connection to close.
+	select {
+	case <-conn.conn.Context().Done():
+	case <-w.Done():
+	}
+	return nil
+}
+
+// readStream reads length-prefixed frames from the stream and queues them.
+func (conn *quicConn) readStream(stream quic.ReceiveStream, prio bool) {
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	buf := make([]byte, 0xFFFF)
+	for {
+		// Read length.
+		if _, err := readFull(stream, buf[:2]); err != nil {
+			return
+		}
+		dataLen := int(m.GetUint16(buf[:2]))
+		if dataLen <= 3 {
+			return
+		}
+
+		// Read data and queue frame.
+		if _, err := readFull(stream, buf[2:dataLen]); err != nil {
+			return
+		}
+		conn.submit(buf[:dataLen], prio)
+	}
+}
+
+func readFull(stream quic.ReceiveStream, b []byte) (int, error) {
+	var read int
+	for read < len(b) {
+		n, err := stream.Read(b[read:])
+		if err != nil {
+			return read, err
+		}
+		read += n
+	}
+	return read, nil
+}
+
+// Write writes regular data to the connection.
+func (conn *quicConn) Write(b []byte) (int, error) {
+	conn.reglLock.Lock()
+	defer conn.reglLock.Unlock()
+
+	return conn.reglStream.Write(b)
+}
+
+// WritePriority writes priority data to the connection.
+func (conn *quicConn) WritePriority(b []byte) (int, error) {
+	conn.prioLock.Lock()
+	defer conn.prioLock.Unlock()
+
+	return conn.prioStream.Write(b)
+}
+
+// Close closes the connection.
+func (conn *quicConn) Close() error {
+	if conn.close() {
+		return conn.conn.CloseWithError(0, "")
+	}
+	return nil
+}
+
+// LocalAddr returns the local network address.
+func (conn *quicConn) LocalAddr() net.Addr {
+	return conn.conn.LocalAddr()
+}
+
+// RemoteAddr returns the remote network address.
+func (conn *quicConn) RemoteAddr() net.Addr {
+	return conn.conn.RemoteAddr()
+}
+
+// SetDeadline sets the read and write deadlines.
+func (conn *quicConn) SetDeadline(t time.Time) error {
+	_ = conn.SetWriteDeadline(t)
+	return conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the write deadline of both streams.
+func (conn *quicConn) SetWriteDeadline(t time.Time) error {
+	if err := conn.reglStream.SetWriteDeadline(t); err != nil {
+		return err
+	}
+	return conn.prioStream.SetWriteDeadline(t)
+}
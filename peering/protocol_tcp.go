@@ -6,7 +6,6 @@ import (
 	"net"
 	"net/netip"
 	"strconv"
-	"time"
 
 	"github.com/mycoria/mycoria/m"
 )
@@ -34,12 +33,7 @@ func tcpPeerWith(peering *Peering, peeringURL *m.PeeringURL, ip netip.Addr) (Lin
 	address := net.JoinHostPort(host, strconv.FormatUint(uint64(peeringURL.Port), 10))
 
 	// Connect.
-	dialer := &net.Dialer{
-		Timeout:       30 * time.Second,
-		FallbackDelay: -1, // Disables Fast Fallback from IPv6 to IPv4.
-		KeepAlive:     -1, // Disable keep-alive.
-	}
-	conn, err := dialer.DialContext(peering.mgr.Ctx(), "tcp", address)
+	conn, proxy, err := peering.dialStream(peering.mgr.Ctx(), peeringURL, address)
 	if err != nil {
 		return nil, fmt.Errorf("connect to %s: %w", address, err)
 	}
@@ -51,6 +45,7 @@ func tcpPeerWith(peering *Peering, peeringURL *m.PeeringURL, ip netip.Addr) (Lin
 		true,
 		peering,
 	)
+	newLink.proxy = formatProxy(proxy)
 	return newLink.handleSetup(peering.mgr)
 }
 
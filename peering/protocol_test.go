@@ -3,6 +3,7 @@ package peering
 import (
 	"net/netip"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -101,3 +102,149 @@ func TestProtocol(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestProtocolUDP(t *testing.T) {
+	t.Parallel()
+
+	testNetworkProtocol(t, "udp", ProtocolUDP)
+}
+
+func TestProtocolQUIC(t *testing.T) {
+	t.Parallel()
+
+	testNetworkProtocol(t, "quic", ProtocolQUIC)
+}
+
+func TestProtocolTLS(t *testing.T) {
+	t.Parallel()
+
+	testNetworkProtocol(t, "tls", ProtocolTLS)
+}
+
+func TestProtocolWebSocket(t *testing.T) {
+	t.Parallel()
+
+	testNetworkProtocol(t, "ws", ProtocolWebSocket)
+	testNetworkProtocol(t, "wss", ProtocolWebSocketSecure)
+}
+
+func TestProtocolUnix(t *testing.T) {
+	t.Parallel()
+
+	testNetworkProtocol(t, "unix", ProtocolUnix)
+}
+
+func testNetworkProtocol(t *testing.T, name string, protocol Protocol) {
+	t.Helper()
+	// Build peering instances.
+	c := config.MakeTestConfig(config.Store{
+		Router: config.Router{
+			Universe:       "test",
+			UniverseSecret: "password",
+		},
+	})
+	i1 := getTestInstance(t, c)
+	i2 := getTestInstance(t, c)
+	p1 := New(i1, make(chan frame.Frame))
+	p2 := New(i2, make(chan frame.Frame))
+
+	err := p1.Start(mgr.New("peering1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p2.Start(mgr.New("peering2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p1.AddProtocol(name, protocol)
+	p2.AddProtocol(name, protocol)
+
+	// Handle frames to receive results.
+	var (
+		results  []string
+		arrived1 = make(chan struct{})
+	)
+	go func() {
+		for range 2 {
+			f := <-p1.frameHandler
+			results = append(results, string(f.MessageData()))
+		}
+		close(arrived1)
+	}()
+
+	// Start listener on a random port or on a temporary socket.
+	listenURL := &m.PeeringURL{Protocol: name}
+	listenIP := netip.MustParseAddr("127.0.0.1")
+	if name == "unix" {
+		listenURL.Path = filepath.Join(t.TempDir(), "peering.sock")
+		listenIP = netip.Addr{}
+	}
+	ln, err := p1.StartListener(listenURL, listenIP)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Connect to listener.
+	connectURL := listenURL
+	if name != "unix" {
+		lnAddr, err := netip.ParseAddrPort(ln.ListenAddress().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		connectURL = &m.PeeringURL{
+			Protocol: name,
+			Port:     lnAddr.Port(),
+		}
+	}
+	link, err := p2.PeerWith(connectURL, listenIP)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testFrame, err := i2.FrameBuilder().NewFrameV1(
+		m.RouterAddress,
+		m.RouterAddress,
+		frame.NetworkTraffic,
+		nil,
+		[]byte(testRequest),
+		nil,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = link.Send(testFrame)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Send priority frame.
+	testPrioFrame, err := i2.FrameBuilder().NewFrameV1(
+		m.RouterAddress,
+		m.RouterAddress,
+		frame.RouterPing,
+		nil,
+		[]byte(testRequest),
+		nil,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = link.SendPriority(testPrioFrame)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Wait for messages to arrive.
+	<-arrived1
+	assert.Equal(t, []string{testRequest, testRequest}, results, "results must match")
+	t.Logf("received test messages via %s!", name)
+
+	err = p1.Stop(p1.mgr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p2.Stop(p2.mgr)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,111 @@
+package peering
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+// ProtocolTLS uses TCP wrapped in TLS.
+// The listener uses a self-signed certificate derived from the router identity.
+// The connecting side may pin the expected router by setting its IP as the
+// peering URL option, eg. "tls://example.com:47369#fd00::1".
+var ProtocolTLS = NewProtocol(
+	"tls",
+	tlsPeerWith,
+	tlsStartListener,
+)
+
+var _ Protocol = ProtocolTLS
+
+func tlsPeerWith(peering *Peering, peeringURL *m.PeeringURL, ip netip.Addr) (Link, error) {
+	// Build destination address.
+	var host string
+	switch {
+	case ip.IsValid():
+		host = ip.String()
+	case peeringURL.Domain != "":
+		host = peeringURL.Domain
+	default:
+		return nil, errors.New("host not specified")
+	}
+	address := net.JoinHostPort(host, strconv.FormatUint(uint64(peeringURL.Port), 10))
+
+	// Create TLS config.
+	tlsConfig, err := makeTLSClientConfig(peeringURL)
+	if err != nil {
+		return nil, err
+	}
+	if peeringURL.Domain != "" {
+		tlsConfig.ServerName = peeringURL.Domain
+	}
+
+	// Connect.
+	ctx, cancel := context.WithTimeout(peering.mgr.Ctx(), 30*time.Second)
+	defer cancel()
+	tcpConn, proxy, err := peering.dialStream(ctx, peeringURL, address)
+	if err != nil {
+		return nil, fmt.Errorf("connect to %s: %w", address, err)
+	}
+	conn := tls.Client(tcpConn, tlsConfig)
+	if err := conn.HandshakeContext(ctx); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("tls handshake with %s: %w", address, err)
+	}
+
+	// Start link setup.
+	newLink := newLinkBase(
+		conn,
+		peeringURL,
+		true,
+		peering,
+	)
+	newLink.proxy = formatProxy(proxy)
+	return newLink.handleSetup(peering.mgr)
+}
+
+func tlsStartListener(peering *Peering, peeringURL *m.PeeringURL, ip netip.Addr) (Listener, error) {
+	// Build listen address.
+	var host string
+	switch {
+	case ip.IsValid():
+		host = ip.String()
+	case peeringURL.Domain != "":
+		host = peeringURL.Domain
+	default:
+		host = ""
+	}
+	address := net.JoinHostPort(host, strconv.FormatUint(uint64(peeringURL.Port), 10))
+
+	// Create TLS config.
+	tlsConfig, err := makeTLSServerConfig(peering.instance.Identity())
+	if err != nil {
+		return nil, fmt.Errorf("create tls config: %w", err)
+	}
+
+	// Bind listener.
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("listen: %w", err)
+	}
+
+	// Start listener.
+	newListener := newListenerBase(
+		peeringURL.FormatWith(host),
+		tls.NewListener(ln, tlsConfig),
+		peeringURL,
+		peering,
+	)
+	newListener.startWorkers()
+
+	// Add to peering manager and return.
+	peering.AddListener(newListener.id, newListener)
+	return newListener, nil
+}
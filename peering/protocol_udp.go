@@ -0,0 +1,425 @@
+package peering
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+// ProtocolUDP uses plain UDP.
+// All links of a listener share the same socket.
+var ProtocolUDP = NewProtocol(
+	"udp",
+	udpPeerWith,
+	udpStartListener,
+)
+
+var _ Protocol = ProtocolUDP
+
+const (
+	// udpMaxDatagramSize is the maximum size of a UDP datagram.
+	udpMaxDatagramSize = 0xFFFF
+	// udpRecvQueueSize is the amount of datagrams buffered per connection.
+	udpRecvQueueSize = 1000
+	// udpAcceptQueueSize is the amount of new connections waiting to be accepted.
+	udpAcceptQueueSize = 100
+)
+
+// udpCloseSignal is sent to the remote when a connection is closed.
+// It is a frame length of zero, which is never valid otherwise.
+var udpCloseSignal = []byte{0, 0}
+
+func udpPeerWith(peering *Peering, peeringURL *m.PeeringURL, ip netip.Addr) (Link, error) {
+	// Build destination address.
+	var host string
+	switch {
+	case ip.IsValid():
+		host = ip.String()
+	case peeringURL.Domain != "":
+		host = peeringURL.Domain
+	default:
+		return nil, errors.New("host not specified")
+	}
+	address := net.JoinHostPort(host, strconv.FormatUint(uint64(peeringURL.Port), 10))
+
+	// Resolve address.
+	udpAddr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("resolve %s: %w", address, err)
+	}
+	remote := udpAddr.AddrPort()
+	remote = netip.AddrPortFrom(remote.Addr().Unmap(), remote.Port())
+
+	// Use the socket of a listener, if possible, so that the remote sees the
+	// same address for all our links. Otherwise, create a dedicated socket.
+	mux := getUDPListenerMux(peering, remote.Addr())
+	if mux == nil {
+		socket, err := net.ListenUDP("udp", nil)
+		if err != nil {
+			return nil, fmt.Errorf("create socket for %s: %w", address, err)
+		}
+		mux = newUDPMux(socket, false, peering)
+	}
+
+	// Create connection.
+	conn, err := mux.newConn(remote)
+	if err != nil {
+		mux.closeIfUnused()
+		return nil, fmt.Errorf("connect to %s: %w", address, err)
+	}
+
+	// Start link setup.
+	newLink := newLinkBase(
+		conn,
+		peeringURL,
+		true,
+		peering,
+	)
+	return newLink.handleSetup(peering.mgr)
+}
+
+func udpStartListener(peering *Peering, peeringURL *m.PeeringURL, ip netip.Addr) (Listener, error) {
+	// Build listen address.
+	var host string
+	switch {
+	case ip.IsValid():
+		host = ip.String()
+	case peeringURL.Domain != "":
+		host = peeringURL.Domain
+	default:
+		host = ""
+	}
+	address := net.JoinHostPort(host, strconv.FormatUint(uint64(peeringURL.Port), 10))
+
+	// Bind socket.
+	udpAddr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("resolve listen address: %w", err)
+	}
+	socket, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return nil, fmt.Errorf("listen: %w", err)
+	}
+
+	// Start listener.
+	newListener := newListenerBase(
+		peeringURL.FormatWith(host),
+		newUDPMux(socket, true, peering),
+		peeringURL,
+		peering,
+	)
+	newListener.startWorkers()
+
+	// Add to peering manager and return.
+	peering.AddListener(newListener.id, newListener)
+	return newListener, nil
+}
+
+// getUDPListenerMux returns the socket multiplexer of a UDP listener that
+// can be used to reach the given IP.
+func getUDPListenerMux(peering *Peering, ip netip.Addr) *udpMux {
+	for _, ln := range peering.copyListenersWithLocking() {
+		lnBase, ok := ln.(*ListenerBase)
+		if !ok {
+			continue
+		}
+		mux, ok := lnBase.listener.(*udpMux)
+		if !ok || !mux.accepting.Load() {
+			continue
+		}
+
+		// Check if the socket can reach the IP.
+		localIP := mux.localAddr.Addr().Unmap()
+		switch {
+		case localIP.IsUnspecified() && localIP.Is6():
+			// Dual stack socket.
+			return mux
+		case localIP.Is4() == ip.Is4():
+			return mux
+		}
+	}
+
+	return nil
+}
+
+// udpMux multiplexes connections to many peers over a single UDP socket.
+// It implements net.Listener.
+type udpMux struct {
+	socket    *net.UDPConn
+	localAddr netip.AddrPort
+
+	conns     map[netip.AddrPort]*udpConn
+	connsLock sync.Mutex
+
+	// accepting specifies whether new connections from unknown remotes are accepted.
+	accepting   atomic.Bool
+	acceptQueue chan *udpConn
+	closing     chan struct{}
+	closeOnce   sync.Once
+
+	peering *Peering
+}
+
+var _ net.Listener = &udpMux{}
+
+func newUDPMux(socket *net.UDPConn, accepting bool, peering *Peering) *udpMux {
+	mux := &udpMux{
+		socket:      socket,
+		localAddr:   socket.LocalAddr().(*net.UDPAddr).AddrPort(), //nolint:forcetypeassert
+		conns:       make(map[netip.AddrPort]*udpConn),
+		acceptQueue: make(chan *udpConn, udpAcceptQueueSize),
+		closing:     make(chan struct{}),
+		peering:     peering,
+	}
+	mux.accepting.Store(accepting)
+	peering.mgr.Go("udp socket reader", mux.reader)
+
+	return mux
+}
+
+// Accept waits for and returns the next connection to the listener.
+func (mux *udpMux) Accept() (net.Conn, error) {
+	select {
+	case conn := <-mux.acceptQueue:
+		return conn, nil
+	case <-mux.closing:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops accepting new connections.
+// The socket is closed as soon as all connections are closed.
+func (mux *udpMux) Close() error {
+	mux.accepting.Store(false)
+	mux.closeOnce.Do(func() {
+		close(mux.closing)
+	})
+
+	// Close connections that were not yet accepted.
+	for {
+		select {
+		case conn := <-mux.acceptQueue:
+			conn.closeByRemote()
+		default:
+			mux.closeIfUnused()
+			return nil
+		}
+	}
+}
+
+// Addr returns the listener's network address.
+func (mux *udpMux) Addr() net.Addr {
+	return net.UDPAddrFromAddrPort(mux.localAddr)
+}
+
+func (mux *udpMux) newConn(remote netip.AddrPort) (*udpConn, error) {
+	mux.connsLock.Lock()
+	defer mux.connsLock.Unlock()
+
+	if _, ok := mux.conns[remote]; ok {
+		return nil, errors.New("already connected to address")
+	}
+
+	conn := newUDPConn(mux, remote)
+	mux.conns[remote] = conn
+	return conn, nil
+}
+
+func (mux *udpMux) removeConn(conn *udpConn) {
+	func() {
+		mux.connsLock.Lock()
+		defer mux.connsLock.Unlock()
+
+		if mux.conns[conn.remote] == conn {
+			delete(mux.conns, conn.remote)
+		}
+	}()
+
+	mux.closeIfUnused()
+}
+
+// closeIfUnused closes the socket if it does not accept new connections and
+// has no connections left.
+func (mux *udpMux) closeIfUnused() {
+	if mux.accepting.Load() {
+		return
+	}
+
+	mux.connsLock.Lock()
+	defer mux.connsLock.Unlock()
+
+	if len(mux.conns) == 0 {
+		mux.closeOnce.Do(func() {
+			close(mux.closing)
+		})
+		_ = mux.socket.Close()
+	}
+}
+
+func (mux *udpMux) reader(w *mgr.WorkerCtx) error {
+	defer mux.closeAllConns()
+
+	var (
+		buf               = make([]byte, udpMaxDatagramSize)
+		consecutiveErrors int
+	)
+	for {
+		n, remote, err := mux.socket.ReadFromUDPAddrPort(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+
+			// Log read error, close after 100 consecutive errors.
+			consecutiveErrors++
+			if consecutiveErrors >= 100 {
+				w.Warn(
+					"closing udp socket after 100 consecutive read errors",
+					"bind", mux.localAddr,
+					"err", err,
+				)
+				_ = mux.socket.Close()
+				return nil
+			}
+
+			w.Debug(
+				"failed to read from udp socket (non-fatal)",
+				"bind", mux.localAddr,
+				"err", err,
+			)
+			continue
+		}
+		consecutiveErrors = 0
+		data := buf[:n]
+		remote = netip.AddrPortFrom(remote.Addr().Unmap(), remote.Port())
+
+		// Get connection of remote.
+		mux.connsLock.Lock()
+		conn, ok := mux.conns[remote]
+		mux.connsLock.Unlock()
+
+		// Handle close signal.
+		if len(data) == len(udpCloseSignal) && m.GetUint16(data) == 0 {
+			if ok {
+				conn.closeByRemote()
+			}
+			continue
+		}
+
+		// Check that the datagram contains exactly one frame.
+		// This keeps the stream of the connection in sync, even if datagrams are lost.
+		if len(data) < 2 || int(m.GetUint16(data)) != len(data) {
+			continue
+		}
+
+		// Accept new connection, if accepting.
+		if !ok {
+			if !mux.accepting.Load() {
+				continue
+			}
+			conn, err = mux.newConn(remote)
+			if err != nil {
+				continue
+			}
+			select {
+			case mux.acceptQueue <- conn:
+			default:
+				// Accept queue is full, drop connection.
+				mux.removeConn(conn)
+				continue
+			}
+		}
+
+		// Submit datagram to connection.
+		conn.submit(data, false)
+	}
+}
+
+func (mux *udpMux) closeAllConns() {
+	mux.connsLock.Lock()
+	conns := make([]*udpConn, 0, len(mux.conns))
+	for _, conn := range mux.conns {
+		conns = append(conns, conn)
+	}
+	mux.connsLock.Unlock()
+
+	for _, conn := range conns {
+		conn.closeByRemote()
+	}
+}
+
+// udpConn is a connection to a single peer on a multiplexed UDP socket.
+// Every write is sent as a single datagram.
+// Reads return the datagrams as a continuous stream.
+type udpConn struct {
+	*frameQueue
+
+	mux    *udpMux
+	remote netip.AddrPort
+}
+
+var _ net.Conn = &udpConn{}
+
+func newUDPConn(mux *udpMux, remote netip.AddrPort) *udpConn {
+	return &udpConn{
+		frameQueue: newFrameQueue(0, udpRecvQueueSize),
+		mux:        mux,
+		remote:     remote,
+	}
+}
+
+// Write writes data to the connection as a single datagram.
+func (conn *udpConn) Write(b []byte) (int, error) {
+	if conn.isClosed() {
+		return 0, net.ErrClosed
+	}
+
+	return conn.mux.socket.WriteToUDPAddrPort(b, conn.remote)
+}
+
+// Close closes the connection and notifies the remote.
+func (conn *udpConn) Close() error {
+	if !conn.isClosed() {
+		_, _ = conn.mux.socket.WriteToUDPAddrPort(udpCloseSignal, conn.remote)
+	}
+	if conn.close() {
+		conn.mux.removeConn(conn)
+	}
+	return nil
+}
+
+// closeByRemote closes the connection without notifying the remote.
+func (conn *udpConn) closeByRemote() {
+	if conn.close() {
+		conn.mux.removeConn(conn)
+	}
+}
+
+// LocalAddr returns the local network address.
+func (conn *udpConn) LocalAddr() net.Addr {
+	return net.UDPAddrFromAddrPort(conn.mux.localAddr)
+}
+
+// RemoteAddr returns the remote network address.
+func (conn *udpConn) RemoteAddr() net.Addr {
+	return net.UDPAddrFromAddrPort(conn.remote)
+}
+
+// SetDeadline sets the read deadline.
+// Writes never block, so there is no write deadline.
+func (conn *udpConn) SetDeadline(t time.Time) error {
+	return conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline is a no-op, as writes never block.
+func (conn *udpConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
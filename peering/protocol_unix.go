@@ -0,0 +1,111 @@
+package peering
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/netip"
+	"os"
+	"time"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+// ProtocolUnix uses unix domain sockets.
+// The socket path is taken from the path of the peering URL,
+// eg. "unix:///run/mycoria/peering.sock".
+// It is meant for routers on the same host, eg. in different containers
+// that share a volume.
+var ProtocolUnix = NewProtocol(
+	"unix",
+	unixPeerWith,
+	unixStartListener,
+)
+
+var _ Protocol = ProtocolUnix
+
+func unixPeerWith(peering *Peering, peeringURL *m.PeeringURL, ip netip.Addr) (Link, error) {
+	// Unix sockets can only be reached locally.
+	if ip.IsValid() || peeringURL.Domain != "" {
+		return nil, errors.New("unix sockets cannot be reached via network")
+	}
+	if peeringURL.Path == "" {
+		return nil, errors.New("socket path not specified")
+	}
+
+	// Connect.
+	dialer := &net.Dialer{
+		Timeout: 30 * time.Second,
+	}
+	conn, err := dialer.DialContext(peering.mgr.Ctx(), "unix", peeringURL.Path)
+	if err != nil {
+		return nil, fmt.Errorf("connect to %s: %w", peeringURL.Path, err)
+	}
+
+	// Start link setup.
+	newLink := newLinkBase(
+		conn,
+		peeringURL,
+		true,
+		peering,
+	)
+	return newLink.handleSetup(peering.mgr)
+}
+
+func unixStartListener(peering *Peering, peeringURL *m.PeeringURL, ip netip.Addr) (Listener, error) {
+	if peeringURL.Path == "" {
+		return nil, errors.New("socket path not specified")
+	}
+
+	// Remove stale socket file.
+	if err := removeStaleUnixSocket(peeringURL.Path); err != nil {
+		return nil, err
+	}
+
+	// Bind listener.
+	// The socket file is removed when the listener is closed.
+	ln, err := net.Listen("unix", peeringURL.Path)
+	if err != nil {
+		return nil, fmt.Errorf("listen: %w", err)
+	}
+
+	// Start listener.
+	newListener := newListenerBase(
+		peeringURL.String(),
+		ln,
+		peeringURL,
+		peering,
+	)
+	newListener.startWorkers()
+
+	// Add to peering manager and return.
+	peering.AddListener(newListener.id, newListener)
+	return newListener, nil
+}
+
+// removeStaleUnixSocket removes the socket file at the given path, if no one
+// is listening on it anymore.
+func removeStaleUnixSocket(path string) error {
+	info, err := os.Lstat(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil
+	case err != nil:
+		return fmt.Errorf("check socket path: %w", err)
+	case info.Mode()&fs.ModeSocket == 0:
+		return fmt.Errorf("socket path %s exists and is not a socket", path)
+	}
+
+	// Check if the socket is still in use.
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		_ = conn.Close()
+		return fmt.Errorf("socket %s is already in use", path)
+	}
+
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("remove stale socket: %w", err)
+	}
+	return nil
+}
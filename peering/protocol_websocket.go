@@ -0,0 +1,387 @@
+package peering
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/coder/websocket"
+
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+// ProtocolWebSocket uses WebSocket over HTTP.
+var ProtocolWebSocket = NewProtocol(
+	"ws",
+	wsPeerWith,
+	wsStartListener,
+)
+
+// ProtocolWebSocketSecure uses WebSocket over HTTPS.
+var ProtocolWebSocketSecure = NewProtocol(
+	"wss",
+	wsPeerWith,
+	wsStartListener,
+)
+
+var (
+	_ Protocol = ProtocolWebSocket
+	_ Protocol = ProtocolWebSocketSecure
+)
+
+// wsReadLimit is the maximum message size, which must fit any frame.
+const wsReadLimit = 0xFFFF
+
+func wsPeerWith(peering *Peering, peeringURL *m.PeeringURL, ip netip.Addr) (Link, error) {
+	// Build destination URL.
+	var host string
+	switch {
+	case ip.IsValid():
+		host = ip.String()
+	case peeringURL.Domain != "":
+		host = peeringURL.Domain
+	default:
+		return nil, errors.New("host not specified")
+	}
+	dstURL := peeringURL.FormatWith(host)
+
+	// Create TLS config.
+	tlsConfig, err := makeTLSClientConfig(peeringURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create HTTP client that records the actual connection.
+	// The configured proxy takes precedence over the proxy from the environment.
+	var (
+		tcpConn     net.Conn
+		proxy       *url.URL
+		tcpConnLock sync.Mutex
+	)
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, usedProxy, err := peering.dialStream(ctx, peeringURL, addr)
+			if err == nil {
+				tcpConnLock.Lock()
+				defer tcpConnLock.Unlock()
+				tcpConn = conn
+				proxy = usedProxy
+			}
+			return conn, err
+		},
+		TLSClientConfig: tlsConfig,
+	}
+	if peering.instance.Config().ProxyFor(peeringURL) == nil {
+		transport.Proxy = http.ProxyFromEnvironment
+	}
+	client := &http.Client{
+		Transport: transport,
+	}
+
+	// Connect.
+	ctx, cancel := context.WithTimeout(peering.mgr.Ctx(), 30*time.Second)
+	defer cancel()
+	c, _, err := websocket.Dial(ctx, dstURL, &websocket.DialOptions{ //nolint:bodyclose // Body is the websocket.
+		HTTPClient: client,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("connect to %s: %w", dstURL, err)
+	}
+	c.SetReadLimit(wsReadLimit)
+
+	// Create net.Conn with actual addresses, as the websocket library does not
+	// provide them for outgoing connections.
+	conn := &wsConn{
+		Conn: websocket.NetConn(peering.mgr.Ctx(), c, websocket.MessageBinary),
+	}
+	tcpConnLock.Lock()
+	if tcpConn != nil {
+		conn.localAddr = tcpConn.LocalAddr()
+		conn.remoteAddr = tcpConn.RemoteAddr()
+	}
+	usedProxy := proxy
+	tcpConnLock.Unlock()
+
+	// Start link setup.
+	newLink := newLinkBase(
+		conn,
+		peeringURL,
+		true,
+		peering,
+	)
+	newLink.proxy = formatProxy(usedProxy)
+	return newLink.handleSetup(peering.mgr)
+}
+
+func wsStartListener(peering *Peering, peeringURL *m.PeeringURL, ip netip.Addr) (Listener, error) {
+	// Build listen address.
+	var host string
+	switch {
+	case ip.IsValid():
+		host = ip.String()
+	case peeringURL.Domain != "":
+		host = peeringURL.Domain
+	default:
+		host = ""
+	}
+	address := net.JoinHostPort(host, strconv.FormatUint(uint64(peeringURL.Port), 10))
+	listenerID := peeringURL.FormatWith(host)
+
+	// Share port with the HTTP API, if it listens on the same port.
+	apiListen := peering.instance.Config().APIListen
+	if apiListen.IsValid() && apiListen.Port() == peeringURL.Port {
+		if peeringURL.Protocol != "ws" {
+			return nil, errors.New("only ws (without TLS) can share the port with the http api")
+		}
+		return peering.mountWebSocketOnAPI(listenerID, peeringURL, apiListen)
+	}
+
+	// Bind listener.
+	tcpListener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("listen: %w", err)
+	}
+	if peeringURL.Protocol == "wss" {
+		tlsConfig, err := makeTLSServerConfig(peering.instance.Identity())
+		if err != nil {
+			_ = tcpListener.Close()
+			return nil, fmt.Errorf("create tls config: %w", err)
+		}
+		tcpListener = tls.NewListener(tcpListener, tlsConfig)
+	}
+
+	// Start HTTP server.
+	acceptor := newWSAcceptor(tcpListener.Addr())
+	mux := http.NewServeMux()
+	mux.Handle(wsHandlerPath(peeringURL), acceptor)
+	acceptor.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	peering.mgr.Go("websocket http server", func(w *mgr.WorkerCtx) error {
+		err := acceptor.server.Serve(tcpListener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			w.Warn(
+				"websocket http server failed",
+				"bind", tcpListener.Addr(),
+				"err", err,
+			)
+		}
+		_ = acceptor.Close()
+		return nil
+	})
+
+	// Start listener.
+	newListener := newListenerBase(
+		listenerID,
+		acceptor,
+		peeringURL,
+		peering,
+	)
+	newListener.startWorkers()
+
+	// Add to peering manager and return.
+	peering.AddListener(newListener.id, newListener)
+	return newListener, nil
+}
+
+// WebSocketHandler returns an HTTP handler that accepts WebSocket peering
+// connections, so that peering can be served by an existing HTTP server.
+// The handler is added as a listener with the given ID and stops accepting
+// connections when the listener is closed.
+func (p *Peering) WebSocketHandler(id string, peeringURL *m.PeeringURL) http.Handler {
+	acceptor := newWSAcceptor(&net.UnixAddr{
+		Name: wsHandlerPath(peeringURL),
+		Net:  "websocket",
+	})
+
+	// Start listener.
+	newListener := newListenerBase(
+		id,
+		acceptor,
+		peeringURL,
+		p,
+	)
+	newListener.startWorkers()
+	p.AddListener(newListener.id, newListener)
+
+	return acceptor
+}
+
+// mountWebSocketOnAPI mounts a WebSocket handler on the HTTP API.
+// As handlers cannot be removed from the API, the mounted handler forwards
+// requests to the current listener of the path.
+func (p *Peering) mountWebSocketOnAPI(id string, peeringURL *m.PeeringURL, apiListen netip.AddrPort) (listener Listener, err error) {
+	api := p.instance.API()
+	if api == nil {
+		return nil, errors.New("http api is not available")
+	}
+	if peeringURL.Path == "" {
+		return nil, errors.New("sharing the port with the http api requires a path")
+	}
+	path := peeringURL.Path
+
+	// Create acceptor.
+	acceptor := newWSAcceptor(net.TCPAddrFromAddrPort(apiListen))
+
+	// Set as current acceptor and mount on API, if not yet done.
+	p.webSocketMountsLock.Lock()
+	defer p.webSocketMountsLock.Unlock()
+
+	if _, mounted := p.webSocketMounts[path]; !mounted {
+		// Registering a conflicting pattern panics.
+		defer func() {
+			if panicVal := recover(); panicVal != nil {
+				listener = nil
+				err = fmt.Errorf("mount on http api: %s", panicVal)
+			}
+		}()
+		api.HandleFunc("GET "+path, func(w http.ResponseWriter, r *http.Request) {
+			p.webSocketMountsLock.Lock()
+			current := p.webSocketMounts[path]
+			p.webSocketMountsLock.Unlock()
+
+			current.ServeHTTP(w, r)
+		})
+	}
+	p.webSocketMounts[path] = acceptor
+
+	// Start listener.
+	newListener := newListenerBase(
+		id,
+		acceptor,
+		peeringURL,
+		p,
+	)
+	newListener.startWorkers()
+
+	// Add to peering manager and return.
+	p.AddListener(newListener.id, newListener)
+	return newListener, nil
+}
+
+func wsHandlerPath(peeringURL *m.PeeringURL) string {
+	if peeringURL.Path == "" {
+		return "/"
+	}
+	return peeringURL.Path
+}
+
+// wsAcceptor accepts WebSocket connections via HTTP and provides them via
+// the net.Listener interface.
+type wsAcceptor struct {
+	addr   net.Addr
+	server *http.Server
+
+	acceptQueue chan net.Conn
+	closing     chan struct{}
+	closed      atomic.Bool
+}
+
+var (
+	_ net.Listener = &wsAcceptor{}
+	_ http.Handler = &wsAcceptor{}
+)
+
+func newWSAcceptor(addr net.Addr) *wsAcceptor {
+	return &wsAcceptor{
+		addr:        addr,
+		acceptQueue: make(chan net.Conn),
+		closing:     make(chan struct{}),
+	}
+}
+
+// ServeHTTP upgrades the request to a WebSocket connection and queues it to
+// be accepted.
+func (a *wsAcceptor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if a == nil || a.closed.Load() {
+		http.Error(w, "listener closed", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Remove any deadlines set by the HTTP server, as the connection will be
+	// long-lived.
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Time{})
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	// Upgrade to websocket.
+	c, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		// Accept already responded with an error.
+		return
+	}
+	c.SetReadLimit(wsReadLimit)
+
+	// Queue for accepting.
+	// The request context is canceled when the handler returns, so use a
+	// background context for the connection and close it on our own.
+	conn := websocket.NetConn(context.Background(), c, websocket.MessageBinary)
+	select {
+	case a.acceptQueue <- conn:
+	case <-a.closing:
+		_ = conn.Close()
+	case <-r.Context().Done():
+		_ = conn.Close()
+	}
+}
+
+// Accept waits for and returns the next connection to the listener.
+func (a *wsAcceptor) Accept() (net.Conn, error) {
+	select {
+	case conn := <-a.acceptQueue:
+		return conn, nil
+	case <-a.closing:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close closes the listener.
+func (a *wsAcceptor) Close() error {
+	if a.closed.CompareAndSwap(false, true) {
+		close(a.closing)
+		if a.server != nil {
+			return a.server.Close()
+		}
+	}
+	return nil
+}
+
+// Addr returns the listener's network address.
+func (a *wsAcceptor) Addr() net.Addr {
+	return a.addr
+}
+
+// wsConn overrides the addresses of a WebSocket connection.
+type wsConn struct {
+	net.Conn
+
+	localAddr  net.Addr
+	remoteAddr net.Addr
+}
+
+// LocalAddr returns the local network address.
+func (conn *wsConn) LocalAddr() net.Addr {
+	if conn.localAddr != nil {
+		return conn.localAddr
+	}
+	return conn.Conn.LocalAddr()
+}
+
+// RemoteAddr returns the remote network address.
+func (conn *wsConn) RemoteAddr() net.Addr {
+	if conn.remoteAddr != nil {
+		return conn.remoteAddr
+	}
+	return conn.Conn.RemoteAddr()
+}
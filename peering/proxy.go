@@ -0,0 +1,154 @@
+package peering
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/proxy"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+// dialStream connects to the given address for the given peering URL.
+// If a proxy is configured for the peering URL, the connection is made
+// through it and the proxy is returned.
+func (p *Peering) dialStream(ctx context.Context, peeringURL *m.PeeringURL, address string) (net.Conn, *url.URL, error) {
+	dialer := &net.Dialer{
+		Timeout:       30 * time.Second,
+		FallbackDelay: -1, // Disables Fast Fallback from IPv6 to IPv4.
+		KeepAlive:     -1, // Disable keep-alive.
+	}
+
+	// Connect directly if no proxy is configured.
+	proxyURL := p.instance.Config().ProxyFor(peeringURL)
+	if proxyURL == nil {
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		return conn, nil, err
+	}
+
+	// Connect via proxy.
+	ctx, cancel := context.WithTimeout(ctx, dialer.Timeout)
+	defer cancel()
+	var (
+		conn net.Conn
+		err  error
+	)
+	switch proxyURL.Scheme {
+	case "socks5", "socks5h":
+		conn, err = dialSOCKS5(ctx, dialer, proxyURL, address)
+	case "http":
+		conn, err = dialHTTPConnect(ctx, dialer, proxyURL, address)
+	default:
+		err = fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("via proxy %s: %w", formatProxy(proxyURL), err)
+	}
+	return conn, proxyURL, nil
+}
+
+// formatProxy returns the proxy URL without credentials.
+func formatProxy(proxyURL *url.URL) string {
+	if proxyURL == nil {
+		return ""
+	}
+	return proxyURL.Scheme + "://" + proxyURL.Host
+}
+
+func dialSOCKS5(ctx context.Context, dialer *net.Dialer, proxyURL *url.URL, address string) (net.Conn, error) {
+	var auth *proxy.Auth
+	if proxyURL.User != nil {
+		auth = &proxy.Auth{
+			User: proxyURL.User.Username(),
+		}
+		auth.Password, _ = proxyURL.User.Password()
+	}
+
+	socksDialer, err := proxy.SOCKS5("tcp", proxyURL.Host, auth, dialer)
+	if err != nil {
+		return nil, err
+	}
+	ctxDialer, ok := socksDialer.(proxy.ContextDialer)
+	if !ok {
+		return nil, errors.New("socks5 dialer does not support contexts")
+	}
+	return ctxDialer.DialContext(ctx, "tcp", address)
+}
+
+func dialHTTPConnect(ctx context.Context, dialer *net.Dialer, proxyURL *url.URL, address string) (net.Conn, error) {
+	conn, err := dialer.DialContext(ctx, "tcp", proxyURL.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	// Abort the handshake when the context is canceled.
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	// Request tunnel.
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		credentials := proxyURL.User.Username() + ":" + password
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)))
+	}
+	if err := req.Write(conn); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("send connect request: %w", err)
+	}
+
+	// Check response.
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("read connect response: %w", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_ = conn.Close()
+		return nil, fmt.Errorf("connect request failed: %s", resp.Status)
+	}
+
+	// Check if the handshake was aborted.
+	if !stop() {
+		_ = conn.Close()
+		return nil, ctx.Err()
+	}
+
+	// Keep any data the remote already sent.
+	if br.Buffered() > 0 {
+		return &bufferedConn{
+			Conn:   conn,
+			reader: br,
+		}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn reads from a buffered reader before reading from the
+// connection.
+type bufferedConn struct {
+	net.Conn
+
+	reader *bufio.Reader
+}
+
+// Read reads data from the connection.
+func (conn *bufferedConn) Read(b []byte) (int, error) {
+	return conn.reader.Read(b)
+}
@@ -0,0 +1,122 @@
+package peering
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestDialHTTPConnect(t *testing.T) {
+	t.Parallel()
+
+	// Start target that greets immediately.
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = target.Close()
+	}()
+	go func() {
+		for {
+			conn, err := target.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = conn.Write([]byte("hello"))
+			_, _ = io.Copy(conn, conn)
+		}
+	}()
+
+	// Start minimal HTTP CONNECT proxy.
+	proxyLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = proxyLn.Close()
+	}()
+	go func() {
+		for {
+			conn, err := proxyLn.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() {
+					_ = conn.Close()
+				}()
+
+				req, err := http.ReadRequest(bufio.NewReader(conn))
+				if err != nil {
+					return
+				}
+				user, pass, ok := (&http.Request{Header: http.Header{
+					"Authorization": req.Header.Values("Proxy-Authorization"),
+				}}).BasicAuth()
+				if req.Method != http.MethodConnect || !ok || user != "user" || pass != "pass" {
+					_, _ = conn.Write([]byte("HTTP/1.1 407 Proxy Authentication Required\r\n\r\n"))
+					return
+				}
+				dst, err := net.Dial("tcp", req.Host)
+				if err != nil {
+					_, _ = conn.Write([]byte("HTTP/1.1 502 Bad Gateway\r\n\r\n"))
+					return
+				}
+				defer func() {
+					_ = dst.Close()
+				}()
+				_, _ = conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+				go func() {
+					_, _ = io.Copy(dst, conn)
+				}()
+				_, _ = io.Copy(conn, dst)
+			}()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	dialer := &net.Dialer{}
+
+	// Check that credentials are required.
+	_, err = dialHTTPConnect(ctx, dialer, &url.URL{
+		Scheme: "http",
+		Host:   proxyLn.Addr().String(),
+	}, target.Addr().String())
+	if err == nil {
+		t.Fatal("connect without credentials should fail")
+	}
+
+	// Connect with credentials.
+	conn, err := dialHTTPConnect(ctx, dialer, &url.URL{
+		Scheme: "http",
+		User:   url.UserPassword("user", "pass"),
+		Host:   proxyLn.Addr().String(),
+	}, target.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	// Check greeting and echo through tunnel.
+	_, err = conn.Write([]byte(" world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 11)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello world" {
+		t.Fatalf("unexpected data through tunnel: %q", buf)
+	}
+}
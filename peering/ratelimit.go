@@ -0,0 +1,92 @@
+package peering
+
+import (
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+// rateLimitDecreaseThreshold defines from which rate limit delay on upstream
+// routers are asked to decrease flow instead of only holding it.
+const rateLimitDecreaseThreshold = 100 * time.Millisecond
+
+// setupRateLimit sets up the rate limiter of the link, if configured.
+// Must be called after the peer is known.
+func (link *LinkBase) setupRateLimit() {
+	// Only match outgoing links by the peering URL, as the configuration
+	// references router.connect entries.
+	peeringURL := link.peeringURL
+	if !link.outgoing {
+		peeringURL = nil
+	}
+
+	rl, ok := link.peering.instance.Config().LinkRateLimit(peeringURL, link.peer)
+	if !ok {
+		return
+	}
+	link.rateLimiter = rate.NewLimiter(rate.Limit(rl.Rate), rl.Burst)
+}
+
+// waitForRateLimit waits until the frame may be sent according to the link
+// and global rate limits.
+// Priority frames are not delayed, but still count towards the limits.
+// Returns false if the worker is done.
+func (link *LinkBase) waitForRateLimit(w *mgr.WorkerCtx, f frame.Frame, prio bool) bool {
+	// Check if any rate limit is configured.
+	if link.rateLimiter == nil && link.peering.rateLimiter == nil {
+		return true
+	}
+
+	// Get frame size.
+	data, err := f.FrameDataWithMargins(0, 0)
+	if err != nil {
+		return true
+	}
+	size := len(data)
+
+	// Reserve tokens and get the required delay.
+	now := time.Now()
+	var delay time.Duration
+	for _, limiter := range []*rate.Limiter{link.rateLimiter, link.peering.rateLimiter} {
+		if limiter == nil {
+			continue
+		}
+		r := limiter.ReserveN(now, size)
+		if !r.OK() {
+			// Frame is bigger than the burst, do not limit.
+			continue
+		}
+		delay = max(delay, r.DelayFrom(now))
+	}
+	if prio || delay <= 0 {
+		return true
+	}
+
+	// Record throttling for flow control and wait.
+	link.throttledUntil.Store(now.Add(delay).UnixNano())
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-w.Done():
+		return false
+	}
+}
+
+// rateLimitIndicator returns a flow control flag that indicates the pressure
+// caused by the rate limits of the link.
+func (link *LinkBase) rateLimitIndicator() frame.FlowControlFlag {
+	remaining := time.Until(time.Unix(0, link.throttledUntil.Load()))
+	switch {
+	case remaining >= rateLimitDecreaseThreshold:
+		return frame.FlowControlFlagDecreaseFlow
+	case remaining > 0:
+		return frame.FlowControlFlagHoldFlow
+	default:
+		return frame.FlowControlFlagIncreaseFlow
+	}
+}
@@ -0,0 +1,94 @@
+package peering
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+func TestLinkRateLimit(t *testing.T) {
+	t.Parallel()
+
+	peer := netip.MustParseAddr("fd00::1")
+	c := config.MakeTestConfig(config.Store{
+		Router: config.Router{
+			LinkRateLimits: map[string]config.RateLimit{
+				peer.String(): {Rate: 100},
+			},
+		},
+	})
+	i := getTestInstance(t, c)
+	p := New(i, nil)
+	if err := p.Start(mgr.New("peering")); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = p.Stop(p.mgr)
+	}()
+
+	// Create link with rate limit.
+	conn, _ := net.Pipe()
+	link := newLinkBase(conn, &m.PeeringURL{Protocol: "pipe"}, true, p)
+	link.peer = peer
+	link.setupRateLimit()
+	if link.rateLimiter == nil {
+		t.Fatal("rate limit was not applied to link")
+	}
+	if link.FlowControlIndicator() != frame.FlowControlFlagIncreaseFlow {
+		t.Error("unthrottled link should indicate to increase flow")
+	}
+
+	// Exhaust burst.
+	link.rateLimiter.ReserveN(time.Now(), config.MinRateLimitBurst)
+
+	// Priority frames must not be delayed.
+	f, err := i.FrameBuilder().NewFrameV1(
+		m.RouterAddress,
+		m.RouterAddress,
+		frame.NetworkTraffic,
+		nil,
+		[]byte(testRequest),
+		nil,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waited := make(chan bool)
+	p.mgr.Go("rate limit test", func(w *mgr.WorkerCtx) error {
+		waited <- link.waitForRateLimit(w, f, true)
+		waited <- link.waitForRateLimit(w, f, false)
+		return nil
+	})
+	select {
+	case <-waited:
+	case <-time.After(time.Second):
+		t.Fatal("priority frame was delayed")
+	}
+
+	// Regular frames must be delayed and signal pressure upstream.
+	waitFor(t, "throttling", func() bool {
+		return link.FlowControlIndicator() == frame.FlowControlFlagDecreaseFlow
+	})
+	select {
+	case <-waited:
+		t.Fatal("regular frame was not delayed")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Waiting must be aborted on shutdown.
+	p.mgr.Cancel()
+	select {
+	case ok := <-waited:
+		if ok {
+			t.Error("wait should report shutdown")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("wait was not aborted")
+	}
+}
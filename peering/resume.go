@@ -0,0 +1,216 @@
+package peering
+
+import (
+	"crypto/subtle"
+	"net/netip"
+	"time"
+
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/state"
+)
+
+// linkResumeWindow defines how long a lost link can be resumed.
+// During this time, the switch label of the link is reserved and its routes
+// are kept in the routing table.
+const linkResumeWindow = time.Minute
+
+// heldLink holds the information required to resume a lost link.
+type heldLink struct {
+	peer        netip.Addr
+	switchLabel m.SwitchLabel
+	outgoing    bool
+	peeringURL  string
+	secret      []byte
+
+	expiry *time.Timer
+}
+
+// peeringResume is sent with a peering request to resume a lost link.
+type peeringResume struct {
+	Auth []byte `cbor:"a,omitempty" json:"a,omitempty"`
+}
+
+// peeringResumeAccept is sent with a peering response to accept resuming a
+// lost link.
+type peeringResumeAccept struct {
+	Nonce []byte `cbor:"n,omitempty" json:"n,omitempty"`
+	Auth  []byte `cbor:"a,omitempty" json:"a,omitempty"`
+}
+
+// holdLink removes the link from the peering list, but keeps its switch
+// label reserved and its routes in the routing table, so that it can be
+// resumed within the resume window.
+// The link is not closed by this function!
+func (p *Peering) holdLink(link *LinkBase) {
+	held := &heldLink{
+		peer:        link.peer,
+		switchLabel: link.switchLabel,
+		outgoing:    link.outgoing,
+		secret:      link.resumeSecret,
+	}
+	if link.peeringURL != nil {
+		held.peeringURL = link.peeringURL.String()
+	}
+
+	p.linksLock.Lock()
+	defer p.linksLock.Unlock()
+
+	// Only hold the link, if it is still the current link of the peer.
+	if p.links[link.peer] != link {
+		return
+	}
+	delete(p.links, link.peer)
+	delete(p.linksByLabel, link.switchLabel)
+
+	// Replace previously held link.
+	if previous := p.heldLinks[link.peer]; previous != nil {
+		previous.expiry.Stop()
+	}
+	held.expiry = time.AfterFunc(linkResumeWindow, func() {
+		p.releaseHeldLink(held)
+	})
+	p.heldLinks[link.peer] = held
+
+	// Trigger peering to reconnect quickly.
+	if !p.mgr.IsDone() {
+		p.TriggerPeering()
+	}
+}
+
+// releaseHeldLink releases the held link, if it was not resumed.
+func (p *Peering) releaseHeldLink(held *heldLink) {
+	p.linksLock.Lock()
+	defer p.linksLock.Unlock()
+
+	if p.heldLinks[held.peer] != held {
+		return
+	}
+	delete(p.heldLinks, held.peer)
+
+	// Remove routes, if there is no new link to the peer.
+	if _, ok := p.links[held.peer]; !ok {
+		p.instance.RoutingTable().RemoveNextHop(held.peer)
+	}
+}
+
+// removeHeldLink removes the held link of the given peer without touching
+// the routing table.
+// Must be called with linksLock held.
+func (p *Peering) removeHeldLink(peer netip.Addr) {
+	if held := p.heldLinks[peer]; held != nil {
+		held.expiry.Stop()
+		delete(p.heldLinks, peer)
+	}
+}
+
+// getHeldLinkByURL returns the held outgoing link with the given peering URL.
+func (p *Peering) getHeldLinkByURL(peeringURL *m.PeeringURL) *heldLink {
+	if peeringURL == nil {
+		return nil
+	}
+	url := peeringURL.String()
+
+	p.linksLock.RLock()
+	defer p.linksLock.RUnlock()
+
+	for _, held := range p.heldLinks {
+		if held.outgoing && held.peeringURL == url {
+			return held
+		}
+	}
+	return nil
+}
+
+// getHeldLinkForResume returns the held link of the given peer, if the
+// resume auth is valid.
+// If the peer still has an active link with a matching secret, the link is
+// closed and held, as the peer has evidently lost it.
+func (p *Peering) getHeldLinkForResume(peer netip.Addr, checkAuth func(secret []byte) bool) *heldLink {
+	// Check if there still is an active link with a matching secret.
+	if link, ok := p.GetLink(peer).(*LinkBase); ok &&
+		len(link.resumeSecret) > 0 &&
+		checkAuth(link.resumeSecret) {
+		link.Close(func() {
+			p.mgr.Info(
+				"closing link (resumed by peer)",
+				"router", link.peer,
+				"address", link.RemoteAddr(),
+			)
+		})
+	}
+
+	p.linksLock.RLock()
+	defer p.linksLock.RUnlock()
+
+	held := p.heldLinks[peer]
+	if held == nil || !checkAuth(held.secret) {
+		return nil
+	}
+	return held
+}
+
+// isSwitchLabelInUse returns whether the switch label is used by an active or
+// held link.
+func (p *Peering) isSwitchLabelInUse(label m.SwitchLabel) bool {
+	p.linksLock.RLock()
+	defer p.linksLock.RUnlock()
+
+	if _, ok := p.linksByLabel[label]; ok {
+		return true
+	}
+	for _, held := range p.heldLinks {
+		if held.switchLabel == label {
+			return true
+		}
+	}
+	return false
+}
+
+func makeResumeRequestAuth(secret, challenge []byte, clientIP, serverIP netip.Addr) []byte {
+	return state.MakeResumptionAuth(
+		secret, "request",
+		challenge, clientIP.AsSlice(), serverIP.AsSlice(),
+	)
+}
+
+func makeResumeAcceptAuth(secret, challenge, nonce []byte, clientIP, serverIP netip.Addr) []byte {
+	return state.MakeResumptionAuth(
+		secret, "accept",
+		challenge, nonce, clientIP.AsSlice(), serverIP.AsSlice(),
+	)
+}
+
+func checkResumeAuth(a, b []byte) bool {
+	return len(a) > 0 && subtle.ConstantTimeCompare(a, b) == 1
+}
+
+// deriveResumedSession derives the link encryption session for a resumed link.
+func deriveResumedSession(secret, challenge, nonce []byte, client bool) (*state.EncryptionSession, error) {
+	return state.NewResumedEncryptionSession(secret, challenge, nonce, client)
+}
+
+// enableResumption derives the resumption secret of the link, so that it can
+// be resumed when lost.
+func (link *LinkBase) enableResumption() {
+	secret, err := link.encSession.DeriveResumptionSecret()
+	if err != nil {
+		link.peering.mgr.Debug(
+			"failed to derive resumption secret",
+			"router", link.peer,
+			"err", err,
+		)
+		return
+	}
+	link.resumeSecret = secret
+}
+
+// releaseAllHeldLinks releases all held links without touching the routing
+// table.
+func (p *Peering) releaseAllHeldLinks() {
+	p.linksLock.Lock()
+	defer p.linksLock.Unlock()
+
+	for peer := range p.heldLinks {
+		p.removeHeldLink(peer)
+	}
+}
@@ -0,0 +1,121 @@
+package peering
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+func TestLinkResumption(t *testing.T) {
+	t.Parallel()
+
+	// Build peering instances.
+	c := config.MakeTestConfig(config.Store{
+		Router: config.Router{
+			Universe:       "test",
+			UniverseSecret: "password",
+		},
+	})
+	i1 := getTestInstance(t, c)
+	i2 := getTestInstance(t, c)
+	p1 := New(i1, make(chan frame.Frame))
+	p2 := New(i2, make(chan frame.Frame))
+	if err := p1.Start(mgr.New("peering1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := p2.Start(mgr.New("peering2")); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = p1.Stop(p1.mgr)
+		_ = p2.Stop(p2.mgr)
+	}()
+	p1.AddProtocol("tcp", ProtocolTCP)
+	p2.AddProtocol("tcp", ProtocolTCP)
+
+	// Start listener and connect.
+	ln, err := p1.StartListener(&m.PeeringURL{Protocol: "tcp"}, netip.MustParseAddr("127.0.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lnAddr, err := netip.ParseAddrPort(ln.ListenAddress().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	connectURL := &m.PeeringURL{
+		Protocol: "tcp",
+		Port:     lnAddr.Port(),
+	}
+	link, err := p2.PeerWith(connectURL, netip.MustParseAddr("127.0.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip1 := i1.Identity().IP
+	ip2 := i2.Identity().IP
+	waitFor(t, "link on listener", func() bool { return p1.GetLink(ip2) != nil })
+	label1 := p1.GetLink(ip2).SwitchLabel()
+	label2 := link.SwitchLabel()
+
+	// Simulate a lost connection.
+	_ = link.(*LinkBase).conn.Close() //nolint:forcetypeassert
+	waitFor(t, "links to be held", func() bool {
+		return p1.GetLink(ip2) == nil && p2.GetLink(ip1) == nil
+	})
+
+	// Reconnect and check if the link was resumed.
+	link, err = p2.PeerWith(connectURL, netip.MustParseAddr("127.0.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !link.(*LinkBase).resumed { //nolint:forcetypeassert
+		t.Fatal("link was not resumed")
+	}
+	if link.SwitchLabel() != label2 {
+		t.Errorf("switch label changed from %d to %d", label2, link.SwitchLabel())
+	}
+	waitFor(t, "resumed link on listener", func() bool { return p1.GetLink(ip2) != nil })
+	if p1.GetLink(ip2).SwitchLabel() != label1 {
+		t.Errorf("listener switch label changed from %d to %d", label1, p1.GetLink(ip2).SwitchLabel())
+	}
+
+	// Check if the resumed link works.
+	testFrame, err := i2.FrameBuilder().NewFrameV1(
+		m.RouterAddress,
+		m.RouterAddress,
+		frame.NetworkTraffic,
+		nil,
+		[]byte(testRequest),
+		nil,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := link.Send(testFrame); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case f := <-p1.frameHandler:
+		if string(f.MessageData()) != testRequest {
+			t.Errorf("unexpected message: %q", f.MessageData())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("message via resumed link did not arrive")
+	}
+}
+
+func waitFor(t *testing.T, what string, check func() bool) {
+	t.Helper()
+
+	for range 100 {
+		if check() {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
@@ -0,0 +1,133 @@
+package peering
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+// Validity of identity certificates.
+// Fixed values make the certificate fully deterministic.
+var (
+	identityCertNotBefore = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	identityCertNotAfter  = time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC)
+)
+
+// makeIdentityCertificate creates a self-signed certificate using the
+// Ed25519 key of the router identity.
+// The certificate is derived from the identity only, so it is always the same.
+func makeIdentityCertificate(id *m.Address) (tls.Certificate, error) {
+	if len(id.PrivateKey) != ed25519.PrivateKeySize {
+		return tls.Certificate{}, errors.New("identity has no private key")
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: new(big.Int).SetBytes(id.IP.AsSlice()),
+		NotBefore:    identityCertNotBefore,
+		NotAfter:     identityCertNotAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{id.IP.AsSlice()},
+	}
+	template.Subject.CommonName = id.IP.String()
+
+	certData, err := x509.CreateCertificate(rand.Reader, template, template, id.PublicKey, id.PrivateKey)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("create certificate: %w", err)
+	}
+
+	return tls.Certificate{
+		Certificate: [][]byte{certData},
+		PrivateKey:  id.PrivateKey,
+	}, nil
+}
+
+// makeTLSServerConfig returns a TLS server config using the identity certificate.
+func makeTLSServerConfig(id *m.Address, nextProtos ...string) (*tls.Config, error) {
+	cert, err := makeIdentityCertificate(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   nextProtos,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// makeTLSClientConfig returns a TLS client config for connecting to the given peering URL.
+// The certificate chain is not verified, as routers use self-signed certificates
+// and the router identity is verified by the peering handshake.
+// If the peering URL option holds a router IP, the certificate must belong to it.
+func makeTLSClientConfig(peeringURL *m.PeeringURL, nextProtos ...string) (*tls.Config, error) {
+	pinned, err := getPinnedRouter(peeringURL)
+	if err != nil {
+		return nil, err
+	}
+
+	conf := &tls.Config{
+		InsecureSkipVerify: true, //nolint:gosec // Router identity is verified in peering handshake.
+		NextProtos:         nextProtos,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if pinned.IsValid() {
+		conf.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyRouterCertificate(rawCerts, pinned)
+		}
+	}
+
+	return conf, nil
+}
+
+// getPinnedRouter returns the router IP from the peering URL option, if set.
+func getPinnedRouter(peeringURL *m.PeeringURL) (netip.Addr, error) {
+	if peeringURL.Option == "" {
+		return netip.Addr{}, nil
+	}
+
+	pinned, err := netip.ParseAddr(peeringURL.Option)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("invalid pinned router IP %q: %w", peeringURL.Option, err)
+	}
+	if !m.BaseNetPrefix.Contains(pinned) {
+		return netip.Addr{}, fmt.Errorf("pinned router IP %s is not a mycoria address", pinned)
+	}
+	return pinned, nil
+}
+
+// verifyRouterCertificate checks if the leaf certificate belongs to the given router.
+func verifyRouterCertificate(rawCerts [][]byte, router netip.Addr) error {
+	if len(rawCerts) == 0 {
+		return errors.New("no certificate presented")
+	}
+	cert, err := x509.ParseCertificate(rawCerts[0])
+	if err != nil {
+		return fmt.Errorf("parse certificate: %w", err)
+	}
+
+	// Check if the certificate key matches the router address.
+	pubKey, ok := cert.PublicKey.(ed25519.PublicKey)
+	if !ok {
+		return errors.New("certificate does not use an Ed25519 key")
+	}
+	if err := m.VerifyAddressKey(router, m.AddressDigestAlg, m.AddressKeyToolID, pubKey); err != nil {
+		return fmt.Errorf("certificate does not belong to pinned router %s: %w", router, err)
+	}
+
+	// Check the self-signature.
+	if err := cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature); err != nil {
+		return fmt.Errorf("check certificate signature: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,56 @@
+package peering
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+func TestIdentityCertificate(t *testing.T) {
+	t.Parallel()
+
+	idA, _, err := m.GeneratePrivacyAddress(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	idB, _, err := m.GeneratePrivacyAddress(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create certificate.
+	cert, err := makeIdentityCertificate(idA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Certificate must be deterministic.
+	cert2, err := makeIdentityCertificate(idA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(cert.Certificate[0]) != string(cert2.Certificate[0]) {
+		t.Fatal("identity certificate is not deterministic")
+	}
+
+	// Verify with pinning.
+	if err := verifyRouterCertificate(cert.Certificate, idA.IP); err != nil {
+		t.Fatalf("certificate should match its router: %s", err)
+	}
+	if err := verifyRouterCertificate(cert.Certificate, idB.IP); err == nil {
+		t.Fatal("certificate must not match another router")
+	}
+
+	// Check pinned router parsing.
+	pinned, err := getPinnedRouter(&m.PeeringURL{Protocol: "tls", Option: idA.IP.String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pinned != idA.IP {
+		t.Fatalf("unexpected pinned router %s", pinned)
+	}
+	if _, err := getPinnedRouter(&m.PeeringURL{Protocol: "tls", Option: "192.0.2.1"}); err == nil {
+		t.Fatal("non-mycoria pinned router must fail")
+	}
+}
@@ -0,0 +1,126 @@
+package router
+
+import (
+	"net/netip"
+	"time"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+// anycastFlowTTL defines how long an idle flow sticks to an anycast member.
+const anycastFlowTTL = 10 * time.Minute
+
+type anycastFlowKey struct {
+	group netip.Addr
+	flow  uint64
+}
+
+type anycastFlow struct {
+	member   netip.Addr
+	lastSeen time.Time
+}
+
+// Anycast returns the anycast table.
+func (r *Router) Anycast() *m.AnycastTable {
+	return r.anycast
+}
+
+// servesAnycast returns whether this router is a member of the given anycast group.
+func (r *Router) servesAnycast(group netip.Addr) bool {
+	for _, am := range r.instance.Config().AnycastMemberships {
+		if am.Group.IP == group && !am.Expired() {
+			return true
+		}
+	}
+	return false
+}
+
+// anycastMembers returns the memberships to announce.
+func (r *Router) anycastMembers() []*m.AnycastMembership {
+	var memberships []*m.AnycastMembership
+	for _, am := range r.instance.Config().AnycastMemberships {
+		if !am.Expired() {
+			memberships = append(memberships, am)
+		}
+	}
+	return memberships
+}
+
+// anycastMemberFor returns the member of the given anycast group that serves
+// the given flow. All frames of a flow are sent to the same member, as long
+// as it is reachable, so that the session stays with one member.
+func (r *Router) anycastMemberFor(group netip.Addr, flow uint64) (member netip.Addr, ok bool) {
+	key := anycastFlowKey{group: group, flow: flow}
+	now := time.Now()
+
+	r.anycastFlowsLock.Lock()
+	defer r.anycastFlowsLock.Unlock()
+
+	// Stick to the member of the flow, if it is still reachable.
+	if af, ok := r.anycastFlows[key]; ok &&
+		r.anycast.IsMember(group, af.member) &&
+		r.hasRouteTo(af.member) {
+		af.lastSeen = now
+		return af.member, true
+	}
+
+	// Select nearest member.
+	member, ok = r.nearestAnycastMember(group, flow)
+	if !ok {
+		return netip.Addr{}, false
+	}
+	r.anycastFlows[key] = &anycastFlow{
+		member:   member,
+		lastSeen: now,
+	}
+	return member, true
+}
+
+// nearestAnycastMember returns the member of the given anycast group with the
+// best route. If no member has a route, a member is selected by the flow and
+// a route discovery is started.
+func (r *Router) nearestAnycastMember(group netip.Addr, flow uint64) (member netip.Addr, ok bool) {
+	members := r.anycast.Members(group)
+	if len(members) == 0 {
+		return netip.Addr{}, false
+	}
+
+	var best *m.RoutingTableEntry
+	for _, member := range members {
+		rte, isDestination := r.table.LookupNearestRoute(member)
+		switch {
+		case !isDestination || rte == nil:
+			// No route to member.
+		case best == nil:
+			best = rte
+		case rte.Path.TotalDelay < best.Path.TotalDelay,
+			rte.Path.TotalDelay == best.Path.TotalDelay && rte.Path.TotalHops < best.Path.TotalHops:
+			best = rte
+		}
+	}
+	if best != nil {
+		return best.DstIP, true
+	}
+
+	// Fall back to selecting a member by flow.
+	member = members[flow%uint64(len(members))]
+	r.DiscoverPing.Discover(member)
+	return member, true
+}
+
+// hasRouteTo returns whether there is a route to the exact destination.
+func (r *Router) hasRouteTo(dst netip.Addr) bool {
+	_, isDestination := r.table.LookupNearestRoute(dst)
+	return isDestination
+}
+
+func (r *Router) cleanAnycastFlows() {
+	r.anycastFlowsLock.Lock()
+	defer r.anycastFlowsLock.Unlock()
+
+	for key, af := range r.anycastFlows {
+		if time.Since(af.lastSeen) > anycastFlowTTL {
+			delete(r.anycastFlows, key)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"github.com/mycoria/mycoria/api/httpapi"
+)
+
+// registerAPI registers the router endpoints on the HTTP API.
+func (r *Router) registerAPI(api *httpapi.API) {
+	api.HandleFunc("GET /api/trace/{ip}", r.traceAPI)
+}
+
+// TraceResult is the result of a trace.
+type TraceResult struct {
+	Dst  netip.Addr  `json:"dst"`
+	Hops []*TraceHop `json:"hops"`
+}
+
+func (r *Router) traceAPI(w http.ResponseWriter, req *http.Request) {
+	dst, err := netip.ParseAddr(req.PathValue("ip"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid IP: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// Traces take longer than the default write timeout.
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(TraceTimeout + 10*time.Second))
+
+	// Trace destination.
+	hops, err := r.TracePing.Trace(req.Context(), dst)
+	switch {
+	case errors.Is(err, ErrTraceActive):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, fmt.Sprintf("trace failed: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeTraceResult(w, dst, hops)
+}
+
+// writeTraceResult responds with the trace result as JSON.
+func writeTraceResult(w http.ResponseWriter, dst netip.Addr, hops []*TraceHop) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(&TraceResult{
+		Dst:  dst,
+		Hops: hops,
+	})
+}
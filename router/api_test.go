@@ -0,0 +1,71 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestTraceAPI(t *testing.T) {
+	t.Parallel()
+
+	r := &Router{}
+	r.TracePing = NewTracePingHandler(r)
+	dst := netip.MustParseAddr("fd00::3")
+
+	// Invalid IP.
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/trace/invalid", nil)
+	req.SetPathValue("ip", "invalid")
+	r.traceAPI(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected bad request for invalid IP, got %d", rec.Code)
+	}
+
+	// Trace already active.
+	r.TracePing.tracing[dst] = struct{}{}
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/api/trace/"+dst.String(), nil)
+	req.SetPathValue("ip", dst.String())
+	r.traceAPI(rec, req)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("expected conflict for active trace, got %d", rec.Code)
+	}
+}
+
+func TestTraceResultEncoding(t *testing.T) {
+	t.Parallel()
+
+	dst := netip.MustParseAddr("fd00::3")
+	hops := []*TraceHop{
+		{Hop: 1, Router: netip.MustParseAddr("fd00::2"), Label: 7, Latency: 12, RTT: 25 * time.Millisecond},
+		{Hop: 2},
+		{Hop: 3, Router: dst, Label: 9, Latency: 3, RTT: 40 * time.Millisecond, Reached: true},
+	}
+
+	rec := httptest.NewRecorder()
+	writeTraceResult(rec, dst, hops)
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("unexpected content type %q", ct)
+	}
+
+	// Decode like the trace command.
+	result := &TraceResult{}
+	if err := json.NewDecoder(rec.Body).Decode(result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Dst != dst || len(result.Hops) != len(hops) {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	for i, hop := range result.Hops {
+		if *hop != *hops[i] {
+			t.Errorf("hop %d does not match: got %+v, expected %+v", i+1, hop, hops[i])
+		}
+	}
+	if result.Hops[1].Answered() {
+		t.Error("unanswered hop should stay unanswered")
+	}
+}
@@ -104,7 +104,7 @@ func (r *Router) checkPolicy(w *mgr.WorkerCtx, inbound bool, connKey connStateKe
 
 	if inbound {
 		// Check inbound policy.
-		if r.instance.Config().CheckInboundTrafficPolicy(connKey.protocol, connKey.localPort, connKey.remoteIP) {
+		if r.checkInboundTrafficPolicy(connKey.protocol, connKey.localPort, connKey.remoteIP) {
 			connState.status.Store(uint32(connStatusAllowed))
 			w.Debug(
 				"incoming connection allowed",
@@ -209,6 +209,21 @@ stateSearch:
 	return connStatus(connState.status.Load())
 }
 
+// checkInboundTrafficPolicy checks the inbound traffic policy for the given
+// source router. Policies for previous addresses of the router apply too.
+func (r *Router) checkInboundTrafficPolicy(protocol uint8, dstPort uint16, src netip.Addr) bool {
+	cfg := r.instance.Config()
+	if cfg.CheckInboundTrafficPolicy(protocol, dstPort, src) {
+		return true
+	}
+	for _, previous := range r.instance.State().Predecessors(src) {
+		if cfg.CheckInboundTrafficPolicy(protocol, dstPort, previous) {
+			return true
+		}
+	}
+	return false
+}
+
 func (r *Router) outboundAllowedTo(dst netip.Addr) bool {
 	// Check if router is isolated.
 	if !r.instance.Config().Router.Isolate {
@@ -216,8 +231,7 @@ func (r *Router) outboundAllowedTo(dst netip.Addr) bool {
 	}
 
 	// Check if dst is a friend.
-	_, ok := r.instance.Config().FriendsByIP[dst]
-	return ok
+	return r.instance.State().IsFriend(dst)
 }
 
 func (r *Router) markRouter(status connStatus, dst netip.Addr) {
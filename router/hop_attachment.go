@@ -0,0 +1,129 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/fxamacker/cbor/v2"
+
+	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/peering"
+	"github.com/mycoria/mycoria/state"
+)
+
+// Hop attachments are added to hop pings by every router that forwards them.
+// They are signed by the forwarding router and record the path of the ping.
+// The announce ping attachment format is used for all hop pings.
+
+// makeHopAttachment returns a signed hop attachment for forwarding a hop ping
+// received on recvLink to sendLink. The given appendix is nested.
+func (r *Router) makeHopAttachment(recvLink frame.LinkAccessor, sendLink peering.Link, apx, signingContext []byte) ([]byte, error) {
+	// Marshal attachment.
+	attach := AnnouncePingAttachment{
+		Router:         r.instance.Identity().PublicAddress,
+		Delay:          recvLink.Latency(),
+		ForwardLabel:   recvLink.SwitchLabel(),
+		ReturnLabel:    sendLink.SwitchLabel(),
+		NextAttachment: apx,
+	}
+	attachData, err := cbor.Marshal(attach)
+	if err != nil {
+		return nil, fmt.Errorf("marshal attachment: %w", err)
+	}
+
+	// Sign attachment.
+	sig, err := r.instance.Identity().SignWithContext(attachData, signingContext)
+	if err != nil {
+		return nil, fmt.Errorf("sign with context: %w", err)
+	}
+	return append(attachData, sig...), nil
+}
+
+// parseHopAttachments parses the hop attachments of a hop ping.
+// The hops are returned in reverse order, ie. the last hop first.
+// If verify is set, the signatures are verified and an error is returned if
+// the ping already passed this router.
+func (r *Router) parseHopAttachments(apx, signingContext []byte, verify bool) ([]m.SwitchHop, error) {
+	hops := make([]m.SwitchHop, 0, 10) // TODO: Can we estimate this better?
+	for i := 1; i <= 100; i++ {
+		// Check if there is data left.
+		if len(apx) == 0 {
+			break
+		}
+
+		// Stop at some point.
+		if i == 100 {
+			return nil, errors.New("max recursion of 100 reached")
+		}
+
+		// Check size of appendix data.
+		if len(apx) < 65 {
+			return nil, errors.New("appendix too small for hop attachment")
+		}
+
+		// Parse attachment.
+		attached := AnnouncePingAttachment{}
+		err := cbor.Unmarshal(apx[:len(apx)-64], &attached)
+		if err != nil {
+			return nil, fmt.Errorf("unmarshal hop attachment at layer %d: %w", i, err)
+		}
+
+		if verify {
+			// Check if this us.
+			if attached.Router.IP == r.instance.Identity().IP {
+				return nil, errHopPingIsLooping
+			}
+
+			// Get (or create) session.
+			session, err := r.sessionFromHopAttachment(&attached)
+			if err != nil {
+				return nil, fmt.Errorf("get session for %s at layer %d: %w", attached.Router.IP, i, err)
+			}
+
+			// Verify signature.
+			sigStart := len(apx) - 64
+			err = session.Address().VerifySigWithContext(apx[:sigStart], apx[sigStart:], signingContext)
+			if err != nil {
+				return nil, fmt.Errorf("verify attachment of %s at layer %d: %w", attached.Router.IP, i, err)
+			}
+		}
+
+		// Add hop to list.
+		hops = append(hops, m.SwitchHop{
+			Router:       attached.Router.IP,
+			Delay:        attached.Delay,
+			ForwardLabel: attached.ForwardLabel,
+			ReturnLabel:  attached.ReturnLabel,
+		})
+
+		// Set apx to next attachment.
+		apx = attached.NextAttachment
+	}
+
+	return hops, nil
+}
+
+func (r *Router) sessionFromHopAttachment(a *AnnouncePingAttachment) (*state.Session, error) {
+	// Get (or create) session.
+	session := r.instance.State().GetSession(a.Router.IP)
+	if session != nil {
+		return session, nil
+	}
+
+	// Check and add router address.
+	if err := a.Router.VerifyAddress(); err != nil {
+		return nil, fmt.Errorf("hop attachment address data invalid: %w", err)
+	}
+	if err := r.instance.State().AddRouter(&a.Router); err != nil {
+		return nil, fmt.Errorf("add router to state: %w", err)
+	}
+
+	// Get session for newly added router.
+	session = r.instance.State().GetSession(a.Router.IP)
+	if session == nil {
+		return nil, errors.New("internal state failure")
+	}
+
+	return session, nil
+}
@@ -0,0 +1,139 @@
+package router
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"net/netip"
+
+	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/m"
+)
+
+const (
+	// multipathMaxRoutes defines how many routes are used for multipath
+	// forwarding. The routing table holds up to three routes per destination.
+	multipathMaxRoutes = 3
+
+	// multipathMaxDelayFactor defines how much slower than the best route
+	// another route may be in order to be used for multipath forwarding.
+	multipathMaxDelayFactor = 2
+	// multipathDelayTolerance is added to the max delay of viable routes, so
+	// that routes with very low delays do not disqualify each other.
+	multipathDelayTolerance = 10 // ms
+)
+
+// flowHash returns a hash of the connection 5-tuple.
+// It is used to keep all frames of a connection on the same route.
+func (key connStateKey) flowHash() uint64 {
+	h := fnv.New64a()
+	b := key.localIP.As16()
+	_, _ = h.Write(b[:])
+	b = key.remoteIP.As16()
+	_, _ = h.Write(b[:])
+	var rest [5]byte
+	rest[0] = key.protocol
+	binary.BigEndian.PutUint16(rest[1:3], key.localPort)
+	binary.BigEndian.PutUint16(rest[3:5], key.remotePort)
+	_, _ = h.Write(rest[:])
+	return h.Sum64()
+}
+
+// addrFlowHash returns a hash of the source and destination IPs.
+// It is used for frames where the connection 5-tuple is not visible.
+func addrFlowHash(src, dst netip.Addr) uint64 {
+	return connStateKey{localIP: src, remoteIP: dst}.flowHash()
+}
+
+// RouteFlow forwards the given frame to the next hop based on the destination
+// IP. Frames are distributed over the viable routes to the destination by the
+// given flow hash, weighted by route delay.
+// If there is no route to the exact destination and no static route applies,
+// a route discovery is started.
+func (r *Router) RouteFlow(f frame.Frame, flow uint64) error {
+	// Check if destination is routable.
+	if !m.RoutingAddressPrefix.Contains(f.DstIP()) {
+		return fmt.Errorf("dst IP %s is not routable", f.DstIP())
+	}
+
+	routes, isDestination := r.table.LookupNearestRoutes(f.DstIP(), multipathMaxRoutes)
+
+	// Discover a route to the destination, if we are the source.
+	if !isDestination && f.SrcIP() == r.instance.Identity().IP &&
+		(len(routes) == 0 || routes[0].Source != m.RouteSourceStatic) {
+		r.DiscoverPing.Discover(f.DstIP())
+	}
+
+	rte := selectMultipathRoute(r.viableRoutes(f.RecvLink(), routes), flow)
+	return r.routeFrameVia(f, rte)
+}
+
+// viableRoutes returns the routes that are usable for multipath forwarding.
+// The given routes must be sorted best first.
+func (r *Router) viableRoutes(recvLink frame.LinkAccessor, routes []*m.RoutingTableEntry) []*m.RoutingTableEntry {
+	if len(routes) <= 1 {
+		return routes
+	}
+
+	maxDelay := int(routes[0].Path.TotalDelay)*multipathMaxDelayFactor + multipathDelayTolerance
+	viable := make([]*m.RoutingTableEntry, 0, len(routes))
+	for _, rte := range routes {
+		switch {
+		case int(rte.Path.TotalDelay) > maxDelay:
+			// Route is too slow compared to the best route.
+		case recvLink != nil && rte.NextHop == recvLink.Peer():
+			// Route would send frame back where it came from.
+		case r.instance.Peering().GetLink(rte.NextHop) == nil:
+			// Next hop is not connected (anymore).
+		default:
+			viable = append(viable, rte)
+		}
+	}
+
+	// Fall back to the best route, so that errors are reported correctly.
+	if len(viable) == 0 {
+		return routes[:1]
+	}
+	return viable
+}
+
+// selectMultipathRoute selects a route for the given flow.
+// Routes are weighted by the inverse of their delay, so that faster routes
+// receive more flows.
+func selectMultipathRoute(routes []*m.RoutingTableEntry, flow uint64) *m.RoutingTableEntry {
+	switch len(routes) {
+	case 0:
+		return nil
+	case 1:
+		return routes[0]
+	}
+
+	// Calculate weights.
+	var (
+		weights     = make([]uint64, len(routes))
+		totalWeight uint64
+	)
+	for i, rte := range routes {
+		weights[i] = routeWeight(rte)
+		totalWeight += weights[i]
+	}
+
+	// Select route by flow.
+	point := flow % totalWeight
+	for i, weight := range weights {
+		if point < weight {
+			return routes[i]
+		}
+		point -= weight
+	}
+	return routes[0]
+}
+
+// routeWeight returns the weight of a route for multipath forwarding.
+func routeWeight(rte *m.RoutingTableEntry) uint64 {
+	delay := uint64(rte.Path.TotalDelay)
+	if delay == 0 {
+		delay = 1
+	}
+	return 1_000_000 / delay
+}
@@ -0,0 +1,52 @@
+package router
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+func TestSelectMultipathRoute(t *testing.T) {
+	t.Parallel()
+
+	routes := []*m.RoutingTableEntry{
+		{Path: m.SwitchPath{TotalDelay: 10}},
+		{Path: m.SwitchPath{TotalDelay: 20}},
+		{Path: m.SwitchPath{TotalDelay: 40}},
+	}
+
+	// Distribute flows and check if they are weighted by delay.
+	selected := make(map[*m.RoutingTableEntry]int)
+	for i := range 10000 {
+		key := connStateKey{
+			localIP:    netip.MustParseAddr("fd00::1"),
+			remoteIP:   netip.MustParseAddr("fd00::2"),
+			protocol:   6,
+			localPort:  uint16(i),
+			remotePort: 443,
+		}
+		rte := selectMultipathRoute(routes, key.flowHash())
+		selected[rte]++
+
+		// Check if flows are stable.
+		if selectMultipathRoute(routes, key.flowHash()) != rte {
+			t.Fatal("flow was not routed consistently")
+		}
+	}
+	if selected[routes[0]] <= selected[routes[1]] || selected[routes[1]] <= selected[routes[2]] {
+		t.Errorf("flows are not weighted by delay: %d, %d, %d",
+			selected[routes[0]], selected[routes[1]], selected[routes[2]])
+	}
+	if selected[routes[2]] == 0 {
+		t.Error("slowest viable route was never used")
+	}
+
+	// Check edge cases.
+	if selectMultipathRoute(nil, 1) != nil {
+		t.Error("no route should be selected from an empty list")
+	}
+	if selectMultipathRoute(routes[:1], 1) != routes[0] {
+		t.Error("single route should always be selected")
+	}
+}
@@ -0,0 +1,39 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+// checkOrgDelegation checks if the given router may use its address.
+// Routers with an organization address must have a valid delegation by the
+// root key of their organization. Routers of the own organization must be
+// delegated by the same root key as this router.
+func (r *Router) checkOrgDelegation(router netip.Addr, od *m.OrgDelegation) error {
+	if m.GetAddressType(router) != m.TypeOrganization {
+		return nil
+	}
+
+	switch {
+	case od == nil:
+		return errors.New("missing organization delegation")
+	case od.Member != router:
+		return fmt.Errorf("organization delegation is for router %s", od.Member)
+	case od.Expired():
+		return errors.New("organization delegation expired")
+	}
+	if err := od.Verify(); err != nil {
+		return fmt.Errorf("invalid organization delegation: %w", err)
+	}
+
+	// Check if the router is delegated by the own organization.
+	own := r.instance.Config().OrgDelegation
+	if own != nil && own.Prefix() == od.Prefix() && !own.Root.PublicKey.Equal(od.Root.PublicKey) {
+		return errors.New("organization delegation is signed by a foreign root key")
+	}
+
+	return nil
+}
@@ -82,7 +82,7 @@ func (r *Router) GetPingHandler(pingType string) PingHandler {
 
 func (r *Router) handlePing(w *mgr.WorkerCtx, f frame.Frame) error {
 	// Parse ping header.
-	hdr, data, err := r.parsePingMsg(f)
+	hdr, data, err := r.parsePingMsg(f, r.instance.State())
 	if err != nil {
 		return err
 	}
@@ -118,6 +118,18 @@ type sendPingOpts struct { //nolint:maligned
 	pingData []byte
 	// Define this message is a response or follow up.
 	followUp bool
+	// Define the TTL of the frame.
+	// The default is used if 0.
+	ttl uint8
+	// Send to these peers instead of routing to destination.
+	// Only valid with dst.
+	nextHops []netip.Addr
+	// Pad the frame message data with zeros to this size.
+	// Handlers of padded pings must ignore trailing data.
+	padTo int
+	// Send from this privacy address instead of the router address.
+	// Only valid with dst.
+	privacy *privacyAddress
 }
 
 func (opts sendPingOpts) validate() error {
@@ -127,12 +139,17 @@ func (opts sendPingOpts) validate() error {
 	case opts.msgType != frame.RouterHopPingDeprecated &&
 		opts.msgType != frame.RouterPing &&
 		opts.msgType != frame.RouterCtrl &&
-		opts.msgType != frame.RouterHopPing:
+		opts.msgType != frame.RouterHopPing &&
+		opts.msgType != frame.SessionCtrl:
 		return fmt.Errorf("%s is not a valid ping message type", opts.msgType)
 	case opts.pingType == "":
 		return errors.New("ping type is mandatory")
 	case len(opts.pingData) == 0:
 		return errors.New("ping data is mandatory")
+	case len(opts.nextHops) > 0 && !opts.dst.IsValid():
+		return errors.New("next hops require dst")
+	case opts.privacy != nil && !opts.dst.IsValid():
+		return errors.New("privacy address requires dst")
 	default:
 		return nil
 	}
@@ -149,15 +166,23 @@ func (r *Router) sendPingMsg(opts sendPingOpts) error {
 		opts.pingID = newPingID()
 	}
 
+	// Get identity and state to send from.
+	identity := r.instance.Identity()
+	srcState := r.instance.State()
+	if opts.privacy != nil {
+		identity = opts.privacy.id
+		srcState = opts.privacy.state
+	}
+
 	// Build and marshal header.
 	hdr := PingHeader{
 		PingID:    opts.pingID,
 		PingType:  opts.pingType,
 		PingCode:  opts.pingCode,
 		FollowUp:  opts.followUp,
-		AddrHash:  r.instance.Identity().Hash,
-		KeyType:   r.instance.Identity().Type,
-		PublicKey: r.instance.Identity().PublicKey,
+		AddrHash:  identity.Hash,
+		KeyType:   identity.Type,
+		PublicKey: identity.PublicKey,
 	}
 	hdrData, err := cbor.Marshal(&hdr)
 	if err != nil {
@@ -168,30 +193,48 @@ func (r *Router) sendPingMsg(opts sendPingOpts) error {
 	}
 
 	// Build complete frame data.
-	requiredSize := 2 + len(hdrData) + len(opts.pingData)
+	requiredSize := max(2+len(hdrData)+len(opts.pingData), opts.padTo)
 	frameData := make([]byte, requiredSize)
 	frameData[0] = 1
 	frameData[1] = uint8(len(hdrData))
 	copy(frameData[2:], hdrData)
 	copy(frameData[2+len(hdrData):], opts.pingData)
 
-	// Make frame.
+	// Get destination and session.
 	dst := opts.dst
 	sendToPeer := false
 	if !dst.IsValid() {
 		dst = opts.peer
 		sendToPeer = true
 	}
+	session := srcState.GetSession(dst)
+
+	// Privacy addresses are not routable, so pings from and to them are
+	// source routed.
+	var switchBlock []byte
+	switch {
+	case opts.privacy != nil:
+		switchBlock = r.privacySwitchBlock(dst, addrFlowHash(identity.IP, dst))
+		if switchBlock == nil {
+			return ErrNoSwitchPath
+		}
+	case m.GetAddressType(dst) == m.TypePrivacy && session != nil:
+		switchBlock = session.ReturnBlock()
+		if m.IsEmptySwitchBlock(switchBlock) {
+			return ErrNoSwitchPath
+		}
+	}
+
+	// Make frame.
 	f, err := r.instance.FrameBuilder().NewFrameV1(
-		r.instance.Identity().IP, dst, opts.msgType,
-		nil, frameData, nil,
+		identity.IP, dst, opts.msgType,
+		switchBlock, frameData, nil,
 	)
 	if err != nil {
 		return fmt.Errorf("build frame: %w", err)
 	}
 
 	// Sign frame.
-	session := r.instance.State().GetSession(dst)
 	switch {
 	case session != nil:
 		// Sign or encrypt with the existing session.
@@ -208,11 +251,14 @@ func (r *Router) sendPingMsg(opts sendPingOpts) error {
 		// Destination router is not known, sign raw.
 		f.SetTTL(0)
 		f.SetSequenceTime(time.Now().Round(state.DefaultPrecision).Add(-state.DefaultPrecision))
-		if err := f.SignRaw(r.instance.Identity().PrivateKey); err != nil {
+		if err := f.SignRaw(identity.PrivateKey); err != nil {
 			return fmt.Errorf("sign frame: %w", err)
 		}
 		f.SetTTL(32)
 	}
+	if opts.ttl > 0 {
+		f.SetTTL(opts.ttl)
+	}
 
 	// Send frame on all links.
 	if f.DstIP() == m.RouterAddress {
@@ -237,6 +283,20 @@ func (r *Router) sendPingMsg(opts sendPingOpts) error {
 	}
 
 	// Send frame.
+	// Send to given next hops.
+	if len(opts.nextHops) > 0 {
+		for i, nextHop := range opts.nextHops {
+			// Clone frame for all but last next hop.
+			var sendFrame frame.Frame = f
+			if i < len(opts.nextHops)-1 {
+				sendFrame = f.Clone()
+			}
+			if err := r.instance.Switch().ForwardByPeer(sendFrame, nextHop); err != nil {
+				return fmt.Errorf("send ping frame to next hop %s: %w", nextHop, err)
+			}
+		}
+		return nil
+	}
 	// Send to peer.
 	if sendToPeer {
 		if err := r.instance.Switch().ForwardByPeer(f, opts.peer); err != nil {
@@ -244,6 +304,13 @@ func (r *Router) sendPingMsg(opts sendPingOpts) error {
 		}
 		return nil
 	}
+	// Send along switch block.
+	if len(switchBlock) > 0 {
+		if err := r.sourceRouteFlow(f, addrFlowHash(f.SrcIP(), f.DstIP())); err != nil {
+			return fmt.Errorf("send ping frame: %w", err)
+		}
+		return nil
+	}
 	// Route to destination.
 	if err := r.RouteFrame(f); err != nil {
 		return fmt.Errorf("send ping frame: %w", err)
@@ -251,12 +318,12 @@ func (r *Router) sendPingMsg(opts sendPingOpts) error {
 	return nil
 }
 
-func (r *Router) parsePingMsg(f frame.Frame) (hdr *PingHeader, body []byte, err error) {
+func (r *Router) parsePingMsg(f frame.Frame, st *state.State) (hdr *PingHeader, body []byte, err error) {
 	// Get (or create) session.
-	session := r.instance.State().GetSession(f.SrcIP())
+	session := st.GetSession(f.SrcIP())
 	if session == nil {
 		// Add address frm
-		session, err = r.sessionFromPingHeader(f)
+		session, err = r.sessionFromPingHeader(f, st)
 		if err != nil {
 			return nil, nil, fmt.Errorf("session from ping: %w", err)
 		}
@@ -278,6 +345,11 @@ func (r *Router) parsePingMsg(f frame.Frame) (hdr *PingHeader, body []byte, err
 		}
 	}
 
+	// Learn return path of pings from privacy addresses.
+	if m.GetAddressType(f.SrcIP()) == m.TypePrivacy {
+		r.learnReturnBlock(session, f)
+	}
+
 	// Get header.
 	hdr, dataOffset, err := parsePingHeader(f)
 	if err != nil {
@@ -287,7 +359,7 @@ func (r *Router) parsePingMsg(f frame.Frame) (hdr *PingHeader, body []byte, err
 	return hdr, f.MessageData()[dataOffset:], nil
 }
 
-func (r *Router) sessionFromPingHeader(f frame.Frame) (*state.Session, error) {
+func (r *Router) sessionFromPingHeader(f frame.Frame, st *state.State) (*state.Session, error) {
 	// Get header.
 	hdr, _, err := parsePingHeader(f)
 	if err != nil {
@@ -304,12 +376,12 @@ func (r *Router) sessionFromPingHeader(f frame.Frame) (*state.Session, error) {
 	if err := addr.VerifyAddress(); err != nil {
 		return nil, fmt.Errorf("ping header address data invalid: %w", err)
 	}
-	if err := r.instance.State().AddRouter(addr); err != nil {
+	if err := st.AddRouter(addr); err != nil {
 		return nil, fmt.Errorf("add router to state: %w", err)
 	}
 
 	// Get session for newly added router.
-	session := r.instance.State().GetSession(f.SrcIP())
+	session := st.GetSession(f.SrcIP())
 	if session == nil {
 		return nil, errors.New("internal state failure")
 	}
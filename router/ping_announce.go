@@ -12,15 +12,18 @@ import (
 	"github.com/mycoria/mycoria/m"
 	"github.com/mycoria/mycoria/mgr"
 	"github.com/mycoria/mycoria/peering"
-	"github.com/mycoria/mycoria/state"
 )
 
 const (
 	announcePingType = "announce"
 	announceInterval = 5 * time.Minute
+
+	// announceMaxAnycast defines how many anycast group memberships are
+	// accepted from a single announcement.
+	announceMaxAnycast = 16
 )
 
-var errAnnouncementIsLooping = errors.New("announcement is looping")
+var errHopPingIsLooping = errors.New("hop ping is looping")
 
 // AnnouncePingHandler handles announce pings.
 type AnnouncePingHandler struct {
@@ -54,6 +57,12 @@ type AnnouncePingMsg struct {
 	// It only has 1 peer or only lite peers.
 	Stub    bool      `cbor:"s,omitempty" json:"s,omitempty"`
 	Expires time.Time `cbor:"e,omitempty" json:"e,omitempty"`
+	// Anycast holds the anycast groups the router serves.
+	Anycast []*m.AnycastMembership `cbor:"a,omitempty" json:"a,omitempty"`
+	// Org holds the delegation of the router address by its organization.
+	Org *m.OrgDelegation `cbor:"o,omitempty" json:"o,omitempty"`
+	// Handover holds the handover from the previous address of the router.
+	Handover *m.IdentityHandover `cbor:"h,omitempty" json:"h,omitempty"`
 }
 
 // AnnouncePingAttachment is an announce ping attachment.
@@ -81,6 +90,11 @@ func (h *AnnouncePingHandler) Send(peer netip.Addr) error {
 	msg.ReturnLabel = link.SwitchLabel()
 	msg.Expires = time.Now().Add(announceInterval*2 + 10*time.Second)
 	msg.Stub = h.r.instance.Config().Router.Stub || h.r.instance.Peering().IsStub()
+	msg.Anycast = h.r.anycastMembers()
+	msg.Org = h.r.instance.Config().OrgDelegation
+	if ih := h.r.instance.Config().IdentityHandover; ih != nil && !ih.Expired() {
+		msg.Handover = ih
+	}
 	data, err := cbor.Marshal(&msg)
 	if err != nil {
 		return fmt.Errorf("marshal: %w", err)
@@ -112,7 +126,7 @@ func (h *AnnouncePingHandler) Handle(w *mgr.WorkerCtx, f frame.Frame, hdr *PingH
 	msg, hops, err := h.parseAnnouncePing(f, data)
 	if err != nil {
 		// If the announcement is looping, ignore it.
-		if errors.Is(err, errAnnouncementIsLooping) {
+		if errors.Is(err, errHopPingIsLooping) {
 			return nil
 		}
 
@@ -129,6 +143,11 @@ func (h *AnnouncePingHandler) Handle(w *mgr.WorkerCtx, f frame.Frame, hdr *PingH
 		return errors.New("last announce ping attachment does not match peer")
 	}
 
+	// Check organization delegation.
+	if err := h.r.checkOrgDelegation(f.SrcIP(), msg.Org); err != nil {
+		return fmt.Errorf("organization router %s: %w", f.SrcIP(), err)
+	}
+
 	// Add router info to state.
 	err = h.r.instance.State().AddPublicRouterInfo(f.SrcIP(), msg.Info)
 	if err != nil {
@@ -139,6 +158,14 @@ func (h *AnnouncePingHandler) Handle(w *mgr.WorkerCtx, f frame.Frame, hdr *PingH
 		)
 	}
 
+	// Add anycast group memberships.
+	h.addAnycastMembers(w, f.SrcIP(), msg)
+
+	// Add identity handover.
+	if msg.Handover != nil {
+		h.addHandover(w, f.SrcIP(), msg.Handover)
+	}
+
 	// Add route to routing table.
 	switchPath := m.SwitchPath{
 		Hops: make([]m.SwitchHop, 0, len(hops)+2),
@@ -257,26 +284,12 @@ forwardToPeers:
 		// Clone frame.
 		fwd := f.Clone()
 
-		// Marshal attachment.
-		attach := AnnouncePingAttachment{
-			Router:         h.r.instance.Identity().PublicAddress,
-			Delay:          recvLink.Latency(),
-			ForwardLabel:   recvLink.SwitchLabel(),
-			ReturnLabel:    sendLink.SwitchLabel(),
-			NextAttachment: apx,
-		}
-		attachData, err := cbor.Marshal(attach)
+		// Add own hop attachment.
+		attachData, err := h.r.makeHopAttachment(recvLink, sendLink, apx, signingContext)
 		if err != nil {
-			return fmt.Errorf("forward: marshal attachment: %w", err)
+			return fmt.Errorf("forward: %w", err)
 		}
 
-		// Sign attachment.
-		sig, err := h.r.instance.Identity().SignWithContext(attachData, signingContext)
-		if err != nil {
-			return fmt.Errorf("forward: sign with context: %w", err)
-		}
-		attachData = append(attachData, sig...)
-
 		// Set new appendix and forward frame to peer.
 		err = fwd.SetAppendixData(attachData)
 		if err != nil {
@@ -295,16 +308,95 @@ forwardToPeers:
 	return nil
 }
 
+// addAnycastMembers verifies the anycast group memberships of the announcing
+// router and adds them to the anycast table.
+func (h *AnnouncePingHandler) addAnycastMembers(w *mgr.WorkerCtx, router netip.Addr, msg *AnnouncePingMsg) {
+	if len(msg.Anycast) > announceMaxAnycast {
+		w.Warn(
+			"ignoring excess anycast memberships",
+			"router", router,
+			"count", len(msg.Anycast),
+		)
+		msg.Anycast = msg.Anycast[:announceMaxAnycast]
+	}
+
+	for _, am := range msg.Anycast {
+		switch {
+		case am == nil:
+			continue
+		case am.Member != router:
+			w.Warn(
+				"announced anycast membership is for another router",
+				"router", router,
+				"member", am.Member,
+			)
+			continue
+		case am.Expired():
+			continue
+		}
+		if err := am.Verify(); err != nil {
+			w.Warn(
+				"announced anycast membership is invalid",
+				"router", router,
+				"group", am.Group.IP,
+				"err", err,
+			)
+			continue
+		}
+
+		// Membership expires with the announcement.
+		expires := am.Expires
+		if !msg.Expires.IsZero() && msg.Expires.Before(expires) {
+			expires = msg.Expires
+		}
+		if h.r.anycast.AddMember(am.Group.IP, router, expires) {
+			w.Info(
+				"added anycast group member",
+				"group", am.Group.IP,
+				"router", router,
+			)
+		}
+	}
+}
+
+// addHandover verifies the identity handover of the announcing router and
+// adds it to the state.
+func (h *AnnouncePingHandler) addHandover(w *mgr.WorkerCtx, router netip.Addr, ih *m.IdentityHandover) {
+	if ih.New != router {
+		w.Warn(
+			"announced identity handover is for another router",
+			"router", router,
+			"new", ih.New,
+		)
+		return
+	}
+
+	if _, err := h.r.instance.State().AddHandover(ih); err != nil {
+		w.Warn(
+			"failed to add announced identity handover",
+			"router", router,
+			"old", ih.Old.IP,
+			"err", err,
+		)
+	}
+}
+
 func (h *AnnouncePingHandler) signingContext(f frame.Frame) []byte {
+	return hopSigningContext(f.SrcIP(), f.SequenceTime(), f.AuthData())
+}
+
+// hopSigningContext returns the signing context for hop attachments of a
+// frame with the given source, sequence time and auth data.
+func hopSigningContext(src netip.Addr, seqTime time.Time, authData []byte) []byte {
 	context := make([]byte,
 		16+ // Source IP
 			8+ // Ping Timestamp
 			64) // Ed25519 Signature
 
 	// Copy all context data.
-	copy(context[:16], f.SrcIP().AsSlice())
-	m.PutUint64(context[16:24], uint64(f.SequenceTime().UnixMilli()))
-	copy(context[24:], f.AuthData())
+	copy(context[:16], src.AsSlice())
+	m.PutUint64(context[16:24], uint64(seqTime.UnixMilli()))
+	copy(context[24:], authData)
 
 	return context
 }
@@ -318,89 +410,14 @@ func (h *AnnouncePingHandler) parseAnnouncePing(f frame.Frame, pingData []byte)
 	}
 
 	// Parse switch path.
-	hops := make([]m.SwitchHop, 0, 10) // TODO: Can we estimate this better?
-	apx := f.AppendixData()
-	signingContext := h.signingContext(f)
-	for i := 1; i <= 100; i++ {
-		// Check if there is data left.
-		if len(apx) == 0 {
-			break
-		}
-
-		// Stop at some point.
-		if i == 100 {
-			return nil, nil, errors.New("max recursion of 100 reached")
-		}
-
-		// Check size of appendix data.
-		if len(apx) < 65 {
-			return nil, nil, errors.New("appendix too small for announce attachment")
-		}
-
-		// Parse attachment.
-		attached := AnnouncePingAttachment{}
-		err := cbor.Unmarshal(apx[:len(apx)-64], &attached)
-		if err != nil {
-			return nil, nil, fmt.Errorf("unmarshal announce attachment at layer %d: %w", i, err)
-		}
-
-		// Check if this us.
-		if attached.Router.IP == h.r.instance.Identity().IP {
-			return nil, nil, errAnnouncementIsLooping
-		}
-
-		// Get (or create) session.
-		session, err := h.sessionFromAnnouncePingAttachment(&attached)
-		if err != nil {
-			return nil, nil, fmt.Errorf("get session for %s at layer %d: %w", attached.Router.IP, i, err)
-		}
-
-		// Verify signature.
-		sigStart := len(apx) - 64
-		err = session.Address().VerifySigWithContext(apx[:sigStart], apx[sigStart:], signingContext)
-		if err != nil {
-			return nil, nil, fmt.Errorf("verify attachment of %s at layer %d: %w", attached.Router.IP, i, err)
-		}
-
-		// Add hop to list.
-		hops = append(hops, m.SwitchHop{
-			Router:       attached.Router.IP,
-			Delay:        attached.Delay,
-			ForwardLabel: attached.ForwardLabel,
-			ReturnLabel:  attached.ReturnLabel,
-		})
-
-		// Set apx to next attachment.
-		apx = attached.NextAttachment
+	hops, err := h.r.parseHopAttachments(f.AppendixData(), h.signingContext(f), true)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	return msg, hops, nil
 }
 
-func (h *AnnouncePingHandler) sessionFromAnnouncePingAttachment(a *AnnouncePingAttachment) (*state.Session, error) {
-	// Get (or create) session.
-	session := h.r.instance.State().GetSession(a.Router.IP)
-	if session != nil {
-		return session, nil
-	}
-
-	// Check and add router address.
-	if err := a.Router.VerifyAddress(); err != nil {
-		return nil, fmt.Errorf("announce ping attachment address data invalid: %w", err)
-	}
-	if err := h.r.instance.State().AddRouter(&a.Router); err != nil {
-		return nil, fmt.Errorf("add router to state: %w", err)
-	}
-
-	// Get session for newly added router.
-	session = h.r.instance.State().GetSession(a.Router.IP)
-	if session == nil {
-		return nil, errors.New("internal state failure")
-	}
-
-	return session, nil
-}
-
 func (r *Router) announceWorker(w *mgr.WorkerCtx) error {
 	// Try to announce first time 5 seconds after start.
 	time.Sleep(5 * time.Second)
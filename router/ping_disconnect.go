@@ -108,6 +108,9 @@ func (h *DisconnectPingHandler) Handle(w *mgr.WorkerCtx, f frame.Frame, hdr *Pin
 			)
 		}
 		msg.Disconnected = nil
+
+		// Remove router from anycast groups.
+		h.r.anycast.RemoveMember(f.SrcIP())
 	}
 
 	// Remove any applicable routes.
@@ -0,0 +1,805 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+
+	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+const (
+	discoverPingType = "discover"
+
+	// Discover ping codes.
+	discoverPingCodeBuild uint8 = 1
+	discoverPingCodeSweep uint8 = 2
+	discoverPingCodeQuery uint8 = 3
+
+	// discoverRouteTTL defines how long discovered routes are valid.
+	discoverRouteTTL = 1 * time.Hour
+	// discoverRetryInterval defines how long to wait before starting another
+	// discovery to the same destination.
+	discoverRetryInterval = 1 * time.Minute
+	// discoverStateTTL defines how long state of discover pings is kept.
+	discoverStateTTL = 30 * time.Second
+
+	// discoverMaxResponses defines how many path responses a destination sends
+	// per discover ping.
+	discoverMaxResponses = 3
+	// discoverSweepFanOut defines to how many next hops sweeps are forwarded.
+	discoverSweepFanOut = 3
+	// discoverQueryMaxSteps defines how many routers are queried at most.
+	discoverQueryMaxSteps = 16
+	// discoverQueryTimeout defines how long to wait for a query response.
+	discoverQueryTimeout = 2 * time.Second
+)
+
+// discoverStages defines the stages of a route discovery.
+// The query stage is used as the last resort.
+var discoverStages = []struct {
+	code    uint8
+	ttl     uint8
+	timeout time.Duration
+}{
+	{code: discoverPingCodeBuild, ttl: 16, timeout: 1 * time.Second},
+	{code: discoverPingCodeBuild, ttl: 64, timeout: 5 * time.Second},
+	{code: discoverPingCodeSweep, ttl: 64, timeout: 10 * time.Second},
+}
+
+// DiscoverPingHandler handles discover pings.
+type DiscoverPingHandler struct {
+	r *Router
+
+	active   map[uint64]*discoverPingState
+	seen     map[uint64]*discoverSeenState
+	attempts map[netip.Addr]time.Time
+	lock     sync.Mutex
+}
+
+// discoverPingState is the state of a discover ping sent by this router.
+type discoverPingState struct {
+	dst netip.Addr
+
+	notify  chan *DiscoverPingMsg
+	expires time.Time
+}
+
+// discoverSeenState tracks discover pings handled by this router.
+type discoverSeenState struct {
+	count   int
+	expires time.Time
+}
+
+var _ PingHandler = &DiscoverPingHandler{}
+
+// NewDiscoverPingHandler returns a new discover ping handler.
+func NewDiscoverPingHandler(r *Router) *DiscoverPingHandler {
+	return &DiscoverPingHandler{
+		r:        r,
+		active:   make(map[uint64]*discoverPingState),
+		seen:     make(map[uint64]*discoverSeenState),
+		attempts: make(map[netip.Addr]time.Time),
+	}
+}
+
+// Type returns the ping type.
+func (h *DiscoverPingHandler) Type() string {
+	return discoverPingType
+}
+
+// Clean cleans any internal state of the ping handler.
+func (h *DiscoverPingHandler) Clean(w *mgr.WorkerCtx) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	now := time.Now()
+	for pingID, pingState := range h.active {
+		if now.After(pingState.expires) {
+			delete(h.active, pingID)
+		}
+	}
+	for pingID, seenState := range h.seen {
+		if now.After(seenState.expires) {
+			delete(h.seen, pingID)
+		}
+	}
+	for dst, attempt := range h.attempts {
+		if now.Sub(attempt) > discoverRetryInterval {
+			delete(h.attempts, dst)
+		}
+	}
+
+	return nil
+}
+
+// DiscoverPingMsg is a discover ping message.
+type DiscoverPingMsg struct {
+	// Dst is the destination of a query.
+	Dst netip.Addr `cbor:"d,omitempty" json:"d,omitempty"`
+	// Route holds the relays between the origin and the destination of the
+	// ping, starting at the origin. Used for queries and responses.
+	Route []netip.Addr `cbor:"r,omitempty" json:"r,omitempty"`
+
+	// RequestTime and RequestAuth hold the sequence time (in unix ms) and
+	// the auth data of the request, so that the origin can verify the hops.
+	RequestTime int64  `cbor:"t,omitempty" json:"t,omitempty"`
+	RequestAuth []byte `cbor:"a,omitempty" json:"a,omitempty"`
+	// Hops holds the hop attachments of the request.
+	Hops []byte `cbor:"h,omitempty" json:"h,omitempty"`
+
+	// Delay is the latency of the link the request was received on.
+	Delay uint16 `cbor:"l,omitempty" json:"l,omitempty"`
+	// ReturnLabel is the label of the link the request was received on.
+	ReturnLabel m.SwitchLabel `cbor:"b,omitempty" json:"b,omitempty"`
+	// NextHops holds the best next hops to the queried destination.
+	NextHops []DiscoverPingHop `cbor:"n,omitempty" json:"n,omitempty"`
+}
+
+// DiscoverPingHop is a next hop returned by a query.
+type DiscoverPingHop struct {
+	Router       netip.Addr    `cbor:"r"           json:"r"`
+	Delay        uint16        `cbor:"d,omitempty" json:"d,omitempty"`
+	ForwardLabel m.SwitchLabel `cbor:"f,omitempty" json:"f,omitempty"`
+}
+
+// Discover starts a route discovery to the given destination in the
+// background, unless a discovery to it was started recently.
+func (h *DiscoverPingHandler) Discover(dst netip.Addr) {
+	if !h.startAttempt(dst) {
+		return
+	}
+
+	h.r.mgr.Go("discover route", func(w *mgr.WorkerCtx) error {
+		h.discover(w, dst)
+		return nil
+	})
+}
+
+// startAttempt records a discovery attempt to the given destination.
+// Returns false if a discovery to it was attempted recently.
+func (h *DiscoverPingHandler) startAttempt(dst netip.Addr) bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	attempt, ok := h.attempts[dst]
+	if ok && time.Since(attempt) < discoverRetryInterval {
+		return false
+	}
+	h.attempts[dst] = time.Now()
+	return true
+}
+
+func (h *DiscoverPingHandler) discover(w *mgr.WorkerCtx, dst netip.Addr) {
+	// Build paths with increasing effort.
+	for _, stage := range discoverStages {
+		found, err := h.discoverPath(w, dst, stage.code, stage.ttl, stage.timeout)
+		switch {
+		case err != nil:
+			w.Debug(
+				"failed to send discover ping",
+				"dst", dst,
+				"code", stage.code,
+				"err", err,
+			)
+		case found:
+			return
+		}
+		if w.IsDone() {
+			return
+		}
+	}
+
+	// Query hop by hop as a last resort.
+	found, err := h.query(w, dst)
+	switch {
+	case err != nil:
+		w.Debug(
+			"route discovery failed",
+			"dst", dst,
+			"err", err,
+		)
+	case !found:
+		w.Debug(
+			"route discovery failed",
+			"dst", dst,
+		)
+	}
+}
+
+// discoverPath sends a build or sweep discover ping to the given destination
+// and waits for the first discovered route.
+func (h *DiscoverPingHandler) discoverPath(w *mgr.WorkerCtx, dst netip.Addr, code, ttl uint8, timeout time.Duration) (found bool, err error) {
+	// Get next hops.
+	maxNextHops := 1
+	if code == discoverPingCodeSweep {
+		maxNextHops = discoverSweepFanOut
+	}
+	nextHops := h.nextHops(dst, maxNextHops, nil)
+	if len(nextHops) == 0 {
+		return false, ErrTableEmpty
+	}
+
+	// Marshal request.
+	data, err := cbor.Marshal(&DiscoverPingMsg{})
+	if err != nil {
+		return false, fmt.Errorf("marshal: %w", err)
+	}
+
+	// Send request.
+	pingID := newPingID()
+	pingState := h.setActive(pingID, dst)
+	err = h.r.sendPingMsg(sendPingOpts{
+		dst:      dst,
+		msgType:  frame.RouterHopPing,
+		pingID:   pingID,
+		pingType: discoverPingType,
+		pingCode: code,
+		pingData: data,
+		ttl:      ttl,
+		nextHops: nextHops,
+	})
+	if err != nil {
+		return false, fmt.Errorf("send ping: %w", err)
+	}
+
+	// Wait for response.
+	select {
+	case <-pingState.notify:
+		return true, nil
+	case <-time.After(timeout):
+		return false, nil
+	case <-w.Done():
+		return false, nil
+	}
+}
+
+// query discovers a route to the given destination by asking one router after
+// another for its best next hop.
+func (h *DiscoverPingHandler) query(w *mgr.WorkerCtx, dst netip.Addr) (found bool, err error) {
+	// Start with own best next hop.
+	nextHops := h.nextHops(dst, 1, nil)
+	if len(nextHops) == 0 {
+		return false, ErrTableEmpty
+	}
+	link := h.r.instance.Peering().GetLink(nextHops[0])
+	if link == nil {
+		return false, errors.New("next hop link not found")
+	}
+	path := []m.SwitchHop{{
+		Router:       h.r.instance.Identity().IP,
+		Delay:        link.Latency(),
+		ForwardLabel: link.SwitchLabel(),
+	}}
+	var (
+		current = link.Peer()
+		route   []netip.Addr
+	)
+
+	for range discoverQueryMaxSteps {
+		// Query current router.
+		resp, err := h.sendQuery(w, current, dst, route)
+		if err != nil {
+			return false, fmt.Errorf("query %s: %w", current, err)
+		}
+		if resp == nil {
+			return false, nil
+		}
+
+		// Add destination as final hop.
+		if current == dst {
+			path = append(path, m.SwitchHop{
+				Router:      dst,
+				ReturnLabel: resp.ReturnLabel,
+			})
+			return h.addDiscoveredRoute(w, dst, m.SwitchPath{Hops: path})
+		}
+
+		// Select next hop that does not loop.
+		var next *DiscoverPingHop
+		for _, nextHop := range resp.NextHops {
+			if !slices.ContainsFunc(path, func(hop m.SwitchHop) bool {
+				return hop.Router == nextHop.Router
+			}) {
+				next = &nextHop
+				break
+			}
+		}
+		if next == nil {
+			return false, nil
+		}
+
+		// Add current router as relay and continue with next hop.
+		path = append(path, m.SwitchHop{
+			Router:       current,
+			Delay:        next.Delay,
+			ForwardLabel: next.ForwardLabel,
+			ReturnLabel:  resp.ReturnLabel,
+		})
+		route = append(route, current)
+		current = next.Router
+	}
+
+	return false, nil
+}
+
+func (h *DiscoverPingHandler) sendQuery(w *mgr.WorkerCtx, router, dst netip.Addr, route []netip.Addr) (*DiscoverPingMsg, error) {
+	// Marshal request.
+	data, err := cbor.Marshal(&DiscoverPingMsg{
+		Dst:   dst,
+		Route: route,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal: %w", err)
+	}
+
+	// Send request along the route.
+	firstHop := router
+	if len(route) > 0 {
+		firstHop = route[0]
+	}
+	pingID := newPingID()
+	pingState := h.setActive(pingID, router)
+	defer h.pluckActive(pingID)
+	err = h.r.sendPingMsg(sendPingOpts{
+		dst:      router,
+		msgType:  frame.RouterHopPing,
+		pingID:   pingID,
+		pingType: discoverPingType,
+		pingCode: discoverPingCodeQuery,
+		pingData: data,
+		nextHops: []netip.Addr{firstHop},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("send ping: %w", err)
+	}
+
+	// Wait for response.
+	select {
+	case resp := <-pingState.notify:
+		return resp, nil
+	case <-time.After(discoverQueryTimeout):
+		return nil, nil
+	case <-w.Done():
+		return nil, nil
+	}
+}
+
+// nextHops returns the best next hops to the given destination, which are
+// nearer to the destination than this router.
+func (h *DiscoverPingHandler) nextHops(dst netip.Addr, maxNextHops int, avoid []netip.Addr) []netip.Addr {
+	maxDistance := m.IPDistance(h.r.instance.Identity().IP, dst)
+	routes := h.r.table.LookupPossiblePaths(dst, maxNextHops, maxDistance, true, avoid)
+	nextHops := make([]netip.Addr, 0, len(routes))
+	for _, rte := range routes {
+		if !slices.Contains(avoid, rte.NextHop) {
+			nextHops = append(nextHops, rte.NextHop)
+		}
+	}
+	return nextHops
+}
+
+// Handle handles incoming ping frames.
+func (h *DiscoverPingHandler) Handle(w *mgr.WorkerCtx, f frame.Frame, hdr *PingHeader, data []byte) error {
+	// Parse message.
+	msg := &DiscoverPingMsg{}
+	if err := cbor.Unmarshal(data, msg); err != nil {
+		return fmt.Errorf("unmarshal msg: %w", err)
+	}
+
+	// Discover pings require a recv link.
+	if f.RecvLink() == nil {
+		return errors.New("discover ping requires recv link for handling")
+	}
+
+	toMe := f.DstIP() == h.r.instance.Identity().IP
+	switch {
+	case !toMe && (hdr.FollowUp || hdr.PingCode == discoverPingCodeQuery):
+		return h.relay(f, msg.Route, hdr.FollowUp)
+	case hdr.FollowUp && hdr.PingCode == discoverPingCodeQuery:
+		return h.handleQueryResponse(f, hdr, msg)
+	case hdr.FollowUp:
+		return h.handlePathResponse(w, f, hdr, msg)
+	case hdr.PingCode == discoverPingCodeQuery:
+		return h.handleQueryRequest(f, hdr, msg)
+	default:
+		return h.handlePathRequest(w, f, hdr)
+	}
+}
+
+func (h *DiscoverPingHandler) handlePathRequest(w *mgr.WorkerCtx, f frame.Frame, hdr *PingHeader) error {
+	recvLink := f.RecvLink()
+
+	// Parse and verify hops.
+	signingContext := hopSigningContext(f.SrcIP(), f.SequenceTime(), f.AuthData())
+	hops, err := h.r.parseHopAttachments(f.AppendixData(), signingContext, true)
+	if err != nil {
+		// If the ping is looping, ignore it.
+		if errors.Is(err, errHopPingIsLooping) {
+			return nil
+		}
+		return fmt.Errorf("parse hops: %w", err)
+	}
+
+	// Check if the last hop matches the peer.
+	switch {
+	case len(hops) == 0 && f.SrcIP() != recvLink.Peer():
+		return errors.New("discover ping has no appendix, but source does not match peer")
+	case len(hops) > 0 && hops[0].Router != recvLink.Peer():
+		return errors.New("last discover ping attachment does not match peer")
+	}
+
+	// Respond if we are the destination.
+	if f.DstIP() == h.r.instance.Identity().IP {
+		if h.markSeen(hdr.PingID) > discoverMaxResponses {
+			return nil
+		}
+
+		// Build relay route from the origin.
+		route := make([]netip.Addr, 0, len(hops))
+		for i := len(hops) - 1; i >= 0; i-- {
+			route = append(route, hops[i].Router)
+		}
+
+		// Create and send response.
+		data, err := cbor.Marshal(&DiscoverPingMsg{
+			Route:       route,
+			RequestTime: f.SequenceTime().UnixMilli(),
+			RequestAuth: f.AuthData(),
+			Hops:        f.AppendixData(),
+			Delay:       recvLink.Latency(),
+			ReturnLabel: recvLink.SwitchLabel(),
+		})
+		if err != nil {
+			return fmt.Errorf("marshal response: %w", err)
+		}
+		err = h.r.sendPingMsg(sendPingOpts{
+			dst:      f.SrcIP(),
+			msgType:  frame.RouterHopPing,
+			pingID:   hdr.PingID,
+			pingType: discoverPingType,
+			pingCode: hdr.PingCode,
+			pingData: data,
+			followUp: true,
+			nextHops: []netip.Addr{recvLink.Peer()},
+		})
+		if err != nil {
+			return fmt.Errorf("send response: %w", err)
+		}
+		return nil
+	}
+
+	// Never forward if router is a stub.
+	if h.r.instance.Config().Router.Stub {
+		return nil
+	}
+
+	// Only forward the first copy of a ping.
+	if h.markSeen(hdr.PingID) > 1 {
+		return nil
+	}
+
+	// Select next hops, avoiding all previous hops.
+	maxNextHops := 1
+	if hdr.PingCode == discoverPingCodeSweep {
+		maxNextHops = discoverSweepFanOut
+	}
+	avoid := make([]netip.Addr, 0, len(hops)+1)
+	avoid = append(avoid, f.SrcIP())
+	for _, hop := range hops {
+		avoid = append(avoid, hop.Router)
+	}
+	nextHops := h.nextHops(f.DstIP(), maxNextHops, avoid)
+
+	// Forward to next hops.
+	apx := f.AppendixData()
+	for _, nextHop := range nextHops {
+		sendLink := h.r.instance.Peering().GetLink(nextHop)
+		if sendLink == nil {
+			continue
+		}
+
+		// Add own hop attachment.
+		attachData, err := h.r.makeHopAttachment(recvLink, sendLink, apx, signingContext)
+		if err != nil {
+			return fmt.Errorf("forward: %w", err)
+		}
+
+		// Set new appendix and forward frame to peer.
+		fwd := f.Clone()
+		err = fwd.SetAppendixData(attachData)
+		if err != nil {
+			return fmt.Errorf("forward: set new appendix: %w", err)
+		}
+		err = h.r.instance.Switch().ForwardByPeer(fwd, nextHop)
+		if err != nil {
+			w.Debug(
+				"failed to forward discover ping",
+				"src", f.SrcIP(),
+				"dst", f.DstIP(),
+				"err", err,
+			)
+		}
+	}
+
+	return nil
+}
+
+func (h *DiscoverPingHandler) handlePathResponse(w *mgr.WorkerCtx, f frame.Frame, hdr *PingHeader, msg *DiscoverPingMsg) error {
+	// Check if the response matches our request.
+	pingState := h.getActive(hdr.PingID)
+	if pingState == nil {
+		return errors.New("no state")
+	}
+	if f.SrcIP() != pingState.dst {
+		return errors.New("response source does not match requested destination")
+	}
+
+	// Parse and verify hops with the context of our request.
+	signingContext := hopSigningContext(
+		h.r.instance.Identity().IP,
+		time.UnixMilli(msg.RequestTime),
+		msg.RequestAuth,
+	)
+	hops, err := h.r.parseHopAttachments(msg.Hops, signingContext, true)
+	if err != nil {
+		return fmt.Errorf("parse hops: %w", err)
+	}
+
+	// Get link to first hop.
+	firstHop := f.SrcIP()
+	if len(hops) > 0 {
+		firstHop = hops[len(hops)-1].Router
+	}
+	link := h.r.instance.Peering().GetLink(firstHop)
+	if link == nil {
+		return errors.New("first hop link not found")
+	}
+
+	// Build path and add route.
+	path := makeDiscoveredPath(
+		m.SwitchHop{
+			Router:       h.r.instance.Identity().IP,
+			Delay:        link.Latency(),
+			ForwardLabel: link.SwitchLabel(),
+		},
+		hops,
+		m.SwitchHop{
+			Router:      f.SrcIP(),
+			Delay:       msg.Delay,
+			ReturnLabel: msg.ReturnLabel,
+		},
+	)
+	added, err := h.addDiscoveredRoute(w, f.SrcIP(), path)
+	if err != nil {
+		return err
+	}
+	if added {
+		select {
+		case pingState.notify <- msg:
+		default:
+		}
+	}
+	return nil
+}
+
+// makeDiscoveredPath builds the switch path from the origin to the
+// destination of a discover ping.
+// The hops must be in the order returned by parseHopAttachments, ie. nearest
+// to the destination first. The delay of the destination hop must be the
+// latency measured by the destination and is moved to the last relay.
+func makeDiscoveredPath(origin m.SwitchHop, hops []m.SwitchHop, dst m.SwitchHop) m.SwitchPath {
+	path := m.SwitchPath{
+		Hops: make([]m.SwitchHop, 0, len(hops)+2),
+	}
+	path.Hops = append(path.Hops, origin)
+
+	// Add relays in forward order.
+	// The hop attachments were made in the direction from the origin, so
+	// forward and return labels are swapped and delays move one hop back.
+	for i := len(hops) - 1; i >= 0; i-- {
+		delay := dst.Delay
+		if i > 0 {
+			delay = hops[i-1].Delay
+		}
+		path.Hops = append(path.Hops, m.SwitchHop{
+			Router:       hops[i].Router,
+			Delay:        delay,
+			ForwardLabel: hops[i].ReturnLabel,
+			ReturnLabel:  hops[i].ForwardLabel,
+		})
+	}
+
+	// Add destination as last.
+	path.Hops = append(path.Hops, m.SwitchHop{
+		Router:      dst.Router,
+		ReturnLabel: dst.ReturnLabel,
+	})
+	path.CalculateTotals()
+
+	return path
+}
+
+func (h *DiscoverPingHandler) addDiscoveredRoute(w *mgr.WorkerCtx, dst netip.Addr, path m.SwitchPath) (added bool, err error) {
+	if len(path.Hops) < 2 {
+		return false, errors.New("incomplete switch path")
+	}
+
+	added, err = h.r.table.AddRoute(m.RoutingTableEntry{
+		DstIP:   dst,
+		NextHop: path.Hops[1].Router,
+		Path:    path,
+		Source:  m.RouteSourceDiscovered,
+		Expires: time.Now().Add(discoverRouteTTL),
+	})
+	if err != nil {
+		return false, fmt.Errorf("add route: %w", err)
+	}
+	if added {
+		w.Info(
+			"discovered route",
+			"router", dst,
+			"nexthop", path.Hops[1].Router,
+			"hops", path.TotalHops,
+		)
+	}
+	return added, nil
+}
+
+func (h *DiscoverPingHandler) handleQueryRequest(f frame.Frame, hdr *PingHeader, msg *DiscoverPingMsg) error {
+	// Get previous router.
+	prev := f.SrcIP()
+	if len(msg.Route) > 0 {
+		prev = msg.Route[len(msg.Route)-1]
+	}
+	if f.RecvLink().Peer() != prev {
+		return errors.New("query not received from previous router")
+	}
+
+	// Create response with the best next hops to the destination.
+	resp := &DiscoverPingMsg{
+		Route:       msg.Route,
+		ReturnLabel: f.RecvLink().SwitchLabel(),
+	}
+	if msg.Dst != h.r.instance.Identity().IP {
+		for _, nextHop := range h.nextHops(msg.Dst, discoverSweepFanOut, []netip.Addr{prev}) {
+			link := h.r.instance.Peering().GetLink(nextHop)
+			if link == nil {
+				continue
+			}
+			resp.NextHops = append(resp.NextHops, DiscoverPingHop{
+				Router:       nextHop,
+				Delay:        link.Latency(),
+				ForwardLabel: link.SwitchLabel(),
+			})
+		}
+	}
+
+	// Send response back along the route.
+	data, err := cbor.Marshal(resp)
+	if err != nil {
+		return fmt.Errorf("marshal response: %w", err)
+	}
+	err = h.r.sendPingMsg(sendPingOpts{
+		dst:      f.SrcIP(),
+		msgType:  frame.RouterHopPing,
+		pingID:   hdr.PingID,
+		pingType: discoverPingType,
+		pingCode: discoverPingCodeQuery,
+		pingData: data,
+		followUp: true,
+		nextHops: []netip.Addr{prev},
+	})
+	if err != nil {
+		return fmt.Errorf("send response: %w", err)
+	}
+	return nil
+}
+
+func (h *DiscoverPingHandler) handleQueryResponse(f frame.Frame, hdr *PingHeader, msg *DiscoverPingMsg) error {
+	pingState := h.getActive(hdr.PingID)
+	if pingState == nil {
+		return errors.New("no state")
+	}
+	if f.SrcIP() != pingState.dst {
+		return errors.New("response source does not match queried router")
+	}
+
+	select {
+	case pingState.notify <- msg:
+	default:
+	}
+	return nil
+}
+
+// relay forwards a discover ping along the given route.
+// The route holds the relays from the origin to the destination of the
+// discovery. Responses travel the route in reverse.
+func (h *DiscoverPingHandler) relay(f frame.Frame, route []netip.Addr, response bool) error {
+	i := slices.Index(route, h.r.instance.Identity().IP)
+	if i < 0 {
+		return errors.New("not on relay route")
+	}
+
+	// Get neighbors on route.
+	var towardsOrigin, towardsDst netip.Addr
+	switch {
+	case response && i == 0:
+		towardsOrigin = f.DstIP()
+	case i == 0:
+		towardsOrigin = f.SrcIP()
+	default:
+		towardsOrigin = route[i-1]
+	}
+	switch {
+	case i < len(route)-1:
+		towardsDst = route[i+1]
+	case response:
+		towardsDst = f.SrcIP()
+	default:
+		towardsDst = f.DstIP()
+	}
+
+	// Check where the frame came from and forward it.
+	prev, next := towardsOrigin, towardsDst
+	if response {
+		prev, next = towardsDst, towardsOrigin
+	}
+	if f.RecvLink().Peer() != prev {
+		return errors.New("discover ping not received from previous relay")
+	}
+	if err := h.r.instance.Switch().ForwardByPeer(f, next); err != nil {
+		return fmt.Errorf("relay to %s: %w", next, err)
+	}
+	return nil
+}
+
+func (h *DiscoverPingHandler) setActive(pingID uint64, dst netip.Addr) *discoverPingState {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	pingState := &discoverPingState{
+		dst:     dst,
+		notify:  make(chan *DiscoverPingMsg, 1),
+		expires: time.Now().Add(discoverStateTTL),
+	}
+	h.active[pingID] = pingState
+	return pingState
+}
+
+func (h *DiscoverPingHandler) getActive(pingID uint64) *discoverPingState {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return h.active[pingID]
+}
+
+func (h *DiscoverPingHandler) pluckActive(pingID uint64) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	delete(h.active, pingID)
+}
+
+// markSeen marks the given ping ID as seen and returns how often it was seen.
+func (h *DiscoverPingHandler) markSeen(pingID uint64) int {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	seenState, ok := h.seen[pingID]
+	if !ok {
+		seenState = &discoverSeenState{
+			expires: time.Now().Add(discoverStateTTL),
+		}
+		h.seen[pingID] = seenState
+	}
+	seenState.count++
+	return seenState.count
+}
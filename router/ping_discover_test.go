@@ -0,0 +1,226 @@
+package router
+
+import (
+	"context"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+
+	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+func TestMakeDiscoveredPath(t *testing.T) {
+	t.Parallel()
+
+	var (
+		origin = netip.MustParseAddr("fd00::1")
+		relay1 = netip.MustParseAddr("fd00::2")
+		relay2 = netip.MustParseAddr("fd00::3")
+		dst    = netip.MustParseAddr("fd00::4")
+	)
+
+	// Links: origin (1) <10ms> (11) relay1 (12) <20ms> (21) relay2 (22) <30ms> (31) dst
+	// Hop attachments are made in the direction from the origin and are
+	// returned nearest to the destination first.
+	hops := []m.SwitchHop{
+		{Router: relay2, Delay: 20, ForwardLabel: 21, ReturnLabel: 22},
+		{Router: relay1, Delay: 10, ForwardLabel: 11, ReturnLabel: 12},
+	}
+	path := makeDiscoveredPath(
+		m.SwitchHop{Router: origin, Delay: 10, ForwardLabel: 1},
+		hops,
+		m.SwitchHop{Router: dst, Delay: 30, ReturnLabel: 31},
+	)
+
+	expected := []m.SwitchHop{
+		{Router: origin, Delay: 10, ForwardLabel: 1},
+		{Router: relay1, Delay: 20, ForwardLabel: 12, ReturnLabel: 11},
+		{Router: relay2, Delay: 30, ForwardLabel: 22, ReturnLabel: 21},
+		{Router: dst, ReturnLabel: 31},
+	}
+	if !reflect.DeepEqual(path.Hops, expected) {
+		t.Errorf("unexpected path:\n%+v\nexpected:\n%+v", path.Hops, expected)
+	}
+	if path.TotalHops != 3 {
+		t.Errorf("expected 3 total hops, got %d", path.TotalHops)
+	}
+	if path.TotalDelay != 10+20+30+m.MinHopDelay {
+		t.Errorf("unexpected total delay of %d", path.TotalDelay)
+	}
+
+	// Check if the path can be used for switching.
+	if err := path.BuildBlocks(); err != nil {
+		t.Errorf("failed to build switch blocks: %s", err)
+	}
+}
+
+func TestDiscoverAttempts(t *testing.T) {
+	t.Parallel()
+
+	h := NewDiscoverPingHandler(nil)
+	dst := netip.MustParseAddr("fd00::1")
+
+	// Only the first of many packets to a destination starts a discovery.
+	if !h.startAttempt(dst) {
+		t.Fatal("first attempt should start discovery")
+	}
+	for range 100 {
+		if h.startAttempt(dst) {
+			t.Fatal("repeated attempt should not start discovery")
+		}
+	}
+	if !h.startAttempt(netip.MustParseAddr("fd00::2")) {
+		t.Fatal("attempt to other destination should start discovery")
+	}
+
+	// Discovery is retried after the retry interval.
+	h.attempts[dst] = time.Now().Add(-discoverRetryInterval - time.Second)
+	if err := h.Clean(nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := h.attempts[dst]; ok {
+		t.Fatal("old attempt should be cleaned")
+	}
+	if !h.startAttempt(dst) {
+		t.Fatal("attempt after retry interval should start discovery")
+	}
+}
+
+func TestDiscoverSeen(t *testing.T) {
+	t.Parallel()
+
+	h := NewDiscoverPingHandler(nil)
+
+	// Count copies of a flooded discover ping.
+	var forwarded, responded int
+	for range 10 {
+		seen := h.markSeen(1)
+		if seen <= 1 {
+			forwarded++
+		}
+		if seen <= discoverMaxResponses {
+			responded++
+		}
+	}
+	if forwarded != 1 {
+		t.Errorf("expected to forward only the first copy, forwarded %d", forwarded)
+	}
+	if responded != discoverMaxResponses {
+		t.Errorf("expected %d responses, got %d", discoverMaxResponses, responded)
+	}
+	if h.markSeen(2) != 1 {
+		t.Error("other ping should be seen the first time")
+	}
+}
+
+func TestDiscoverMultiHopResponse(t *testing.T) {
+	t.Parallel()
+
+	// Links: origin (1) <10ms> (11) relay1 (12) <20ms> (21) relay2 (22) <30ms> (31) dst
+
+	// Create router, relays and destination.
+	// Any routing address is used, as they are quick to generate.
+	var ids [3]*m.Address
+	for i := range ids {
+		id, _, err := m.GenerateRoutableAddress(context.Background(), []netip.Prefix{m.RoutingAddressPrefix})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = id
+	}
+	origin, relay1, relay2 := ids[0], ids[1], ids[2]
+	dst := m.RoamingPrefix.Addr().Next()
+	r := newTestRouter(t, origin)
+	if err := r.instance.Peering().AddLink(&testLink{peer: relay1.IP, label: 1, latency: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Relays attach their hops to the request of the origin.
+	requestTime := time.UnixMilli(time.Now().UnixMilli())
+	requestAuth := make([]byte, 64)
+	signingContext := hopSigningContext(origin.IP, requestTime, requestAuth)
+	apx, err := (&Router{instance: &testInstance{identity: relay1}}).makeHopAttachment(
+		&testLink{peer: origin.IP, label: 11, latency: 10},
+		&testLink{peer: relay2.IP, label: 12},
+		nil, signingContext,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	apx, err = (&Router{instance: &testInstance{identity: relay2}}).makeHopAttachment(
+		&testLink{peer: relay1.IP, label: 21, latency: 20},
+		&testLink{peer: dst, label: 22},
+		apx, signingContext,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Destination responds.
+	msg := &DiscoverPingMsg{
+		Route:       []netip.Addr{relay1.IP, relay2.IP},
+		RequestTime: requestTime.UnixMilli(),
+		RequestAuth: requestAuth,
+		Hops:        apx,
+		Delay:       30,
+		ReturnLabel: 31,
+	}
+	data, err := cbor.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := r.instance.FrameBuilder().NewFrameV1(dst, origin.IP, frame.RouterHopPing, nil, data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.SetRecvLink(r.instance.Peering().GetLink(relay1.IP))
+
+	// Origin handles response.
+	pingState := r.DiscoverPing.setActive(1, dst)
+	err = r.mgr.Do("handle response", func(w *mgr.WorkerCtx) error {
+		return r.DiscoverPing.handlePathResponse(w, f, &PingHeader{PingID: 1, FollowUp: true}, msg)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-pingState.notify:
+	default:
+		t.Error("discovery should be notified")
+	}
+
+	// Check route.
+	rte, isDestination := r.table.LookupNearestRoute(dst)
+	if rte == nil || !isDestination {
+		t.Fatal("route to destination should be added")
+	}
+	if rte.Source != m.RouteSourceDiscovered || rte.NextHop != relay1.IP {
+		t.Errorf("unexpected route: %+v", rte)
+	}
+	expected := []m.SwitchHop{
+		{Router: origin.IP, Delay: 10, ForwardLabel: 1},
+		{Router: relay1.IP, Delay: 20, ForwardLabel: 12, ReturnLabel: 11},
+		{Router: relay2.IP, Delay: 30, ForwardLabel: 22, ReturnLabel: 21},
+		{Router: dst, ReturnLabel: 31},
+	}
+	if !reflect.DeepEqual(rte.Path.Hops, expected) {
+		t.Errorf("unexpected path:\n%+v\nexpected:\n%+v", rte.Path.Hops, expected)
+	}
+	checkSwitchBlock(t, "forward", rte.Path.ForwardBlock, []m.SwitchLabel{0, 11, 21, 31}, []m.SwitchLabel{1, 12, 22, 0})
+	checkSwitchBlock(t, "return", rte.Path.ReturnBlock, []m.SwitchLabel{0, 22, 12, 1}, []m.SwitchLabel{31, 21, 11, 0})
+
+	// Responses with tampered hops are rejected.
+	msg.Hops[len(msg.Hops)-1] ^= 0xFF
+	r.DiscoverPing.setActive(2, dst)
+	err = r.mgr.Do("handle response", func(w *mgr.WorkerCtx) error {
+		return r.DiscoverPing.handlePathResponse(w, f, &PingHeader{PingID: 2, FollowUp: true}, msg)
+	})
+	if err == nil {
+		t.Error("response with tampered hops should be rejected")
+	}
+}
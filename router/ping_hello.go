@@ -23,10 +23,17 @@ type HelloPingHandler struct {
 
 	sendLock sync.Mutex
 
-	active     map[netip.Addr]*helloPingState
+	active     map[helloPingKey]*helloPingState
 	activeLock sync.Mutex
 }
 
+// helloPingKey identifies a hello ping by the local and remote address, as
+// privacy addresses have their own sessions.
+type helloPingKey struct {
+	local  netip.Addr
+	remote netip.Addr
+}
+
 // helloPingState is hello ping state.
 type helloPingState struct {
 	pingID     uint64
@@ -43,7 +50,7 @@ var _ PingHandler = &HelloPingHandler{}
 func NewHelloPingHandler(r *Router) *HelloPingHandler {
 	return &HelloPingHandler{
 		r:      r,
-		active: make(map[netip.Addr]*helloPingState),
+		active: make(map[helloPingKey]*helloPingState),
 	}
 }
 
@@ -52,11 +59,11 @@ func (h *HelloPingHandler) Type() string {
 	return helloPingType
 }
 
-func (h *HelloPingHandler) getActive(remote netip.Addr) *helloPingState {
+func (h *HelloPingHandler) getActive(key helloPingKey) *helloPingState {
 	h.activeLock.Lock()
 	defer h.activeLock.Unlock()
 
-	state := h.active[remote]
+	state := h.active[key]
 	if state != nil && time.Now().Before(state.expires) {
 		return state
 	}
@@ -64,11 +71,11 @@ func (h *HelloPingHandler) getActive(remote netip.Addr) *helloPingState {
 	return nil
 }
 
-func (h *HelloPingHandler) setActive(remote netip.Addr, helloState *helloPingState) {
+func (h *HelloPingHandler) setActive(key helloPingKey, helloState *helloPingState) {
 	h.activeLock.Lock()
 	defer h.activeLock.Unlock()
 
-	h.active[remote] = helloState
+	h.active[key] = helloState
 }
 
 // Clean cleans any internal state of the ping handler.
@@ -77,9 +84,9 @@ func (h *HelloPingHandler) Clean(w *mgr.WorkerCtx) error {
 	defer h.activeLock.Unlock()
 
 	now := time.Now()
-	for remote, helloState := range h.active {
+	for key, helloState := range h.active {
 		if now.After(helloState.expires) {
-			delete(h.active, remote)
+			delete(h.active, key)
 		}
 	}
 
@@ -87,13 +94,26 @@ func (h *HelloPingHandler) Clean(w *mgr.WorkerCtx) error {
 }
 
 // HelloPingRequest is a hello ping request.
+// The hybrid key exchange is offered in addition to the default key exchange,
+// so that routers that do not support it can fall back.
 type HelloPingRequest struct {
-	KeyExchange     []byte `cbor:"kx,omitempty"  json:"kx,omitempty"`
-	KeyExchangeType string `cbor:"kxt,omitempty" json:"kxt,omitempty"`
+	KeyExchange           []byte `cbor:"kx,omitempty"   json:"kx,omitempty"`
+	KeyExchangeType       string `cbor:"kxt,omitempty"  json:"kxt,omitempty"`
+	HybridKeyExchange     []byte `cbor:"hkx,omitempty"  json:"hkx,omitempty"`
+	HybridKeyExchangeType string `cbor:"hkxt,omitempty" json:"hkxt,omitempty"`
 
 	MTU int `cbor:"mtu,omitempty" json:"mtu,omitempty"`
 }
 
+// selectKeyExchange returns the hybrid key exchange, if offered and
+// supported, and the default key exchange otherwise.
+func (request *HelloPingRequest) selectKeyExchange() (kxKey []byte, kxType string) {
+	if len(request.HybridKeyExchange) > 0 && state.KXTypeSupported(request.HybridKeyExchangeType) {
+		return request.HybridKeyExchange, request.HybridKeyExchangeType
+	}
+	return request.KeyExchange, request.KeyExchangeType
+}
+
 // HelloPingResponse is a hello ping response.
 type HelloPingResponse struct {
 	KeyExchange     []byte `cbor:"kx,omitempty"  json:"kx,omitempty"`
@@ -106,12 +126,25 @@ type HelloPingResponse struct {
 
 // Send sends a hello message to the given destination.
 func (h *HelloPingHandler) Send(dstIP netip.Addr) (notify <-chan struct{}, err error) {
+	return h.send(nil, dstIP)
+}
+
+// send sends a hello message to the given destination from the given privacy
+// address, or from the router address if nil.
+func (h *HelloPingHandler) send(privacy *privacyAddress, dstIP netip.Addr) (notify <-chan struct{}, err error) {
 	// Make sure we don't sent a hello ping twice.
 	h.sendLock.Lock()
 	defer h.sendLock.Unlock()
 
 	// Check if we already have an active hello ping.
-	if pingState := h.getActive(dstIP); pingState != nil {
+	key := helloPingKey{
+		local:  h.r.instance.Identity().IP,
+		remote: dstIP,
+	}
+	if privacy != nil {
+		key.local = privacy.id.IP
+	}
+	if pingState := h.getActive(key); pingState != nil {
 		return pingState.notify, ErrAlreadyActive
 	}
 	pingState := &helloPingState{
@@ -125,12 +158,18 @@ func (h *HelloPingHandler) Send(dstIP netip.Addr) (notify <-chan struct{}, err e
 	if err != nil {
 		return nil, fmt.Errorf("init key exchange: %w", err)
 	}
+	hkxKey, hkxType, err := pingState.encSession.InitKeyClientHybrid()
+	if err != nil {
+		return nil, fmt.Errorf("init hybrid key exchange: %w", err)
+	}
 
 	// Create request and send it.
 	request := HelloPingRequest{
-		KeyExchange:     kxKey,
-		KeyExchangeType: kxType,
-		MTU:             h.r.instance.Config().TunMTU(),
+		KeyExchange:           kxKey,
+		KeyExchangeType:       kxType,
+		HybridKeyExchange:     hkxKey,
+		HybridKeyExchangeType: hkxType,
+		MTU:                   h.r.instance.Config().TunMTU(),
 	}
 	data, err := cbor.Marshal(&request)
 	if err != nil {
@@ -144,6 +183,7 @@ func (h *HelloPingHandler) Send(dstIP netip.Addr) (notify <-chan struct{}, err e
 		pingID:   pingState.pingID,
 		pingType: helloPingType,
 		pingData: data,
+		privacy:  privacy,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("send ping: %w", err)
@@ -152,18 +192,19 @@ func (h *HelloPingHandler) Send(dstIP netip.Addr) (notify <-chan struct{}, err e
 	h.r.mgr.Debug(
 		"sent hello ping",
 		"router", dstIP,
+		"src", key.local,
 	)
 
 	// Ping is sent, add expiry and save to state.
 	pingState.expires = time.Now().Add(30 * time.Second)
-	h.setActive(dstIP, pingState)
+	h.setActive(key, pingState)
 	return pingState.notify, nil
 }
 
 // Handle handles incoming ping frames.
 func (h *HelloPingHandler) Handle(w *mgr.WorkerCtx, f frame.Frame, hdr *PingHeader, data []byte) error {
 	if hdr.FollowUp {
-		return h.handlePingHelloResponse(w, f, hdr, data)
+		return h.handlePingHelloResponse(w, f, hdr, data, h.r.instance.State())
 	}
 	return h.handlePingHelloRequest(w, f, hdr, data)
 }
@@ -180,7 +221,8 @@ func (h *HelloPingHandler) handlePingHelloRequest(w *mgr.WorkerCtx, f frame.Fram
 	if session == nil {
 		return fmt.Errorf("internal error: router %s unknown", f.SrcIP())
 	}
-	kxKey, kxType, err := session.Encryption().InitKeyServer(request.KeyExchange, request.KeyExchangeType)
+	kxKey, kxType := request.selectKeyExchange()
+	kxKey, kxType, err := session.Encryption().InitKeyServer(kxKey, kxType)
 	if err != nil {
 		return fmt.Errorf("server key exchange: %w", err)
 	}
@@ -217,7 +259,9 @@ func (h *HelloPingHandler) handlePingHelloRequest(w *mgr.WorkerCtx, f frame.Fram
 	return nil
 }
 
-func (h *HelloPingHandler) handlePingHelloResponse(w *mgr.WorkerCtx, f frame.Frame, hdr *PingHeader, data []byte) error {
+// handlePingHelloResponse handles a hello response with the sessions of the
+// given state.
+func (h *HelloPingHandler) handlePingHelloResponse(w *mgr.WorkerCtx, f frame.Frame, hdr *PingHeader, data []byte, st *state.State) error {
 	// Parse response.
 	response := HelloPingResponse{}
 	if err := cbor.Unmarshal(data, &response); err != nil {
@@ -225,7 +269,11 @@ func (h *HelloPingHandler) handlePingHelloResponse(w *mgr.WorkerCtx, f frame.Fra
 	}
 
 	// Get ping state.
-	pingState := h.getActive(f.SrcIP())
+	key := helloPingKey{
+		local:  f.DstIP(),
+		remote: f.SrcIP(),
+	}
+	pingState := h.getActive(key)
 	if pingState == nil {
 		return errors.New("no state")
 	}
@@ -247,7 +295,7 @@ func (h *HelloPingHandler) handlePingHelloResponse(w *mgr.WorkerCtx, f frame.Fra
 	pingState.encSession.InitCleanup()
 
 	// Save to session.
-	session := h.r.instance.State().GetSession(f.SrcIP())
+	session := st.GetSession(f.SrcIP())
 	if session == nil {
 		return fmt.Errorf("internal error: router %s unknown", f.SrcIP())
 	}
@@ -259,7 +307,7 @@ func (h *HelloPingHandler) handlePingHelloResponse(w *mgr.WorkerCtx, f frame.Fra
 	// Notify waiters, set cooldown (to block too quick requests) and save.
 	close(pingState.notify)
 	pingState.expires = time.Now().Add(5 * time.Second)
-	h.setActive(f.SrcIP(), pingState)
+	h.setActive(key, pingState)
 
 	w.Debug(
 		"hello ping successful (client)",
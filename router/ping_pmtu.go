@@ -0,0 +1,270 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+
+	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/mgr"
+	"github.com/mycoria/mycoria/state"
+)
+
+// Path MTU probing.
+// Frames travel over links with different MTUs and every link adds its own
+// overhead. Instead of tracking all of this, the path MTU to a destination is
+// probed with ping frames that are padded to the size of a network traffic
+// frame with a packet of the probed size. The biggest probe that is answered
+// is the path MTU. Probes do not carry a switch block, so the size of the
+// switch block must be subtracted for source routed traffic.
+
+const (
+	pmtuPingType = "pmtu"
+
+	// pmtuProbeInterval defines how often the path MTU is probed again.
+	pmtuProbeInterval = 10 * time.Minute
+	// pmtuProbeTimeout defines how long to wait for the response to a probe.
+	pmtuProbeTimeout = time.Second
+	// pmtuProbeAttempts defines how often a probe is sent before the size is
+	// considered too big.
+	pmtuProbeAttempts = 2
+	// pmtuProbeResolution defines when to stop searching for the path MTU.
+	pmtuProbeResolution = 64
+)
+
+// PMTUPingHandler handles path MTU probe pings.
+type PMTUPingHandler struct {
+	r *Router
+
+	active  map[uint64]*pmtuProbeState
+	probing map[netip.Addr]struct{}
+	lock    sync.Mutex
+}
+
+type pmtuProbeState struct {
+	size    int
+	notify  chan struct{}
+	expires time.Time
+}
+
+var _ PingHandler = &PMTUPingHandler{}
+
+// NewPMTUPingHandler returns a new path MTU ping handler.
+func NewPMTUPingHandler(r *Router) *PMTUPingHandler {
+	return &PMTUPingHandler{
+		r:       r,
+		active:  make(map[uint64]*pmtuProbeState),
+		probing: make(map[netip.Addr]struct{}),
+	}
+}
+
+// Type returns the ping type.
+func (h *PMTUPingHandler) Type() string {
+	return pmtuPingType
+}
+
+// Clean cleans any internal state of the ping handler.
+func (h *PMTUPingHandler) Clean(w *mgr.WorkerCtx) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	now := time.Now()
+	for pingID, probeState := range h.active {
+		if now.After(probeState.expires) {
+			delete(h.active, pingID)
+		}
+	}
+
+	return nil
+}
+
+// pmtuPingMsg is a path MTU probe message.
+// Probes are padded to the probed size.
+type pmtuPingMsg struct {
+	Size int `cbor:"s,omitempty" json:"s,omitempty"`
+}
+
+// Probe starts probing the path MTU to the given destination in the
+// background, unless it is already being probed.
+func (h *PMTUPingHandler) Probe(dst netip.Addr) {
+	h.lock.Lock()
+	if _, ok := h.probing[dst]; ok {
+		h.lock.Unlock()
+		return
+	}
+	h.probing[dst] = struct{}{}
+	h.lock.Unlock()
+
+	h.r.mgr.Go("probe path mtu", func(w *mgr.WorkerCtx) error {
+		defer func() {
+			h.lock.Lock()
+			defer h.lock.Unlock()
+			delete(h.probing, dst)
+		}()
+
+		h.probe(w, dst)
+		return nil
+	})
+}
+
+func (h *PMTUPingHandler) probe(w *mgr.WorkerCtx, dst netip.Addr) {
+	session := h.r.instance.State().GetSession(dst)
+	if session == nil {
+		return
+	}
+
+	// Packets cannot be bigger than the tun MTU on either side.
+	upper := h.r.instance.Config().TunMTU()
+	if remoteMTU := session.TunMTU(); remoteMTU > 0 {
+		upper = min(upper, remoteMTU)
+	}
+	lower := state.MinMTU
+
+	// Check the bounds first, as most paths support the full size and the
+	// destination might not support probing at all.
+	switch {
+	case upper <= lower:
+		session.SetPathMTU(upper)
+		return
+	case h.probeSize(w, dst, upper):
+		session.SetPathMTU(upper)
+		return
+	case !h.probeSize(w, dst, lower):
+		// Destination does not answer probes, keep path MTU unknown.
+		session.SetPathMTU(0)
+		return
+	}
+
+	// Search for the biggest size that passes.
+	for upper-lower > pmtuProbeResolution {
+		size := (lower + upper) / 2
+		if h.probeSize(w, dst, size) {
+			lower = size
+		} else {
+			upper = size
+		}
+	}
+	session.SetPathMTU(lower)
+
+	w.Debug(
+		"probed path mtu",
+		"router", dst,
+		"mtu", lower,
+	)
+}
+
+// probeSize returns whether a probe of the given size reaches the destination.
+func (h *PMTUPingHandler) probeSize(w *mgr.WorkerCtx, dst netip.Addr, size int) bool {
+	for range pmtuProbeAttempts {
+		notify, err := h.send(dst, size)
+		if err != nil {
+			return false
+		}
+
+		select {
+		case <-notify:
+			return true
+		case <-time.After(pmtuProbeTimeout):
+		case <-w.Done():
+			return false
+		}
+	}
+	return false
+}
+
+func (h *PMTUPingHandler) send(dst netip.Addr, size int) (notify <-chan struct{}, err error) {
+	data, err := cbor.Marshal(&pmtuPingMsg{
+		Size: size,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal: %w", err)
+	}
+
+	// Register probe before sending it.
+	pingID := newPingID()
+	probeState := &pmtuProbeState{
+		size:    size,
+		notify:  make(chan struct{}),
+		expires: time.Now().Add(pmtuProbeTimeout * 2),
+	}
+	h.lock.Lock()
+	h.active[pingID] = probeState
+	h.lock.Unlock()
+
+	// Send probe padded to the probed size.
+	err = h.r.sendPingMsg(sendPingOpts{
+		dst:      dst,
+		msgType:  frame.RouterPing,
+		pingID:   pingID,
+		pingType: pmtuPingType,
+		pingData: data,
+		padTo:    size,
+	})
+	if err != nil {
+		h.lock.Lock()
+		delete(h.active, pingID)
+		h.lock.Unlock()
+		return nil, fmt.Errorf("send ping: %w", err)
+	}
+
+	return probeState.notify, nil
+}
+
+// Handle handles incoming ping frames.
+func (h *PMTUPingHandler) Handle(w *mgr.WorkerCtx, f frame.Frame, hdr *PingHeader, data []byte) error {
+	msg := pmtuPingMsg{}
+	if _, err := cbor.UnmarshalFirst(data, &msg); err != nil {
+		return fmt.Errorf("unmarshal msg: %w", err)
+	}
+
+	if hdr.FollowUp {
+		return h.handleResponse(hdr, &msg)
+	}
+	return h.handleRequest(f, hdr, &msg)
+}
+
+func (h *PMTUPingHandler) handleRequest(f frame.Frame, hdr *PingHeader, msg *pmtuPingMsg) error {
+	// Check if the probe arrived in full.
+	if len(f.MessageData()) != msg.Size {
+		return fmt.Errorf("probe size mismatch: got %d bytes, expected %d", len(f.MessageData()), msg.Size)
+	}
+
+	// Confirm received size.
+	data, err := cbor.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+	err = h.r.sendPingMsg(sendPingOpts{
+		dst:      f.SrcIP(),
+		msgType:  frame.RouterPing,
+		pingID:   hdr.PingID,
+		pingType: pmtuPingType,
+		pingData: data,
+		followUp: true,
+	})
+	if err != nil {
+		return fmt.Errorf("send pmtu response: %w", err)
+	}
+	return nil
+}
+
+func (h *PMTUPingHandler) handleResponse(hdr *PingHeader, msg *pmtuPingMsg) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	probeState, ok := h.active[hdr.PingID]
+	if !ok {
+		return errors.New("no state")
+	}
+	if msg.Size != probeState.size {
+		return fmt.Errorf("probe size mismatch: confirmed %d bytes, sent %d", msg.Size, probeState.size)
+	}
+
+	delete(h.active, hdr.PingID)
+	close(probeState.notify)
+	return nil
+}
@@ -0,0 +1,346 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+
+	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/mgr"
+	"github.com/mycoria/mycoria/state"
+)
+
+const (
+	rekeyPingType = "rekey"
+
+	rekeyPingCodeRequest uint8 = 0
+	rekeyPingCodeConfirm uint8 = 1
+
+	// rekeyConfirmRetryInterval defines how often the confirmation is sent
+	// again until it is acknowledged.
+	rekeyConfirmRetryInterval = 2 * time.Second
+)
+
+// RekeyPingHandler handles re-keying of sessions with a fresh key exchange
+// within the existing session.
+type RekeyPingHandler struct {
+	r *Router
+
+	active     map[netip.Addr]*rekeyPingState
+	activeLock sync.Mutex
+}
+
+// rekeyPingState is re-key ping state.
+type rekeyPingState struct {
+	pingID  uint64
+	expires time.Time
+
+	// acked is set while the confirmation is sent and is closed when it is
+	// acknowledged.
+	acked chan struct{}
+}
+
+var _ PingHandler = &RekeyPingHandler{}
+
+// NewRekeyPingHandler returns a new re-key ping handler.
+func NewRekeyPingHandler(r *Router) *RekeyPingHandler {
+	return &RekeyPingHandler{
+		r:      r,
+		active: make(map[netip.Addr]*rekeyPingState),
+	}
+}
+
+// Type returns the ping type.
+func (h *RekeyPingHandler) Type() string {
+	return rekeyPingType
+}
+
+// Clean cleans any internal state of the ping handler.
+func (h *RekeyPingHandler) Clean(w *mgr.WorkerCtx) error {
+	h.activeLock.Lock()
+	defer h.activeLock.Unlock()
+
+	now := time.Now()
+	for remote, rekeyState := range h.active {
+		if now.After(rekeyState.expires) {
+			delete(h.active, remote)
+		}
+	}
+
+	return nil
+}
+
+// RekeyPingMsg is a re-key ping message.
+type RekeyPingMsg struct {
+	KeyExchange     []byte `cbor:"kx,omitempty"  json:"kx,omitempty"`
+	KeyExchangeType string `cbor:"kxt,omitempty" json:"kxt,omitempty"`
+}
+
+// Start starts re-keying the session with the given router, if required.
+func (h *RekeyPingHandler) Start(dstIP netip.Addr) error {
+	session := h.r.instance.State().GetSession(dstIP)
+	if session == nil {
+		return fmt.Errorf("internal error: router %s unknown", dstIP)
+	}
+
+	// Check and start re-keying while locked, so that only one is started.
+	h.activeLock.Lock()
+	defer h.activeLock.Unlock()
+
+	if !session.Encryption().RekeyRequired() {
+		return nil
+	}
+	kxKey, kxType, err := session.Encryption().RekeyStart()
+	if err != nil {
+		return fmt.Errorf("start key exchange: %w", err)
+	}
+
+	// Create request and send it.
+	data, err := cbor.Marshal(&RekeyPingMsg{
+		KeyExchange:     kxKey,
+		KeyExchangeType: kxType,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+	pingID := newPingID()
+	err = h.r.sendPingMsg(sendPingOpts{
+		dst:      dstIP,
+		msgType:  frame.SessionCtrl,
+		pingID:   pingID,
+		pingType: rekeyPingType,
+		pingCode: rekeyPingCodeRequest,
+		pingData: data,
+	})
+	if err != nil {
+		return fmt.Errorf("send ping: %w", err)
+	}
+
+	h.active[dstIP] = &rekeyPingState{
+		pingID:  pingID,
+		expires: time.Now().Add(state.RekeyTimeout),
+	}
+	return nil
+}
+
+// Handle handles incoming ping frames.
+func (h *RekeyPingHandler) Handle(w *mgr.WorkerCtx, f frame.Frame, hdr *PingHeader, data []byte) error {
+	// Re-keying is only done within an existing encrypted session.
+	if f.MessageType() != frame.SessionCtrl {
+		return errors.New("re-key ping must be sent as session control")
+	}
+	session := h.r.instance.State().GetSession(f.SrcIP())
+	if session == nil {
+		return fmt.Errorf("internal error: router %s unknown", f.SrcIP())
+	}
+
+	switch {
+	case hdr.FollowUp && hdr.PingCode == rekeyPingCodeConfirm:
+		return h.handleConfirmAck(w, f, hdr)
+	case hdr.FollowUp:
+		return h.handleResponse(w, f, hdr, session, data)
+	case hdr.PingCode == rekeyPingCodeConfirm:
+		return h.handleConfirm(w, f, hdr)
+	default:
+		return h.handleRequest(w, f, hdr, session, data)
+	}
+}
+
+func (h *RekeyPingHandler) handleRequest(w *mgr.WorkerCtx, f frame.Frame, hdr *PingHeader, session *state.Session, data []byte) error {
+	// Parse request.
+	request := RekeyPingMsg{}
+	if err := cbor.Unmarshal(data, &request); err != nil {
+		return fmt.Errorf("unmarshal request: %w", err)
+	}
+
+	// If both sides started re-keying at the same time, the router with the
+	// lower address continues as the initiator.
+	if session.Encryption().RekeyActive() &&
+		h.r.instance.Identity().IP.Less(f.SrcIP()) {
+		return nil
+	}
+
+	// Do key exchange.
+	kxKey, kxType, err := session.Encryption().RekeyServer(request.KeyExchange, request.KeyExchangeType)
+	if err != nil {
+		return fmt.Errorf("server key exchange: %w", err)
+	}
+
+	// Create response and send it.
+	// The response is still encrypted with the current keys.
+	data, err = cbor.Marshal(&RekeyPingMsg{
+		KeyExchange:     kxKey,
+		KeyExchangeType: kxType,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+	err = h.r.sendPingMsg(sendPingOpts{
+		dst:      f.SrcIP(),
+		msgType:  frame.SessionCtrl,
+		pingID:   hdr.PingID,
+		pingType: rekeyPingType,
+		pingData: data,
+		followUp: true,
+	})
+	if err != nil {
+		return fmt.Errorf("send re-key response: %w", err)
+	}
+
+	w.Debug(
+		"re-keying session (server)",
+		"router", f.SrcIP(),
+	)
+	return nil
+}
+
+func (h *RekeyPingHandler) handleResponse(w *mgr.WorkerCtx, f frame.Frame, hdr *PingHeader, session *state.Session, data []byte) error {
+	// Parse response.
+	response := RekeyPingMsg{}
+	if err := cbor.Unmarshal(data, &response); err != nil {
+		return fmt.Errorf("unmarshal response: %w", err)
+	}
+
+	// Check and remove state.
+	h.activeLock.Lock()
+	defer h.activeLock.Unlock()
+
+	rekeyState, ok := h.active[f.SrcIP()]
+	switch {
+	case !ok:
+		return errors.New("no state")
+	case rekeyState.pingID != hdr.PingID:
+		return errors.New("ping ID mismatch")
+	case rekeyState.acked != nil:
+		return errors.New("already re-keyed")
+	}
+
+	// Finalize key exchange and switch to new keys.
+	err := session.Encryption().RekeyClientComplete(response.KeyExchange, response.KeyExchangeType)
+	if err != nil {
+		delete(h.active, f.SrcIP())
+		return fmt.Errorf("complete client key exchange: %w", err)
+	}
+
+	// Confirm with the new keys, so that the other side switches too.
+	// The confirmation is sent again until it is acknowledged.
+	if err := h.sendConfirm(f.SrcIP(), hdr.PingID); err != nil {
+		w.Debug(
+			"failed to send re-key confirmation",
+			"router", f.SrcIP(),
+			"err", err,
+		)
+	}
+	dst, pingID, acked := f.SrcIP(), hdr.PingID, make(chan struct{})
+	rekeyState.expires = time.Now().Add(state.RekeyTimeout)
+	rekeyState.acked = acked
+	h.r.mgr.Go("confirm re-key", func(w *mgr.WorkerCtx) error {
+		h.retryConfirm(w, dst, pingID, acked)
+		return nil
+	})
+
+	w.Debug(
+		"re-keyed session (client)",
+		"router", f.SrcIP(),
+	)
+	return nil
+}
+
+// retryConfirm sends the confirmation again until it is acknowledged or the
+// re-keying times out.
+func (h *RekeyPingHandler) retryConfirm(w *mgr.WorkerCtx, dst netip.Addr, pingID uint64, acked chan struct{}) {
+	ticker := time.NewTicker(rekeyConfirmRetryInterval)
+	defer ticker.Stop()
+	timeout := time.NewTimer(state.RekeyTimeout)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case <-acked:
+			return
+		case <-w.Done():
+			return
+		case <-timeout.C:
+			w.Debug(
+				"re-key confirmation was not acknowledged",
+				"router", dst,
+			)
+			return
+		case <-ticker.C:
+		}
+
+		if err := h.sendConfirm(dst, pingID); err != nil {
+			w.Debug(
+				"failed to send re-key confirmation",
+				"router", dst,
+				"err", err,
+			)
+		}
+	}
+}
+
+func (h *RekeyPingHandler) sendConfirm(dst netip.Addr, pingID uint64) error {
+	data, err := cbor.Marshal(&RekeyPingMsg{})
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+	err = h.r.sendPingMsg(sendPingOpts{
+		dst:      dst,
+		msgType:  frame.SessionCtrl,
+		pingID:   pingID,
+		pingType: rekeyPingType,
+		pingCode: rekeyPingCodeConfirm,
+		pingData: data,
+	})
+	if err != nil {
+		return fmt.Errorf("send re-key confirmation: %w", err)
+	}
+	return nil
+}
+
+func (h *RekeyPingHandler) handleConfirm(_ *mgr.WorkerCtx, f frame.Frame, hdr *PingHeader) error {
+	// The confirmation was encrypted with the new keys, which already
+	// switched the session to them. Acknowledge it with the new keys, so
+	// that the other side stops sending it.
+	data, err := cbor.Marshal(&RekeyPingMsg{})
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+	err = h.r.sendPingMsg(sendPingOpts{
+		dst:      f.SrcIP(),
+		msgType:  frame.SessionCtrl,
+		pingID:   hdr.PingID,
+		pingType: rekeyPingType,
+		pingCode: rekeyPingCodeConfirm,
+		pingData: data,
+		followUp: true,
+	})
+	if err != nil {
+		return fmt.Errorf("send re-key acknowledgement: %w", err)
+	}
+	return nil
+}
+
+func (h *RekeyPingHandler) handleConfirmAck(_ *mgr.WorkerCtx, f frame.Frame, hdr *PingHeader) error {
+	h.activeLock.Lock()
+	defer h.activeLock.Unlock()
+
+	rekeyState, ok := h.active[f.SrcIP()]
+	switch {
+	case !ok:
+		// Confirmation was acknowledged more than once.
+		return nil
+	case rekeyState.pingID != hdr.PingID:
+		return errors.New("ping ID mismatch")
+	case rekeyState.acked == nil:
+		return errors.New("re-keying not confirmed yet")
+	}
+	close(rekeyState.acked)
+	delete(h.active, f.SrcIP())
+
+	return nil
+}
@@ -0,0 +1,316 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+
+	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+// Tracing.
+// A trace sends hop pings with an increasing TTL towards the destination.
+// Every router handles hop pings and forwards the probe by IP routing, until
+// the TTL would expire. The router where the TTL expires answers with the
+// switch label and latency of the link the probe was received on. The
+// destination always answers.
+
+const (
+	tracePingType = "trace"
+
+	// TraceMaxHops defines the maximum amount of hops of a trace.
+	TraceMaxHops = 32
+	// traceMaxLost defines after how many unanswered hops in a row a trace is
+	// aborted.
+	traceMaxLost = 3
+	// traceProbeTimeout defines how long to wait for the response to a probe.
+	traceProbeTimeout = 2 * time.Second
+
+	// TraceTimeout is the maximum duration of a trace.
+	TraceTimeout = TraceMaxHops * traceProbeTimeout
+)
+
+// ErrTraceActive is returned when a trace to the destination is already active.
+var ErrTraceActive = errors.New("trace already active")
+
+// TracePingHandler handles trace pings.
+type TracePingHandler struct {
+	r *Router
+
+	active  map[uint64]*tracePingState
+	tracing map[netip.Addr]struct{}
+	lock    sync.Mutex
+}
+
+// tracePingState is trace ping state.
+type tracePingState struct {
+	hop     uint8
+	started time.Time
+
+	response chan *TraceHop
+	expires  time.Time
+}
+
+// TraceHop is a hop of a trace.
+type TraceHop struct {
+	// Hop is the number of the hop, starting at 1.
+	Hop int `json:"hop"`
+	// Router is the router that answered the probe.
+	// Is invalid if the probe was not answered.
+	Router netip.Addr `json:"router,omitempty"`
+	// Label is the switch label of the link the probe was received on.
+	Label m.SwitchLabel `json:"label,omitempty"`
+	// Latency is the latency of the link the probe was received on in
+	// milliseconds.
+	Latency uint16 `json:"latency,omitempty"`
+	// RTT is the round trip time of the probe.
+	RTT time.Duration `json:"rtt,omitempty"`
+	// Reached reports whether the router is the destination.
+	Reached bool `json:"reached,omitempty"`
+}
+
+// Answered returns whether the probe of the hop was answered.
+func (th *TraceHop) Answered() bool {
+	return th.Router.IsValid()
+}
+
+var _ PingHandler = &TracePingHandler{}
+
+// NewTracePingHandler returns a new trace ping handler.
+func NewTracePingHandler(r *Router) *TracePingHandler {
+	return &TracePingHandler{
+		r:       r,
+		active:  make(map[uint64]*tracePingState),
+		tracing: make(map[netip.Addr]struct{}),
+	}
+}
+
+// Type returns the ping type.
+func (h *TracePingHandler) Type() string {
+	return tracePingType
+}
+
+// Clean cleans any internal state of the ping handler.
+func (h *TracePingHandler) Clean(w *mgr.WorkerCtx) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	now := time.Now()
+	for pingID, traceState := range h.active {
+		if now.After(traceState.expires) {
+			delete(h.active, pingID)
+		}
+	}
+
+	return nil
+}
+
+// tracePingMsg is a trace ping message.
+type tracePingMsg struct {
+	Hop     uint8         `cbor:"h,omitempty"  json:"h,omitempty"`
+	Label   m.SwitchLabel `cbor:"l,omitempty"  json:"l,omitempty"`
+	Latency uint16        `cbor:"ms,omitempty" json:"ms,omitempty"`
+	Reached bool          `cbor:"r,omitempty"  json:"r,omitempty"`
+}
+
+// Trace traces the path to the given destination.
+// It returns the hops of the trace until the destination is reached, the
+// trace is aborted or the context is canceled.
+func (h *TracePingHandler) Trace(ctx context.Context, dst netip.Addr) ([]*TraceHop, error) {
+	if !m.RoutingAddressPrefix.Contains(dst) {
+		return nil, fmt.Errorf("%s is not a router address", dst)
+	}
+
+	// Only allow one trace per destination at a time.
+	h.lock.Lock()
+	if _, ok := h.tracing[dst]; ok {
+		h.lock.Unlock()
+		return nil, ErrTraceActive
+	}
+	h.tracing[dst] = struct{}{}
+	h.lock.Unlock()
+	defer func() {
+		h.lock.Lock()
+		defer h.lock.Unlock()
+		delete(h.tracing, dst)
+	}()
+
+	return traceHops(ctx, func(ctx context.Context, hop uint8) (*TraceHop, error) {
+		return h.probe(ctx, dst, hop)
+	})
+}
+
+// traceHops probes hops with the given function until the destination is
+// reached, too many hops in a row are not answered or the maximum amount of
+// hops is reached.
+func traceHops(ctx context.Context, probe func(ctx context.Context, hop uint8) (*TraceHop, error)) ([]*TraceHop, error) {
+	hops := make([]*TraceHop, 0, 8)
+	var lost int
+	for hop := uint8(1); hop <= TraceMaxHops; hop++ {
+		th, err := probe(ctx, hop)
+		if err != nil {
+			return hops, err
+		}
+		hops = append(hops, th)
+
+		// Check if trace is done.
+		switch {
+		case th.Reached:
+			return hops, nil
+		case th.Answered():
+			lost = 0
+		default:
+			lost++
+			if lost >= traceMaxLost {
+				return hops, nil
+			}
+		}
+	}
+
+	return hops, nil
+}
+
+func (h *TracePingHandler) probe(ctx context.Context, dst netip.Addr, hop uint8) (*TraceHop, error) {
+	data, err := cbor.Marshal(&tracePingMsg{
+		Hop: hop,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal: %w", err)
+	}
+
+	// Register probe before sending it.
+	pingID := newPingID()
+	traceState := &tracePingState{
+		hop:      hop,
+		started:  time.Now(),
+		response: make(chan *TraceHop, 1),
+		expires:  time.Now().Add(traceProbeTimeout * 2),
+	}
+	h.lock.Lock()
+	h.active[pingID] = traceState
+	h.lock.Unlock()
+
+	// Send probe, which expires at the probed hop.
+	// The TTL is reduced before sending to the first hop.
+	err = h.r.sendPingMsg(sendPingOpts{
+		dst:      dst,
+		msgType:  frame.RouterHopPing,
+		pingID:   pingID,
+		pingType: tracePingType,
+		pingData: data,
+		ttl:      hop + 1,
+	})
+	if err != nil {
+		h.lock.Lock()
+		delete(h.active, pingID)
+		h.lock.Unlock()
+		return nil, fmt.Errorf("send probe: %w", err)
+	}
+
+	// Wait for response.
+	select {
+	case th := <-traceState.response:
+		return th, nil
+	case <-time.After(traceProbeTimeout):
+		return &TraceHop{Hop: int(hop)}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Handle handles incoming ping frames.
+func (h *TracePingHandler) Handle(w *mgr.WorkerCtx, f frame.Frame, hdr *PingHeader, data []byte) error {
+	msg := tracePingMsg{}
+	if err := cbor.Unmarshal(data, &msg); err != nil {
+		return fmt.Errorf("unmarshal msg: %w", err)
+	}
+
+	toMe := f.DstIP() == h.r.instance.Identity().IP
+	reached := toMe ||
+		(m.GetAddressType(f.DstIP()) == m.TypeAnycast && h.r.servesAnycast(f.DstIP()))
+	switch {
+	case hdr.FollowUp && toMe:
+		return h.handleResponse(f, hdr, &msg)
+	case hdr.FollowUp:
+		return errors.New("trace response is not for us")
+	case reached || f.TTL() <= 1:
+		return h.handleRequest(f, hdr, &msg, reached)
+	default:
+		// Forward probe towards destination.
+		if err := h.r.RouteFrame(f); err != nil {
+			return fmt.Errorf("forward probe: %w", err)
+		}
+		return nil
+	}
+}
+
+func (h *TracePingHandler) handleRequest(f frame.Frame, hdr *PingHeader, msg *tracePingMsg, reached bool) error {
+	response := newTraceResponse(f, msg, reached)
+	data, err := cbor.Marshal(response)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+
+	// Send response back via the link the probe was received on, as we might
+	// not have a route to the source.
+	opts := sendPingOpts{
+		dst:      f.SrcIP(),
+		msgType:  frame.RouterPing,
+		pingID:   hdr.PingID,
+		pingType: tracePingType,
+		pingData: data,
+		followUp: true,
+	}
+	if recvLink := f.RecvLink(); recvLink != nil {
+		opts.nextHops = []netip.Addr{recvLink.Peer()}
+	}
+	if err := h.r.sendPingMsg(opts); err != nil {
+		return fmt.Errorf("send trace response: %w", err)
+	}
+	return nil
+}
+
+// newTraceResponse returns the response to the given probe with info about
+// the link the probe was received on.
+func newTraceResponse(f frame.Frame, msg *tracePingMsg, reached bool) *tracePingMsg {
+	response := &tracePingMsg{
+		Hop:     msg.Hop,
+		Reached: reached,
+	}
+	if recvLink := f.RecvLink(); recvLink != nil {
+		response.Label = recvLink.SwitchLabel()
+		response.Latency = recvLink.Latency()
+	}
+	return response
+}
+
+func (h *TracePingHandler) handleResponse(f frame.Frame, hdr *PingHeader, msg *tracePingMsg) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	traceState, ok := h.active[hdr.PingID]
+	if !ok {
+		return errors.New("no state")
+	}
+	if msg.Hop != traceState.hop {
+		return fmt.Errorf("trace hop mismatch: got %d, sent %d", msg.Hop, traceState.hop)
+	}
+	delete(h.active, hdr.PingID)
+
+	traceState.response <- &TraceHop{
+		Hop:     int(msg.Hop),
+		Router:  f.SrcIP(),
+		Label:   msg.Label,
+		Latency: msg.Latency,
+		RTT:     time.Since(traceState.started),
+		Reached: msg.Reached,
+	}
+	return nil
+}
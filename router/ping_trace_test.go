@@ -0,0 +1,136 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+
+	"github.com/mycoria/mycoria/frame"
+)
+
+func TestTraceHops(t *testing.T) {
+	t.Parallel()
+
+	answered := netip.MustParseAddr("fd00::1")
+
+	// Trace stops at the maximum amount of hops.
+	hops, err := traceHops(context.Background(), func(_ context.Context, hop uint8) (*TraceHop, error) {
+		return &TraceHop{Hop: int(hop), Router: answered}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hops) != TraceMaxHops {
+		t.Errorf("expected trace to stop after %d hops, got %d", TraceMaxHops, len(hops))
+	}
+
+	// Trace stops when the destination is reached.
+	hops, err = traceHops(context.Background(), func(_ context.Context, hop uint8) (*TraceHop, error) {
+		return &TraceHop{Hop: int(hop), Router: answered, Reached: hop == 3}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hops) != 3 || !hops[2].Reached {
+		t.Errorf("expected trace to stop at reached destination, got %d hops", len(hops))
+	}
+
+	// Trace stops after too many unanswered hops in a row.
+	hops, err = traceHops(context.Background(), func(_ context.Context, hop uint8) (*TraceHop, error) {
+		if hop == 2 || hop >= 4 {
+			return &TraceHop{Hop: int(hop)}, nil
+		}
+		return &TraceHop{Hop: int(hop), Router: answered}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hops) != 3+traceMaxLost {
+		t.Errorf("expected trace to stop after %d lost hops, got %d hops", traceMaxLost, len(hops))
+	}
+
+	// Errors abort the trace and return the hops so far.
+	hops, err = traceHops(context.Background(), func(_ context.Context, hop uint8) (*TraceHop, error) {
+		if hop == 2 {
+			return nil, context.Canceled
+		}
+		return &TraceHop{Hop: int(hop), Router: answered}, nil
+	})
+	if !errors.Is(err, context.Canceled) || len(hops) != 1 {
+		t.Errorf("expected canceled trace with 1 hop, got %d hops: %v", len(hops), err)
+	}
+}
+
+func TestTraceRequestResponse(t *testing.T) {
+	t.Parallel()
+
+	var (
+		origin = netip.MustParseAddr("fd00::1")
+		relay  = netip.MustParseAddr("fd00::2")
+		dst    = netip.MustParseAddr("fd00::3")
+	)
+	h := NewTracePingHandler(nil)
+	b := frame.NewFrameBuilder()
+
+	// Register probe.
+	traceState := &tracePingState{
+		hop:      2,
+		response: make(chan *TraceHop, 1),
+	}
+	h.active[1] = traceState
+
+	// Relay answers probe with info about the link it was received on.
+	request, err := b.NewFrameV1(origin, dst, frame.RouterHopPing, nil, []byte("probe"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.SetRecvLink(&testLink{peer: origin, label: 7, latency: 12})
+	response := newTraceResponse(request, &tracePingMsg{Hop: 2}, false)
+	if response.Hop != 2 || response.Label != 7 || response.Latency != 12 || response.Reached {
+		t.Fatalf("unexpected trace response: %+v", response)
+	}
+
+	// Transfer response.
+	data, err := cbor.Marshal(response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := &tracePingMsg{}
+	if err := cbor.Unmarshal(data, msg); err != nil {
+		t.Fatal(err)
+	}
+	responseFrame, err := b.NewFrameV1(relay, origin, frame.RouterPing, nil, data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Responses for other hops and unknown probes are rejected.
+	if err := h.handleResponse(responseFrame, &PingHeader{PingID: 1}, &tracePingMsg{Hop: 3}); err == nil {
+		t.Error("response for other hop should be rejected")
+	}
+	if err := h.handleResponse(responseFrame, &PingHeader{PingID: 2}, msg); err == nil {
+		t.Error("response for unknown probe should be rejected")
+	}
+
+	// Origin receives response.
+	if err := h.handleResponse(responseFrame, &PingHeader{PingID: 1}, msg); err != nil {
+		t.Fatal(err)
+	}
+	th := <-traceState.response
+	if th.Hop != 2 || th.Router != relay || th.Label != 7 || th.Latency != 12 || th.Reached {
+		t.Errorf("unexpected trace hop: %+v", th)
+	}
+	if _, ok := h.active[1]; ok {
+		t.Error("probe should be removed after response")
+	}
+
+	// Destination reports that it was reached.
+	request.SetRecvLink(nil)
+	response = newTraceResponse(request, &tracePingMsg{Hop: 3}, true)
+	if !response.Reached || response.Label != 0 {
+		t.Errorf("unexpected trace response of destination: %+v", response)
+	}
+}
@@ -0,0 +1,288 @@
+package router
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+	"github.com/mycoria/mycoria/state"
+)
+
+// Privacy addresses.
+// Privacy addresses are not routable and are used as the source of outbound
+// connections, so that destinations cannot correlate them with the router
+// address. Every privacy address has its own identity and sessions.
+// The current privacy address is added to the tun device and set as the
+// preferred source of new connections, while connections to friends keep using
+// the router address. After the rotation interval, a new privacy address takes
+// over new connections. Previous privacy addresses are kept for a while, so
+// that their connections can finish.
+// As privacy addresses cannot be routed to, traffic from them is source routed
+// and destinations reply along the return path learned from it. Sessions of
+// privacy addresses are not re-keyed and their path MTU is not probed.
+
+const (
+	// defaultPrivacyRotate defines after how long a new privacy address is
+	// used for new connections.
+	defaultPrivacyRotate = time.Hour
+	// defaultPrivacyKeep defines how long a previous privacy address is kept.
+	defaultPrivacyKeep = 24 * time.Hour
+)
+
+// privacyAddress is a privacy address with its own sessions.
+type privacyAddress struct {
+	id      *m.Address
+	state   *state.State
+	created time.Time
+}
+
+// getPrivacyAddress returns the privacy address of the router with the given
+// IP, if it exists.
+func (r *Router) getPrivacyAddress(ip netip.Addr) *privacyAddress {
+	if m.GetAddressType(ip) != m.TypePrivacy {
+		return nil
+	}
+
+	r.privacyLock.RLock()
+	defer r.privacyLock.RUnlock()
+
+	return r.privacy[ip]
+}
+
+func (r *Router) privacyWorker(w *mgr.WorkerCtx) error {
+	cfg := r.instance.Config().Router.PrivacyAddresses
+	rotate := defaultPrivacyRotate
+	if cfg.Rotate > 0 {
+		rotate = time.Duration(cfg.Rotate) * time.Minute
+	}
+	keep := defaultPrivacyKeep
+	if cfg.Keep > 0 {
+		keep = time.Duration(cfg.Keep) * time.Minute
+	}
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	var (
+		current      *privacyAddress
+		friendRoutes []netip.Prefix
+	)
+	defer func() {
+		// Use the router address for new connections again.
+		if current != nil {
+			r.removePreferredSourceRoutes(w, append(friendRoutes, m.BaseNetPrefix))
+		}
+	}()
+	for {
+		// Rotate privacy address, if due.
+		if current == nil || time.Since(current.created) > rotate {
+			next, err := r.addPrivacyAddress(w)
+			if err != nil {
+				w.Warn(
+					"failed to add privacy address",
+					"err", err,
+				)
+			} else {
+				current = next
+				friendRoutes = r.setFriendSourceRoutes(w, friendRoutes)
+				w.Info(
+					"rotated privacy address",
+					"address", current.id.IP,
+				)
+			}
+		}
+
+		// Remove privacy addresses that were replaced long enough ago.
+		r.cleanPrivacyAddresses(w, current, rotate+keep)
+
+		select {
+		case <-w.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// addPrivacyAddress creates a new privacy address and uses it as the source
+// of new connections.
+func (r *Router) addPrivacyAddress(w *mgr.WorkerCtx) (*privacyAddress, error) {
+	id, _, err := m.GeneratePrivacyAddress(w.Ctx())
+	if err != nil {
+		return nil, fmt.Errorf("generate: %w", err)
+	}
+	p := &privacyAddress{
+		id:      id,
+		state:   r.instance.State().WithIdentity(id),
+		created: time.Now(),
+	}
+
+	// Register before adding to the tun device, so that traffic is accepted
+	// as soon as the OS uses the address.
+	r.privacyLock.Lock()
+	r.privacy[id.IP] = p
+	r.privacyLock.Unlock()
+
+	// Add to tun device and use for new connections.
+	nic := r.instance.TunDevice()
+	if err := nic.AddAddress(netip.PrefixFrom(id.IP, 128)); err != nil {
+		r.removePrivacyAddress(p)
+		return nil, fmt.Errorf("add to tun device: %w", err)
+	}
+	if err := nic.SetPreferredSourceRoute(m.BaseNetPrefix, id.IP); err != nil {
+		r.removePrivacyAddress(p)
+		return nil, fmt.Errorf("set as preferred source: %w", err)
+	}
+
+	return p, nil
+}
+
+// setFriendSourceRoutes sets the router address as the preferred source for
+// friends, as they know us by it. Routes of the previous call that are not
+// needed anymore, eg. because a friend was handed over to a new address, are
+// removed. Returns the routes that were set.
+func (r *Router) setFriendSourceRoutes(w *mgr.WorkerCtx, previous []netip.Prefix) []netip.Prefix {
+	nic := r.instance.TunDevice()
+	routerIP := r.instance.Identity().IP
+
+	var routes []netip.Prefix
+	for friendIP := range r.instance.Config().FriendsByIP {
+		for _, ip := range []netip.Addr{friendIP, r.instance.State().Successor(friendIP)} {
+			prefix := netip.PrefixFrom(ip, 128)
+			if slices.Contains(routes, prefix) {
+				continue
+			}
+			if err := nic.SetPreferredSourceRoute(prefix, routerIP); err != nil {
+				w.Warn(
+					"failed to set router address as preferred source for friend",
+					"router", ip,
+					"err", err,
+				)
+				continue
+			}
+			routes = append(routes, prefix)
+		}
+	}
+
+	r.removePreferredSourceRoutes(w, slices.DeleteFunc(previous, func(prefix netip.Prefix) bool {
+		return slices.Contains(routes, prefix)
+	}))
+	return routes
+}
+
+// removePreferredSourceRoutes removes the given preferred source routes from
+// the tun device.
+func (r *Router) removePreferredSourceRoutes(w *mgr.WorkerCtx, routes []netip.Prefix) {
+	nic := r.instance.TunDevice()
+	for _, prefix := range routes {
+		if err := nic.RemovePreferredSourceRoute(prefix); err != nil {
+			w.Warn(
+				"failed to remove preferred source route",
+				"prefix", prefix,
+				"err", err,
+			)
+		}
+	}
+}
+
+// cleanPrivacyAddresses removes privacy addresses older than maxAge, except
+// the current one, and cleans the sessions of the others.
+func (r *Router) cleanPrivacyAddresses(w *mgr.WorkerCtx, current *privacyAddress, maxAge time.Duration) {
+	r.privacyLock.RLock()
+	var (
+		remove []*privacyAddress
+		active []*privacyAddress
+	)
+	for _, p := range r.privacy {
+		if p != current && time.Since(p.created) > maxAge {
+			remove = append(remove, p)
+		} else {
+			active = append(active, p)
+		}
+	}
+	r.privacyLock.RUnlock()
+
+	for _, p := range remove {
+		r.removePrivacyAddress(p)
+		w.Debug(
+			"removed privacy address",
+			"address", p.id.IP,
+		)
+	}
+	for _, p := range active {
+		p.state.CleanSessions()
+	}
+}
+
+// removePrivacyAddress removes the privacy address from the router and the
+// tun device. Its preferred source route is not removed, as it was either
+// replaced by the route of the next privacy address or never set.
+func (r *Router) removePrivacyAddress(p *privacyAddress) {
+	r.privacyLock.Lock()
+	delete(r.privacy, p.id.IP)
+	r.privacyLock.Unlock()
+
+	_ = r.instance.TunDevice().RemoveAddress(netip.PrefixFrom(p.id.IP, 128))
+}
+
+// privacySwitchBlock returns the switch block for sending traffic of the given
+// flow from a privacy address to the given destination.
+// Returns nil if no switch path to the destination is known. In this case, a
+// route discovery is started.
+func (r *Router) privacySwitchBlock(dst netip.Addr, flow uint64) []byte {
+	routes, isDestination := r.table.LookupNearestRoutes(dst, multipathMaxRoutes)
+	if !isDestination {
+		r.DiscoverPing.Discover(dst)
+		return nil
+	}
+
+	rte := selectMultipathRoute(r.viableRoutes(nil, routes), flow)
+	if rte.Source == m.RouteSourcePeer {
+		// Peers are reached via the switch label of their link.
+		link := r.instance.Peering().GetLink(rte.NextHop)
+		if link == nil {
+			return nil
+		}
+		return peerSwitchBlock(link.SwitchLabel())
+	}
+	if m.IsEmptySwitchBlock(rte.Path.ForwardBlock) {
+		return nil
+	}
+	return rte.Path.ForwardBlock
+}
+
+// peerSwitchBlock returns the switch block for sending to a peer via the link
+// with the given switch label. It leaves space for the return label of the
+// peer, so that the peer learns the return block.
+func peerSwitchBlock(label m.SwitchLabel) []byte {
+	block := make([]byte, max(label.EncodedSize(), m.SwitchLabel(m.MaxPrivateSwitchLabel).EncodedSize()))
+	binary.PutUvarint(block, uint64(label))
+	return block
+}
+
+// handlePrivacyFrame handles frames destined to a privacy address.
+// Privacy addresses only receive network traffic and hello responses of the
+// connections they started.
+func (r *Router) handlePrivacyFrame(w *mgr.WorkerCtx, f frame.Frame, p *privacyAddress) error {
+	switch f.MessageType() { //nolint:exhaustive
+	case frame.NetworkTraffic:
+		return r.handleIncomingTraffic(w, f, p)
+
+	case frame.RouterPing:
+		hdr, data, err := r.parsePingMsg(f, p.state)
+		if err != nil {
+			return err
+		}
+		if hdr.PingType != helloPingType || !hdr.FollowUp {
+			return fmt.Errorf("ping type %s is not supported by privacy addresses", hdr.PingType)
+		}
+		return r.HelloPing.handlePingHelloResponse(w, f, hdr, data, p.state)
+
+	default:
+		return fmt.Errorf("message type %s is not supported by privacy addresses", f.MessageType())
+	}
+}
@@ -0,0 +1,40 @@
+package router
+
+import (
+	"testing"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+func TestPeerSwitchBlock(t *testing.T) {
+	t.Parallel()
+
+	labels := []m.SwitchLabel{5, m.MaxRoutableSwitchLabel, m.MaxRoutableSwitchLabel + 1, m.MaxPrivateSwitchLabel}
+	for _, label := range labels {
+		for _, peerLabel := range labels {
+			block := peerSwitchBlock(label)
+
+			// Send to peer.
+			next, err := m.NextRotateSwitchBlock(block, 0)
+			if err != nil || next != label {
+				t.Fatalf("expected own label %d, got %d: %v", label, next, err)
+			}
+			// Peer receives.
+			next, err = m.NextRotateSwitchBlock(block, peerLabel)
+			if err != nil || next != 0 {
+				t.Fatalf("expected peer to be destination, got %d: %v", next, err)
+			}
+
+			// Peer replies along the return block.
+			m.TransformToReturnBlock(block)
+			next, err = m.NextRotateSwitchBlock(block, 0)
+			if err != nil || next != peerLabel {
+				t.Fatalf("expected peer label %d, got %d: %v", peerLabel, next, err)
+			}
+			next, err = m.NextRotateSwitchBlock(block, label)
+			if err != nil || next != 0 {
+				t.Fatalf("expected to be destination, got %d: %v", next, err)
+			}
+		}
+	}
+}
@@ -31,17 +31,31 @@ type Router struct {
 
 	table *m.RoutingTable
 
+	anycast          *m.AnycastTable
+	anycastFlows     map[anycastFlowKey]*anycastFlow
+	anycastFlowsLock sync.Mutex
+
+	restoredRoutes     map[netip.Addr][]m.RoutingTableEntry
+	restoredRoutesLock sync.Mutex
+
 	pingHandlers     map[string]PingHandler
 	pingHandlersLock sync.RWMutex
 
 	connStates     map[connStateKey]*connStateEntry
 	connStatesLock sync.RWMutex
 
+	privacy     map[netip.Addr]*privacyAddress
+	privacyLock sync.RWMutex
+
 	HelloPing      *HelloPingHandler
 	PingPong       *PingPongHandler
+	PMTUPing       *PMTUPingHandler
 	ErrorPing      *ErrorPingHandler
 	AnnouncePing   *AnnouncePingHandler
 	DisconnectPing *DisconnectPingHandler
+	DiscoverPing   *DiscoverPingHandler
+	TracePing      *TracePingHandler
+	RekeyPing      *RekeyPingHandler
 
 	instance instance
 }
@@ -82,19 +96,30 @@ func New(instance instance, routerConfig Config) (*Router, error) {
 		return nil, errors.New("internal error: failed to derive router IP prefix")
 	}
 	// Create routing table.
+	damping := instance.Config().Router.RouteDamping
 	tbl := m.NewRoutingTable(m.RoutingTableConfig{
 		RoutablePrefixes: m.GetRoutablePrefixesFor(routerIP, routerPrefix),
 		RouterIP:         routerIP,
+		Damping: m.RouteDampingConfig{
+			Disable:           damping.Disable,
+			SuppressThreshold: damping.Suppress,
+			ReuseThreshold:    damping.Reuse,
+			HalfLife:          time.Duration(damping.HalfLife) * time.Minute,
+		},
 	})
 
 	// Create router.
 	r := &Router{
-		routerConfig: routerConfig,
-		input:        make(chan frame.Frame),
-		table:        tbl,
-		pingHandlers: make(map[string]PingHandler),
-		connStates:   make(map[connStateKey]*connStateEntry),
-		instance:     instance,
+		routerConfig:   routerConfig,
+		input:          make(chan frame.Frame),
+		table:          tbl,
+		anycast:        m.NewAnycastTable(),
+		anycastFlows:   make(map[anycastFlowKey]*anycastFlow),
+		restoredRoutes: make(map[netip.Addr][]m.RoutingTableEntry),
+		pingHandlers:   make(map[string]PingHandler),
+		connStates:     make(map[connStateKey]*connStateEntry),
+		privacy:        make(map[netip.Addr]*privacyAddress),
+		instance:       instance,
 	}
 	if r.instance.Config().System.DisableTun {
 		r.handleTraffic.Store(false)
@@ -111,6 +136,10 @@ func New(instance instance, routerConfig Config) (*Router, error) {
 	if err := r.RegisterPingHandler(r.PingPong); err != nil {
 		return nil, err
 	}
+	r.PMTUPing = NewPMTUPingHandler(r)
+	if err := r.RegisterPingHandler(r.PMTUPing); err != nil {
+		return nil, err
+	}
 	r.ErrorPing = NewErrorPingHandler(r)
 	if err := r.RegisterPingHandler(r.ErrorPing); err != nil {
 		return nil, err
@@ -123,6 +152,23 @@ func New(instance instance, routerConfig Config) (*Router, error) {
 	if err := r.RegisterPingHandler(r.DisconnectPing); err != nil {
 		return nil, err
 	}
+	r.DiscoverPing = NewDiscoverPingHandler(r)
+	if err := r.RegisterPingHandler(r.DiscoverPing); err != nil {
+		return nil, err
+	}
+	r.TracePing = NewTracePingHandler(r)
+	if err := r.RegisterPingHandler(r.TracePing); err != nil {
+		return nil, err
+	}
+	r.RekeyPing = NewRekeyPingHandler(r)
+	if err := r.RegisterPingHandler(r.RekeyPing); err != nil {
+		return nil, err
+	}
+
+	// Register API endpoints.
+	if api := instance.API(); api != nil {
+		r.registerAPI(api)
+	}
 
 	return r, nil
 }
@@ -131,6 +177,28 @@ func New(instance instance, routerConfig Config) (*Router, error) {
 func (r *Router) Start(mgr *mgr.Manager) error {
 	r.mgr = mgr
 
+	// Load routes saved from the previous run.
+	loaded, err := r.loadRoutes()
+	switch {
+	case err != nil:
+		mgr.Warn(
+			"failed to load saved routes",
+			"err", err,
+		)
+	case loaded > 0:
+		mgr.Info(
+			"loaded saved routes",
+			"routes", loaded,
+		)
+		mgr.Go("restore saved routes", r.restoreRoutesWorker)
+	}
+
+	// Check if an organization address is delegated.
+	if m.GetAddressType(r.instance.Identity().IP) == m.TypeOrganization &&
+		r.instance.Config().OrgDelegation == nil {
+		mgr.Warn("router has an organization address without delegation (router.organization), other routers will ignore its announcements")
+	}
+
 	mgr.Go("announce router", r.announceWorker)
 	mgr.Go("accounce disconnects", r.disconnectWorker)
 	mgr.Go("keep-alive peers", r.keepAliveWorker)
@@ -138,6 +206,16 @@ func (r *Router) Start(mgr *mgr.Manager) error {
 	mgr.Go("clean conn states", r.cleanConnStatesWorker)
 	mgr.Go("clean ping handlers", r.cleanPingHandlersWorker)
 	mgr.Go("clean routing table", r.cleanRoutingTableWorker)
+	if len(r.instance.Config().StaticRoutes) > 0 {
+		mgr.Go("install static routes", r.staticRoutesWorker)
+	}
+	if r.instance.Config().Router.PrivacyAddresses.Enable && !r.instance.Config().System.DisableTun {
+		if runtime.GOOS == "linux" {
+			mgr.Go("rotate privacy addresses", r.privacyWorker)
+		} else {
+			mgr.Warn("privacy addresses (router.privacyAddresses) are only supported on linux")
+		}
+	}
 
 	for i := 0; i < runtime.NumCPU(); i++ {
 		mgr.Go("router", r.frameHandler)
@@ -167,6 +245,14 @@ func (r *Router) Stop(mgr *mgr.Manager) error {
 	// TODO: Can we improve this?
 	time.Sleep(100 * time.Millisecond)
 
+	// Save learned routes for the next start.
+	if err := r.saveRoutes(); err != nil {
+		r.mgr.Warn(
+			"failed to save routes",
+			"err", err,
+		)
+	}
+
 	return nil
 }
 
@@ -206,6 +292,19 @@ func (r *Router) handleFrame(w *mgr.WorkerCtx, f frame.Frame) error {
 		// If the frame is destined to us, handle as incoming frame.
 		return r.handleIncomingFrame(w, f)
 
+	case m.GetAddressType(f.DstIP()) == m.TypeAnycast && r.servesAnycast(f.DstIP()):
+		// If the frame is destined to an anycast group we serve, handle as
+		// incoming frame.
+		return r.handleIncomingFrame(w, f)
+
+	case m.GetAddressType(f.DstIP()) == m.TypePrivacy:
+		// If the frame is destined to one of our privacy addresses, handle as
+		// privacy frame. Privacy addresses are not routable, so drop others.
+		if p := r.getPrivacyAddress(f.DstIP()); p != nil {
+			return r.handlePrivacyFrame(w, f, p)
+		}
+		return fmt.Errorf("unknown privacy address %s", f.DstIP())
+
 	case f.MessageType() == frame.RouterHopPingDeprecated:
 		fallthrough
 	case f.MessageType() == frame.RouterHopPing:
@@ -224,10 +323,10 @@ func (r *Router) handleIncomingFrame(w *mgr.WorkerCtx, f frame.Frame) error {
 		return r.handlePing(w, f)
 
 	case frame.NetworkTraffic:
-		return r.handleIncomingTraffic(w, f)
+		return r.handleIncomingTraffic(w, f, nil)
 
 	case frame.SessionCtrl:
-		return errors.New("not yet supported")
+		return r.handlePing(w, f)
 
 	case frame.SessionData:
 		return errors.New("not yet supported")
@@ -238,6 +337,10 @@ func (r *Router) handleIncomingFrame(w *mgr.WorkerCtx, f frame.Frame) error {
 }
 
 func (r *Router) handleUnsolicitedFrame(f frame.Frame) error {
+	// Clear any switch block, as the frame now continues by IP routing.
+	// This happens when a switch label of a source routed frame is unavailable.
+	clear(f.SwitchBlock())
+
 	// For now, just forward.
 	err := r.RouteFrame(f)
 	switch {
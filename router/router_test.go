@@ -0,0 +1,94 @@
+package router
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/mycoria/mycoria/api/httpapi"
+	"github.com/mycoria/mycoria/api/netstack"
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+	"github.com/mycoria/mycoria/peering"
+	"github.com/mycoria/mycoria/state"
+	"github.com/mycoria/mycoria/switchr"
+	"github.com/mycoria/mycoria/tun"
+)
+
+// newTestRouter returns a router with the given identity, which is not
+// started and has no network access.
+func newTestRouter(t *testing.T, id *m.Address) *Router {
+	t.Helper()
+
+	inst := &testInstance{
+		config:   &config.Config{},
+		identity: id,
+		builder:  frame.NewFrameBuilder(),
+	}
+	inst.state = state.New(inst, nil)
+	r, err := New(inst, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.mgr = mgr.New("router")
+	inst.table = r.table
+	inst.peering = peering.New(inst, nil)
+	inst.swtch = switchr.New(inst, nil)
+
+	return r
+}
+
+// testInstance is an instance for testing the router.
+type testInstance struct {
+	config   *config.Config
+	identity *m.Address
+	builder  *frame.Builder
+	state    *state.State
+	table    *m.RoutingTable
+	peering  *peering.Peering
+	swtch    *switchr.Switch
+}
+
+var _ instance = &testInstance{}
+
+func (i *testInstance) Version() string               { return "v0.0.0" }
+func (i *testInstance) Config() *config.Config        { return i.config }
+func (i *testInstance) Identity() *m.Address          { return i.identity }
+func (i *testInstance) FrameBuilder() *frame.Builder  { return i.builder }
+func (i *testInstance) State() *state.State           { return i.state }
+func (i *testInstance) NetStack() *netstack.NetStack  { return nil }
+func (i *testInstance) API() *httpapi.API             { return nil }
+func (i *testInstance) TunDevice() *tun.Device        { return nil }
+func (i *testInstance) Switch() *switchr.Switch       { return i.swtch }
+func (i *testInstance) Peering() *peering.Peering     { return i.peering }
+func (i *testInstance) RoutingTable() *m.RoutingTable { return i.table }
+
+// testLink is a link with fixed properties.
+type testLink struct {
+	peering.Link
+
+	peer    netip.Addr
+	label   m.SwitchLabel
+	latency uint16
+}
+
+func (l *testLink) Peer() netip.Addr           { return l.peer }
+func (l *testLink) SwitchLabel() m.SwitchLabel { return l.label }
+func (l *testLink) Latency() uint16            { return l.latency }
+
+// checkSwitchBlock checks the labels returned when switching the given block
+// at each hop.
+func checkSwitchBlock(t *testing.T, name string, block []byte, recvLabels, expected []m.SwitchLabel) {
+	t.Helper()
+
+	for i, recvLabel := range recvLabels {
+		next, err := m.NextRotateSwitchBlock(block, recvLabel)
+		if err != nil {
+			t.Fatalf("%s hop %d: failed to switch: %s", name, i, err)
+		}
+		if next != expected[i] {
+			t.Errorf("%s hop %d: expected label %d, got %d", name, i, expected[i], next)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package router
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+	"github.com/mycoria/mycoria/storage"
+)
+
+// Learned routes are saved to the storage when the router stops and are loaded
+// again when it starts. As the switch labels of links change with every new
+// connection, loaded routes are held back until the link to their next hop is
+// established again and the next hop has announced its switch label for the
+// link back to this router. They are then anchored to the new link in both
+// directions. Any other outdated route information is replaced by new
+// announcements or expires.
+
+// restoreRoutesInterval defines how often held back routes are checked.
+const restoreRoutesInterval = 5 * time.Second
+
+// saveRoutes saves the learned routes of the routing table, including any
+// routes that have not been restored yet, to the storage.
+func (r *Router) saveRoutes() error {
+	routes := r.table.LearnedRoutes()
+	func() {
+		r.restoredRoutesLock.Lock()
+		defer r.restoredRoutesLock.Unlock()
+
+		for _, held := range r.restoredRoutes {
+			routes = append(routes, held...)
+		}
+	}()
+
+	now := time.Now()
+	stored := make([]storage.StoredRoute, 0, len(routes))
+	for _, rte := range routes {
+		if rte.Expires.Before(now) {
+			continue
+		}
+		stored = append(stored, storage.StoredRoute{
+			DstIP:   rte.DstIP,
+			NextHop: rte.NextHop,
+			Path:    rte.Path,
+			Stub:    rte.Stub,
+			Source:  rte.Source,
+			Expires: rte.Expires,
+		})
+	}
+
+	if err := r.instance.State().SaveRoutes(stored); err != nil {
+		return fmt.Errorf("save %d routes: %w", len(stored), err)
+	}
+	return nil
+}
+
+// loadRoutes loads the saved routes from the storage and holds them back until
+// they can be restored. Returns the amount of loaded routes.
+func (r *Router) loadRoutes() (int, error) {
+	stored, err := r.instance.State().LoadRoutes()
+	if err != nil {
+		return 0, fmt.Errorf("load routes: %w", err)
+	}
+
+	r.restoredRoutesLock.Lock()
+	defer r.restoredRoutesLock.Unlock()
+
+	var (
+		loaded int
+		now    = time.Now()
+		self   = r.instance.Identity().IP
+	)
+	for _, sr := range stored {
+		switch {
+		case sr.Expires.Before(now):
+			// Route has expired while the router was offline.
+			continue
+		case sr.Source != m.RouteSourceGossip && sr.Source != m.RouteSourceDiscovered:
+			// Only learned routes are restored.
+			continue
+		case len(sr.Path.Hops) < 2 ||
+			sr.Path.Hops[0].Router != self ||
+			sr.Path.Hops[1].Router != sr.NextHop:
+			// Route does not start at this router via its next hop.
+			continue
+		}
+
+		r.restoredRoutes[sr.NextHop] = append(r.restoredRoutes[sr.NextHop], m.RoutingTableEntry{
+			DstIP:   sr.DstIP,
+			NextHop: sr.NextHop,
+			Path:    sr.Path,
+			Stub:    sr.Stub,
+			Source:  sr.Source,
+			Expires: sr.Expires,
+		})
+		loaded++
+	}
+
+	return loaded, nil
+}
+
+func (r *Router) restoreRoutesWorker(w *mgr.WorkerCtx) error {
+	ticker := time.NewTicker(restoreRoutesInterval)
+	defer ticker.Stop()
+	for {
+		if r.restoreRoutes(w) {
+			return nil
+		}
+
+		select {
+		case <-w.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// restoreRoutes adds the held back routes of connected next hops to the
+// routing table and drops expired routes.
+// Returns whether all held back routes have been handled.
+func (r *Router) restoreRoutes(w *mgr.WorkerCtx) (done bool) {
+	r.restoredRoutesLock.Lock()
+	defer r.restoredRoutesLock.Unlock()
+
+	now := time.Now()
+	for nextHop, routes := range r.restoredRoutes {
+		// Drop expired routes.
+		routes = slices.DeleteFunc(routes, func(rte m.RoutingTableEntry) bool {
+			return rte.Expires.Before(now)
+		})
+		if len(routes) == 0 {
+			delete(r.restoredRoutes, nextHop)
+			continue
+		}
+
+		// Wait for next hop to be connected and to announce its return label.
+		link := r.instance.Peering().GetLink(nextHop)
+		if link == nil {
+			r.restoredRoutes[nextHop] = routes
+			continue
+		}
+		returnLabel, ok := r.peerReturnLabel(nextHop)
+		if !ok {
+			r.restoredRoutes[nextHop] = routes
+			continue
+		}
+
+		// Anchor routes to the new link and add them to the table.
+		var restored int
+		for _, rte := range routes {
+			rte.Path = anchorSwitchPath(rte.Path, link.Latency(), link.SwitchLabel(), returnLabel)
+
+			added, err := r.table.AddRoute(rte)
+			switch {
+			case err != nil:
+				w.Debug(
+					"failed to restore route",
+					"dst", rte.DstIP,
+					"nextHop", nextHop,
+					"err", err,
+				)
+			case added:
+				restored++
+			}
+		}
+		delete(r.restoredRoutes, nextHop)
+
+		w.Debug(
+			"restored routes",
+			"nextHop", nextHop,
+			"restored", restored,
+			"held", len(routes),
+		)
+	}
+
+	return len(r.restoredRoutes) == 0
+}
+
+// peerReturnLabel returns the switch label the given peer uses for the link
+// back to this router, as learned from the peer's announcement.
+func (r *Router) peerReturnLabel(peer netip.Addr) (label m.SwitchLabel, ok bool) {
+	rte, _ := r.table.LookupNearestRoute(peer)
+	switch {
+	case rte == nil,
+		rte.DstIP != peer,
+		rte.Source != m.RouteSourcePeer,
+		len(rte.Path.Hops) != 2,
+		rte.Path.Hops[1].ReturnLabel == 0:
+		return 0, false
+	}
+	return rte.Path.Hops[1].ReturnLabel, true
+}
+
+// anchorSwitchPath returns a copy of the given switch path with the first
+// link replaced by the link with the given delay and labels.
+// The switch blocks need to be built again.
+func anchorSwitchPath(path m.SwitchPath, delay uint16, forwardLabel, returnLabel m.SwitchLabel) m.SwitchPath {
+	hops := slices.Clone(path.Hops)
+	hops[0].Delay = delay
+	hops[0].ForwardLabel = forwardLabel
+	hops[1].ReturnLabel = returnLabel
+	return m.SwitchPath{Hops: hops}
+}
@@ -0,0 +1,42 @@
+package router
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+func TestAnchorSwitchPath(t *testing.T) {
+	t.Parallel()
+
+	var (
+		origin = netip.MustParseAddr("fd00::1")
+		relay  = netip.MustParseAddr("fd00::2")
+		dst    = netip.MustParseAddr("fd00::3")
+	)
+
+	// Saved links: origin (1) <10ms> (11) relay (12) <20ms> (21) dst
+	stored := m.SwitchPath{Hops: []m.SwitchHop{
+		{Router: origin, Delay: 10, ForwardLabel: 1},
+		{Router: relay, Delay: 20, ForwardLabel: 12, ReturnLabel: 11},
+		{Router: dst, ReturnLabel: 21},
+	}}
+
+	// Reconnected link: origin (5) <15ms> (15) relay
+	path := anchorSwitchPath(stored, 15, 5, 15)
+	if err := path.BuildBlocks(); err != nil {
+		t.Fatalf("failed to build switch blocks: %s", err)
+	}
+	if stored.Hops[0].ForwardLabel != 1 || stored.Hops[1].ReturnLabel != 11 {
+		t.Error("stored path was modified")
+	}
+	if path.Hops[0].Delay != 15 {
+		t.Errorf("expected delay of new link, got %d", path.Hops[0].Delay)
+	}
+
+	// Forward: origin -> relay -> dst
+	checkSwitchBlock(t, "forward", path.ForwardBlock, []m.SwitchLabel{0, 15, 21}, []m.SwitchLabel{5, 12, 0})
+	// Return: dst -> relay -> origin
+	checkSwitchBlock(t, "return", path.ReturnBlock, []m.SwitchLabel{0, 12, 5}, []m.SwitchLabel{21, 15, 0})
+}
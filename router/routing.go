@@ -23,6 +23,9 @@ import (
 // - build with TTL of 64 and 5s timeout
 // - sweep with TTL of 64 and 10s timeout
 // - query: hop by hop discovery with direct messages only
+//
+// Route discovery is implemented by the discover ping handler and is started
+// for locally originated traffic without a route to the exact destination.
 
 var (
 	// ErrWouldLoop is returned when a packet cannot be routed because it would
@@ -32,17 +35,46 @@ var (
 	// ErrTableEmpty is returned when a packet cannot be routed because the
 	// routing table is empty.
 	ErrTableEmpty = errors.New("not routing: table empty")
+
+	// ErrNoAnycastMember is returned when a packet cannot be routed because
+	// no member of the anycast group is known.
+	ErrNoAnycastMember = errors.New("not routing: no anycast group member known")
+
+	// ErrNoSwitchPath is returned when a frame from a privacy address cannot
+	// be sent, because no switch path to the destination is known.
+	ErrNoSwitchPath = errors.New("not routing: no switch path known")
 )
 
 // RouteFrame forwards the given frame to the next hop based on the destination IP.
+// Network traffic is distributed over multiple routes by source and destination.
+// Frames to anycast addresses are delivered to the nearest member of the group.
 func (r *Router) RouteFrame(f frame.Frame) error {
 	// Check if destination is routable.
 	if !m.RoutingAddressPrefix.Contains(f.DstIP()) {
 		return fmt.Errorf("dst IP %s is not routable", f.DstIP())
 	}
 
+	// Route to nearest anycast group member.
+	if m.GetAddressType(f.DstIP()) == m.TypeAnycast {
+		member, ok := r.anycastMemberFor(f.DstIP(), addrFlowHash(f.SrcIP(), f.DstIP()))
+		if !ok {
+			return ErrNoAnycastMember
+		}
+		rte, _ := r.table.LookupNearestRoute(member)
+		return r.routeFrameVia(f, rte)
+	}
+
+	// Use multipath for network traffic.
+	if f.MessageType() == frame.NetworkTraffic {
+		return r.RouteFlow(f, addrFlowHash(f.SrcIP(), f.DstIP()))
+	}
+
 	// Lookup routing table for best next hop.
 	rte, _ := r.table.LookupNearestRoute(f.DstIP())
+	return r.routeFrameVia(f, rte)
+}
+
+func (r *Router) routeFrameVia(f frame.Frame, rte *m.RoutingTableEntry) error {
 	if rte == nil {
 		return ErrTableEmpty
 	}
@@ -67,6 +99,8 @@ func (r *Router) cleanRoutingTableWorker(w *mgr.WorkerCtx) error {
 			return nil
 		case <-ticker.C:
 			r.table.Clean()
+			r.anycast.Clean()
+			r.cleanAnycastFlows()
 		}
 	}
 }
@@ -0,0 +1,138 @@
+package router
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"net/netip"
+	"slices"
+
+	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/state"
+	"github.com/mycoria/mycoria/switchr"
+)
+
+// switchBlockFor returns the switch block for sending network traffic of the
+// given flow to the given destination.
+// Returns nil if the traffic should be routed by IP.
+func (r *Router) switchBlockFor(dst netip.Addr, session *state.Session, flow uint64) []byte {
+	switch {
+	case m.GetAddressType(dst) == m.TypePrivacy:
+		// Privacy addresses are not routable and are only reachable via the
+		// return block learned from their traffic.
+		return session.ReturnBlock()
+	case !r.instance.Config().Router.SourceRouting:
+		return nil
+	}
+
+	// Use the switch path of a route to the exact destination.
+	routes, isDestination := r.table.LookupNearestRoutes(dst, multipathMaxRoutes)
+	if isDestination {
+		rte := selectMultipathRoute(r.viableRoutes(nil, routes), flow)
+		if rte.Source == m.RouteSourcePeer {
+			// Peers are reached directly.
+			return nil
+		}
+		return rte.Path.ForwardBlock
+	}
+
+	// Otherwise, use the return block learned from incoming traffic.
+	return session.ReturnBlock()
+}
+
+// sourceRouteFlow sends a locally originated frame along its switch block.
+// If the frame has no switch block or the first hop is unavailable, the frame
+// is routed by IP instead.
+func (r *Router) sourceRouteFlow(f frame.Frame, flow uint64) error {
+	block := f.SwitchBlock()
+	if !m.IsEmptySwitchBlock(block) {
+		// Take own switch label from the block.
+		nextHop, err := m.NextRotateSwitchBlock(block, 0)
+		if err == nil && nextHop != 0 {
+			err = r.instance.Switch().ForwardByLabel(f, nextHop)
+			if !errors.Is(err, switchr.ErrNextHopUnavailable) {
+				return err
+			}
+		}
+
+		// Fall back to routing by IP.
+		clear(block)
+	}
+
+	return r.RouteFlow(f, flow)
+}
+
+// learnReturnBlock saves the return block of source routed traffic to the
+// session, so that replies can take the same path back.
+// Return blocks are always learned from privacy addresses, as they cannot be
+// reached otherwise.
+func (r *Router) learnReturnBlock(session *state.Session, f frame.Frame) {
+	block := f.SwitchBlock()
+	switch {
+	case m.IsEmptySwitchBlock(block):
+		return
+	case !r.instance.Config().Router.SourceRouting &&
+		m.GetAddressType(f.SrcIP()) != m.TypePrivacy:
+		return
+	}
+
+	// The switch block holds the return labels of all hops in reverse.
+	var buf [255]byte
+	returnBlock := buf[:len(block)]
+	copy(returnBlock, block)
+	m.TransformToReturnBlock(returnBlock)
+
+	// The switch block is not authenticated, so check it before using it.
+	if r.checkReturnBlock(f, returnBlock) != nil {
+		return
+	}
+	session.SetReturnBlock(returnBlock)
+}
+
+// checkReturnBlock checks if the return block learned from the given frame
+// may be used to reply to its source.
+// As the switch block is not authenticated, the return block must consist of
+// valid labels and must leave through the link the frame was received on.
+// For routable sources, that link must also be the next hop of a known route
+// to the source.
+func (r *Router) checkReturnBlock(f frame.Frame, returnBlock []byte) error {
+	recvLink := f.RecvLink()
+	if recvLink == nil {
+		return errors.New("missing recv link")
+	}
+
+	// Check labels, the first one is our own.
+	var first m.SwitchLabel
+	for rest := returnBlock; len(rest) > 0; {
+		label, n := binary.Uvarint(rest)
+		if n <= 0 || label > math.MaxUint16 {
+			return errors.New("return block is malformed")
+		}
+		if label == 0 {
+			break
+		}
+		if first == 0 {
+			first = m.SwitchLabel(label)
+		}
+		rest = rest[n:]
+	}
+
+	// Check if the reply leaves through the link the frame was received on.
+	if first != recvLink.SwitchLabel() ||
+		r.instance.Peering().GetLinkByLabel(recvLink.SwitchLabel()) == nil {
+		return errors.New("return block does not start at recv link")
+	}
+
+	// Check if the recv link leads to a routable source.
+	if m.GetAddressType(f.SrcIP()) != m.TypePrivacy {
+		routes, _ := r.table.LookupNearestRoutes(f.SrcIP(), multipathMaxRoutes)
+		if !slices.ContainsFunc(routes, func(rte *m.RoutingTableEntry) bool {
+			return rte.NextHop == recvLink.Peer()
+		}) {
+			return errors.New("recv link is not a next hop to source")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,285 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/state"
+)
+
+func TestSwitchBlockFor(t *testing.T) {
+	t.Parallel()
+
+	// Links: origin (1) <10ms> (11) relay (12) <20ms> (21) dst
+	origin, relay, dst := newTestAddress(t), newTestAddress(t), newTestAddress(t)
+	r := newTestRouter(t, origin)
+	if err := r.instance.Peering().AddLink(&sendLink{testLink: testLink{peer: relay.IP, label: 1, latency: 10}}); err != nil {
+		t.Fatal(err)
+	}
+	session := newTestSession(t, r, dst)
+	learned := []byte{1, 7, 0}
+	session.SetReturnBlock(learned)
+
+	// Without source routing, traffic is routed by IP.
+	if block := r.switchBlockFor(dst.IP, session, 1); block != nil {
+		t.Errorf("expected no switch block without source routing, got %v", block)
+	}
+
+	// Privacy addresses are always reached via the learned return block.
+	privacy, _, err := m.GeneratePrivacyAddress(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	privacySession := newTestSession(t, r, privacy)
+	privacySession.SetReturnBlock(learned)
+	if block := r.switchBlockFor(privacy.IP, privacySession, 1); !bytes.Equal(block, learned) {
+		t.Errorf("expected learned block for privacy address, got %v", block)
+	}
+
+	// Without a route to the destination, the learned return block is used.
+	r.instance.Config().Router.SourceRouting = true
+	if block := r.switchBlockFor(dst.IP, session, 1); !bytes.Equal(block, learned) {
+		t.Errorf("expected learned block without route, got %v", block)
+	}
+
+	// With a route to the destination, its switch path is used.
+	rte := addTestRoute(t, r, origin.IP, relay.IP, dst.IP)
+	if block := r.switchBlockFor(dst.IP, session, 1); !bytes.Equal(block, rte.Path.ForwardBlock) {
+		t.Errorf("expected forward block of route %v, got %v", rte.Path.ForwardBlock, block)
+	}
+
+	// Peers are reached directly.
+	if block := r.switchBlockFor(relay.IP, newTestSession(t, r, relay), 1); block != nil {
+		t.Errorf("expected no switch block for peer, got %v", block)
+	}
+}
+
+func TestSourceRouteFlow(t *testing.T) {
+	t.Parallel()
+
+	// Links: origin (1) <10ms> (11) relay (12) <20ms> (21) dst
+	origin, relay, dst := newTestAddress(t), newTestAddress(t), newTestAddress(t)
+	r := newTestRouter(t, origin)
+	relayLink := &sendLink{testLink: testLink{peer: relay.IP, label: 1, latency: 10}}
+	if err := r.instance.Peering().AddLink(relayLink); err != nil {
+		t.Fatal(err)
+	}
+	rte := addTestRoute(t, r, origin.IP, relay.IP, dst.IP)
+
+	// Frames are sent along their switch block.
+	f := newTestFrame(t, r, origin.IP, dst.IP, rte.Path.ForwardBlock)
+	if err := r.sourceRouteFlow(f, 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(relayLink.sent) != 1 || relayLink.sent[0] != f {
+		t.Fatal("frame should be sent to relay")
+	}
+	checkSwitchBlock(t, "forward", f.SwitchBlock(), []m.SwitchLabel{11, 21}, []m.SwitchLabel{12, 0})
+
+	// Frames fall back to routing by IP, if the first hop is unavailable.
+	f = newTestFrame(t, r, origin.IP, dst.IP, []byte{9, 12, 0, 0, 0})
+	if err := r.sourceRouteFlow(f, 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(relayLink.sent) != 2 || relayLink.sent[1] != f {
+		t.Fatal("frame should be routed to relay by IP")
+	}
+	if !m.IsEmptySwitchBlock(f.SwitchBlock()) {
+		t.Errorf("switch block should be cleared when routing by IP, got %v", f.SwitchBlock())
+	}
+
+	// Frames without switch block are routed by IP.
+	f = newTestFrame(t, r, origin.IP, dst.IP, nil)
+	if err := r.sourceRouteFlow(f, 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(relayLink.sent) != 3 || relayLink.sent[2] != f {
+		t.Fatal("frame should be routed to relay by IP")
+	}
+}
+
+func TestLearnReturnBlock(t *testing.T) {
+	t.Parallel()
+
+	// Links: src (1) <10ms> (11) relay (12) <20ms> (21) dst
+	src, relay, dst := newTestAddress(t), newTestAddress(t), newTestAddress(t)
+	r := newTestRouter(t, dst)
+	relayLink := &sendLink{testLink: testLink{peer: relay.IP, label: 21, latency: 20}}
+	if err := r.instance.Peering().AddLink(relayLink); err != nil {
+		t.Fatal(err)
+	}
+	otherLink := &sendLink{testLink: testLink{peer: newTestAddress(t).IP, label: 22}}
+	if err := r.instance.Peering().AddLink(otherLink); err != nil {
+		t.Fatal(err)
+	}
+
+	// receive returns a frame from the given source, as it arrives after
+	// being switched along the path.
+	path := m.SwitchPath{Hops: []m.SwitchHop{
+		{Router: src.IP, ForwardLabel: 1},
+		{Router: relay.IP, ForwardLabel: 12, ReturnLabel: 11},
+		{Router: dst.IP, ReturnLabel: 21},
+	}}
+	if err := path.BuildBlocks(); err != nil {
+		t.Fatal(err)
+	}
+	receive := func(src netip.Addr, recvLink frame.LinkAccessor) frame.Frame {
+		t.Helper()
+
+		block := slices.Clone(path.ForwardBlock)
+		for _, recvLabel := range []m.SwitchLabel{0, 11, 21} {
+			if _, err := m.NextRotateSwitchBlock(block, recvLabel); err != nil {
+				t.Fatal(err)
+			}
+		}
+		f := newTestFrame(t, r, src, dst.IP, block)
+		f.SetRecvLink(recvLink)
+		return f
+	}
+	checkLearned := func(name string, session *state.Session) {
+		t.Helper()
+
+		block := slices.Clone(session.ReturnBlock())
+		if block == nil {
+			t.Fatalf("%s: return block should be learned", name)
+		}
+		checkSwitchBlock(t, name, block, []m.SwitchLabel{0, 12, 1}, []m.SwitchLabel{21, 11, 0})
+	}
+
+	// Return blocks of routable sources are only learned with source routing.
+	session := newTestSession(t, r, src)
+	r.learnReturnBlock(session, receive(src.IP, relayLink))
+	if session.ReturnBlock() != nil {
+		t.Fatal("return block should not be learned without source routing")
+	}
+
+	// Return blocks of routable sources are only learned, if the recv link
+	// is the next hop of a route to the source.
+	r.instance.Config().Router.SourceRouting = true
+	addTestRoute(t, r, dst.IP, otherLink.peer, src.IP)
+	r.learnReturnBlock(session, receive(src.IP, relayLink))
+	if session.ReturnBlock() != nil {
+		t.Fatal("return block should not be learned from link not leading to source")
+	}
+	addTestRoute(t, r, dst.IP, relay.IP, src.IP)
+	r.learnReturnBlock(session, receive(src.IP, relayLink))
+	checkLearned("routable", session)
+
+	// Tampered return blocks are ignored.
+	session.SetReturnBlock(nil)
+	r.learnReturnBlock(session, receive(src.IP, otherLink))
+	if session.ReturnBlock() != nil {
+		t.Fatal("return block not starting at recv link should not be learned")
+	}
+	f := receive(src.IP, relayLink)
+	for i := range f.SwitchBlock() {
+		f.SwitchBlock()[i] = 0xFF
+	}
+	r.learnReturnBlock(session, f)
+	if session.ReturnBlock() != nil {
+		t.Fatal("malformed return block should not be learned")
+	}
+
+	// Return blocks of privacy addresses are always learned.
+	r.instance.Config().Router.SourceRouting = false
+	privacy, _, err := m.GeneratePrivacyAddress(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	privacySession := newTestSession(t, r, privacy)
+	r.learnReturnBlock(privacySession, receive(privacy.IP, otherLink))
+	if privacySession.ReturnBlock() != nil {
+		t.Fatal("return block from other recv link should not be learned")
+	}
+	r.learnReturnBlock(privacySession, receive(privacy.IP, relayLink))
+	checkLearned("privacy", privacySession)
+}
+
+// sendLink is a test link that records sent frames.
+type sendLink struct {
+	testLink
+
+	sent []frame.Frame
+}
+
+func (l *sendLink) Send(f frame.Frame) error {
+	l.sent = append(l.sent, f)
+	return nil
+}
+
+func (l *sendLink) SendPriority(f frame.Frame) error {
+	return l.Send(f)
+}
+
+func (l *sendLink) FlowControlIndicator() frame.FlowControlFlag {
+	return 0
+}
+
+// newTestAddress returns a new routable address.
+// Any routing address is used, as they are quick to generate.
+func newTestAddress(t *testing.T) *m.Address {
+	t.Helper()
+
+	id, _, err := m.GenerateRoutableAddress(context.Background(), []netip.Prefix{m.RoutingAddressPrefix})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// newTestSession returns the session of the router with the given address.
+func newTestSession(t *testing.T, r *Router, id *m.Address) *state.Session {
+	t.Helper()
+
+	if err := r.instance.State().AddRouter(&id.PublicAddress); err != nil {
+		t.Fatal(err)
+	}
+	session := r.instance.State().GetSession(id.IP)
+	if session == nil {
+		t.Fatal("failed to get session")
+	}
+	return session
+}
+
+// addTestRoute adds a route from the router to the destination via the relay
+// and returns it as stored in the table.
+func addTestRoute(t *testing.T, r *Router, router, relay, dst netip.Addr) *m.RoutingTableEntry {
+	t.Helper()
+
+	_, err := r.table.AddRoute(m.RoutingTableEntry{
+		DstIP:   dst,
+		NextHop: relay,
+		Path: m.SwitchPath{Hops: []m.SwitchHop{
+			{Router: router, Delay: 10, ForwardLabel: 1},
+			{Router: relay, Delay: 20, ForwardLabel: 12, ReturnLabel: 11},
+			{Router: dst, ReturnLabel: 21},
+		}},
+		Source:  m.RouteSourceGossip,
+		Expires: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rte, isDestination := r.table.LookupNearestRoute(dst)
+	if rte == nil || !isDestination {
+		t.Fatal("route should be added")
+	}
+	return rte
+}
+
+// newTestFrame returns a network traffic frame with the given switch block.
+func newTestFrame(t *testing.T, r *Router, src, dst netip.Addr, block []byte) frame.Frame {
+	t.Helper()
+
+	f, err := r.instance.FrameBuilder().NewFrameV1(src, dst, frame.NetworkTraffic, block, []byte("test"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
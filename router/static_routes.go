@@ -0,0 +1,68 @@
+package router
+
+import (
+	"time"
+
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+// staticRoutesInterval defines how often static routes are (re)installed.
+// Static routes are removed from the table when the link to their peer is
+// removed and are added again with the next run after the peer reconnects.
+const staticRoutesInterval = 10 * time.Second
+
+func (r *Router) staticRoutesWorker(w *mgr.WorkerCtx) error {
+	r.installStaticRoutes(w)
+
+	ticker := time.NewTicker(staticRoutesInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.Done():
+			return nil
+		case <-ticker.C:
+			r.installStaticRoutes(w)
+		}
+	}
+}
+
+// installStaticRoutes adds the configured static routes of all connected
+// peers to the routing table. Existing static routes are updated.
+func (r *Router) installStaticRoutes(w *mgr.WorkerCtx) {
+	for _, route := range r.instance.Config().StaticRoutes {
+		link := r.instance.Peering().GetLink(route.Via)
+		if link == nil {
+			continue
+		}
+
+		// Build switch path, starting with this router.
+		hops := make([]m.SwitchHop, 0, len(route.Path)+1)
+		hops = append(hops, m.SwitchHop{
+			Router:       r.instance.Identity().IP,
+			Delay:        link.Latency(),
+			ForwardLabel: link.SwitchLabel(),
+		})
+		if len(route.Path) > 0 {
+			hops = append(hops, route.Path...)
+		} else {
+			hops = append(hops, m.SwitchHop{Router: route.Via})
+		}
+
+		_, err := r.table.AddRoute(m.RoutingTableEntry{
+			DstIP:         hops[len(hops)-1].Router,
+			RoutingPrefix: route.Prefix,
+			NextHop:       route.Via,
+			Path:          m.SwitchPath{Hops: hops},
+			Source:        m.RouteSourceStatic,
+		})
+		if err != nil {
+			w.Warn(
+				"failed to add static route",
+				"prefix", route.Prefix,
+				"via", route.Via,
+				"err", err,
+			)
+		}
+	}
+}
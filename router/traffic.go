@@ -12,9 +12,18 @@ import (
 	"github.com/mycoria/mycoria/state"
 )
 
-func (r *Router) handleIncomingTraffic(w *mgr.WorkerCtx, f frame.Frame) error {
+// handleIncomingTraffic handles network traffic destined to this router.
+// If the traffic is destined to a privacy address, it must be given, as it
+// holds the sessions. Privacy addresses only receive replies to connections
+// they started and do not send error pings, as these would be sent from the
+// router address.
+func (r *Router) handleIncomingTraffic(w *mgr.WorkerCtx, f frame.Frame, p *privacyAddress) error {
 	// Get session.
-	session := r.instance.State().GetSession(f.SrcIP())
+	st := r.instance.State()
+	if p != nil {
+		st = p.state
+	}
+	session := st.GetSession(f.SrcIP())
 	if session == nil {
 		return fmt.Errorf("unknown src router: %s", f.SrcIP())
 	}
@@ -22,7 +31,7 @@ func (r *Router) handleIncomingTraffic(w *mgr.WorkerCtx, f frame.Frame) error {
 	// Unseal.
 	if err := f.Unseal(session); err != nil {
 		// Send error ping if encryption is not set up.
-		if errors.Is(err, state.ErrEncryptionNotSetUp) {
+		if errors.Is(err, state.ErrEncryptionNotSetUp) && p == nil {
 			if err := r.ErrorPing.SendNoEncryptionKeys(f.SrcIP()); err != nil {
 				return fmt.Errorf("send error ping no encryption keys: %w", err)
 			}
@@ -51,6 +60,10 @@ func (r *Router) handleIncomingTraffic(w *mgr.WorkerCtx, f frame.Frame) error {
 
 	// Check if handling is enabled or
 	if !r.handleTraffic.Load() {
+		if p != nil {
+			f.ReturnToPool()
+			return nil
+		}
 		if err := r.ErrorPing.SendRejected(src, dst, protocol, dstPort); err != nil {
 			return fmt.Errorf("send rejected ping: %w", err)
 		}
@@ -59,11 +72,13 @@ func (r *Router) handleIncomingTraffic(w *mgr.WorkerCtx, f frame.Frame) error {
 
 	// Check integrity.
 	switch {
-	case src != f.SrcIP():
+	case src != f.SrcIP() && !r.anycast.IsMember(src, f.SrcIP()):
+		// Members of anycast groups may reply from the anycast address.
 		f.ReturnToPool()
 		return errors.New("invalid packet: src IPs do not match")
 
-	case dst != f.DstIP():
+	case dst != f.DstIP() && !(m.GetAddressType(dst) == m.TypeAnycast && r.servesAnycast(dst)):
+		// Traffic to anycast addresses is sent to a member router.
 		f.ReturnToPool()
 		return errors.New("invalid packet: dst IPs do not match")
 
@@ -72,16 +87,25 @@ func (r *Router) handleIncomingTraffic(w *mgr.WorkerCtx, f frame.Frame) error {
 		return errors.New("invalid packet: dst IP is internal range")
 	}
 	// Check policy.
-	status, _ := r.checkPolicy(w, true, connStateKey{
+	key := connStateKey{
 		localIP:    dst,
 		remoteIP:   src,
 		protocol:   protocol,
 		localPort:  dstPort,
 		remotePort: srcPort,
-	}, len(packetData))
+	}
+	if _, ok := r.getConnState(key); !ok && p != nil {
+		// Privacy addresses only receive replies.
+		f.ReturnToPool()
+		return errors.New("privacy addresses only receive replies")
+	}
+	status, _ := r.checkPolicy(w, true, key, len(packetData))
 	if status != connStatusAllowed {
 		// Packet may not be received.
 		f.ReturnToPool()
+		if p != nil {
+			return nil
+		}
 		if err := r.ErrorPing.SendAccessDenied(src, dst, protocol, dstPort); err != nil {
 			return fmt.Errorf("send access denied ping: %w", err)
 		}
@@ -89,6 +113,9 @@ func (r *Router) handleIncomingTraffic(w *mgr.WorkerCtx, f frame.Frame) error {
 		return nil
 	}
 
+	// Learn return path of source routed traffic.
+	r.learnReturnBlock(session, f)
+
 	// Hand frame to tun device.
 	select {
 	case r.instance.TunDevice().SendFrame <- f:
@@ -13,6 +13,7 @@ import (
 	"github.com/mycoria/mycoria/frame"
 	"github.com/mycoria/mycoria/m"
 	"github.com/mycoria/mycoria/mgr"
+	"github.com/mycoria/mycoria/state"
 )
 
 func (r *Router) handleTun(w *mgr.WorkerCtx) error {
@@ -84,6 +85,7 @@ func (r *Router) handleTunPacket(w *mgr.WorkerCtx, packetData []byte) { //nolint
 	defer r.instance.FrameBuilder().ReturnPooledSlice(packetData)
 
 	// Check integrity and addresses.
+	privacy := r.getPrivacyAddress(src)
 	switch {
 	case !r.handleTraffic.Load():
 		// Traffic handling is disabled.
@@ -101,14 +103,22 @@ func (r *Router) handleTunPacket(w *mgr.WorkerCtx, packetData []byte) { //nolint
 		)
 		return
 
-	case src != routerIP:
-		// Drop packet if source does not match router IP.
+	case src != routerIP && !r.servesAnycast(src) && privacy == nil:
+		// Drop packet if source does not match router IP, a served anycast
+		// address or a privacy address.
 		w.Debug(
 			"dropping packet with src that does not match router IP",
 			"src", src,
 		)
 		return
 	}
+	// Use the identity and sessions of the privacy address, if sent from one.
+	srcIdentity := r.instance.Identity()
+	srcState := r.instance.State()
+	if privacy != nil {
+		srcIdentity = privacy.id
+		srcState = privacy.state
+	}
 	// Check policy.
 	key := connStateKey{
 		localIP:    src,
@@ -135,14 +145,32 @@ func (r *Router) handleTunPacket(w *mgr.WorkerCtx, packetData []byte) { //nolint
 		return
 	}
 
+	// Send traffic to anycast addresses to the nearest member of the group.
+	// The session is with the member router.
+	flow := key.flowHash()
+	routeDst := dst
+	if m.GetAddressType(dst) == m.TypeAnycast {
+		member, ok := r.anycastMemberFor(dst, flow)
+		if !ok {
+			if err := r.respondWithError(src, packetData, connStatusUnreachable); err != nil {
+				w.Debug(
+					"failed to send icmp error",
+					"err", err,
+				)
+			}
+			return
+		}
+		routeDst = member
+	}
+
 	// Get session.
-	session := r.instance.State().GetSession(dst)
+	session := srcState.GetSession(routeDst)
 	if session == nil || !session.Encryption().IsSetUp() {
 		// Setup encryption with hello ping.
-		notify, err := r.HelloPing.Send(dst)
+		notify, err := r.HelloPing.send(privacy, routeDst)
 		if err != nil {
 			switch {
-			case errors.Is(err, ErrTableEmpty):
+			case errors.Is(err, ErrTableEmpty), errors.Is(err, ErrNoSwitchPath):
 				// Ignore packets if we can't route them.
 			case errors.Is(err, ErrAlreadyActive):
 				w.Debug(
@@ -183,19 +211,57 @@ func (r *Router) handleTunPacket(w *mgr.WorkerCtx, packetData []byte) { //nolint
 			return
 		}
 
-		session = r.instance.State().GetSession(dst)
+		session = srcState.GetSession(routeDst)
 		if session == nil {
 			w.Warn(
 				"internal error: no session after hello ping",
-				"router", dst,
+				"router", routeDst,
 				"dst", dst,
 			)
 			return
 		}
 	}
 
+	// Sessions with privacy addresses are not re-keyed and their path MTU is
+	// not probed, as privacy addresses only handle traffic and hello pings.
+	privacySession := privacy != nil || m.GetAddressType(routeDst) == m.TypePrivacy
+
+	// Re-key session, if due.
+	if !privacySession && session.Encryption().RekeyRequired() {
+		if err := r.RekeyPing.Start(routeDst); err != nil {
+			w.Debug(
+				"failed to start re-keying",
+				"router", routeDst,
+				"err", err,
+			)
+		}
+	}
+
+	// Probe path MTU, if not yet done or outdated.
+	if !privacySession && time.Since(session.PathMTUProbed()) > pmtuProbeInterval {
+		r.PMTUPing.Probe(routeDst)
+	}
+
 	// Check MTU.
-	dstMTU := session.TunMTU()
+	// The path MTU is probed without switch block, so subtract it.
+	var switchBlock []byte
+	if privacy != nil {
+		switchBlock = r.privacySwitchBlock(routeDst, flow)
+		if switchBlock == nil {
+			// Drop packet until a switch path is discovered.
+			w.Debug(
+				"dropping packet from privacy address without switch path",
+				"dst", dst,
+			)
+			return
+		}
+	} else {
+		switchBlock = r.switchBlockFor(routeDst, session, flow)
+	}
+	dstMTU := session.MTU()
+	if dstMTU != 0 && dstMTU == session.PathMTU() {
+		dstMTU = max(dstMTU-len(switchBlock), state.MinMTU)
+	}
 	if dstMTU != 0 && len(packetData) > dstMTU {
 		// Packet is too big for MTU, notify OS.
 		if err := r.sendICMP6PacketTooBig(src, dstMTU, packetData); err != nil {
@@ -210,14 +276,14 @@ func (r *Router) handleTunPacket(w *mgr.WorkerCtx, packetData []byte) { //nolint
 	// Make new frame from data.
 	// TODO: Stop copying data. (Don't forget about the ReturnPooledSlice above!)
 	f, err := r.instance.FrameBuilder().NewFrameV1(
-		r.instance.Identity().IP, dst,
+		srcIdentity.IP, routeDst,
 		frame.NetworkTraffic,
-		nil, packetData, nil,
+		switchBlock, packetData, nil,
 	)
 	if err != nil {
 		w.Warn(
 			"failed to build frame",
-			"router", dst,
+			"router", routeDst,
 			"err", err,
 		)
 		return
@@ -227,7 +293,7 @@ func (r *Router) handleTunPacket(w *mgr.WorkerCtx, packetData []byte) { //nolint
 	if err := f.Seal(session); err != nil {
 		w.Warn(
 			"failed to seal frame",
-			"router", dst,
+			"router", routeDst,
 			"err", err,
 		)
 		f.ReturnToPool()
@@ -235,7 +301,7 @@ func (r *Router) handleTunPacket(w *mgr.WorkerCtx, packetData []byte) { //nolint
 	}
 
 	// Send the frame along its way!
-	if err := r.RouteFrame(f); err != nil {
+	if err := r.sourceRouteFlow(f, flow); err != nil {
 		w.Warn(
 			"failed to route frame ",
 			"dst", dst,
@@ -0,0 +1,207 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/storage"
+)
+
+// Identity handovers.
+// Routers announce the handover from their previous address. Accepted
+// handovers are stored with the new router and domain mappings to the old
+// address are moved to the new address. Friends are configured by address, so
+// the successors of friends are treated as friends too.
+// The expiry of a handover only limits how long it is announced and accepted.
+// Accepted handovers are kept after they expire, just like the moved domain
+// mappings, so that friends are still recognized by their new address.
+// As any router can announce a handover from a freshly generated address,
+// handovers are only accepted if the old address is a friend or has domain
+// mappings.
+
+const (
+	// handoverMaxChain defines how many handovers in a row are followed.
+	handoverMaxChain = 8
+	// handoverLoadMax defines how many handovers are loaded from the storage.
+	handoverLoadMax = 10_000
+)
+
+// loadHandovers loads the handovers from the storage.
+func (state *State) loadHandovers() error {
+	q := storage.NewRouterQuery(
+		func(a *storage.StoredRouter) bool {
+			return a.Handover != nil
+		},
+		nil,
+		handoverLoadMax,
+	)
+	if err := state.storage.QueryRouters(q); err != nil {
+		return err
+	}
+
+	state.handoversLock.Lock()
+	defer state.handoversLock.Unlock()
+
+	state.handovers = make(map[netip.Addr]*m.IdentityHandover)
+	state.predecessors = make(map[netip.Addr][]netip.Addr)
+	for _, stored := range q.Result() {
+		state.setHandover(stored.Handover)
+	}
+	return nil
+}
+
+// setHandover sets the handover of the old address and updates the index of
+// predecessors. The handovers lock must be held.
+func (state *State) setHandover(ih *m.IdentityHandover) {
+	if existing := state.handovers[ih.Old.IP]; existing != nil {
+		previous := slices.DeleteFunc(state.predecessors[existing.New], func(ip netip.Addr) bool {
+			return ip == ih.Old.IP
+		})
+		if len(previous) > 0 {
+			state.predecessors[existing.New] = previous
+		} else {
+			delete(state.predecessors, existing.New)
+		}
+	}
+
+	state.handovers[ih.Old.IP] = ih
+	state.predecessors[ih.New] = append(state.predecessors[ih.New], ih.Old.IP)
+}
+
+// AddHandover adds an identity handover announced by its new router.
+// Returns whether the handover was added. Handovers from addresses that are
+// neither a friend nor have domain mappings are ignored.
+func (state *State) AddHandover(ih *m.IdentityHandover) (added bool, err error) {
+	// Check handover.
+	if err := ih.Verify(); err != nil {
+		return false, err
+	}
+	if ih.Expired() {
+		return false, errors.New("handover expired")
+	}
+
+	// Check if the handover is relevant.
+	mappings, err := state.storage.QueryMappings("")
+	if err != nil {
+		return false, fmt.Errorf("query domain mappings: %w", err)
+	}
+	mappings = slices.DeleteFunc(mappings, func(mapping storage.StoredMapping) bool {
+		return mapping.Router != ih.Old.IP
+	})
+	if len(mappings) == 0 && !state.IsFriend(ih.Old.IP) {
+		return false, nil
+	}
+
+	state.handoversLock.Lock()
+	defer state.handoversLock.Unlock()
+
+	// Check for existing handover of the old address.
+	// If the old address was handed over multiple times, use the most recent.
+	existing := state.handovers[ih.Old.IP]
+	switch {
+	case existing == nil:
+	case existing.New == ih.New && !ih.Expires.After(existing.Expires):
+		return false, nil
+	case existing.New != ih.New && existing.Expires.After(ih.Expires):
+		return false, fmt.Errorf("old address was handed over to %s more recently", existing.New)
+	}
+
+	// Save handover to new router.
+	stored, err := state.storage.GetRouter(ih.New)
+	if err != nil {
+		return false, fmt.Errorf("get stored router: %w", err)
+	}
+	stored.Handover = ih
+	if err := state.storage.SaveRouter(stored); err != nil {
+		return false, fmt.Errorf("save to storage: %w", err)
+	}
+
+	// Remove replaced handover from its router, so it is not loaded again.
+	if existing != nil && existing.New != ih.New {
+		replaced, err := state.storage.GetRouter(existing.New)
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+		case err != nil:
+			return false, fmt.Errorf("get replaced router: %w", err)
+		case replaced.Handover != nil && replaced.Handover.Old.IP == ih.Old.IP:
+			replaced.Handover = nil
+			if err := state.storage.SaveRouter(replaced); err != nil {
+				return false, fmt.Errorf("remove replaced handover: %w", err)
+			}
+		}
+	}
+	state.setHandover(ih)
+
+	// Move domain mappings to new router.
+	for _, mapping := range mappings {
+		if err := state.storage.SaveMapping(mapping.Domain, ih.New); err != nil {
+			return true, fmt.Errorf("move domain mapping %s: %w", mapping.Domain, err)
+		}
+	}
+
+	if state.mgr != nil {
+		state.mgr.Info(
+			"router identity handed over",
+			"old", ih.Old.IP,
+			"new", ih.New,
+			"mappings", len(mappings),
+		)
+	}
+	return true, nil
+}
+
+// Successor returns the current address of the given router, following its
+// identity handovers. Returns the given address if it was not handed over.
+func (state *State) Successor(ip netip.Addr) netip.Addr {
+	state.handoversLock.RLock()
+	defer state.handoversLock.RUnlock()
+
+	for range handoverMaxChain {
+		ih := state.handovers[ip]
+		if ih == nil {
+			break
+		}
+		ip = ih.New
+	}
+	return ip
+}
+
+// Predecessors returns the previous addresses of the given router, which were
+// handed over to it.
+func (state *State) Predecessors(ip netip.Addr) []netip.Addr {
+	state.handoversLock.RLock()
+	defer state.handoversLock.RUnlock()
+
+	var predecessors []netip.Addr
+	current := []netip.Addr{ip}
+	for range handoverMaxChain {
+		var previous []netip.Addr
+		for _, ip := range current {
+			previous = append(previous, state.predecessors[ip]...)
+		}
+		if len(previous) == 0 {
+			break
+		}
+		predecessors = append(predecessors, previous...)
+		current = previous
+	}
+	return predecessors
+}
+
+// IsFriend returns whether the given router is a configured friend or was
+// handed over from one.
+func (state *State) IsFriend(ip netip.Addr) bool {
+	friends := state.instance.Config().FriendsByIP
+	if _, ok := friends[ip]; ok {
+		return true
+	}
+	for _, previous := range state.Predecessors(ip) {
+		if _, ok := friends[previous]; ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,231 @@
+package state
+
+import (
+	"context"
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/m"
+)
+
+func TestHandover(t *testing.T) {
+	t.Parallel()
+
+	old := newTestRouterAddress(t)
+	newAddr := &m.PublicAddress{IP: m.RoamingPrefix.Addr().Next()}
+	if newAddr.IP == old.IP {
+		newAddr.IP = newAddr.IP.Next()
+	}
+
+	// Create state with old router as friend and with a domain mapping.
+	state := New(&instanceStub{
+		IdentityStub: old,
+		ConfigStub: &config.Config{
+			FriendsByIP: map[netip.Addr]config.Friend{
+				old.IP: {Name: "old", IP: old.IP},
+			},
+		},
+	}, nil)
+	if err := state.AddRouter(newAddr); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.storage.SaveMapping("test.myco", old.IP); err != nil {
+		t.Fatal(err)
+	}
+	if state.IsFriend(newAddr.IP) {
+		t.Fatal("new router should not be a friend before handover")
+	}
+
+	// Add handover.
+	ih, err := m.NewIdentityHandover(old, newAddr.IP, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	added, err := state.AddHandover(ih)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !added {
+		t.Fatal("handover should be added")
+	}
+	added, err = state.AddHandover(ih)
+	if err != nil || added {
+		t.Fatalf("known handover should not be added again: %v", err)
+	}
+
+	// Check mappings.
+	if state.Successor(old.IP) != newAddr.IP {
+		t.Fatal("successor of old router should be new router")
+	}
+	if predecessors := state.Predecessors(newAddr.IP); len(predecessors) != 1 || predecessors[0] != old.IP {
+		t.Fatalf("unexpected predecessors of new router: %v", predecessors)
+	}
+	if !state.IsFriend(newAddr.IP) {
+		t.Fatal("new router should be a friend after handover")
+	}
+	mapped, err := state.storage.GetMapping("test.myco")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mapped != newAddr.IP {
+		t.Fatal("domain mapping should be moved to new router")
+	}
+
+	// Handovers are loaded from storage.
+	if err := state.loadHandovers(); err != nil {
+		t.Fatal(err)
+	}
+	if state.Successor(old.IP) != newAddr.IP {
+		t.Fatal("handover should be loaded from storage")
+	}
+
+	// Friends are still recognized after the handover expired, also after
+	// loading it from storage.
+	stored, err := state.storage.GetRouter(newAddr.IP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored.Handover.Expires = time.Now().Add(-time.Hour)
+	if err := state.storage.SaveRouter(stored); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.loadHandovers(); err != nil {
+		t.Fatal(err)
+	}
+	if !state.handovers[old.IP].Expired() {
+		t.Fatal("loaded handover should be expired")
+	}
+	if state.Successor(old.IP) != newAddr.IP {
+		t.Fatal("successor of old router should be new router after expiry")
+	}
+	if !state.IsFriend(newAddr.IP) {
+		t.Fatal("new router should still be a friend after expiry")
+	}
+
+	// Expired handovers are not accepted.
+	expired, err := m.NewIdentityHandover(old, newAddr.IP.Next(), time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := state.AddHandover(expired); err == nil {
+		t.Fatal("expired handover should be rejected")
+	}
+
+	// Invalid handovers are rejected.
+	ih.New = ih.New.Next()
+	if _, err := state.AddHandover(ih); err == nil {
+		t.Fatal("invalid handover should be rejected")
+	}
+
+	// Handovers of unknown routers are ignored.
+	unknown := newTestRouterAddress(t)
+	unknownHandover, err := m.NewIdentityHandover(unknown, newAddr.IP.Next(), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	added, err = state.AddHandover(unknownHandover)
+	if err != nil || added {
+		t.Fatalf("handover of unknown router should be ignored: %v", err)
+	}
+	if state.Successor(unknown.IP) != unknown.IP {
+		t.Fatal("handover of unknown router should not be stored")
+	}
+
+	// Handovers of routers with domain mappings are accepted.
+	if err := state.AddRouter(&m.PublicAddress{IP: unknownHandover.New}); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.storage.SaveMapping("unknown.myco", unknown.IP); err != nil {
+		t.Fatal(err)
+	}
+	added, err = state.AddHandover(unknownHandover)
+	if err != nil || !added {
+		t.Fatalf("handover of router with domain mapping should be added: %v", err)
+	}
+	if state.Successor(unknown.IP) != unknownHandover.New {
+		t.Fatal("successor of router with domain mapping should be new router")
+	}
+}
+
+func TestHandoverChain(t *testing.T) {
+	t.Parallel()
+
+	// Generate three consecutive addresses of a friend.
+	var addrs []*m.Address
+	for range 3 {
+		addrs = append(addrs, newTestRouterAddress(t))
+	}
+	state := New(&instanceStub{
+		IdentityStub: addrs[0],
+		ConfigStub: &config.Config{
+			FriendsByIP: map[netip.Addr]config.Friend{
+				addrs[0].IP: {Name: "friend", IP: addrs[0].IP},
+			},
+		},
+	}, nil)
+	handover := func(old, newAddr *m.Address) {
+		t.Helper()
+
+		if err := state.AddRouter(&newAddr.PublicAddress); err != nil {
+			t.Fatal(err)
+		}
+		ih, err := m.NewIdentityHandover(old, newAddr.IP, time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		added, err := state.AddHandover(ih)
+		if err != nil || !added {
+			t.Fatalf("handover should be added: %v", err)
+		}
+	}
+
+	// Handovers within the handover chain of a friend are accepted.
+	handover(addrs[0], addrs[1])
+	handover(addrs[1], addrs[2])
+	if state.Successor(addrs[0].IP) != addrs[2].IP {
+		t.Fatal("successor of first address should be last address")
+	}
+	if !slices.Equal(state.Predecessors(addrs[2].IP), []netip.Addr{addrs[1].IP, addrs[0].IP}) {
+		t.Fatalf("unexpected predecessors of last address: %v", state.Predecessors(addrs[2].IP))
+	}
+	if !state.IsFriend(addrs[2].IP) {
+		t.Fatal("last address should be a friend")
+	}
+
+	// Handing over an address again moves it in the index.
+	other := newTestRouterAddress(t)
+	handover(addrs[1], other)
+	if predecessors := state.Predecessors(addrs[2].IP); len(predecessors) != 0 {
+		t.Fatalf("last address should have no predecessors anymore, got %v", predecessors)
+	}
+	if !slices.Equal(state.Predecessors(other.IP), []netip.Addr{addrs[1].IP, addrs[0].IP}) {
+		t.Fatalf("unexpected predecessors of other address: %v", state.Predecessors(other.IP))
+	}
+
+	// The index is rebuilt when loading from storage.
+	if err := state.loadHandovers(); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(state.Predecessors(other.IP), []netip.Addr{addrs[1].IP, addrs[0].IP}) {
+		t.Fatalf("unexpected predecessors after loading: %v", state.Predecessors(other.IP))
+	}
+}
+
+// newTestRouterAddress returns a new router address.
+// Any routing address is used, as they are quick to generate.
+func newTestRouterAddress(t *testing.T) *m.Address {
+	t.Helper()
+
+	for {
+		addr, _, err := m.GenerateRoutableAddress(context.Background(), []netip.Prefix{m.RoutingAddressPrefix})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.GetAddressType(addr.IP) != m.TypeAnycast {
+			return addr
+		}
+	}
+}
@@ -1,8 +1,10 @@
 package state
 
 import (
+	"bytes"
 	"errors"
 	"net/netip"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -36,6 +38,11 @@ type Session struct {
 	encryption *EncryptionSession
 	mtu        atomic.Int32
 
+	pathMTU       atomic.Int32
+	pathMTUProbed atomic.Int64
+
+	returnBlock []byte
+
 	lock  sync.Mutex
 	state *State
 }
@@ -90,8 +97,8 @@ func (s *Session) Encryption() *EncryptionSession {
 // SetTunMTU sets the reported tun device MTU of that router.
 func (s *Session) SetTunMTU(mtu int) {
 	// Raise to minimum 1280 mtu.
-	if mtu > 0 && mtu < 1280 {
-		mtu = 1280
+	if mtu > 0 && mtu < MinMTU {
+		mtu = MinMTU
 	}
 
 	s.mtu.Store(int32(mtu))
@@ -102,6 +109,73 @@ func (s *Session) TunMTU() int {
 	return int(s.mtu.Load())
 }
 
+// MinMTU is the minimum MTU of IPv6.
+const MinMTU = 1280
+
+// SetPathMTU sets the probed path MTU to that router.
+// The path MTU is the biggest packet that can be sent to the router without a
+// switch block.
+func (s *Session) SetPathMTU(mtu int) {
+	// Raise to minimum 1280 mtu.
+	if mtu > 0 && mtu < MinMTU {
+		mtu = MinMTU
+	}
+
+	s.pathMTU.Store(int32(mtu))
+	s.pathMTUProbed.Store(time.Now().UnixNano())
+}
+
+// PathMTU returns the probed path MTU to that router.
+// Returns zero if the path MTU was not probed yet.
+func (s *Session) PathMTU() int {
+	return int(s.pathMTU.Load())
+}
+
+// PathMTUProbed returns when the path MTU was last probed.
+func (s *Session) PathMTUProbed() time.Time {
+	probed := s.pathMTUProbed.Load()
+	if probed == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, probed)
+}
+
+// MTU returns the biggest packet that can be sent to that router without a
+// switch block, based on its tun MTU and the probed path MTU.
+// Returns zero if neither is known.
+func (s *Session) MTU() int {
+	tunMTU := s.TunMTU()
+	pathMTU := s.PathMTU()
+	switch {
+	case tunMTU == 0:
+		return pathMTU
+	case pathMTU == 0:
+		return tunMTU
+	default:
+		return min(tunMTU, pathMTU)
+	}
+}
+
+// SetReturnBlock sets the switch block learned from incoming traffic, which
+// leads back to that router.
+func (s *Session) SetReturnBlock(block []byte) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if !bytes.Equal(s.returnBlock, block) {
+		s.returnBlock = slices.Clone(block)
+	}
+}
+
+// ReturnBlock returns the switch block learned from incoming traffic, which
+// leads back to that router. The returned block must not be modified.
+func (s *Session) ReturnBlock() []byte {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.returnBlock
+}
+
 // inUse marks the session as in use.
 func (s *Session) inUse() {
 	s.lock.Lock()
@@ -4,12 +4,14 @@ import (
 	"bytes"
 	"crypto/cipher"
 	"crypto/ecdh"
+	"crypto/mlkem"
 	"crypto/rand"
 	"errors"
 	"fmt"
 	"math/bits"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/zeebo/blake3"
 	_ "golang.org/x/crypto/blake2b"
@@ -18,11 +20,22 @@ import (
 
 const (
 	defaultKXType = "ECDH-X25519/BLAKE3"
+	hybridKXType  = "ECDH-X25519+ML-KEM-768/BLAKE3"
 
 	rolloverLowerBound = 0x0000_00FF // 255
 	rolloverUpperBound = 0xFFFF_FF00 // 255 below max
 )
 
+// KXTypeSupported returns whether the given kx type is supported.
+func KXTypeSupported(kxType string) bool {
+	switch kxType {
+	case defaultKXType, hybridKXType:
+		return true
+	default:
+		return false
+	}
+}
+
 // EncryptionSession holds all necessary information for encrypting a duplex packet stream.
 type EncryptionSession struct {
 	lock sync.Mutex
@@ -30,13 +43,26 @@ type EncryptionSession struct {
 	// Key exchange and keys.
 	kxRouterPrivate *ecdh.PrivateKey
 	kxRemotePublic  *ecdh.PublicKey
+	kxKEMPrivate    *mlkem.DecapsulationKey768
+	kxKEMShared     []byte
 	inKey           []byte
 	outKey          []byte
+	chainKey        []byte
 
 	// Active ciphers.
 	inCipher  cipher.AEAD
 	outCipher cipher.AEAD
 
+	// Re-keying.
+	keysSet      time.Time
+	keyedFrames  uint64
+	rekeyPrivate *ecdh.PrivateKey
+	rekeyStarted time.Time
+	altIn        *sessionKey
+	altExpires   time.Time
+	nextOut      *sessionKey
+	nextChain    []byte
+
 	// Replay Attack Mitigation
 	prioSeqHandler *SequenceHandler
 	reglSeqHandler *SequenceHandler
@@ -75,6 +101,34 @@ func (s *EncryptionSession) InitKeyClientStart() (kxKey []byte, kxType string, e
 	return s.kxRouterPrivate.PublicKey().Bytes(), defaultKXType, nil
 }
 
+// InitKeyClientHybrid generates additional exchange keys on the client for a
+// hybrid key exchange, which combines ECDH with the post-quantum ML-KEM.
+// It must be called after InitKeyClientStart and its exchange key is offered
+// in addition to the one of InitKeyClientStart, so that the server can fall
+// back to the default key exchange.
+func (s *EncryptionSession) InitKeyClientHybrid() (kxKey []byte, kxType string, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// Check if the key exchange was started.
+	if s.kxRouterPrivate == nil {
+		return nil, "", errors.New("key exchange not started")
+	}
+
+	// Generate new decapsulation key.
+	kemPrivate, err := mlkem.GenerateKey768()
+	if err != nil {
+		return nil, "", fmt.Errorf("generate kem key: %w", err)
+	}
+
+	// Set and return public key and encapsulation key.
+	s.kxKEMPrivate = kemPrivate
+	kxKey = make([]byte, 0, 32+mlkem.EncapsulationKeySize768)
+	kxKey = append(kxKey, s.kxRouterPrivate.PublicKey().Bytes()...)
+	kxKey = append(kxKey, kemPrivate.EncapsulationKey().Bytes()...)
+	return kxKey, hybridKXType, nil
+}
+
 // InitKeyServer takes the exchange key of the client and generates exchange keys on the server.
 // It already uses that information to finalize the encryption keys.
 // Call InitCleanup() when done with key setup.
@@ -82,8 +136,16 @@ func (s *EncryptionSession) InitKeyServer(kxKey []byte, kxType string) (returnKx
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
-	// Check kx type.
-	if kxType != defaultKXType {
+	// Check kx type and split hybrid key.
+	var kemKey []byte
+	switch kxType {
+	case defaultKXType:
+	case hybridKXType:
+		if len(kxKey) != 32+mlkem.EncapsulationKeySize768 {
+			return nil, "", errors.New("invalid hybrid exchange key size")
+		}
+		kxKey, kemKey = kxKey[:32], kxKey[32:]
+	default:
 		return nil, "", fmt.Errorf("kx type %q not supported", kxType)
 	}
 
@@ -100,23 +162,51 @@ func (s *EncryptionSession) InitKeyServer(kxKey []byte, kxType string) (returnKx
 		return nil, "", fmt.Errorf("generate key: %w", err)
 	}
 	s.kxRouterPrivate = private
+	returnKxKey = s.kxRouterPrivate.PublicKey().Bytes()
+
+	// Encapsulate a shared key to the client, if hybrid.
+	if kemKey != nil {
+		kemPublic, err := mlkem.NewEncapsulationKey768(kemKey)
+		if err != nil {
+			return nil, "", fmt.Errorf("parse remote kem key: %w", err)
+		}
+		kemShared, ciphertext := kemPublic.Encapsulate()
+		s.kxKEMShared = kemShared
+		returnKxKey = append(returnKxKey, ciphertext...)
+	}
 
 	// Make keys and ciphers from new shared secret.
 	if err := s.initFinalize(false, kxSetupContext); err != nil {
 		return nil, "", fmt.Errorf("finalize keys: %w", err)
 	}
 
-	return s.kxRouterPrivate.PublicKey().Bytes(), kxType, nil
+	return returnKxKey, kxType, nil
 }
 
 // InitKeyClientComplete takes the exchange key of the server to finalize the encryption keys.
+// The server may have chosen any of the offered kx types.
 // Call InitCleanup() when done with key setup.
 func (s *EncryptionSession) InitKeyClientComplete(kxKey []byte, kxType string) error {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
-	// Check kx type.
-	if kxType != defaultKXType {
+	// Check kx type and decapsulate shared key, if hybrid.
+	switch kxType {
+	case defaultKXType:
+	case hybridKXType:
+		if s.kxKEMPrivate == nil {
+			return errors.New("hybrid key exchange not offered")
+		}
+		if len(kxKey) != 32+mlkem.CiphertextSize768 {
+			return errors.New("invalid hybrid exchange key size")
+		}
+		kemShared, err := s.kxKEMPrivate.Decapsulate(kxKey[32:])
+		if err != nil {
+			return fmt.Errorf("decapsulate kem key: %w", err)
+		}
+		s.kxKEMShared = kemShared
+		kxKey = kxKey[:32]
+	default:
 		return fmt.Errorf("kx type %q not supported", kxType)
 	}
 
@@ -139,6 +229,10 @@ const (
 	kxSetupContext    = " - initial setup"
 	kxExtraContext    = " - extra keys - "
 	kxRolloverContext = " - key rollover "
+	kxResumeContext   = " - resumption - "
+	kxRekeyContext    = " - key rekeying "
+	kxHybridContext   = " - hybrid kx -  "
+	kxChainContext    = " - chaining key "
 )
 
 func (s *EncryptionSession) initFinalize(reverse bool, keyContext string) error {
@@ -152,6 +246,63 @@ func (s *EncryptionSession) initFinalize(reverse bool, keyContext string) error
 		return fmt.Errorf("compute shared key: %w", err)
 	}
 
+	// Combine with the shared key of the key encapsulation, if hybrid.
+	// The combined key stays secure as long as one of the two is unbroken.
+	if s.kxKEMShared != nil {
+		sharedKey = combineKeys(kxHybridContext, sharedKey, s.kxKEMShared)
+	}
+
+	return s.setKeys(sharedKey, reverse, keyContext)
+}
+
+// combineKeys combines the given keys into a new key with the given context.
+func combineKeys(keyContext string, keys ...[]byte) []byte {
+	var keyMaterial []byte
+	for _, key := range keys {
+		keyMaterial = append(keyMaterial, key...)
+	}
+	combined := make([]byte, 32)
+	blake3.DeriveKey(kxBaseContext+keyContext, keyMaterial, combined)
+	return combined
+}
+
+// setKeys derives the keys from the given shared key and sets them.
+func (s *EncryptionSession) setKeys(sharedKey []byte, reverse bool, keyContext string) error {
+	in, out, err := deriveKeys(sharedKey, reverse, keyContext)
+	if err != nil {
+		return err
+	}
+
+	// Assign to session.
+	s.inKey = in.key
+	s.inCipher = in.cipher
+	s.outKey = out.key
+	s.outCipher = out.cipher
+	s.chainKey = combineKeys(kxChainContext, sharedKey)
+	s.keysSet = time.Now()
+	s.keyedFrames = 0
+
+	// Reset re-keying.
+	s.rekeyPrivate = nil
+	s.altIn = nil
+	s.nextOut = nil
+	s.nextChain = nil
+
+	// Reset sequence handlers.
+	s.prioSeqHandler.Reset()
+	s.reglSeqHandler.Reset()
+
+	return nil
+}
+
+// sessionKey is a key with its cipher.
+type sessionKey struct {
+	key    []byte
+	cipher cipher.AEAD
+}
+
+// deriveKeys derives the incoming and outgoing keys from the given shared key.
+func deriveKeys(sharedKey []byte, reverse bool, keyContext string) (in, out *sessionKey, err error) {
 	// Derive keys.
 	keys := make([]byte, chacha20poly1305.KeySize*2)
 	blake3.DeriveKey(kxBaseContext+keyContext, sharedKey, keys)
@@ -161,43 +312,31 @@ func (s *EncryptionSession) initFinalize(reverse bool, keyContext string) error
 	if len(key1) != chacha20poly1305.KeySize ||
 		len(key2) != chacha20poly1305.KeySize ||
 		bytes.Equal(key1, key2) {
-		return errors.New("derived keys are faulty")
+		return nil, nil, errors.New("derived keys are faulty")
 	}
 
 	// Create ciphers.
 	c1, err := chacha20poly1305.New(key1)
 	if err != nil {
-		return fmt.Errorf("create first cipher: %w", err)
+		return nil, nil, fmt.Errorf("create first cipher: %w", err)
 	}
 	c2, err := chacha20poly1305.New(key2)
 	if err != nil {
-		return fmt.Errorf("create second cipher: %w", err)
+		return nil, nil, fmt.Errorf("create second cipher: %w", err)
 	}
 
-	// Assign to session.
 	if reverse {
-		s.inKey = key1
-		s.inCipher = c1
-		s.outKey = key2
-		s.outCipher = c2
-	} else {
-		s.inKey = key2
-		s.inCipher = c2
-		s.outKey = key1
-		s.outCipher = c1
+		return &sessionKey{key: key1, cipher: c1}, &sessionKey{key: key2, cipher: c2}, nil
 	}
-
-	// Reset sequence handlers.
-	s.prioSeqHandler.Reset()
-	s.reglSeqHandler.Reset()
-
-	return nil
+	return &sessionKey{key: key2, cipher: c2}, &sessionKey{key: key1, cipher: c1}, nil
 }
 
 // InitCleanup cleans up the exchange keys after the initial setup.
 func (s *EncryptionSession) InitCleanup() {
 	s.kxRemotePublic = nil
 	s.kxRouterPrivate = nil
+	s.kxKEMPrivate = nil
+	s.kxKEMShared = nil
 }
 
 // DeriveSessionFromKX derives a new encryption session with the current key
@@ -219,6 +358,7 @@ func (s *EncryptionSession) DeriveSessionFromKX(reverse bool, purpose string) (*
 	newS := NewEncryptionSession()
 	newS.kxRemotePublic = s.kxRemotePublic
 	newS.kxRouterPrivate = s.kxRouterPrivate
+	newS.kxKEMShared = s.kxKEMShared
 	// Finalize with different context.
 	if err := newS.initFinalize(reverse, kxExtraContext+purpose); err != nil {
 		return nil, fmt.Errorf("finalize keys: %w", err)
@@ -295,6 +435,7 @@ func (s *EncryptionSession) Out(prio bool) (
 		}
 	}
 
+	s.keyedFrames++
 	ack, recvRate = sh.Ack()
 	return seqNum, ack, recvRate, s.outCipher, nil
 }
@@ -0,0 +1,256 @@
+package state
+
+import (
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Re-keying.
+// Sessions are re-keyed with a fresh key exchange within the existing session
+// after some time or volume. The initiator sends its exchange key and the
+// responder answers with its own. The responder prepares the new keys, but
+// continues to use the current keys. The initiator switches to the new keys
+// when it receives the response, and the responder switches when it first
+// receives a frame encrypted with the new keys. Until then, the responder
+// keeps the prepared keys and the initiator keeps the previous incoming key,
+// so that a lost frame cannot leave the two sides with different keys. Once a
+// frame encrypted with the new keys was received, the previous incoming key is
+// accepted for a grace period, so that frames in flight are not lost.
+// The new shared key is combined with a chaining key derived from the previous
+// shared key, so that sessions set up with a hybrid key exchange keep its
+// post-quantum protection.
+
+const (
+	// RekeyInterval defines after which time a session is re-keyed.
+	RekeyInterval = time.Hour
+	// RekeyFrames defines after how many outgoing frames a session is re-keyed.
+	RekeyFrames = 1 << 22
+	// RekeyTimeout defines how long a re-keying may take before it is abandoned.
+	RekeyTimeout = 30 * time.Second
+	// rekeyGracePeriod defines how long the previous incoming key is accepted
+	// after the first frame encrypted with the new keys was received.
+	rekeyGracePeriod = RekeyTimeout
+)
+
+// RekeyRequired returns whether the session should be re-keyed.
+func (s *EncryptionSession) RekeyRequired() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	switch {
+	case s.inCipher == nil || s.outCipher == nil:
+		// Not set up.
+		return false
+	case s.rekeyActive():
+		// Already re-keying.
+		return false
+	default:
+		return time.Since(s.keysSet) > RekeyInterval ||
+			s.keyedFrames > RekeyFrames
+	}
+}
+
+// RekeyActive returns whether this side has started a re-keying, which has
+// not yet completed or timed out.
+func (s *EncryptionSession) RekeyActive() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.rekeyActive()
+}
+
+func (s *EncryptionSession) rekeyActive() bool {
+	return s.rekeyPrivate != nil && time.Since(s.rekeyStarted) < RekeyTimeout
+}
+
+// RekeyStart generates exchange keys for re-keying on the initiator.
+func (s *EncryptionSession) RekeyStart() (kxKey []byte, kxType string, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// Check if encryption is set up.
+	if s.inCipher == nil || s.outCipher == nil {
+		return nil, "", ErrEncryptionNotSetUp
+	}
+
+	// Generate new private key.
+	private, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, "", fmt.Errorf("generate key: %w", err)
+	}
+
+	// Set and return public key.
+	s.rekeyPrivate = private
+	s.rekeyStarted = time.Now()
+	return private.PublicKey().Bytes(), defaultKXType, nil
+}
+
+// RekeyServer takes the exchange key of the initiator and generates exchange
+// keys on the responder. The new keys are prepared, but only used after the
+// first frame encrypted with them is received. They are kept until then or
+// until they are replaced by another re-keying.
+func (s *EncryptionSession) RekeyServer(kxKey []byte, kxType string) (returnKxKey []byte, returnKxType string, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// Check if encryption is set up.
+	if s.inCipher == nil || s.outCipher == nil {
+		return nil, "", ErrEncryptionNotSetUp
+	}
+	// Check kx type.
+	if kxType != defaultKXType {
+		return nil, "", fmt.Errorf("kx type %q not supported", kxType)
+	}
+
+	// Parse given public key.
+	public, err := ecdh.X25519().NewPublicKey(kxKey)
+	if err != nil {
+		return nil, "", fmt.Errorf("parse remote public key: %w", err)
+	}
+
+	// Generate new private key and compute shared key.
+	private, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, "", fmt.Errorf("generate key: %w", err)
+	}
+	sharedKey, err := private.ECDH(public)
+	if err != nil {
+		return nil, "", fmt.Errorf("compute shared key: %w", err)
+	}
+	sharedKey = combineKeys(kxRekeyContext, sharedKey, s.chainKey)
+
+	// Prepare new keys.
+	in, out, err := deriveKeys(sharedKey, false, kxRekeyContext)
+	if err != nil {
+		return nil, "", fmt.Errorf("derive keys: %w", err)
+	}
+	s.altIn = in
+	s.nextOut = out
+	s.nextChain = combineKeys(kxChainContext, sharedKey)
+	s.altExpires = time.Time{}
+
+	// Abandon own re-keying, if any.
+	s.rekeyPrivate = nil
+
+	return private.PublicKey().Bytes(), kxType, nil
+}
+
+// RekeyClientComplete takes the exchange key of the responder and switches to
+// the new keys. The previous incoming key is kept until the first frame
+// encrypted with the new keys is received.
+func (s *EncryptionSession) RekeyClientComplete(kxKey []byte, kxType string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// Check if we are re-keying.
+	if !s.rekeyActive() {
+		return errors.New("no active re-keying")
+	}
+	// Check kx type.
+	if kxType != defaultKXType {
+		return fmt.Errorf("kx type %q not supported", kxType)
+	}
+
+	// Parse given public key and compute shared key.
+	public, err := ecdh.X25519().NewPublicKey(kxKey)
+	if err != nil {
+		return fmt.Errorf("parse remote public key: %w", err)
+	}
+	sharedKey, err := s.rekeyPrivate.ECDH(public)
+	if err != nil {
+		return fmt.Errorf("compute shared key: %w", err)
+	}
+	s.rekeyPrivate = nil
+	sharedKey = combineKeys(kxRekeyContext, sharedKey, s.chainKey)
+
+	// Derive and switch to new keys.
+	in, out, err := deriveKeys(sharedKey, true, kxRekeyContext)
+	if err != nil {
+		return fmt.Errorf("derive keys: %w", err)
+	}
+	s.nextOut = nil
+	s.nextChain = nil
+	s.switchKeys(in, out, combineKeys(kxChainContext, sharedKey), false)
+	return nil
+}
+
+// switchKeys switches to the given keys and keeps the current incoming key as
+// the alternate key. If the new keys are already confirmed by a received
+// frame, the grace period of the previous key starts immediately.
+// Sequence handlers are not reset, so that replay protection spans the
+// switch.
+func (s *EncryptionSession) switchKeys(in, out *sessionKey, chainKey []byte, confirmed bool) {
+	s.altIn = &sessionKey{
+		key:    s.inKey,
+		cipher: s.inCipher,
+	}
+	s.altExpires = time.Time{}
+	if confirmed {
+		s.altExpires = time.Now().Add(rekeyGracePeriod)
+	}
+
+	s.inKey = in.key
+	s.inCipher = in.cipher
+	s.outKey = out.key
+	s.outCipher = out.cipher
+	s.chainKey = chainKey
+	s.keysSet = time.Now()
+	s.keyedFrames = 0
+}
+
+// InAlternate returns the alternate cipher to decrypt an incoming frame, if
+// the frame cannot be decrypted with the cipher returned by In.
+// The alternate cipher is the previous one after re-keying, or the next one
+// while the other side is switching. Returns nil if there is none.
+// Alternate ciphers without expiry are kept until they are confirmed.
+func (s *EncryptionSession) InAlternate() cipher.AEAD {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	switch {
+	case s.altIn == nil:
+		return nil
+	case !s.altExpires.IsZero() && time.Now().After(s.altExpires):
+		s.altIn = nil
+		s.nextOut = nil
+		s.nextChain = nil
+		return nil
+	default:
+		return s.altIn.cipher
+	}
+}
+
+// ConfirmAlternate must be called when an incoming frame was decrypted with
+// the alternate cipher. If it is the next cipher, the session switches to the
+// new keys.
+func (s *EncryptionSession) ConfirmAlternate(c cipher.AEAD) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.nextOut == nil || s.altIn == nil || s.altIn.cipher != c {
+		return
+	}
+
+	in := s.altIn
+	out := s.nextOut
+	chainKey := s.nextChain
+	s.nextOut = nil
+	s.nextChain = nil
+	s.switchKeys(in, out, chainKey, true)
+}
+
+// ConfirmCurrent must be called when an incoming frame was decrypted with the
+// cipher returned by In while an alternate cipher exists. If the previous key
+// is still kept after re-keying, its grace period starts.
+func (s *EncryptionSession) ConfirmCurrent() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.nextOut == nil && s.altIn != nil && s.altExpires.IsZero() {
+		s.altExpires = time.Now().Add(rekeyGracePeriod)
+	}
+}
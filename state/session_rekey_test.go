@@ -0,0 +1,200 @@
+package state
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestRekey(t *testing.T) {
+	t.Parallel()
+
+	e1 := NewEncryptionSession()
+	e2 := NewEncryptionSession()
+
+	// Setup encryption.
+	kxKey1, kxType1, err := e1.InitKeyClientStart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kxKey2, kxType2, err := e2.InitKeyServer(kxKey1, kxType1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e1.InitKeyClientComplete(kxKey2, kxType2); err != nil {
+		t.Fatal(err)
+	}
+	e1.InitCleanup()
+	e2.InitCleanup()
+	oldIn1, oldIn2 := e1.inCipher, e2.inCipher
+
+	// Re-keying is required after some time.
+	if e1.RekeyRequired() {
+		t.Fatal("new session should not require re-keying")
+	}
+	e1.keysSet = time.Now().Add(-RekeyInterval - time.Second)
+	if !e1.RekeyRequired() {
+		t.Fatal("old session should require re-keying")
+	}
+
+	// Start re-keying.
+	kxKey1, kxType1, err = e1.RekeyStart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e1.RekeyRequired() || !e1.RekeyActive() {
+		t.Fatal("re-keying should be active")
+	}
+	kxKey2, kxType2, err = e2.RekeyServer(kxKey1, kxType1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Server still uses the current keys, but accepts the next.
+	if e2.inCipher != oldIn2 {
+		t.Fatal("server should not switch keys before confirmation")
+	}
+	next2 := e2.InAlternate()
+	if next2 == nil {
+		t.Fatal("server should accept the next key")
+	}
+
+	// Client switches to the new keys and accepts the previous.
+	if err := e1.RekeyClientComplete(kxKey2, kxType2); err != nil {
+		t.Fatal(err)
+	}
+	if e1.RekeyActive() || e1.RekeyRequired() {
+		t.Fatal("re-keying should be done")
+	}
+	if e1.InAlternate() != oldIn1 {
+		t.Fatal("client should accept the previous key")
+	}
+	if !bytes.Equal(e1.outKey, e2.altIn.key) {
+		t.Fatal("client out key should match server next in key")
+	}
+
+	// Server switches on first frame with new keys.
+	e2.ConfirmAlternate(next2)
+	if e2.inCipher != next2 || e2.InAlternate() != oldIn2 {
+		t.Fatal("server should switch to the new keys and accept the previous")
+	}
+	if !bytes.Equal(e1.outKey, e2.inKey) || !bytes.Equal(e1.inKey, e2.outKey) {
+		t.Fatal("keys do not match after re-keying")
+	}
+	if !bytes.Equal(e1.chainKey, e2.chainKey) {
+		t.Fatal("chaining keys do not match after re-keying")
+	}
+
+	// Previous key expires.
+	e1.altExpires = time.Now().Add(-time.Second)
+	if e1.InAlternate() != nil {
+		t.Fatal("previous key should expire")
+	}
+}
+
+func TestRekeyLostConfirm(t *testing.T) {
+	t.Parallel()
+
+	e1 := NewEncryptionSession()
+	e2 := NewEncryptionSession()
+
+	// Setup encryption.
+	kxKey1, kxType1, err := e1.InitKeyClientStart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kxKey2, kxType2, err := e2.InitKeyServer(kxKey1, kxType1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e1.InitKeyClientComplete(kxKey2, kxType2); err != nil {
+		t.Fatal(err)
+	}
+	e1.InitCleanup()
+	e2.InitCleanup()
+
+	// Re-key, but drop the confirmation of the client.
+	kxKey1, kxType1, err = e1.RekeyStart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kxKey2, kxType2, err = e2.RekeyServer(kxKey1, kxType1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e1.RekeyClientComplete(kxKey2, kxType2); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both sides keep the other keys until a frame with the new keys arrives.
+	if !e1.altExpires.IsZero() || !e2.altExpires.IsZero() {
+		t.Fatal("alternate keys should not expire before new keys are used")
+	}
+
+	// Server still sends with the previous keys.
+	if err := transferTestFrame(e2, e1); err != nil {
+		t.Fatalf("server to client with previous keys: %s", err)
+	}
+	if !e1.altExpires.IsZero() {
+		t.Fatal("client should keep the previous key")
+	}
+
+	// Server switches on the first frame of the client.
+	if err := transferTestFrame(e1, e2); err != nil {
+		t.Fatalf("client to server with new keys: %s", err)
+	}
+	if !bytes.Equal(e1.outKey, e2.inKey) || !bytes.Equal(e1.inKey, e2.outKey) {
+		t.Fatal("keys do not match after re-keying")
+	}
+
+	// Client starts grace period of previous key on first frame of the server.
+	if err := transferTestFrame(e2, e1); err != nil {
+		t.Fatalf("server to client with new keys: %s", err)
+	}
+	if e1.altExpires.IsZero() || e2.altExpires.IsZero() {
+		t.Fatal("previous keys should expire after grace period")
+	}
+
+	// Traffic flows both ways after the previous keys expired.
+	e1.altExpires = time.Now().Add(-time.Second)
+	e2.altExpires = time.Now().Add(-time.Second)
+	if err := transferTestFrame(e1, e2); err != nil {
+		t.Fatalf("client to server: %s", err)
+	}
+	if err := transferTestFrame(e2, e1); err != nil {
+		t.Fatalf("server to client: %s", err)
+	}
+}
+
+// transferTestFrame encrypts a message on the sender and decrypts it on the
+// receiver, in the same way frames are sealed and unsealed.
+func transferTestFrame(from, to *EncryptionSession) error {
+	msg := []byte("The quick brown fox jumps over the lazy dog.")
+
+	// Encrypt.
+	seqNum, _, _, out, err := from.Out(false)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, out.NonceSize())
+	encrypted := out.Seal(nil, nonce, msg, nil)
+
+	// Decrypt.
+	in, err := to.In(seqNum, false)
+	if err != nil {
+		return err
+	}
+	alt := to.InAlternate()
+	if _, err := in.Open(nil, nonce, encrypted, nil); err != nil {
+		if alt == nil {
+			return err
+		}
+		if _, err := alt.Open(nil, nonce, encrypted, nil); err != nil {
+			return err
+		}
+		to.ConfirmAlternate(alt)
+	} else if alt != nil {
+		to.ConfirmCurrent()
+	}
+	return to.Check(seqNum, false)
+}
@@ -0,0 +1,79 @@
+package state
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/zeebo/blake3"
+)
+
+// ResumptionSecretSize is the size of a resumption secret.
+const ResumptionSecretSize = 32
+
+// DeriveResumptionSecret derives a secret from the current keys, which both
+// sides of the session derive equally. It can be used to resume the session
+// with NewResumedEncryptionSession after the connection was lost.
+// Must be called before any key rollover.
+func (s *EncryptionSession) DeriveResumptionSecret() ([]byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if len(s.inKey) == 0 || len(s.outKey) == 0 {
+		return nil, ErrEncryptionNotSetUp
+	}
+
+	// Order keys, so that both sides derive the same secret.
+	keys := make([]byte, 0, len(s.inKey)+len(s.outKey))
+	if bytes.Compare(s.inKey, s.outKey) < 0 {
+		keys = append(keys, s.inKey...)
+		keys = append(keys, s.outKey...)
+	} else {
+		keys = append(keys, s.outKey...)
+		keys = append(keys, s.inKey...)
+	}
+
+	secret := make([]byte, ResumptionSecretSize)
+	blake3.DeriveKey(kxBaseContext+kxResumeContext+"secret", keys, secret)
+	return secret, nil
+}
+
+// NewResumedEncryptionSession returns a new encryption session derived from a
+// resumption secret and the nonces of both sides.
+func NewResumedEncryptionSession(secret, clientNonce, serverNonce []byte, reverse bool) (*EncryptionSession, error) {
+	if len(secret) != ResumptionSecretSize {
+		return nil, errors.New("invalid resumption secret")
+	}
+	if len(clientNonce) == 0 || len(serverNonce) == 0 {
+		return nil, errors.New("missing nonce")
+	}
+
+	// Mix secret and nonces.
+	sharedKey := make([]byte, 0, len(secret)+len(clientNonce)+len(serverNonce))
+	sharedKey = append(sharedKey, secret...)
+	sharedKey = append(sharedKey, clientNonce...)
+	sharedKey = append(sharedKey, serverNonce...)
+
+	s := NewEncryptionSession()
+	if err := s.setKeys(sharedKey, reverse, kxResumeContext+"session"); err != nil {
+		return nil, fmt.Errorf("set keys: %w", err)
+	}
+	return s, nil
+}
+
+// MakeResumptionAuth returns an authentication code for the given data,
+// proving knowledge of the resumption secret.
+func MakeResumptionAuth(secret []byte, purpose string, data ...[]byte) []byte {
+	authKey := make([]byte, 32)
+	blake3.DeriveKey(kxBaseContext+kxResumeContext+purpose, secret, authKey)
+
+	h, err := blake3.NewKeyed(authKey)
+	if err != nil {
+		// Only fails with invalid key size.
+		panic(err)
+	}
+	for _, d := range data {
+		_, _ = h.Write(d)
+	}
+	return h.Sum(nil)
+}
@@ -0,0 +1,72 @@
+package state
+
+import (
+	"bytes"
+	"testing"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+func TestResumption(t *testing.T) {
+	t.Parallel()
+
+	e1 := NewEncryptionSession()
+	e2 := NewEncryptionSession()
+
+	// Setup encryption.
+	kxKey1, kxType1, err := e1.InitKeyClientStart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kxKey2, kxType2, err := e2.InitKeyServer(kxKey1, kxType1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e1.InitKeyClientComplete(kxKey2, kxType2); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both sides must derive the same secret.
+	secret1, err := e1.DeriveResumptionSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret2, err := e2.DeriveResumptionSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(secret1, secret2) {
+		t.Fatal("resumption secrets do not match")
+	}
+
+	// Auth must depend on the purpose.
+	if bytes.Equal(
+		MakeResumptionAuth(secret1, "request", []byte{1}),
+		MakeResumptionAuth(secret1, "accept", []byte{1}),
+	) {
+		t.Fatal("resumption auth must differ between purposes")
+	}
+
+	// Create resumed sessions and test encryption.
+	clientNonce := []byte{1, 2, 3, 4}
+	serverNonce := []byte{5, 6, 7, 8}
+	r1, err := NewResumedEncryptionSession(secret1, clientNonce, serverNonce, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, err := NewResumedEncryptionSession(secret2, clientNonce, serverNonce, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(r1.outKey, e1.outKey) || bytes.Equal(r1.inKey, e1.inKey) {
+		t.Fatal("resumed session must use new keys")
+	}
+
+	testNonce := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+	msg := make([]byte, len(testData)+chacha20poly1305.Overhead)
+	copy(msg, testData)
+	msg = r1.outCipher.Seal(msg[:0], testNonce, msg[:len(testData)], nil)
+	if _, err := r2.inCipher.Open(msg[:0], testNonce, msg, nil); err != nil {
+		t.Fatal(err)
+	}
+}
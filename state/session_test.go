@@ -1,6 +1,7 @@
 package state
 
 import (
+	"bytes"
 	"context"
 	mathrand "math/rand"
 	"sync"
@@ -65,6 +66,82 @@ func TestKeyExchange(t *testing.T) {
 	}
 }
 
+func TestHybridKeyExchange(t *testing.T) {
+	t.Parallel()
+
+	// Test hybrid key exchange.
+	e1 := NewEncryptionSession()
+	e2 := NewEncryptionSession()
+
+	// Client
+	_, _, err := e1.InitKeyClientStart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hkxKey1, hkxType1, err := e1.InitKeyClientHybrid()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Server
+	kxKey2, kxType2, err := e2.InitKeyServer(hkxKey1, hkxType1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kxType2 != hybridKXType {
+		t.Fatalf("server chose kx type %q", kxType2)
+	}
+	// Client
+	err = e1.InitKeyClientComplete(kxKey2, kxType2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Check keys and derived sessions.
+	if !bytes.Equal(e1.outKey, e2.inKey) || !bytes.Equal(e1.inKey, e2.outKey) {
+		t.Fatal("hybrid keys do not match")
+	}
+	d1, err := e1.DeriveSessionFromKX(true, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d2, err := e2.DeriveSessionFromKX(false, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(d1.outKey, d2.inKey) || !bytes.Equal(d1.inKey, d2.outKey) {
+		t.Fatal("derived hybrid keys do not match")
+	}
+	e1.InitCleanup()
+	e2.InitCleanup()
+
+	// Test fallback of server to default key exchange.
+	e3 := NewEncryptionSession()
+	e4 := NewEncryptionSession()
+
+	// Client
+	kxKey3, kxType3, err := e3.InitKeyClientStart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = e3.InitKeyClientHybrid()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Server
+	kxKey4, kxType4, err := e4.InitKeyServer(kxKey3, kxType3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Client
+	err = e3.InitKeyClientComplete(kxKey4, kxType4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(e3.outKey, e4.inKey) || !bytes.Equal(e3.inKey, e4.outKey) {
+		t.Fatal("fallback keys do not match")
+	}
+}
+
 func TestSequence(t *testing.T) {
 	t.Parallel()
 
@@ -174,6 +251,92 @@ func TestTimeSequence(t *testing.T) {
 	}
 }
 
+func TestSessionMTU(t *testing.T) {
+	t.Parallel()
+
+	s := &Session{}
+	if s.MTU() != 0 || !s.PathMTUProbed().IsZero() {
+		t.Fatal("mtu should be unknown")
+	}
+
+	// Tun MTU only.
+	s.SetTunMTU(1400)
+	if s.MTU() != 1400 {
+		t.Fatalf("mtu should be tun mtu, got %d", s.MTU())
+	}
+
+	// Path MTU is smaller.
+	s.SetPathMTU(1300)
+	if s.MTU() != 1300 {
+		t.Fatalf("mtu should be path mtu, got %d", s.MTU())
+	}
+	if s.PathMTUProbed().IsZero() {
+		t.Fatal("path mtu should be probed")
+	}
+
+	// Path MTU is raised to minimum.
+	s.SetPathMTU(1000)
+	if s.PathMTU() != MinMTU {
+		t.Fatalf("path mtu should be raised to %d, got %d", MinMTU, s.PathMTU())
+	}
+
+	// Path MTU is bigger.
+	s.SetPathMTU(9000)
+	if s.MTU() != 1400 {
+		t.Fatalf("mtu should be tun mtu, got %d", s.MTU())
+	}
+
+	// Probing failed.
+	s.SetPathMTU(0)
+	if s.MTU() != 1400 || s.PathMTUProbed().IsZero() {
+		t.Fatal("failed probe should keep mtu unknown but record probe")
+	}
+}
+
+func TestWithIdentity(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	router, _, err := m.GeneratePrivacyAddress(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privacy, _, err := m.GeneratePrivacyAddress(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote, _, err := m.GeneratePrivacyAddress(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Routers added to the router state are known to the privacy state.
+	state := New(&instanceStub{
+		IdentityStub: router,
+		ConfigStub:   &config.Config{},
+	}, nil)
+	privacyState := state.WithIdentity(privacy)
+	if err := state.AddRouter(&remote.PublicAddress); err != nil {
+		t.Fatal(err)
+	}
+
+	// Sessions are separate and sign with their own identity.
+	s1 := state.GetSession(remote.IP)
+	s2 := privacyState.GetSession(remote.IP)
+	if s1 == nil || s2 == nil {
+		t.Fatal("failed to get sessions")
+	}
+	if s1 == s2 {
+		t.Fatal("sessions must be separate")
+	}
+	if !s1.Signing().RouterPrivKey().Equal(router.PrivateKey) {
+		t.Fatal("router session must sign with router key")
+	}
+	if !s2.Signing().RouterPrivKey().Equal(privacy.PrivateKey) {
+		t.Fatal("privacy session must sign with privacy key")
+	}
+}
+
 var (
 	generateTestSessions sync.Once
 	generatedS1          *Session
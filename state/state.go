@@ -23,6 +23,10 @@ type State struct {
 	sessions     map[netip.Addr]*Session
 	sessionsLock sync.Mutex
 
+	handovers     map[netip.Addr]*m.IdentityHandover
+	predecessors  map[netip.Addr][]netip.Addr
+	handoversLock sync.RWMutex
+
 	instance instance
 }
 
@@ -52,14 +56,53 @@ func New(instance instance, store storage.Storage) *State {
 		storage:        store,
 		maxStorageSize: maxStorageSize,
 
-		sessions: make(map[netip.Addr]*Session),
-		instance: instance,
+		sessions:     make(map[netip.Addr]*Session),
+		handovers:    make(map[netip.Addr]*m.IdentityHandover),
+		predecessors: make(map[netip.Addr][]netip.Addr),
+		instance:     instance,
+	}
+}
+
+// WithIdentity returns a state manager that uses the given identity for its
+// sessions, but shares the router storage with this state manager.
+// It is used for privacy addresses, which need their own sessions.
+// The returned state manager is not started, use CleanSessions to remove
+// unused sessions.
+func (state *State) WithIdentity(identity *m.Address) *State {
+	return &State{
+		mgr:            state.mgr,
+		storage:        state.storage,
+		maxStorageSize: state.maxStorageSize,
+
+		sessions:     make(map[netip.Addr]*Session),
+		handovers:    make(map[netip.Addr]*m.IdentityHandover),
+		predecessors: make(map[netip.Addr][]netip.Addr),
+		instance: &identityInstance{
+			instance: state.instance,
+			identity: identity,
+		},
 	}
 }
 
+// identityInstance overrides the identity of an instance.
+type identityInstance struct {
+	instance
+	identity *m.Address
+}
+
+func (ii *identityInstance) Identity() *m.Address {
+	return ii.identity
+}
+
 // Start starts brings the device online and starts workers.
 func (state *State) Start(mgr *mgr.Manager) error {
 	state.mgr = mgr
+	if err := state.loadHandovers(); err != nil {
+		mgr.Warn(
+			"failed to load identity handovers",
+			"err", err,
+		)
+	}
 	mgr.Go("session cleaner", state.sessionCleanerWorker)
 	return nil
 }
@@ -197,6 +240,17 @@ func (state *State) MarkRouterOffline(id netip.Addr) error {
 	return nil
 }
 
+// LoadRoutes returns the routes saved to the storage.
+func (state *State) LoadRoutes() ([]storage.StoredRoute, error) {
+	return state.storage.GetRoutes()
+}
+
+// SaveRoutes saves the given routes to the storage, replacing any previously
+// saved routes.
+func (state *State) SaveRoutes(routes []storage.StoredRoute) error {
+	return state.storage.SaveRoutes(routes)
+}
+
 // SetEncryptionSession sets the encryption session.
 func (state *State) SetEncryptionSession(ip netip.Addr, encSession *EncryptionSession) error {
 	session := state.GetSession(ip)
@@ -255,7 +309,7 @@ func (state *State) sessionCleanerWorker(w *mgr.WorkerCtx) error {
 			return nil
 		case <-ticker.C:
 			// Clean session every tick.
-			state.cleanSessions()
+			state.CleanSessions()
 
 			// Clean storage every 10 ticks.
 			// TODO: Clean storage in separate worker.
@@ -266,7 +320,8 @@ func (state *State) sessionCleanerWorker(w *mgr.WorkerCtx) error {
 	}
 }
 
-func (state *State) cleanSessions() {
+// CleanSessions removes sessions that are no longer in use.
+func (state *State) CleanSessions() {
 	state.sessionsLock.Lock()
 	defer state.sessionsLock.Unlock()
 
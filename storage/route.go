@@ -0,0 +1,18 @@
+package storage
+
+import (
+	"net/netip"
+	"time"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+// StoredRoute is the format used to store routing table entries.
+type StoredRoute struct {
+	DstIP   netip.Addr    `json:"dstIP,omitempty"   yaml:"dstIP,omitempty"`
+	NextHop netip.Addr    `json:"nextHop,omitempty" yaml:"nextHop,omitempty"`
+	Path    m.SwitchPath  `json:"path,omitempty"    yaml:"path,omitempty"`
+	Stub    bool          `json:"stub,omitempty"    yaml:"stub,omitempty"`
+	Source  m.RouteSource `json:"source,omitempty"  yaml:"source,omitempty"`
+	Expires time.Time     `json:"expires,omitempty" yaml:"expires,omitempty"`
+}
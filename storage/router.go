@@ -18,6 +18,9 @@ type StoredRouter struct {
 	// Offline signifies that the router has announced it is going offline.
 	Offline bool `json:"offline,omitempty" yaml:"offline,omitempty"`
 
+	// Handover is the handover from the previous address of the router.
+	Handover *m.IdentityHandover `json:"handover,omitempty" yaml:"handover,omitempty"`
+
 	CreatedAt time.Time  `json:"createdAt,omitempty" yaml:"createdAt,omitempty"`
 	UpdatedAt time.Time  `json:"updatedAt,omitempty" yaml:"updatedAt,omitempty"`
 	UsedAt    *time.Time `json:"usedAt,omitempty"    yaml:"usedAt,omitempty"`
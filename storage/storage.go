@@ -16,6 +16,7 @@ var (
 type Storage interface {
 	DatabaseModule
 	RouterStorage
+	RouteStorage
 	DomainMappingStorage
 }
 
@@ -35,6 +36,12 @@ type RouterStorage interface {
 	DeleteRouter(router netip.Addr) error
 }
 
+// RouteStorage is an interface to a routing table storage.
+type RouteStorage interface {
+	GetRoutes() ([]StoredRoute, error)
+	SaveRoutes(routes []StoredRoute) error
+}
+
 // DomainMappingStorage is an interface to a domain mapping storage.
 type DomainMappingStorage interface {
 	GetMapping(domain string) (router netip.Addr, err error)
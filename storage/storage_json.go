@@ -21,6 +21,7 @@ type JSONFileStorage struct {
 // JSONStorageFormat is the format in which the JSONFileStorage stores the state.
 type JSONStorageFormat struct {
 	Routers  map[netip.Addr]*StoredRouter `json:"routers,omitempty"  yaml:"routers,omitempty"`
+	Routes   []StoredRoute                `json:"routes,omitempty"   yaml:"routes,omitempty"`
 	Mappings map[string]StoredMapping     `json:"mappings,omitempty" yaml:"mappings,omitempty"`
 }
 
@@ -38,6 +39,7 @@ func NewJSONFileStorage(filename string) (*JSONFileStorage, error) {
 			return nil, fmt.Errorf("unmarshal json: %w", err)
 		}
 		s.routers = stored.Routers
+		s.routes = stored.Routes
 		s.mappings = stored.Mappings
 
 	case errors.Is(err, os.ErrNotExist):
@@ -62,6 +64,7 @@ func NewJSONFileStorage(filename string) (*JSONFileStorage, error) {
 func (s *JSONFileStorage) Stop(mgr *mgr.Manager) error {
 	data, err := json.Marshal(&JSONStorageFormat{
 		Routers:  s.routers,
+		Routes:   s.routes,
 		Mappings: s.mappings,
 	})
 	if err != nil {
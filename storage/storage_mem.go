@@ -15,6 +15,9 @@ type MemStorage struct {
 	routers     map[netip.Addr]*StoredRouter
 	routersLock sync.RWMutex
 
+	routes     []StoredRoute
+	routesLock sync.RWMutex
+
 	mappings     map[string]StoredMapping
 	mappingsLock sync.RWMutex
 }
@@ -135,6 +138,23 @@ func (s *MemStorage) Prune(keep int) {
 	// TODO: Add more pruning steps.
 }
 
+// GetRoutes returns the stored routes.
+func (s *MemStorage) GetRoutes() ([]StoredRoute, error) {
+	s.routesLock.RLock()
+	defer s.routesLock.RUnlock()
+
+	return slices.Clone(s.routes), nil
+}
+
+// SaveRoutes replaces the stored routes.
+func (s *MemStorage) SaveRoutes(routes []StoredRoute) error {
+	s.routesLock.Lock()
+	defer s.routesLock.Unlock()
+
+	s.routes = slices.Clone(routes)
+	return nil
+}
+
 // GetMapping returns a domain mapping from the storage.
 func (s *MemStorage) GetMapping(domain string) (router netip.Addr, err error) {
 	s.mappingsLock.RLock()
@@ -14,6 +14,9 @@ import (
 	"github.com/mycoria/mycoria/state"
 )
 
+// ErrNextHopUnavailable is returned when there is no link to the next hop.
+var ErrNextHopUnavailable = errors.New("next hop unavailable")
+
 // Switch handles packets based on switch labels.
 type Switch struct {
 	input       chan frame.Frame
@@ -82,8 +85,9 @@ func (s *Switch) handleFrame(f frame.Frame) error {
 	}
 
 	// Get switch block.
+	// Frames without (or with a cleared) switch block are routed by IP.
 	switchBlock := f.SwitchBlock()
-	if len(switchBlock) == 0 {
+	if m.IsEmptySwitchBlock(switchBlock) {
 		return s.escalateFrame(f)
 	}
 
@@ -105,7 +109,12 @@ func (s *Switch) handleFrame(f frame.Frame) error {
 	}
 
 	// Forward frame to next hop.
-	return s.ForwardByLabel(f, nextHopLabel)
+	err = s.ForwardByLabel(f, nextHopLabel)
+	if errors.Is(err, ErrNextHopUnavailable) {
+		// Let the router fall back to routing by IP.
+		return s.escalateFrame(f)
+	}
+	return err
 }
 
 func (s *Switch) escalateFrame(f frame.Frame) error {
@@ -121,7 +130,7 @@ func (s *Switch) ForwardByLabel(f frame.Frame, nextHopLabel m.SwitchLabel) error
 	// Get link by switch label.
 	link := s.instance.Peering().GetLinkByLabel(nextHopLabel)
 	if link == nil {
-		return errors.New("next hop unavailable")
+		return ErrNextHopUnavailable
 	}
 
 	return s.forwardToLink(f, link)
@@ -132,7 +141,7 @@ func (s *Switch) ForwardByPeer(f frame.Frame, peerIP netip.Addr) error {
 	// Get link by switch label.
 	link := s.instance.Peering().GetLink(peerIP)
 	if link == nil {
-		return errors.New("next hop unavailable")
+		return ErrNextHopUnavailable
 	}
 
 	return s.forwardToLink(f, link)
@@ -0,0 +1,177 @@
+package switchr
+
+import (
+	"context"
+	"net/netip"
+	"slices"
+	"testing"
+
+	"github.com/mycoria/mycoria/api/httpapi"
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/peering"
+	"github.com/mycoria/mycoria/state"
+	"github.com/mycoria/mycoria/tun"
+)
+
+func TestSwitchFrame(t *testing.T) {
+	t.Parallel()
+
+	// Links: src (1) <-> (11) switch (12) <-> (21) dst
+	var (
+		src = netip.MustParseAddr("fd00::1")
+		dst = netip.MustParseAddr("fd00::3")
+	)
+	s, routerInput := newTestSwitch(t)
+	srcLink := &testLink{peer: src, label: 11}
+	dstLink := &testLink{peer: dst, label: 12}
+	for _, link := range []*testLink{srcLink, dstLink} {
+		if err := s.instance.Peering().AddLink(link); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := m.SwitchPath{Hops: []m.SwitchHop{
+		{Router: src, ForwardLabel: 1},
+		{ForwardLabel: 12, ReturnLabel: 11},
+		{Router: dst, ReturnLabel: 21},
+	}}
+	if err := path.BuildBlocks(); err != nil {
+		t.Fatal(err)
+	}
+
+	// receive returns a frame with the given switch block, as it arrives from
+	// the source.
+	receive := func(block []byte) frame.Frame {
+		t.Helper()
+
+		block = slices.Clone(block)
+		if len(block) > 0 {
+			if _, err := m.NextRotateSwitchBlock(block, 0); err != nil {
+				t.Fatal(err)
+			}
+		}
+		f, err := s.instance.(*testInstance).builder.NewFrameV1(src, dst, frame.NetworkTraffic, block, []byte("test"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.SetRecvLink(srcLink)
+		return f
+	}
+	checkEscalated := func(name string, f frame.Frame) {
+		t.Helper()
+
+		select {
+		case escalated := <-routerInput:
+			if escalated != f {
+				t.Errorf("%s: unexpected frame was escalated", name)
+			}
+		default:
+			t.Errorf("%s: frame should be escalated to router", name)
+		}
+	}
+
+	// Frames are forwarded along the switch block.
+	f := receive(path.ForwardBlock)
+	if err := s.handleFrame(f); err != nil {
+		t.Fatal(err)
+	}
+	if len(dstLink.sent) != 1 || dstLink.sent[0] != f {
+		t.Fatal("frame should be forwarded to destination")
+	}
+	if next, err := m.NextRotateSwitchBlock(f.SwitchBlock(), 21); err != nil || next != 0 {
+		t.Errorf("switch block should lead to destination, got label %d (err: %v)", next, err)
+	}
+
+	// Frames are escalated to the router, if the next hop is unavailable, so
+	// that they are routed by IP.
+	f = receive([]byte{1, 13, 0, 0})
+	if err := s.handleFrame(f); err != nil {
+		t.Fatal(err)
+	}
+	checkEscalated("unavailable next hop", f)
+
+	// Frames to the switch itself and without switch block are escalated.
+	f = receive([]byte{1, 0, 0})
+	if err := s.handleFrame(f); err != nil {
+		t.Fatal(err)
+	}
+	checkEscalated("destination", f)
+	f = receive(nil)
+	if err := s.handleFrame(f); err != nil {
+		t.Fatal(err)
+	}
+	checkEscalated("no switch block", f)
+
+	// Frames with switch block need a recv link.
+	f = receive(path.ForwardBlock)
+	f.SetRecvLink(nil)
+	if err := s.handleFrame(f); err == nil {
+		t.Error("frame without recv link should fail")
+	}
+	if len(dstLink.sent) != 1 {
+		t.Error("no further frames should be forwarded")
+	}
+}
+
+// newTestSwitch returns a switch and its channel to the router.
+func newTestSwitch(t *testing.T) (*Switch, chan frame.Frame) {
+	t.Helper()
+
+	id, _, err := m.GeneratePrivacyAddress(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst := &testInstance{
+		config:   &config.Config{},
+		identity: id,
+		builder:  frame.NewFrameBuilder(),
+		table:    m.NewRoutingTable(m.RoutingTableConfig{}),
+	}
+	inst.state = state.New(inst, nil)
+	inst.peering = peering.New(inst, nil)
+
+	routerInput := make(chan frame.Frame, 1)
+	return New(inst, routerInput), routerInput
+}
+
+// testInstance is an instance for testing the switch.
+type testInstance struct {
+	config   *config.Config
+	identity *m.Address
+	builder  *frame.Builder
+	state    *state.State
+	table    *m.RoutingTable
+	peering  *peering.Peering
+}
+
+var _ instance = &testInstance{}
+
+func (i *testInstance) Version() string               { return "v0.0.0" }
+func (i *testInstance) Config() *config.Config        { return i.config }
+func (i *testInstance) Identity() *m.Address          { return i.identity }
+func (i *testInstance) FrameBuilder() *frame.Builder  { return i.builder }
+func (i *testInstance) State() *state.State           { return i.state }
+func (i *testInstance) TunDevice() *tun.Device        { return nil }
+func (i *testInstance) RoutingTable() *m.RoutingTable { return i.table }
+func (i *testInstance) API() *httpapi.API             { return nil }
+func (i *testInstance) Peering() *peering.Peering     { return i.peering }
+
+// testLink is a link that records sent frames.
+type testLink struct {
+	peering.Link
+
+	peer  netip.Addr
+	label m.SwitchLabel
+	sent  []frame.Frame
+}
+
+func (l *testLink) Peer() netip.Addr                            { return l.peer }
+func (l *testLink) SwitchLabel() m.SwitchLabel                  { return l.label }
+func (l *testLink) FlowControlIndicator() frame.FlowControlFlag { return 0 }
+func (l *testLink) SendPriority(f frame.Frame) error            { return l.Send(f) }
+
+func (l *testLink) Send(f frame.Frame) error {
+	l.sent = append(l.sent, f)
+	return nil
+}
@@ -2,6 +2,7 @@ package tun
 
 import (
 	"fmt"
+	"net"
 	"net/netip"
 
 	"github.com/vishvananda/netlink"
@@ -120,3 +121,25 @@ func (d *Device) RemoveRoute(prefix netip.Prefix) error {
 		Family:    netlink.FAMILY_V6,
 	})
 }
+
+// SetPreferredSourceRoute routes the prefix via the interface with a high priority and
+// sets the preferred source address of new connections to it.
+func (d *Device) SetPreferredSourceRoute(prefix netip.Prefix, src netip.Addr) error {
+	return netlink.RouteReplace(&netlink.Route{
+		LinkIndex: d.linkIndex,
+		Dst:       netipx.PrefixIPNet(prefix),
+		Src:       net.IP(src.AsSlice()),
+		Priority:  1,
+		Family:    netlink.FAMILY_V6,
+	})
+}
+
+// RemovePreferredSourceRoute removes a route set with SetPreferredSourceRoute.
+func (d *Device) RemovePreferredSourceRoute(prefix netip.Prefix) error {
+	return netlink.RouteDel(&netlink.Route{
+		LinkIndex: d.linkIndex,
+		Dst:       netipx.PrefixIPNet(prefix),
+		Priority:  1,
+		Family:    netlink.FAMILY_V6,
+	})
+}
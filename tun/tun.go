@@ -88,6 +88,16 @@ func Create(instance instance) (*Device, error) {
 		return nil, fmt.Errorf("failed to add primary address %v: %w", primaryAddress, err)
 	}
 
+	// Add addresses of served anycast groups.
+	for _, am := range instance.Config().AnycastMemberships {
+		anycastAddress := netip.PrefixFrom(am.Group.IP, 128)
+		if err := d.AddAddress(anycastAddress); err != nil {
+			_ = t.Close()
+			return nil, fmt.Errorf("failed to add anycast address %v: %w", anycastAddress, err)
+		}
+		d.secondaryIPs = append(d.secondaryIPs, anycastAddress)
+	}
+
 	return d, nil
 }
 
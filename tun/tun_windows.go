@@ -1,6 +1,7 @@
 package tun
 
 import (
+	"errors"
 	"fmt"
 	"net/netip"
 
@@ -109,3 +110,16 @@ func (d *Device) RemoveRoute(prefix netip.Prefix) error {
 
 	return luid.DeleteRoute(prefix, config.DefaultAPIAddress)
 }
+
+// SetPreferredSourceRoute routes the prefix via the interface with a high priority and
+// sets the preferred source address of new connections to it.
+// Not supported on Windows.
+func (d *Device) SetPreferredSourceRoute(prefix netip.Prefix, src netip.Addr) error {
+	return errors.New("preferred source routes are not supported on windows")
+}
+
+// RemovePreferredSourceRoute removes a route set with SetPreferredSourceRoute.
+// Not supported on Windows.
+func (d *Device) RemovePreferredSourceRoute(prefix netip.Prefix) error {
+	return errors.New("preferred source routes are not supported on windows")
+}